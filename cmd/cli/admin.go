@@ -0,0 +1,258 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"text/tabwriter"
+
+	"github.com/NikosGour/chatter/internal"
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/chatter/internal/models"
+)
+
+// Length of the passwords reset-password makes up
+const randomPasswordLength = 16
+
+func user(args []string) {
+	sub, args := subcommand("user", args)
+	fs := flag.NewFlagSet("user "+sub, flag.ExitOnError)
+
+	switch sub {
+	case "create":
+		username := fs.String("username", "", "`name` to log in with")
+		password := fs.String("password", "", "`password` to log in with")
+		is_test := fs.Bool("test", false, "flag the user as test data, deleted by purge-test-data")
+		loadConfig(fs, args)
+
+		withAPI(func(api *internal.APIServer) error {
+			u, err := api.CreateUser(*username, *password, *is_test)
+			if err != nil {
+				return fmt.Errorf("on CreateUser(%s): %w", *username, err)
+			}
+			fmt.Printf("created user `%s` with id %s\n", u.Username, u.Id)
+			return nil
+		})
+
+	case "disable", "enable":
+		ref := fs.String("user", "", "`user` id or username")
+		target := adminTargetFlags(fs)
+		loadConfig(fs, args)
+
+		withAPI(func(api *internal.APIServer) error {
+			u, err := api.FindUser(*ref)
+			if err != nil {
+				return err
+			}
+			if base := target.base(); base != "" {
+				err = adminRequest(base, common.Config.HTTP.AdminToken, http.MethodPost, internal.AdminUsersPath+"/"+u.Id.String()+"/"+sub, nil, nil)
+			} else {
+				_, err = api.SetUserDisabled(u.Id, sub == "disable")
+			}
+			if err != nil {
+				return fmt.Errorf("on SetUserDisabled(%s): %w", u.Id, err)
+			}
+			fmt.Printf("%sd user `%s`\n", sub, u.Username)
+			return nil
+		})
+
+	case "reset-password":
+		ref := fs.String("user", "", "`user` id or username")
+		password := fs.String("password", "", "the new `password`, a random one when unset")
+		target := adminTargetFlags(fs)
+		loadConfig(fs, args)
+
+		new_password := *password
+		if new_password == "" {
+			new_password = rand.Text()[:randomPasswordLength]
+		}
+		withAPI(func(api *internal.APIServer) error {
+			u, err := api.FindUser(*ref)
+			if err != nil {
+				return err
+			}
+			if base := target.base(); base != "" {
+				err = adminRequest(base, common.Config.HTTP.AdminToken, http.MethodPost, internal.AdminUsersPath+"/"+u.Id.String()+"/password", models.PasswordReset{Password: new_password}, nil)
+			} else {
+				err = api.ResetPassword(u.Id, new_password)
+			}
+			if err != nil {
+				return fmt.Errorf("on ResetPassword(%s): %w", u.Id, err)
+			}
+			if *password == "" {
+				fmt.Printf("new password of `%s`: %s\n", u.Username, new_password)
+				return nil
+			}
+			fmt.Printf("reset the password of `%s`\n", u.Username)
+			return nil
+		})
+
+	default:
+		unknownSubcommand("user", sub)
+	}
+}
+
+func server(args []string) {
+	sub, args := subcommand("server", args)
+	fs := flag.NewFlagSet("server "+sub, flag.ExitOnError)
+
+	switch sub {
+	case "list":
+		loadConfig(fs, args)
+
+		withAPI(func(api *internal.APIServer) error {
+			servers, err := api.Servers()
+			if err != nil {
+				return fmt.Errorf("on Servers: %w", err)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tNAME\tMEMBERS\tCREATED\tTEST")
+			for _, s := range servers {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%t\n", s.Id, s.Name, len(s.Users), s.DateCreated.Format("2006-01-02 15:04"), s.IsTest)
+			}
+			return w.Flush()
+		})
+
+	case "members":
+		ref := fs.String("server", "", "`server` id or name")
+		loadConfig(fs, args)
+
+		withAPI(func(api *internal.APIServer) error {
+			s, err := api.FindServer(*ref)
+			if err != nil {
+				return err
+			}
+			members, err := api.Members(s.Id)
+			if err != nil {
+				return fmt.Errorf("on Members(%s): %w", s.Id, err)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tUSERNAME\tROLE\tNICKNAME\tDISABLED")
+			for _, m := range members {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\n", m.User.Id, m.User.Username, m.Role, m.User.Nickname, m.User.Disabled)
+			}
+			return w.Flush()
+		})
+
+	case "add-member", "remove-member":
+		server_ref := fs.String("server", "", "`server` id or name")
+		user_ref := fs.String("user", "", "`user` id or username")
+		target := adminTargetFlags(fs)
+		loadConfig(fs, args)
+
+		withAPI(func(api *internal.APIServer) error {
+			s, err := api.FindServer(*server_ref)
+			if err != nil {
+				return err
+			}
+			u, err := api.FindUser(*user_ref)
+			if err != nil {
+				return err
+			}
+
+			base := target.base()
+			member_path := internal.AdminServersPath + "/" + s.Id.String() + "/members/" + u.Id.String()
+			if sub == "add-member" {
+				if base != "" {
+					err = adminRequest(base, common.Config.HTTP.AdminToken, http.MethodPut, member_path, nil, nil)
+				} else {
+					err = api.AddMember(s.Id, u.Id)
+				}
+				if err != nil {
+					return fmt.Errorf("on AddMember(%s, %s): %w", s.Id, u.Id, err)
+				}
+				fmt.Printf("added `%s` to `%s`\n", u.Username, s.Name)
+				return nil
+			}
+
+			if base != "" {
+				err = adminRequest(base, common.Config.HTTP.AdminToken, http.MethodDelete, member_path, nil, nil)
+			} else {
+				err = api.RemoveMember(s.Id, u.Id)
+			}
+			if err != nil {
+				return fmt.Errorf("on RemoveMember(%s, %s): %w", s.Id, u.Id, err)
+			}
+			fmt.Printf("removed `%s` from `%s`\n", u.Username, s.Name)
+			return nil
+		})
+
+	case "export":
+		ref := fs.String("server", "", "`server` id or name")
+		out := fs.String("out", "", "`path` of the JSON file, <server id>.json when unset")
+		loadConfig(fs, args)
+
+		withAPI(func(api *internal.APIServer) error {
+			s, err := api.FindServer(*ref)
+			if err != nil {
+				return err
+			}
+			export, err := api.ExportServer(s.Id)
+			if err != nil {
+				return fmt.Errorf("on ExportServer(%s): %w", s.Id, err)
+			}
+
+			data, err := json.MarshalIndent(export, "", "  ")
+			if err != nil {
+				return fmt.Errorf("on MarshalIndent: %w", err)
+			}
+			path := *out
+			if path == "" {
+				path = s.Id.String() + ".json"
+			}
+			err = os.WriteFile(path, data, 0o600)
+			if err != nil {
+				return fmt.Errorf("on WriteFile: %w", err)
+			}
+			fmt.Printf("exported `%s`, %d members, %d tabs and %d messages, to `%s`\n", s.Name, len(export.Members), len(export.Tabs), len(export.Messages), path)
+			return nil
+		})
+
+	default:
+		unknownSubcommand("server", sub)
+	}
+}
+
+// Where the commands that change what connected clients see are run
+type adminTarget struct {
+	url    *string
+	direct *bool
+}
+
+func adminTargetFlags(fs *flag.FlagSet) adminTarget {
+	return adminTarget{
+		url:    fs.String("url", "", "base `url` of the server, from http.host and http.port when unset"),
+		direct: fs.Bool("direct", false, "change the storage directly even when http.admin_token is set, connected clients aren't told"),
+	}
+}
+
+// The base url of the running server to go through its admin API,
+// empty when the storage is changed directly: with -direct or without http.admin_token
+func (a adminTarget) base() string {
+	if *a.direct || common.Config.HTTP.AdminToken == "" {
+		return ""
+	}
+	if *a.url != "" {
+		return *a.url
+	}
+	return serverURL(common.Config.HTTP)
+}
+
+// Splits the subcommand off args, exiting when there is none
+func subcommand(cmd string, args []string) (string, []string) {
+	if len(args) == 0 || args[0] == "" || args[0][0] == '-' {
+		fmt.Fprintf(os.Stderr, "missing `%s` subcommand\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+	return args[0], args[1:]
+}
+
+func unknownSubcommand(cmd string, sub string) {
+	fmt.Fprintf(os.Stderr, "unknown command `%s %s`\n\n%s", cmd, sub, usage)
+	os.Exit(2)
+}
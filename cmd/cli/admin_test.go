@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/fasthttp/websocket"
+)
+
+// Runs the admin commands against the storage, with no server running
+func TestAdminCommands(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the binary")
+	}
+	bin := buildBinary(t)
+	dir := t.TempDir()
+	port := freePort(t)
+	flags := seededFlags(t, bin, dir, port)
+
+	out := runCommand(t, bin, dir, flags, "user", "create", "-username", "eleni", "-password", "4567")
+	expectOutput(t, out, "created user `eleni`")
+	out = runCommand(t, bin, dir, flags, "server", "add-member", "-server", "HUA", "-user", "eleni")
+	expectOutput(t, out, "added `eleni` to `HUA`")
+	out = runCommand(t, bin, dir, flags, "user", "disable", "-user", "eleni")
+	expectOutput(t, out, "disabled user `eleni`")
+
+	out = runCommand(t, bin, dir, flags, "server", "members", "-server", "HUA")
+	eleni := memberRow(t, out, "eleni")
+	if eleni[len(eleni)-1] != "true" {
+		t.Fatalf("expected eleni to be listed as disabled, got %q", eleni)
+	}
+
+	out = runCommand(t, bin, dir, flags, "user", "reset-password", "-user", "eleni")
+	_, password, ok := strings.Cut(strings.TrimSpace(out), "new password of `eleni`: ")
+	if !ok || len(password) != randomPasswordLength {
+		t.Fatalf("expected a random password of %d characters, got %q", randomPasswordLength, out)
+	}
+
+	path := filepath.Join(dir, "hua.json")
+	out = runCommand(t, bin, dir, flags, "server", "export", "-server", "HUA", "-out", path)
+	expectOutput(t, out, "exported `HUA`, 4 members")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	export := models.ServerExport{}
+	err = json.Unmarshal(data, &export)
+	if err != nil || export.Server.Name != "HUA" || len(export.Members) != 4 {
+		t.Fatalf("unexpected export: %s\n%s", err, data)
+	}
+
+	out = runCommand(t, bin, dir, flags, "server", "remove-member", "-server", "HUA", "-user", "eleni")
+	expectOutput(t, out, "removed `eleni` from `HUA`")
+	out = runCommand(t, bin, dir, flags, "server", "list")
+	expectOutput(t, out, "Gamiades")
+	if strings.Contains(runCommand(t, bin, dir, flags, "server", "members", "-server", "HUA"), "eleni") {
+		t.Fatal("expected eleni to be removed from HUA")
+	}
+
+	// The running server sees what the commands stored
+	serve := startServe(t, bin, dir, flags)
+	base := fmt.Sprintf("http://127.0.0.1:%d", port)
+	waitReady(t, base+"/readyz", serve.exited)
+
+	c, err := newChatClient(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.login("eleni", password)
+	expectAPIError(t, err, models.ErrUserDisabled)
+
+	out = runCommand(t, bin, dir, flags, "user", "enable", "-user", "eleni")
+	expectOutput(t, out, "enabled user `eleni`")
+	err = c.login("eleni", password)
+	if err != nil {
+		t.Fatalf("expected eleni to log in with the new password once enabled: %s", err)
+	}
+	serve.stop(t, os.Interrupt)
+}
+
+// Runs the admin commands through the admin API of the running server, which tells its clients
+func TestAdminCommandsThroughAPI(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the binary")
+	}
+	bin := buildBinary(t)
+	dir := t.TempDir()
+	port := freePort(t)
+	flags := append(seededFlags(t, bin, dir, port), "-http.admin_token=secret")
+	base := fmt.Sprintf("http://127.0.0.1:%d", port)
+
+	serve := startServe(t, bin, dir, flags)
+	waitReady(t, base+"/readyz", serve.exited)
+
+	nikos, _ := loginToGeneral(t, base)
+	nikos_conn, err := nikos.dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nikos_conn.Close()
+
+	maria, err := newChatClient(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = maria.login("maria", "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	maria_conn, err := maria.dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer maria_conn.Close()
+
+	// Members of Gamiades are told of the new member
+	out := runCommand(t, bin, dir, flags, "server", "add-member", "-server", "Gamiades", "-user", "mitsos")
+	expectOutput(t, out, "added `mitsos` to `Gamiades`")
+	member := models.Member{}
+	err = json.Unmarshal(readEventOf(t, nikos_conn, models.EventMemberJoin), &member)
+	if err != nil || member.User.Username != "mitsos" {
+		t.Fatalf("expected mitsos to join, got %#v: %v", member, err)
+	}
+
+	// A disabled user is disconnected and can't log in again
+	out = runCommand(t, bin, dir, flags, "user", "disable", "-user", "maria")
+	expectOutput(t, out, "disabled user `maria`")
+	maria_conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for {
+		_, _, err := maria_conn.ReadMessage()
+		close_err := &websocket.CloseError{}
+		if errors.As(err, &close_err) {
+			if close_err.Code != websocket.ClosePolicyViolation {
+				t.Fatalf("expected maria's websocket to close with %d, got %d", websocket.ClosePolicyViolation, close_err.Code)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatalf("expected a close frame, got %s\n%s", err, serve.logs)
+		}
+	}
+	err = maria.login("maria", "123")
+	expectAPIError(t, err, models.ErrUserDisabled)
+
+	out = runCommand(t, bin, dir, flags, "user", "enable", "-user", "maria")
+	expectOutput(t, out, "enabled user `maria`")
+	out = runCommand(t, bin, dir, flags, "user", "reset-password", "-user", "maria", "-password", "4567")
+	expectOutput(t, out, "reset the password of `maria`")
+	err = maria.login("maria", "4567")
+	if err != nil {
+		t.Fatalf("expected maria to log in with the new password: %s", err)
+	}
+
+	// Without the server the admin API can't be reached, unless the storage is changed directly
+	serve.stop(t, os.Interrupt)
+	cmd := exec.Command(bin, append([]string{"server", "remove-member", "-server", "Gamiades", "-user", "mitsos"}, flags...)...)
+	cmd.Dir = dir
+	out_bytes, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("expected remove-member to fail with the server stopped, got:\n%s", out_bytes)
+	}
+	out = runCommand(t, bin, dir, flags, "server", "remove-member", "-server", "Gamiades", "-user", "mitsos", "-direct")
+	expectOutput(t, out, "removed `mitsos` from `Gamiades`")
+}
+
+// Runs a command of the binary from dir with the flags, failing the test if it fails
+func runCommand(t *testing.T, bin string, dir string, flags []string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command(bin, append(args, flags...)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("on %s: %s\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+func expectOutput(t *testing.T, out string, expected string) {
+	t.Helper()
+	if !strings.Contains(out, expected) {
+		t.Fatalf("expected the output to contain %q, got:\n%s", expected, out)
+	}
+}
+
+func expectAPIError(t *testing.T, err error, expected *common.APIError) {
+	t.Helper()
+	api_err := &chatAPIError{}
+	if !errors.As(err, &api_err) || api_err.Code != expected.Code {
+		t.Fatalf("expected %s, got %v", expected.Code, err)
+	}
+}
+
+// The columns of the user's row in the output of server members
+func memberRow(t *testing.T, out string, username string) []string {
+	t.Helper()
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 1 && fields[1] == username {
+			return fields
+		}
+	}
+	t.Fatalf("expected %s among the members, got:\n%s", username, out)
+	return nil
+}
+
+// Reads events off conn until one of the type arrives and returns its data
+func readEventOf(t *testing.T, conn *websocket.Conn, event_type string) json.RawMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	defer conn.SetReadDeadline(time.Time{})
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("expected a %s event, got %s", event_type, err)
+		}
+		event := chatEvent{}
+		err = json.Unmarshal(data, &event)
+		if err == nil && event.Type == event_type {
+			return event.Data
+		}
+	}
+}
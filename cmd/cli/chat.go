@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/logging/log"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/term"
+)
+
+// Chats in the terminal as a user of the running server
+func chat(args []string) {
+	fs := flag.NewFlagSet("chat", flag.ExitOnError)
+	url := fs.String("url", "", "base `url` of the server, from http.host and http.port when unset")
+	username := fs.String("username", "", "`name` to log in with, asked for when unset")
+	password := fs.String("password", "", "`password` to log in with, asked for when unset")
+	loadConfig(fs, args)
+
+	base := *url
+	if base == "" {
+		base = serverURL(common.Config.HTTP)
+	}
+
+	client, err := newChatClient(base)
+	if err != nil {
+		log.Fatal("%s", err)
+	}
+
+	err = promptCredentials(username, password)
+	if err != nil {
+		log.Fatal("%s", err)
+	}
+	err = client.login(*username, *password)
+	if err != nil {
+		log.Fatal("on logging in to %s as %s: %s", base, *username, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p := tea.NewProgram(newChatModel(client), tea.WithAltScreen(), tea.WithContext(ctx))
+	go client.listen(ctx, func(msg any) { p.Send(msg) })
+
+	_, err = p.Run()
+	if err != nil && ctx.Err() == nil {
+		log.Fatal("%s", err)
+	}
+}
+
+// Asks for what wasn't given as a flag, the password without echoing it
+func promptCredentials(username *string, password *string) error {
+	if *username == "" {
+		fmt.Print("username: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("on reading the username: %w", err)
+		}
+		*username = strings.TrimSpace(line)
+	}
+
+	if *password == "" {
+		fmt.Print("password: ")
+		data, err := term.ReadPassword(os.Stdin.Fd())
+		fmt.Println()
+		if err != nil {
+			return fmt.Errorf("on reading the password: %w", err)
+		}
+		*password = string(data)
+	}
+	return nil
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NikosGour/chatter/internal"
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/fasthttp/websocket"
+	"github.com/google/uuid"
+)
+
+const (
+	// Messages fetched per page of history
+	historyPage = 50
+
+	// Waits between redials of the websocket, doubling from the first up to the last
+	redialMin = time.Second
+	redialMax = 30 * time.Second
+)
+
+// Talks to a running server as one user, over its REST API and a websocket to /ws/messages
+type chatClient struct {
+	base string
+	http *http.Client
+	jar  http.CookieJar
+
+	// Kept to log in again when the session stops working, after a restart without http.cookie_key
+	username string
+	password string
+	me       models.User
+
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+// Error answered by the server, with the status it came with
+type chatAPIError struct {
+	Status int
+	common.ErrorResponse
+}
+
+func (e *chatAPIError) Error() string {
+	return fmt.Sprintf("%s (%d %s)", e.Message, e.Status, e.Code)
+}
+
+func newChatClient(base string) (*chatClient, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, fmt.Errorf("on cookiejar.New: %w", err)
+	}
+
+	c := &chatClient{base: strings.TrimSuffix(base, "/"), jar: jar}
+	c.http = &http.Client{Timeout: 10 * time.Second, Jar: jar}
+	return c, nil
+}
+
+// Sends a JSON request to path under APIBasePath and decodes the answer into out, when out isn't nil
+func (c *chatClient) do(method string, path string, body any, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("on Marshal: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.base+internal.APIBasePath+path, reader)
+	if err != nil {
+		return fmt.Errorf("on NewRequest: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("on %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("on reading the response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		api_err := &chatAPIError{Status: resp.StatusCode}
+		err := json.Unmarshal(data, &api_err.ErrorResponse)
+		if err != nil || api_err.Message == "" {
+			api_err.Message = strings.TrimSpace(string(data))
+		}
+		return api_err
+	}
+
+	if out == nil {
+		return nil
+	}
+	err = json.Unmarshal(data, out)
+	if err != nil {
+		return fmt.Errorf("on Unmarshal: %w", err)
+	}
+	return nil
+}
+
+func (c *chatClient) login(username string, password string) error {
+	me := models.User{}
+	err := c.do(http.MethodPost, "/user/login", models.Credentials{Username: username, Password: password}, &me)
+	if err != nil {
+		return err
+	}
+
+	c.username, c.password, c.me = username, password, me
+	return nil
+}
+
+// The servers the user is a member of
+func (c *chatClient) servers() ([]models.Server, error) {
+	all := []models.Server{}
+	err := c.do(http.MethodGet, "/server", nil, &all)
+	if err != nil {
+		return nil, err
+	}
+
+	servers := []models.Server{}
+	for _, server := range all {
+		members := []models.User{}
+		err := c.do(http.MethodGet, "/server/"+server.Id.String()+"/users", nil, &members)
+		var api_err *chatAPIError
+		if errors.As(err, &api_err) && api_err.Status == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, member := range members {
+			if member.Id == c.me.Id {
+				servers = append(servers, server)
+				break
+			}
+		}
+	}
+	return servers, nil
+}
+
+// The tabs of the server, with the user's read state
+func (c *chatClient) tabs(server_id uuid.UUID) ([]models.Tab, error) {
+	tabs := []models.Tab{}
+	err := c.do(http.MethodGet, "/server/"+server_id.String()+"/tabs", nil, &tabs)
+	if err != nil {
+		return nil, err
+	}
+	return tabs, nil
+}
+
+// A page of the tab's messages older than before, the newest page when before is 0
+func (c *chatClient) history(tab_id uuid.UUID, before int64) ([]models.Message, error) {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(historyPage))
+	if before > 0 {
+		query.Set("before", strconv.FormatInt(before, 10))
+	}
+
+	messages := []models.Message{}
+	err := c.do(http.MethodGet, "/message/tab/"+tab_id.String()+"?"+query.Encode(), nil, &messages)
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// Marks the tab as read up to the message
+func (c *chatClient) ack(tab_id uuid.UUID, message_id int64) (*models.ReadState, error) {
+	read_state := &models.ReadState{}
+	err := c.do(http.MethodPost, "/tab/"+tab_id.String()+"/ack", models.Ack{MessageId: message_id}, read_state)
+	if err != nil {
+		return nil, err
+	}
+	return read_state, nil
+}
+
+// Sends an op over the websocket.
+//
+// Fails while the websocket is down, the caller tells the user to try again
+func (c *chatClient) send(op string, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("on Marshal: %w", err)
+	}
+	frame, err := json.Marshal(models.ClientOp{Op: op, Data: raw})
+	if err != nil {
+		return fmt.Errorf("on Marshal: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return errors.New("not connected")
+	}
+	return c.conn.WriteMessage(websocket.TextMessage, frame)
+}
+
+func (c *chatClient) sendMessage(tab_id uuid.UUID, text string) error {
+	msg := models.Message{Text: text, Tab: &models.Tab{Id: tab_id}, DateSent: time.Now()}
+	return c.send(models.OpMessageCreate, msg)
+}
+
+func (c *chatClient) viewTab(tab_id uuid.UUID) error {
+	return c.send(models.OpTabView, models.TabOp{TabId: tab_id})
+}
+
+// Event pushed by the server, Data is decoded by whoever handles its Type
+type chatEvent struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// The websocket came up, or went down and is redialed after Retry
+type chatSocketState struct {
+	Connected bool
+	Err       error
+	Retry     time.Duration
+}
+
+// Keeps a websocket to /ws/messages open until ctx is done, redialing whenever it drops.
+//
+// Every event and every change of state is handed to deliver, from this goroutine.
+func (c *chatClient) listen(ctx context.Context, deliver func(msg any)) {
+	wait := redialMin
+	for {
+		conn, err := c.dial(ctx)
+		if err == nil {
+			wait = redialMin
+			deliver(chatSocketState{Connected: true})
+			err = c.read(ctx, conn, deliver)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		deliver(chatSocketState{Err: err, Retry: wait})
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, redialMax)
+	}
+}
+
+func (c *chatClient) dial(ctx context.Context) (*websocket.Conn, error) {
+	ws_url, err := url.Parse(c.base + "/ws/messages")
+	if err != nil {
+		return nil, fmt.Errorf("on url.Parse: %w", err)
+	}
+	ws_url.Scheme = strings.Replace(ws_url.Scheme, "http", "ws", 1)
+
+	dialer := &websocket.Dialer{Jar: c.jar, HandshakeTimeout: 10 * time.Second, Proxy: http.ProxyFromEnvironment}
+	conn, resp, err := dialer.DialContext(ctx, ws_url.String(), nil)
+	if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+		// The server no longer takes the session, it's dialed again with a new one
+		login_err := c.login(c.username, c.password)
+		if login_err != nil {
+			return nil, fmt.Errorf("on logging in again: %w", login_err)
+		}
+		conn, _, err = dialer.DialContext(ctx, ws_url.String(), nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("on dial %s: %w", ws_url, err)
+	}
+
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+	return conn, nil
+}
+
+// Reads events off conn until it fails or ctx is done
+func (c *chatClient) read(ctx context.Context, conn *websocket.Conn, deliver func(msg any)) error {
+	stop := context.AfterFunc(ctx, func() {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		conn.Close()
+	})
+	defer stop()
+	defer func() {
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		event := chatEvent{}
+		err = json.Unmarshal(data, &event)
+		if err != nil {
+			continue
+		}
+		deliver(event)
+	}
+}
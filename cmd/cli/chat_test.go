@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/services"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/google/uuid"
+)
+
+// Messages in the General tab of the chat fixture, enough for a few pages of history
+const chatHistoryLength = 2*historyPage + 20
+
+// Drives the chat client and its screen against a running server: the history is paged
+// with the before cursor, the new marker follows the read state and the client logs in
+// again once a restart ended its session.
+func TestChatClient(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the binary")
+	}
+	bin := buildBinary(t)
+	dir := t.TempDir()
+	port := freePort(t)
+	flags := seedChatFixture(t, bin, dir, port)
+	base := fmt.Sprintf("http://127.0.0.1:%d", port)
+
+	serve := startServe(t, bin, dir, flags)
+	waitReady(t, base+"/readyz", serve.exited)
+
+	c, err := newChatClient(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.login("nikos", "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab_id := chatTab(t, c, "General")
+
+	// Every page holds the messages right before the oldest of the previous one
+	pages := [][]models.Message{}
+	before := int64(0)
+	for {
+		page, err := c.history(tab_id, before)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		pages = append(pages, page)
+		before = page[0].Id
+	}
+	if len(pages) != 3 || len(pages[0]) != historyPage || len(pages[1]) != historyPage || len(pages[2]) != chatHistoryLength-2*historyPage {
+		t.Fatalf("expected pages of %d, %d and %d messages, got %d pages", historyPage, historyPage, chatHistoryLength-2*historyPage, len(pages))
+	}
+	expected := chatHistoryLength - 1
+	for _, page := range pages {
+		for i := len(page) - 1; i >= 0; i-- {
+			if page[i].Text != chatHistoryText(expected) || (i > 0 && page[i-1].Id >= page[i].Id) {
+				t.Fatalf("expected `%s` in id order, got `%s` (%d)", chatHistoryText(expected), page[i].Text, page[i].Id)
+			}
+			expected--
+		}
+	}
+
+	// The screen loads the newest page, then the older one once scrolled to the top
+	_, err = c.ack(tab_id, pages[0][historyPage-11].Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newChatModel(c)
+	m.Update(tea.WindowSizeMsg{Width: 200, Height: 3 * historyPage})
+	runChatCmd(m, m.loadSidebar())
+	if open, _ := m.openTab(); open != tab_id {
+		t.Fatalf("expected General to be opened first, got %s", open)
+	}
+	if len(m.messages) != historyPage || m.messages[0].Id != pages[0][0].Id || !m.more {
+		t.Fatalf("expected the newest page with more to load, got %d messages", len(m.messages))
+	}
+
+	// The marker goes above the first message of others after the read state, nikos wrote the one right after it
+	lines := strings.Split(m.viewport.View(), "\n")
+	marker := slices.IndexFunc(lines, func(line string) bool { return strings.Contains(line, "── new ──") })
+	if marker == -1 || marker+1 >= len(lines) || !strings.Contains(lines[marker+1], chatHistoryText(chatHistoryLength-9)) {
+		t.Fatalf("expected the new marker right above `%s`, got:\n%s", chatHistoryText(chatHistoryLength-9), m.viewport.View())
+	}
+
+	m.viewport.GotoTop()
+	runChatCmd(m, m.handleKey(tea.KeyMsg{Type: tea.KeyPgUp}))
+	if len(m.messages) != 2*historyPage || m.messages[0].Id != pages[1][0].Id || m.messages[historyPage].Id != pages[0][0].Id {
+		t.Fatalf("expected the older page above the newest, got %d messages", len(m.messages))
+	}
+
+	// Opening the tab read it up to its newest message
+	tabs, err := c.tabs(chatServer(t, c).Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tab := range tabs {
+		if tab.Id == tab_id && (tab.ReadState == nil || tab.ReadState.LastReadMessageId != pages[0][historyPage-1].Id || tab.ReadState.Unread != 0) {
+			t.Fatalf("expected General to be read up to %d, got %#v", pages[0][historyPage-1].Id, tab.ReadState)
+		}
+	}
+
+	// Without http.cookie_key the restart ends the session, the websocket dial logs in again
+	serve.stop(t, os.Interrupt)
+	serve = startServe(t, bin, dir, flags)
+	waitReady(t, base+"/readyz", serve.exited)
+
+	conn, err := c.dial(context.Background())
+	if err != nil {
+		t.Fatalf("expected the client to log in again and connect: %s", err)
+	}
+	defer conn.Close()
+	c.conn = conn
+	err = c.sendMessage(tab_id, "after the restart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := models.Message{}
+	err = json.Unmarshal(readEventOf(t, conn, models.EventMessageCreate), &msg)
+	if err != nil || msg.Text != "after the restart" || msg.Sender == nil || msg.Sender.Id != c.me.Id {
+		t.Fatalf("expected the message sent as nikos after the restart, got %#v: %v", msg, err)
+	}
+	serve.stop(t, os.Interrupt)
+}
+
+// Counts mentions of the user the way the server does, at word boundaries and in any case
+func TestChatMarkUnread(t *testing.T) {
+	me := models.User{Id: uuid.New(), Username: "nikos"}
+	other := &models.User{Id: uuid.New(), Username: "maria"}
+	tab := models.Tab{Id: uuid.New(), Name: "Memes"}
+	m := newChatModel(&chatClient{me: me})
+	m.entries = []chatEntry{{Tab: tab}}
+
+	for _, text := range []string{"hey @NIKOS", "@nikosgour", "nikos@example.com", "@nikos!"} {
+		m.markUnread(&models.Message{Text: text, Sender: other, Tab: &tab})
+	}
+	read_state := m.entries[0].Tab.ReadState
+	if read_state == nil || read_state.Unread != 4 || read_state.Mentions != 2 {
+		t.Fatalf("expected 4 unread with 2 mentions, got %#v", read_state)
+	}
+}
+
+// Seeds nikos and maria with chatHistoryLength messages in Gamiades' General tab
+// and returns the flags to serve it on port
+func seedChatFixture(t *testing.T, bin string, dir string, port int) []string {
+	t.Helper()
+	fixture := services.Fixture{
+		Users:   []services.FixtureUser{{Username: "nikos", Password: "123"}, {Username: "maria", Password: "123"}},
+		Servers: []services.FixtureServer{{Name: "Gamiades", Members: []string{"nikos", "maria"}, Tabs: []string{"General"}}},
+	}
+	for i := range chatHistoryLength {
+		sender := "maria"
+		if i == chatHistoryLength-10 {
+			sender = "nikos"
+		}
+		fixture.Messages = append(fixture.Messages, services.FixtureMessage{Server: "Gamiades", Tab: "General", Sender: sender, Text: chatHistoryText(i)})
+	}
+	data, err := json.Marshal(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "chat.json")
+	err = os.WriteFile(path, data, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flags := []string{"-storage.driver=sqlite", "-http.host=127.0.0.1", "-http.port=" + strconv.Itoa(port)}
+	seed := exec.Command(bin, append([]string{"seed", "-file", path}, flags...)...)
+	seed.Dir = dir
+	out, err := seed.CombinedOutput()
+	if err != nil {
+		t.Fatalf("on seed: %s\n%s", err, out)
+	}
+	return flags
+}
+
+func chatHistoryText(i int) string {
+	return fmt.Sprintf("history %03d", i)
+}
+
+func chatServer(t *testing.T, c *chatClient) models.Server {
+	t.Helper()
+	servers, err := c.servers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 1 {
+		t.Fatalf("expected nikos to be in Gamiades only, got %#v", servers)
+	}
+	return servers[0]
+}
+
+func chatTab(t *testing.T, c *chatClient, name string) uuid.UUID {
+	t.Helper()
+	tabs, err := c.tabs(chatServer(t, c).Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tab := range tabs {
+		if tab.Name == name {
+			return tab.Id
+		}
+	}
+	t.Fatalf("expected a %s tab, got %#v", name, tabs)
+	return uuid.Nil
+}
+
+// Runs cmd and feeds what it returns back to the screen, like the tea program would.
+// Commands that wait, like the cursor blinking, are left out.
+func runChatCmd(m *chatModel, cmd tea.Cmd) {
+	if cmd == nil {
+		return
+	}
+	switch msg := cmd().(type) {
+	case tea.BatchMsg:
+		for _, c := range msg {
+			runChatCmd(m, c)
+		}
+	case chatSidebarMsg, chatHistoryMsg, chatReadStateMsg, chatErrMsg:
+		_, next := m.Update(msg)
+		runChatCmd(m, next)
+	}
+}
@@ -0,0 +1,502 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/google/uuid"
+)
+
+const sidebarWidth = 26
+
+var (
+	serverStyle    = lipgloss.NewStyle().Bold(true)
+	openTabStyle   = lipgloss.NewStyle().Reverse(true)
+	unreadStyle    = lipgloss.NewStyle().Bold(true)
+	faintStyle     = lipgloss.NewStyle().Faint(true)
+	newStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	senderStyle    = lipgloss.NewStyle().Bold(true)
+	sidebarStyle   = lipgloss.NewStyle().Width(sidebarWidth).BorderStyle(lipgloss.NormalBorder()).BorderRight(true)
+	statusStyle    = lipgloss.NewStyle().Faint(true)
+	errStatusStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+)
+
+// A tab in the sidebar, under the server it belongs to
+type chatEntry struct {
+	Server models.Server
+	Tab    models.Tab
+}
+
+type (
+	chatSidebarMsg struct{ Entries []chatEntry }
+	chatHistoryMsg struct {
+		TabId    uuid.UUID
+		Before   int64
+		Messages []models.Message
+	}
+	chatReadStateMsg struct{ ReadState models.ReadState }
+	chatErrMsg       struct{ Err error }
+)
+
+// The chat screen: the servers and tabs on the left, the open tab on the right and a line to write in
+type chatModel struct {
+	client *chatClient
+
+	entries []chatEntry
+	// Index of the open tab in entries, -1 before the sidebar is loaded
+	open int
+
+	// The loaded history of the open tab, oldest first
+	messages []models.Message
+	// Where the tab was read up to when it was opened, the new marker goes after it
+	read_up_to int64
+	more       bool
+	loading    bool
+
+	// Set once the websocket has been up, to tell a reconnect from the first connect
+	was_connected bool
+	status        string
+	status_err    bool
+
+	viewport viewport.Model
+	input    textinput.Model
+	width    int
+}
+
+func newChatModel(client *chatClient) *chatModel {
+	input := textinput.New()
+	input.Prompt = "> "
+	input.Placeholder = "write a message"
+	input.Focus()
+
+	return &chatModel{client: client, open: -1, viewport: viewport.New(0, 0), input: input, status: "connecting..."}
+}
+
+func (m *chatModel) Init() tea.Cmd {
+	return tea.Batch(textinput.Blink, m.loadSidebar())
+}
+
+func (m *chatModel) loadSidebar() tea.Cmd {
+	return func() tea.Msg {
+		servers, err := m.client.servers()
+		if err != nil {
+			return chatErrMsg{fmt.Errorf("on loading the servers: %w", err)}
+		}
+
+		entries := []chatEntry{}
+		for _, server := range servers {
+			tabs, err := m.client.tabs(server.Id)
+			if err != nil {
+				return chatErrMsg{fmt.Errorf("on loading the tabs of %s: %w", server.Name, err)}
+			}
+			for _, tab := range tabs {
+				entries = append(entries, chatEntry{Server: server, Tab: tab})
+			}
+		}
+		return chatSidebarMsg{Entries: entries}
+	}
+}
+
+func (m *chatModel) loadHistory(tab_id uuid.UUID, before int64) tea.Cmd {
+	return func() tea.Msg {
+		messages, err := m.client.history(tab_id, before)
+		if err != nil {
+			return chatErrMsg{fmt.Errorf("on loading the history: %w", err)}
+		}
+		return chatHistoryMsg{TabId: tab_id, Before: before, Messages: messages}
+	}
+}
+
+func (m *chatModel) ack(tab_id uuid.UUID, message_id int64) tea.Cmd {
+	return func() tea.Msg {
+		read_state, err := m.client.ack(tab_id, message_id)
+		if err != nil {
+			return chatErrMsg{fmt.Errorf("on marking the tab read: %w", err)}
+		}
+		return chatReadStateMsg{ReadState: *read_state}
+	}
+}
+
+// Runs an op over the websocket, reporting when it couldn't be sent
+func (m *chatModel) sendOp(send func() error) tea.Cmd {
+	return func() tea.Msg {
+		err := send()
+		if err != nil {
+			return chatErrMsg{fmt.Errorf("couldn't send, %w", err)}
+		}
+		return nil
+	}
+}
+
+func (m *chatModel) openTab() (uuid.UUID, bool) {
+	if m.open < 0 || m.open >= len(m.entries) {
+		return uuid.Nil, false
+	}
+	return m.entries[m.open].Tab.Id, true
+}
+
+// Shows the tab at index i, its history is loaded from the newest page
+func (m *chatModel) switchTab(i int) tea.Cmd {
+	if len(m.entries) == 0 {
+		return nil
+	}
+	m.open = (i + len(m.entries)) % len(m.entries)
+	entry := m.entries[m.open]
+
+	m.messages, m.more, m.loading = nil, false, true
+	m.read_up_to = 0
+	if entry.Tab.ReadState != nil {
+		m.read_up_to = entry.Tab.ReadState.LastReadMessageId
+	}
+	m.render()
+
+	tab_id := entry.Tab.Id
+	return tea.Batch(m.loadHistory(tab_id, 0), m.sendOp(func() error { return m.client.viewTab(tab_id) }))
+}
+
+func (m *chatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.viewport.Width = max(msg.Width-sidebarWidth-1, 1)
+		m.viewport.Height = max(msg.Height-2, 1)
+		m.input.Width = max(msg.Width-len(m.input.Prompt)-1, 1)
+		m.render()
+		return m, nil
+
+	case tea.KeyMsg:
+		return m, m.handleKey(msg)
+
+	case chatSidebarMsg:
+		open_id, _ := m.openTab()
+		m.entries = msg.Entries
+		m.open = slices.IndexFunc(m.entries, func(e chatEntry) bool { return e.Tab.Id == open_id })
+		if m.open == -1 {
+			return m, m.switchTab(0)
+		}
+		return m, nil
+
+	case chatHistoryMsg:
+		return m, m.handleHistory(msg)
+
+	case chatSocketState:
+		if !msg.Connected {
+			m.setStatus(fmt.Sprintf("disconnected: %s, reconnecting in %s", msg.Err, msg.Retry), true)
+			return m, nil
+		}
+
+		m.setStatus("connected", false)
+		if !m.was_connected {
+			m.was_connected = true
+			return m, nil
+		}
+		// Events sent while the websocket was down are lost, so everything is loaded again
+		if tab_id, ok := m.openTab(); ok {
+			return m, tea.Batch(m.loadSidebar(), m.loadHistory(tab_id, 0), m.sendOp(func() error { return m.client.viewTab(tab_id) }))
+		}
+		return m, m.loadSidebar()
+
+	case chatEvent:
+		return m, m.handleEvent(msg)
+
+	case chatReadStateMsg:
+		m.setReadState(msg.ReadState)
+		return m, nil
+
+	case chatErrMsg:
+		m.setStatus(msg.Err.Error(), true)
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m *chatModel) handleKey(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "ctrl+c", "esc":
+		return tea.Quit
+	case "tab", "ctrl+n":
+		return m.switchTab(m.open + 1)
+	case "shift+tab", "ctrl+p":
+		return m.switchTab(m.open - 1)
+	case "pgdown":
+		m.viewport.PageDown()
+		return nil
+	case "pgup":
+		m.viewport.PageUp()
+		return m.loadOlder()
+	case "enter":
+		text := strings.TrimSpace(m.input.Value())
+		tab_id, ok := m.openTab()
+		if text == "" || !ok {
+			return nil
+		}
+		m.input.Reset()
+		return m.sendOp(func() error { return m.client.sendMessage(tab_id, text) })
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return cmd
+}
+
+// Loads the page before the oldest loaded message once the history is scrolled to its top
+func (m *chatModel) loadOlder() tea.Cmd {
+	tab_id, ok := m.openTab()
+	if !ok || !m.viewport.AtTop() || !m.more || m.loading || len(m.messages) == 0 {
+		return nil
+	}
+	m.loading = true
+	return m.loadHistory(tab_id, m.messages[0].Id)
+}
+
+func (m *chatModel) handleHistory(msg chatHistoryMsg) tea.Cmd {
+	tab_id, ok := m.openTab()
+	if !ok || msg.TabId != tab_id {
+		return nil
+	}
+	m.loading = false
+	m.more = len(msg.Messages) == historyPage
+
+	if msg.Before != 0 {
+		// The view stays on the messages it showed, above them the older page
+		lines := m.viewport.TotalLineCount()
+		m.messages = append(msg.Messages, m.messages...)
+		m.render()
+		m.viewport.SetYOffset(m.viewport.YOffset + m.viewport.TotalLineCount() - lines)
+		return nil
+	}
+
+	m.messages = msg.Messages
+	m.render()
+	m.viewport.GotoBottom()
+	return m.ackNewest()
+}
+
+// Marks the open tab read up to its newest message, unless it already is
+func (m *chatModel) ackNewest() tea.Cmd {
+	if len(m.messages) == 0 {
+		return nil
+	}
+	entry := m.entries[m.open]
+	newest := m.messages[len(m.messages)-1].Id
+	if entry.Tab.ReadState != nil && entry.Tab.ReadState.LastReadMessageId >= newest {
+		return nil
+	}
+	return m.ack(entry.Tab.Id, newest)
+}
+
+func (m *chatModel) handleEvent(event chatEvent) tea.Cmd {
+	switch event.Type {
+	case models.EventMessageCreate, models.EventMessageUpdate:
+		msg := models.Message{}
+		err := json.Unmarshal(event.Data, &msg)
+		if err != nil || msg.Tab == nil {
+			return nil
+		}
+
+		tab_id, _ := m.openTab()
+		if msg.Tab.Id == tab_id {
+			return m.showMessage(&msg, event.Type == models.EventMessageCreate)
+		}
+		if event.Type == models.EventMessageCreate && msg.Sender != nil && msg.Sender.Id != m.client.me.Id {
+			m.markUnread(&msg)
+		}
+
+	case models.EventReadStateUpdate:
+		read_state := models.ReadState{}
+		err := json.Unmarshal(event.Data, &read_state)
+		if err != nil {
+			return nil
+		}
+		m.setReadState(read_state)
+
+	case models.EventServerCreate, models.EventServerUpdate, models.EventServerDelete,
+		models.EventTabCreate, models.EventTabUpdate, models.EventTabDelete, models.EventMemberJoin:
+		return m.loadSidebar()
+
+	case models.EventError:
+		res := common.ErrorResponse{}
+		err := json.Unmarshal(event.Data, &res)
+		if err != nil {
+			return nil
+		}
+		m.setStatus(res.Message, true)
+	}
+	return nil
+}
+
+// Adds a message of the open tab to the history, or replaces it when it was updated
+func (m *chatModel) showMessage(msg *models.Message, created bool) tea.Cmd {
+	i := slices.IndexFunc(m.messages, func(loaded models.Message) bool { return loaded.Id == msg.Id })
+	if i != -1 {
+		m.messages[i] = *msg
+		m.render()
+		return nil
+	}
+	if !created {
+		return nil
+	}
+
+	at_bottom := m.viewport.AtBottom()
+	m.messages = append(m.messages, *msg)
+	m.render()
+	if at_bottom {
+		m.viewport.GotoBottom()
+	}
+	if msg.Sender != nil && msg.Sender.Id == m.client.me.Id {
+		// Sending it means everything above was read
+		m.read_up_to = msg.Id
+	}
+	return m.ackNewest()
+}
+
+// Counts a message of another tab as unread, the way the server does until the tab is opened
+func (m *chatModel) markUnread(msg *models.Message) {
+	mention := models.Mentions(msg.Text, m.client.me.Username)
+	for i := range m.entries {
+		if m.entries[i].Tab.Id != msg.Tab.Id {
+			continue
+		}
+		read_state := m.entries[i].Tab.ReadState
+		if read_state == nil {
+			read_state = &models.ReadState{TabId: msg.Tab.Id}
+			m.entries[i].Tab.ReadState = read_state
+		}
+		read_state.Unread++
+		if mention {
+			read_state.Mentions++
+		}
+	}
+}
+
+func (m *chatModel) setReadState(read_state models.ReadState) {
+	for i := range m.entries {
+		if m.entries[i].Tab.Id == read_state.TabId {
+			m.entries[i].Tab.ReadState = &read_state
+		}
+	}
+}
+
+func (m *chatModel) setStatus(status string, is_err bool) {
+	m.status, m.status_err = status, is_err
+}
+
+// Draws the history of the open tab into the viewport
+func (m *chatModel) render() {
+	if m.viewport.Width <= 0 {
+		return
+	}
+	entry_style := lipgloss.NewStyle().Width(m.viewport.Width)
+
+	lines := []string{}
+	switch {
+	case m.loading && len(m.messages) == 0:
+		lines = append(lines, faintStyle.Render("loading..."))
+	case m.more:
+		lines = append(lines, faintStyle.Render("── pgup for older messages ──"))
+	case m.open >= 0 && m.open < len(m.entries):
+		lines = append(lines, faintStyle.Render("── start of #"+m.entries[m.open].Tab.Name+" ──"))
+	}
+
+	marked := false
+	for _, msg := range m.messages {
+		from_other := msg.Sender != nil && msg.Sender.Id != m.client.me.Id
+		if !marked && from_other && msg.Id > m.read_up_to {
+			lines = append(lines, newStyle.Render("── new ──"))
+			marked = true
+		}
+		lines = append(lines, entry_style.Render(formatMessage(&msg)))
+	}
+
+	m.viewport.SetContent(strings.Join(lines, "\n"))
+}
+
+func formatMessage(msg *models.Message) string {
+	text := msg.Text
+	for _, attachment := range msg.Attachments {
+		text = strings.TrimSpace(text + " [" + attachment.Filename + "]")
+	}
+	return faintStyle.Render(msg.DateSent.Local().Format("15:04")) + " " + senderStyle.Render(senderName(msg.Sender)) + " " + text
+}
+
+// The name clients show for a user, their nickname in the server first
+func senderName(u *models.User) string {
+	switch {
+	case u == nil:
+		return "?"
+	case u.Nickname != "":
+		return u.Nickname
+	case u.DisplayName != "":
+		return u.DisplayName
+	default:
+		return u.Username
+	}
+}
+
+func (m *chatModel) View() string {
+	if m.width == 0 {
+		return ""
+	}
+
+	sidebar := []string{}
+	server_id := uuid.Nil
+	for i, entry := range m.entries {
+		if entry.Server.Id != server_id {
+			server_id = entry.Server.Id
+			sidebar = append(sidebar, serverStyle.Render(truncate(entry.Server.Name, sidebarWidth)))
+		}
+		sidebar = append(sidebar, tabLabel(entry.Tab, i == m.open))
+	}
+	if len(m.entries) == 0 {
+		sidebar = append(sidebar, faintStyle.Render("no tabs yet"))
+	}
+	left := sidebarStyle.Height(m.viewport.Height).MaxHeight(m.viewport.Height).Render(strings.Join(sidebar, "\n"))
+
+	status := statusStyle.Render(m.client.me.Username + " · " + m.status + " · tab/shift+tab switch tabs, pgup/pgdown scroll, esc quits")
+	if m.status_err {
+		status = errStatusStyle.Render(m.client.me.Username + " · " + m.status)
+	}
+	status = lipgloss.NewStyle().MaxWidth(m.width).Render(status)
+
+	return lipgloss.JoinVertical(lipgloss.Left, lipgloss.JoinHorizontal(lipgloss.Top, left, m.viewport.View()), status, m.input.View())
+}
+
+// The tab's line in the sidebar, with its unread count and a @ when it mentions the user
+func tabLabel(tab models.Tab, open bool) string {
+	marker := ""
+	if tab.ReadState != nil && tab.ReadState.Unread > 0 {
+		marker = fmt.Sprintf(" %d", tab.ReadState.Unread)
+		if tab.ReadState.Mentions > 0 {
+			marker += "@"
+		}
+	}
+
+	label := truncate("  # "+tab.Name, sidebarWidth-len(marker)) + marker
+	switch {
+	case open:
+		return openTabStyle.Render(label)
+	case marker != "":
+		return unreadStyle.Render(label)
+	default:
+		return label
+	}
+}
+
+func truncate(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	return string(runes[:max(width-1, 0)]) + "…"
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/logging/log"
+	"gopkg.in/yaml.v3"
+)
+
+func config(args []string) {
+	sub, args := subcommand("config", args)
+	if sub != "print" {
+		unknownSubcommand("config", sub)
+	}
+
+	loadConfig(flag.NewFlagSet("config print", flag.ExitOnError), args)
+
+	out, err := yaml.Marshal(common.Config.Masked())
+	if err != nil {
+		log.Fatal("on yaml.Marshal: %s", err)
+	}
+	fmt.Print(string(out))
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NikosGour/chatter/internal"
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/logging/log"
+)
+
+// Asks the running server through the admin API, the counts only live in its memory.
+func connections(args []string) {
+	fs := flag.NewFlagSet("connections", flag.ExitOnError)
+	url := fs.String("url", "", "base `url` of the server, from http.host and http.port when unset")
+	loadConfig(fs, args)
+
+	base := *url
+	if base == "" {
+		base = serverURL(common.Config.HTTP)
+	}
+
+	stats, err := fetchConnections(base, common.Config.HTTP.AdminToken)
+	if err != nil {
+		log.Fatal("%s", err)
+	}
+	fmt.Printf("%d connections from %d users\n", stats.Connections, stats.Users)
+}
+
+func fetchConnections(base string, token string) (*models.ConnectionStats, error) {
+	stats := &models.ConnectionStats{}
+	err := adminRequest(base, token, http.MethodGet, internal.AdminConnectionsPath, nil, stats)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// Sends a request to path under AdminPath with body as JSON, when it isn't nil,
+// and decodes the answer into out, when out isn't nil
+func adminRequest(base string, token string, method string, path string, body any, out any) error {
+	if token == "" {
+		return errors.New("http.admin_token is not set, the admin API is off")
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("on Marshal: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, base+internal.AdminPath+path, reader)
+	if err != nil {
+		return fmt.Errorf("on NewRequest: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("on %s %s, is the server running: %w", method, req.URL, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("on reading the response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s answered %d: %s", method, req.URL, resp.StatusCode, data)
+	}
+
+	if out == nil {
+		return nil
+	}
+	err = json.Unmarshal(data, out)
+	if err != nil {
+		return fmt.Errorf("on Unmarshal: %w", err)
+	}
+	return nil
+}
+
+// Where the server configured by cfg is reached from this machine
+func serverURL(cfg common.HTTPConfig) string {
+	host := cfg.Host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+
+	scheme := "http"
+	if cfg.TLS() {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, strconv.Itoa(cfg.Port))
+}
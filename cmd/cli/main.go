@@ -1,17 +1,108 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"os"
+
 	"github.com/NikosGour/chatter/internal"
+	"github.com/NikosGour/chatter/internal/blob"
 	"github.com/NikosGour/chatter/internal/common"
 	"github.com/NikosGour/chatter/internal/storage"
+	"github.com/NikosGour/logging/log"
 )
 
+const usage = `Usage: cli [command] [flags]
+
+Commands:
+	serve                    start the API server (default)
+	seed                     seed test data from a fixture file
+	purge-test-data          delete all users and servers flagged as test data
+	config print             print the effective config, secrets masked
+
+	user create              create a user
+	user disable             stop a user from logging in and end their sessions
+	user enable              let a disabled user log in again
+	user reset-password      set a user's password, a random one unless -password is given
+	server list              list the servers
+	server members           list the members of a server
+	server add-member        add a user to a server
+	server remove-member     remove a user from a server, except its owner
+	server export            write a server with its members, tabs and messages to a JSON file
+	connections              show the live connections of the running server, needs http.admin_token
+	chat                     chat in the terminal as a user of the running server
+
+Users and servers are named by id, by username or by name.
+
+user disable, user enable, user reset-password, server add-member and server remove-member
+go through the admin API of the running server when http.admin_token is set, so its connected
+clients are told and a disabled user's websockets are closed. Without the token, or with -direct,
+they change the storage directly: connected clients only see the change once they reconnect
+and a disabled user stays connected until then.
+Every command takes -config and a flag per setting, run a command with -h to list them.
+`
+
 func main() {
-	common.InitDotenv()
+	cmd, args := "serve", os.Args[1:]
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+
+	switch cmd {
+	case "serve":
+		serve(args)
+	case "seed":
+		seed(args)
+	case "purge-test-data":
+		purgeTestData(args)
+	case "config":
+		config(args)
+	case "user":
+		user(args)
+	case "server":
+		server(args)
+	case "connections":
+		connections(args)
+	case "chat":
+		chat(args)
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command `%s`\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+}
+
+func serve(args []string) {
+	loadConfig(flag.NewFlagSet("serve", flag.ExitOnError), args)
 
-	db := storage.NewPostgreSQLStorage()
+	db := storage.NewStorage()
 
-	api := internal.NewAPIServer(db)
+	api := internal.NewAPIServer(db, blob.NewStore())
 
 	api.Start()
 }
+
+// Runs fn against the configured storage, exiting when it fails.
+//
+// Only the services are built, none of the workers serving starts.
+func withAPI(fn func(api *internal.APIServer) error) {
+	db := storage.NewStorage()
+	api := internal.NewAPIServer(db, blob.NewStore())
+	api.BuildServices()
+
+	err := fn(api)
+	db.Close()
+	if err != nil {
+		log.Error("%s", err)
+		os.Exit(1)
+	}
+}
+
+// Loads the config from every layer, exiting when it's invalid
+func loadConfig(fs *flag.FlagSet, args []string) {
+	err := common.LoadConfig(fs, args)
+	if err != nil {
+		log.Fatal("%s", err)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Builds the binary and runs it from an empty directory, with nothing of the source tree
+// around it, the way a deployed binary runs.
+func TestBinaryRunsOutsideSourceTree(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the binary")
+	}
+	bin := buildBinary(t)
+	dir := t.TempDir()
+	port := freePort(t)
+	flags := seededFlags(t, bin, dir, port)
+
+	serve := startServe(t, bin, dir, flags)
+	status, body := waitReady(t, fmt.Sprintf("http://127.0.0.1:%d/readyz", port), serve.exited)
+	if status != http.StatusOK {
+		t.Fatalf("expected /readyz to be 200, got %d: %s\n%s", status, body, serve.logs)
+	}
+	serve.stop(t, os.Interrupt)
+
+	_, err := os.Stat(filepath.Join(dir, "chatter.db"))
+	if err != nil {
+		t.Fatalf("expected the database in the working directory: %s", err)
+	}
+}
+
+// A running serve command
+type serveProcess struct {
+	cmd    *exec.Cmd
+	logs   *bytes.Buffer
+	exited chan error
+}
+
+// Builds the binary into a temporary directory
+func buildBinary(t *testing.T) string {
+	t.Helper()
+	go_bin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("the go command isn't available")
+	}
+
+	// -trimpath keeps the binary from finding the source tree through the paths compiled into it
+	bin := filepath.Join(t.TempDir(), "chatter")
+	out, err := exec.Command(go_bin, "build", "-trimpath", "-o", bin, ".").CombinedOutput()
+	if err != nil {
+		t.Fatalf("on go build: %s\n%s", err, out)
+	}
+	return bin
+}
+
+// Seeds a SQLite database in dir and returns the flags to serve it on port
+func seededFlags(t *testing.T, bin string, dir string, port int) []string {
+	t.Helper()
+	flags := []string{"-storage.driver=sqlite", "-http.host=127.0.0.1", "-http.port=" + strconv.Itoa(port)}
+
+	seed := exec.Command(bin, append([]string{"seed"}, flags...)...)
+	seed.Dir = dir
+	out, err := seed.CombinedOutput()
+	if err != nil {
+		t.Fatalf("on seed: %s\n%s", err, out)
+	}
+	return flags
+}
+
+// Starts serve from dir, killed when the test ends
+func startServe(t *testing.T, bin string, dir string, flags []string) *serveProcess {
+	t.Helper()
+	p := &serveProcess{logs: &bytes.Buffer{}, exited: make(chan error, 1)}
+	p.cmd = exec.Command(bin, append([]string{"serve"}, flags...)...)
+	p.cmd.Dir = dir
+	p.cmd.Stdout = p.logs
+	p.cmd.Stderr = p.logs
+	err := p.cmd.Start()
+	if err != nil {
+		t.Fatalf("on serve: %s", err)
+	}
+	go func() {
+		p.exited <- p.cmd.Wait()
+	}()
+	t.Cleanup(func() { p.cmd.Process.Kill() })
+	return p
+}
+
+// Signals serve and waits for it to exit cleanly
+func (p *serveProcess) stop(t *testing.T, sig os.Signal) {
+	t.Helper()
+	err := p.cmd.Process.Signal(sig)
+	if err != nil {
+		t.Fatalf("on Signal: %s", err)
+	}
+	select {
+	case err := <-p.exited:
+		if err != nil {
+			t.Fatalf("expected serve to exit cleanly, got: %s\n%s", err, p.logs)
+		}
+	case <-time.After(20 * time.Second):
+		t.Fatalf("serve didn't exit after %s\n%s", sig, p.logs)
+	}
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("on Listen: %s", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// Polls url until the server answers, failing if it exits first
+func waitReady(t *testing.T, url string, exited <-chan error) (int, string) {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-exited:
+			t.Fatalf("serve exited before it was ready: %v", err)
+		default:
+		}
+
+		resp, err := http.Get(url)
+		if err == nil {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return resp.StatusCode, string(body)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("serve wasn't up after 30s")
+	return 0, ""
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/NikosGour/chatter/db"
+	"github.com/NikosGour/chatter/internal"
+	"github.com/NikosGour/logging/log"
+)
+
+func seed(args []string) {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	file := fs.String("file", "", "fixture `path`, .yaml, .yml or .json, the embedded "+db.DummyFixture+" when unset")
+	loadConfig(fs, args)
+	name := *file
+	if name == "" {
+		name = db.DummyFixture
+	}
+
+	withAPI(func(api *internal.APIServer) error {
+		err := api.Seed(*file)
+		if err != nil {
+			return fmt.Errorf("on Seed(%s): %w", name, err)
+		}
+		log.Info("seeded `%s`", name)
+		return nil
+	})
+}
+
+func purgeTestData(args []string) {
+	loadConfig(flag.NewFlagSet("purge-test-data", flag.ExitOnError), args)
+
+	withAPI(func(api *internal.APIServer) error {
+		users, servers, err := api.PurgeTestData()
+		if err != nil {
+			return fmt.Errorf("on PurgeTestData: %w", err)
+		}
+		log.Info("deleted %d test users and %d test servers", users, servers)
+		return nil
+	})
+}
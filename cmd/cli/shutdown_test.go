@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/services"
+	"github.com/fasthttp/websocket"
+	"github.com/google/uuid"
+)
+
+// Sends SIGTERM with a websocket client connected and a message just sent: the client is told
+// to reconnect and the message is either stored or refused with shutting_down, never lost.
+func TestSIGTERMDrainsWebsockets(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the binary")
+	}
+	bin := buildBinary(t)
+	dir := t.TempDir()
+	port := freePort(t)
+	flags := seededFlags(t, bin, dir, port)
+	base := fmt.Sprintf("http://127.0.0.1:%d", port)
+
+	serve := startServe(t, bin, dir, flags)
+	waitReady(t, base+"/readyz", serve.exited)
+
+	c, tab_id := loginToGeneral(t, base)
+	conn, err := c.dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	text := "sent right before SIGTERM " + uuid.NewString()
+	err = c.sendMessage(tab_id, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = serve.cmd.Process.Signal(syscall.SIGTERM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refused := false
+	conn.SetReadDeadline(time.Now().Add(20 * time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		close_err := &websocket.CloseError{}
+		if errors.As(err, &close_err) {
+			if close_err.Code != websocket.CloseServiceRestart {
+				t.Fatalf("expected the server to close with %d, got %d", websocket.CloseServiceRestart, close_err.Code)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatalf("expected a close frame, got %s\n%s", err, serve.logs)
+		}
+
+		event := chatEvent{}
+		json.Unmarshal(data, &event)
+		if event.Type == models.EventError {
+			res := common.ErrorResponse{}
+			json.Unmarshal(event.Data, &res)
+			refused = res.Code == services.ErrShuttingDown.Code
+		}
+	}
+	select {
+	case err := <-serve.exited:
+		if err != nil {
+			t.Fatalf("expected serve to exit cleanly, got: %s\n%s", err, serve.logs)
+		}
+	case <-time.After(20 * time.Second):
+		t.Fatalf("serve didn't exit after SIGTERM\n%s", serve.logs)
+	}
+
+	serve = startServe(t, bin, dir, flags)
+	waitReady(t, base+"/readyz", serve.exited)
+	c, tab_id = loginToGeneral(t, base)
+	messages, err := c.history(tab_id, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := false
+	for _, msg := range messages {
+		stored = stored || msg.Text == text
+	}
+	t.Logf("stored: %t, refused: %t", stored, refused)
+	if stored == refused {
+		t.Fatalf("expected the message to be either stored or refused, stored: %t, refused: %t", stored, refused)
+	}
+	serve.stop(t, syscall.SIGTERM)
+}
+
+// Logs in as nikos of the dummy fixture and finds the General tab of Gamiades
+func loginToGeneral(t *testing.T, base string) (*chatClient, uuid.UUID) {
+	t.Helper()
+	c, err := newChatClient(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.login("nikos", "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	servers, err := c.servers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, server := range servers {
+		if server.Name != "Gamiades" {
+			continue
+		}
+		tabs, err := c.tabs(server.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tab := range tabs {
+			if tab.Name == "General" {
+				return c, tab.Id
+			}
+		}
+	}
+	t.Fatal("the dummy fixture has no General tab in Gamiades")
+	return nil, uuid.Nil
+}
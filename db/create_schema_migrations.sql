@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS schema_migrations
+(
+    version      TEXT UNIQUE PRIMARY KEY,
+    date_applied TIMESTAMP NOT NULL
+);
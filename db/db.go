@@ -0,0 +1,14 @@
+// Package db holds the SQL chatter runs and the test fixtures, embedded into the binary
+// so it runs from any directory.
+package db
+
+import "embed"
+
+// The create_*.sql files, the sqlite specific ones under sqlite/, migrations/ and fixtures/.
+// v0.1.0/ is the old schema and isn't embedded.
+//
+//go:embed *.sql sqlite/*.sql migrations/*.sql fixtures/*
+var FS embed.FS
+
+// The fixture seed uses when it isn't given one
+const DummyFixture = "fixtures/dummy.yaml"
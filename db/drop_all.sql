@@ -1,3 +1,8 @@
+DROP TABLE IF EXISTS schema_migrations;
+DROP TABLE IF EXISTS rate_limits;
+DROP TABLE IF EXISTS message_mentions;
+DROP TABLE IF EXISTS read_states;
+DROP TABLE IF EXISTS attachments;
 DROP TABLE IF EXISTS messages;
 DROP TABLE IF EXISTS tabs;
 DROP TABLE IF EXISTS server_members;
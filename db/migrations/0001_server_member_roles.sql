@@ -0,0 +1,2 @@
+ALTER TABLE server_members
+    ADD COLUMN "role" TEXT NOT NULL DEFAULT 'member';
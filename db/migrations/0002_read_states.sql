@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS read_states
+(
+    user_id              TEXT   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    tab_id               TEXT   NOT NULL REFERENCES tabs (id) ON DELETE CASCADE,
+    last_read_message_id BIGINT NOT NULL,
+    PRIMARY KEY (user_id, tab_id)
+);
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN hide_read_receipts BOOLEAN NOT NULL DEFAULT FALSE;
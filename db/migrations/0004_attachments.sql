@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS attachments
+(
+    id           TEXT      PRIMARY KEY,
+    message_id   BIGINT    NOT NULL REFERENCES messages (id) ON DELETE CASCADE,
+    "position"   INTEGER   NOT NULL,
+    filename     TEXT      NOT NULL,
+    content_type TEXT      NOT NULL,
+    "size"       BIGINT    NOT NULL,
+    date_created TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS attachments_message_id ON attachments (message_id);
@@ -0,0 +1,4 @@
+ALTER TABLE attachments ADD COLUMN width INTEGER;
+ALTER TABLE attachments ADD COLUMN height INTEGER;
+ALTER TABLE attachments ADD COLUMN has_thumbnail BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE attachments ADD COLUMN date_processed TIMESTAMP;
@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN bio TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN avatar_id TEXT;
+ALTER TABLE server_members ADD COLUMN nickname TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS rate_limits
+(
+    bucket TEXT   PRIMARY KEY,
+    tat    BIGINT NOT NULL
+);
+
+ALTER TABLE tabs ADD COLUMN slow_mode INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS message_mentions
+(
+    message_id BIGINT NOT NULL REFERENCES messages (id) ON DELETE CASCADE,
+    user_id    TEXT   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    PRIMARY KEY (message_id, user_id)
+);
@@ -0,0 +1,205 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrAmbiguousName = common.NewAPIError(http.StatusConflict, "ambiguous_name", "more than one match, use the id instead")
+)
+
+// Operations of the admin commands. They go through the services and publish the events
+// the endpoints do, which only reach the clients connected to the same process.
+// The admin API runs those that change what connected clients see inside the running server.
+
+// Creates a user, checked like a login is.
+//
+// Might return ErrValidationFailed, ErrUserAlreadyExists or any other sql error
+func (s *APIServer) CreateUser(username string, password string, is_test bool) (*models.User, error) {
+	credentials := &models.Credentials{Username: username, Password: password}
+	err := credentials.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", common.ErrValidationFailed, err)
+	}
+
+	user := &models.User{Username: username, DateCreated: time.Now(), IsTest: is_test}
+	_, err = s.user_service.Create(user, password)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Finds a user by UUID or by username.
+//
+// Might return ErrUserNotFound, ErrAmbiguousName or any other sql error
+func (s *APIServer) FindUser(ref string) (*models.User, error) {
+	id, err := uuid.Parse(ref)
+	if err == nil {
+		return s.user_service.GetByID(id)
+	}
+
+	users, err := s.user_service.GetByUsername(ref)
+	if err != nil {
+		return nil, err
+	}
+	switch len(users) {
+	case 0:
+		return nil, fmt.Errorf("%w:%s", models.ErrUserNotFound, ref)
+	case 1:
+		return &users[0], nil
+	}
+	return nil, fmt.Errorf("%w:username=%s", ErrAmbiguousName, ref)
+}
+
+// Disables a user, closing their websockets, or enables them again.
+//
+// Might return ErrUserNotFound or any other sql error
+func (s *APIServer) SetUserDisabled(id uuid.UUID, disabled bool) (*models.User, error) {
+	user, err := s.user_service.SetDisabled(id, disabled)
+	if err != nil {
+		return nil, err
+	}
+	if disabled {
+		s.conn_manager.Disconnect(id, websocket.ClosePolicyViolation, "user disabled")
+	}
+	return user, nil
+}
+
+// Sets a new password for the user, ending their sessions and closing their websockets.
+//
+// Might return ErrValidationFailed, ErrUserNotFound or any other sql error
+func (s *APIServer) ResetPassword(id uuid.UUID, password string) error {
+	patch := &models.UserPatch{Password: &password}
+	err := patch.Validate()
+	if err != nil {
+		return fmt.Errorf("%w: %w", common.ErrValidationFailed, err)
+	}
+
+	user, err := s.user_service.Update(id, patch)
+	if err != nil {
+		return err
+	}
+	s.conn_manager.Disconnect(id, websocket.ClosePolicyViolation, "password reset")
+	s.conn_manager.PublishToCoMembers(id, models.NewEvent(models.EventUserUpdate, user))
+	return nil
+}
+
+func (s *APIServer) Servers() ([]models.Server, error) {
+	return s.server_service.GetAll()
+}
+
+// Finds a server by UUID or by name.
+//
+// Might return ErrServerNotFound, ErrAmbiguousName or any other sql error
+func (s *APIServer) FindServer(ref string) (*models.Server, error) {
+	id, err := uuid.Parse(ref)
+	if err == nil {
+		return s.server_service.GetByID(id)
+	}
+
+	servers, err := s.server_service.GetByName(ref)
+	if err != nil {
+		return nil, err
+	}
+	switch len(servers) {
+	case 0:
+		return nil, fmt.Errorf("%w:%s", models.ErrServerNotFound, ref)
+	case 1:
+		return &servers[0], nil
+	}
+	return nil, fmt.Errorf("%w:name=%s", ErrAmbiguousName, ref)
+}
+
+func (s *APIServer) Members(server_id uuid.UUID) ([]models.Member, error) {
+	return s.server_service.GetMembers(server_id)
+}
+
+// Might return ErrUserNotFound, ErrServerNotFound, ErrUserAlreadyInServer or any other sql error
+func (s *APIServer) AddMember(server_id uuid.UUID, user_id uuid.UUID) error {
+	err := s.server_service.AddUserToServer(user_id, server_id)
+	if err != nil {
+		return err
+	}
+
+	member, err := s.server_service.GetMember(server_id, user_id)
+	if err != nil {
+		return err
+	}
+	s.conn_manager.PublishToServer(server_id, models.NewEvent(models.EventMemberJoin, member))
+	return nil
+}
+
+// Might return ErrServerNotFound, ErrNotServerMember, ErrCannotRemoveOwner or any other sql error
+func (s *APIServer) RemoveMember(server_id uuid.UUID, user_id uuid.UUID) error {
+	return s.server_service.RemoveUserFromServer(user_id, server_id)
+}
+
+// Might return ErrServerNotFound or any other sql error
+func (s *APIServer) ExportServer(server_id uuid.UUID) (*models.ServerExport, error) {
+	return s.export_service.Export(server_id)
+}
+
+// POST /admin/users/:id/disable and /admin/users/:id/enable
+func (s *APIServer) adminSetUserDisabled(disabled bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := common.ParamsParseUUID(c, "id")
+		if err != nil {
+			return common.JSONErr(c, err)
+		}
+
+		user, err := s.SetUserDisabled(id, disabled)
+		if err != nil {
+			return common.JSONErr(c, err)
+		}
+		return c.JSON(user)
+	}
+}
+
+// POST /admin/users/:id/password
+func (s *APIServer) adminResetPassword(c *fiber.Ctx) error {
+	id, err := common.ParamsParseUUID(c, "id")
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+	body, err := common.BodyParse[models.PasswordReset](c)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	err = s.ResetPassword(id, body.Password)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// PUT and DELETE /admin/servers/:id/members/:user_id
+func (s *APIServer) adminSetMember(c *fiber.Ctx) error {
+	server_id, err := common.ParamsParseUUID(c, "id")
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+	user_id, err := common.ParamsParseUUID(c, "user_id")
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	if c.Method() == fiber.MethodDelete {
+		err = s.RemoveMember(server_id, user_id)
+	} else {
+		err = s.AddMember(server_id, user_id)
+	}
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
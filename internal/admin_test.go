@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAdminPasswordResetEndsSessions(t *testing.T) {
+	token := common.Config.HTTP.AdminToken
+	t.Cleanup(func() { common.Config.HTTP.AdminToken = token })
+	common.Config.HTTP.AdminToken = "secret"
+	s, app := newTestAPI(t)
+	base := listen(t, app)
+
+	maria := newTestUser(t, s, "maria")
+	session := login(t, app, "maria", "123")
+	conn := dialMessages(t, base, session)
+
+	body, err := json.Marshal(map[string]string{"password": "4567"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(fiber.MethodPost, AdminPath+AdminUsersPath+"/"+maria.String()+"/password", bytes.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer secret")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusNoContent {
+		t.Fatalf("expected the password to be reset, got %d", resp.StatusCode)
+	}
+
+	// Neither the cookie nor the websocket opened with it outlive the reset
+	resp, data := request(t, app, fiber.MethodGet, "/user/me/profile", nil, session)
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Fatalf("expected the session to end, got %d: %s", resp.StatusCode, data)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		close_err := &websocket.CloseError{}
+		if errors.As(err, &close_err) {
+			if close_err.Code != websocket.ClosePolicyViolation {
+				t.Fatalf("expected the websocket to close with %d, got %d", websocket.ClosePolicyViolation, close_err.Code)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatalf("expected a close frame, got %s", err)
+		}
+	}
+
+	session = login(t, app, "maria", "4567")
+	resp, data = request(t, app, fiber.MethodGet, "/user/me/profile", nil, session)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected the new password to log in, got %d: %s", resp.StatusCode, data)
+	}
+}
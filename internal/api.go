@@ -1,70 +1,189 @@
 package internal
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"slices"
-	"time"
-
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/NikosGour/chatter/build"
+	"github.com/NikosGour/chatter/db"
+	"github.com/NikosGour/chatter/internal/blob"
 	"github.com/NikosGour/chatter/internal/common"
 	"github.com/NikosGour/chatter/internal/controllers"
+	"github.com/NikosGour/chatter/internal/metrics"
+	"github.com/NikosGour/chatter/internal/middleware"
 	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/openapi"
 	"github.com/NikosGour/chatter/internal/repositories"
 	"github.com/NikosGour/chatter/internal/services"
 	"github.com/NikosGour/chatter/internal/storage"
 	"github.com/NikosGour/logging/log"
 	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	APIBasePath = "/api/v1"
+	APIVersion  = "1.0.0"
+	OpenAPIPath = "/openapi.json"
+	// Served outside of APIBasePath, for the orchestrator and monitoring
+	MetricsPath = "/metrics"
+	HealthPath  = "/healthz"
+	ReadyPath   = "/readyz"
+	// Also outside of APIBasePath, for operators and only served when http.admin_token is set
+	AdminPath            = "/admin"
+	AdminConnectionsPath = "/connections"
+	AdminUsersPath       = "/users"
+	AdminServersPath     = "/servers"
+
+	// Attachments are downloaded from AttachmentPath/<id>
+	AttachmentPath = "/attachment"
+	// Avatars are downloaded from AvatarPath/<id>
+	AvatarPath = "/avatar"
 )
 
 type APIServer struct {
 	listening_addr string
-	db             *storage.PostgreSQLStorage
+	db             storage.Storage
+	blobs          blob.Store
 
 	user_controller    *controllers.UserController
 	server_controller  *controllers.ServerController
 	message_controller *controllers.MessageController
 	tab_controller     *controllers.TabController
 
+	attachment_controller *controllers.AttachmentController
+	profile_controller    *controllers.ProfileController
+	health_controller     *controllers.HealthController
+	admin_controller      *controllers.AdminController
+
 	user_service    *services.UserService
 	server_service  *services.ServerService
 	message_service *services.MessageService
 	tab_service     *services.TabService
+	seed_service    *services.SeedService
+	export_service  *services.ExportService
+
+	presence_service *services.PresenceService
+	typing_service   *services.TypingService
+
+	read_state_service *services.ReadStateService
+	attachment_service *services.AttachmentService
+	thumbnail_service  *services.ThumbnailService
+	profile_service    *services.ProfileService
+	rate_limit_service *services.RateLimitService
+	health_service     *services.HealthService
 
 	conn_manager *services.ConnManager
 }
 
-func NewAPIServer(db *storage.PostgreSQLStorage) *APIServer {
-	s := &APIServer{db: db}
-	listening_addr := common.Dotenv[common.EnvHOST_ADDRESS] + ":" + common.Dotenv[common.EnvPORT]
-	s.listening_addr = listening_addr
+func NewAPIServer(db storage.Storage, blobs blob.Store) *APIServer {
+	s := &APIServer{db: db, blobs: blobs}
+	s.listening_addr = net.JoinHostPort(common.Config.HTTP.Host, strconv.Itoa(common.Config.HTTP.Port))
 	return s
 }
 
+// Serves until SIGINT or SIGTERM, then shuts down gracefully.
+// A second signal stops the server right away.
 func (s *APIServer) Start() {
 	app := s.SetupServer()
 
-	err := app.Listen(s.listening_addr)
-	if err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, 1)
+	go func() {
+		cfg := common.Config.HTTP
+		if cfg.TLS() {
+			errs <- app.ListenTLS(s.listening_addr, cfg.TLSCertFile, cfg.TLSKeyFile)
+			return
+		}
+		errs <- app.Listen(s.listening_addr)
+	}()
+
+	select {
+	case err := <-errs:
 		log.Fatal("%s", err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	s.Shutdown(app)
+}
+
+// Stops the server within http.shutdown_timeout.
+//
+// New connections are refused and requests in flight finish, then the queued websocket messages
+// are stored, the websocket clients are told to reconnect elsewhere and the storage is closed.
+func (s *APIServer) Shutdown(app *fiber.App) {
+	timeout := common.Config.HTTP.ShutdownTimeout
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	log.Info("shutting down, waiting at most %s", timeout)
+
+	err := app.ShutdownWithContext(ctx)
+	if err != nil {
+		log.Error("on stopping the http server: %s", err)
+	}
+
+	err = s.thumbnail_service.Stop(ctx)
+	if err != nil {
+		log.Error("on stopping the thumbnail worker: %s", err)
+	}
+
+	err = s.conn_manager.Shutdown(ctx)
+	if err != nil {
+		log.Error("on draining the websocket connections: %s", err)
+	}
+
+	err = s.db.Close()
+	if err != nil {
+		log.Error("on closing the storage: %s", err)
 	}
+	log.Info("shut down")
 }
 
 func (s *APIServer) SetupServer() *fiber.App {
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		ErrorHandler: common.ErrorHandler,
+		// Bodies are limited per route by middleware.BodyLimit, larger ones are streamed to it
+		// instead of being turned down, and multipart forms are only parsed once they got through
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
+		// Behind a reverse proxy the client address is taken from its header, from the trusted proxies only
+		ProxyHeader:             common.Config.HTTP.ProxyHeader,
+		EnableTrustedProxyCheck: common.Config.HTTP.ProxyHeader != "",
+		TrustedProxies:          common.Config.HTTP.TrustedProxies,
+		EnableIPValidation:      true,
+	})
 
-	app.Use(cors.New())
-	app.Use(logger.New(logger.Config{
-		Format: "${time} | ${status} | ${latency} | ${ip} | ${method} | ${path} | Params: ${queryParams} | ReqBody: ${body} | ResBody: ${resBody} | ${error}\n",
+	app.Use(requestid.New(requestid.Config{ContextKey: common.LocalsRequestId}))
+	app.Use(middleware.Metrics())
+	app.Use(cors.New(cors.Config{AllowOrigins: strings.Join(common.Config.HTTP.CORSOrigins, ",")}))
+	// Bodies can hold anything users send, they are only logged in debug builds
+	app.Use(middleware.Logger(common.Logger, build.DEBUG_MODE))
+	app.Use(middleware.BodyLimit(fiber.DefaultBodyLimit, map[string]int{
+		// Room for a message with every attachment at its largest
+		fiber.MethodPost + " " + APIBasePath + "/message/attachments": models.MaxAttachments*models.MaxAttachmentSize + 1<<20,
+		fiber.MethodPut + " " + APIBasePath + "/user/me/avatar":       models.MaxAvatarSize + 1<<20,
 	}))
 
 	s.DependencyInjection()
-	s.SetupDummyData()
 
-	ws := app.Group("/ws", func(c *fiber.Ctx) error {
+	rate_limit := middleware.RateLimit(s.rate_limit_service)
+
+	ws := app.Group("/ws", rate_limit, func(c *fiber.Ctx) error {
 		if !websocket.IsWebSocketUpgrade(c) {
 			return fiber.ErrUpgradeRequired
 		}
@@ -88,7 +207,7 @@ func (s *APIServer) SetupServer() *fiber.App {
 		log.Info("Sent")
 	}))
 
-	ws.Get("/messages", websocket.New(func(c *websocket.Conn) {
+	ws.Get("/messages", s.wsAuth, websocket.New(func(c *websocket.Conn) {
 
 		defer func() {
 			err := c.Close()
@@ -97,185 +216,142 @@ func (s *APIServer) SetupServer() *fiber.App {
 			}
 		}()
 
-		_id := c.Query("uid")
-		id, err := uuid.Parse(_id)
-		if err != nil {
-			log.Error("%s", err)
-			err := c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseUnsupportedData, fmt.Sprintf("uid param is not a valid uuid: `%s`", _id)))
-			if err != nil {
-				log.Error("couldn't inform the client of malformed uuid: %s", err)
-			}
-			return
-		}
-		s.conn_manager.AddClient(id, c)
-		log.Debug("%#v", s.conn_manager.Clients)
-		defer s.conn_manager.RemoveClient(id)
+		id := c.Locals(common.LocalsUserId).(uuid.UUID)
+		client := s.conn_manager.AddClient(id, c)
+		defer s.conn_manager.RemoveClient(client)
 
-		s.conn_manager.ClientReadIncoming(id)
+		s.conn_manager.ClientReadIncoming(client)
 	}))
 
-	user := app.Group("/user")
-	user.Post("/", s.user_controller.Create)
-	user.Get("/", s.user_controller.GetAll)
-	user.Get("/:id", s.user_controller.GetById)
-
-	group := app.Group("/server")
-	group.Post("/", s.server_controller.Create)
-	group.Get("/", s.server_controller.GetAll)
-	group.Get("/:id", s.server_controller.GetById)
-	group.Get("/:id/users", s.server_controller.GetUsersById)
-	group.Get("/:id/tabs", s.server_controller.GetTabsById)
-	group.Post("/:id", s.server_controller.AddUserToServer)
-
-	message := app.Group("/message")
-	message.Post("/", s.message_controller.Create)
-	message.Get("/", s.message_controller.GetAll)
-	message.Get("/:id", s.message_controller.GetById)
-	message.Get("/tab/:tab_id", s.message_controller.GetByTabId)
-
-	tab := app.Group("/tab")
-	tab.Post("/", s.tab_controller.Create)
-	tab.Get("/", s.tab_controller.GetAll)
-	tab.Get("/:id", s.tab_controller.GetById)
-
-	return app
-}
-
-func (s *APIServer) DependencyInjection() {
-
-	user_repo := repositories.NewUserRepository(s.db)
-	tab_repo := repositories.NewTabRepository(s.db)
-	message_repo := repositories.NewMessageRepository(s.db)
-	server_repo := repositories.NewServerRepository(s.db)
-
-	s.user_service = services.NewUserService(user_repo)
-	s.tab_service = services.NewTabService(tab_repo)
-	s.message_service = services.NewMessageService(message_repo, s.tab_service)
-	s.server_service = services.NewServerService(server_repo, s.user_service, s.tab_service)
-
-	s.conn_manager = services.NewConnManager(s.message_service, s.tab_service, s.server_service)
-	go s.conn_manager.HandleIncomingMessages()
-
-	s.user_controller = controllers.NewUserController(s.user_service)
-	s.tab_controller = controllers.NewTabController(s.tab_service)
-	s.message_controller = controllers.NewMessageController(s.message_service)
-	s.server_controller = controllers.NewServerController(s.server_service)
-}
-
-func (s *APIServer) SetupDummyData() {
-	usernames := []string{"nikos", "maria", "rinos", "nisfa", "gkai", "mitsos"}
-	user_ids := []uuid.UUID{}
-	for _, username := range usernames {
-
-		user, err := s.user_service.GetByTestUsername(username)
+	if pool := storage.Pool(s.db); pool != nil {
+		err := metrics.RegisterDBStats(pool)
 		if err != nil {
-			if !errors.Is(err, models.ErrUserNotFound) {
-				log.Warn("%s", err)
-				continue
-			}
-
-		}
-		if len(user) != 0 {
-			user_ids = append(user_ids, user[0].Id)
-			continue
-		}
-
-		id, err := s.user_service.Create(&repositories.UserDBO{Username: username, Password: "123", DateCreated: time.Now(), IsTest: true})
-		if err != nil {
-			log.Warn("%s", err)
+			log.Error("on registering the database pool metrics: %s", err)
 		}
-		user_ids = append(user_ids, id)
 	}
-
-	servers := []struct {
-		Name     string
-		User_ids []int
-	}{
-		{
-			Name:     "Gamiades",
-			User_ids: []int{0, 1, 2},
-		},
-		{
-			Name:     "HUA",
-			User_ids: []int{3, 4, 5},
-		},
-		{
-			Name:     "CTF",
-			User_ids: []int{1, 3, 5},
-		},
-		{
-			Name:     "ArchUsers",
-			User_ids: []int{0, 2, 4},
-		},
+	app.Get(MetricsPath, adaptor.HTTPHandler(promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{})))
+	app.Get(HealthPath, s.health_controller.Health)
+	app.Get(ReadyPath, s.health_controller.Ready)
+	if token := common.Config.HTTP.AdminToken; token != "" {
+		admin := app.Group(AdminPath, middleware.AdminToken(token))
+		admin.Get(AdminConnectionsPath, s.admin_controller.Connections)
+		admin.Post(AdminUsersPath+"/:id/disable", s.adminSetUserDisabled(true))
+		admin.Post(AdminUsersPath+"/:id/enable", s.adminSetUserDisabled(false))
+		admin.Post(AdminUsersPath+"/:id/password", s.adminResetPassword)
+		admin.Put(AdminServersPath+"/:id/members/:user_id", s.adminSetMember)
+		admin.Delete(AdminServersPath+"/:id/members/:user_id", s.adminSetMember)
 	}
-	server_ids := []uuid.UUID{}
-	for _, ser := range servers {
-		server, err := s.server_service.GetByTestName(ser.Name)
-		if err != nil {
-			if !errors.Is(err, models.ErrServerNotFound) {
-				log.Warn("%s", err)
-				continue
-			}
-		}
-		if len(server) != 0 {
-			server_ids = append(server_ids, server[0].Id)
-			continue
-		}
 
-		id, err := s.server_service.Create(&repositories.ServerDBO{Name: ser.Name, DateCreated: time.Now(), IsTest: true})
-		if err != nil {
-			log.Warn("%s", err)
-		}
-		server_ids = append(server_ids, id)
+	v1 := app.Group(APIBasePath, rate_limit)
+	doc := openapi.New("chatter", APIVersion, APIBasePath)
+	doc.Register(v1, s.Routes())
+	v1.Get(OpenAPIPath, func(c *fiber.Ctx) error {
+		return c.JSON(doc)
+	})
 
-		for _, idx := range ser.User_ids {
-			user_id := user_ids[idx]
-			err := s.server_service.AddUserToServer(user_id, id)
-			if err != nil {
-				log.Warn("%s", err)
-			}
+	err := doc.CheckRoutes(app, APIBasePath, OpenAPIPath)
+	if err != nil {
+		if build.DEBUG_MODE {
+			log.Fatal("%s", err)
 		}
+		log.Error("%s", err)
 	}
 
-	tabs := []struct {
-		Name        string
-		Servers_idx []int
-	}{
-		{Name: "General", Servers_idx: []int{0, 1, 2}},
-		{Name: "Memes", Servers_idx: []int{0, 1, 2, 3}},
-		{Name: "Studying", Servers_idx: []int{2, 3}},
-	}
+	return app
+}
 
-	for _, t := range tabs {
-		_, err := s.tab_service.GetByName(t.Name)
+// Authenticates a websocket upgrade through the session cookie like middleware.WithActiveUser.
+//
+// In debug builds the user can also be picked with the uid query param.
+func (s *APIServer) wsAuth(c *fiber.Ctx) error {
+	var id uuid.UUID
+	session, err := common.ReadSession(c)
+	if err == nil {
+		id = session.UserId
+		err = s.user_service.CheckSession(session)
+	} else if build.DEBUG_MODE && c.Query("uid") != "" {
+		id, err = uuid.Parse(c.Query("uid"))
 		if err != nil {
-			if errors.Is(err, models.ErrTabNotFound) {
-				continue
-			}
-			log.Warn("%s", err)
-			continue
-
+			return common.JSONErr(c, fmt.Errorf("%w: uid param is not a valid uuid: `%s`", common.ErrInvalidParam, c.Query("uid")))
 		}
+		err = s.user_service.CheckActive(id)
+	}
+	if errors.Is(err, models.ErrUserNotFound) {
+		err = common.ErrUnauthorized
+	}
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
 
-		for _, idx := range t.Servers_idx {
-			server_id := server_ids[idx]
-			tabs, err := s.server_service.GetTabs(server_id)
-			if err != nil {
-				log.Warn("%s", err)
-				continue
-			}
+	c.Locals(common.LocalsUserId, id)
+	return c.Next()
+}
 
-			if slices.ContainsFunc(tabs, func(tab models.Tab) bool {
-				return tab.Name == t.Name
-			}) {
-				continue
-			}
+// Builds the services and controllers, then starts the workers serving needs:
+// the loop storing websocket messages and the thumbnail worker.
+func (s *APIServer) DependencyInjection() {
+	s.BuildServices()
+	go s.conn_manager.HandleIncomingMessages()
+	go s.thumbnail_service.Run()
+}
 
-			_, err = s.tab_service.Create(&repositories.TabDBO{Name: t.Name, ServerId: server_id, DateCreated: time.Now()})
-			if err != nil {
-				log.Warn("%s", err)
-			}
+// Builds the services and controllers without starting any worker,
+// for the commands that work on the storage without serving it.
+func (s *APIServer) BuildServices() {
+	repos, err := repositories.NewRepositories(s.db)
+	if err != nil {
+		log.Fatal("%s", err)
+	}
 
-		}
+	s.user_service = services.NewUserService(repos.User, repos, s.blobs, APIBasePath+AvatarPath)
+	s.tab_service = services.NewTabService(repos.Tab, repos.Server, repos, s.blobs)
+	s.message_service = services.NewMessageService(repos.Message, repos.Attachment, repos.Server, repos, s.user_service, s.tab_service, APIBasePath+AttachmentPath, common.Config.Limits.MessageMaxLength)
+	s.server_service = services.NewServerService(repos.Server, repos, s.blobs, s.user_service, s.tab_service)
+	s.read_state_service = services.NewReadStateService(repos.ReadState, repos.Server, repos, s.user_service, s.tab_service, s.message_service)
+	s.seed_service = services.NewSeedService(repos, s.user_service, s.server_service, s.tab_service, s.message_service)
+	s.export_service = services.NewExportService(s.server_service, s.tab_service, s.message_service)
+
+	s.rate_limit_service = services.NewRateLimitService(repos.RateLimit, repos.Server, s.tab_service)
+
+	s.presence_service = services.NewPresenceService()
+	s.typing_service = services.NewTypingService()
+	s.conn_manager = services.NewConnManager(s.message_service, s.tab_service, s.server_service, s.presence_service, s.typing_service, s.rate_limit_service, int64(common.Config.Limits.WSMaxFrameSize))
+
+	s.thumbnail_service = services.NewThumbnailService(repos.Attachment, s.blobs, s.conn_manager)
+	s.attachment_service = services.NewAttachmentService(repos.Attachment, repos.Server, repos, s.blobs, s.tab_service, s.message_service, s.thumbnail_service, s.rate_limit_service)
+	s.profile_service = services.NewProfileService(repos.User, s.blobs, s.user_service)
+	s.health_service = services.NewHealthService(s.db, s.conn_manager)
+
+	s.user_controller = controllers.NewUserController(s.user_service, s.server_service, s.conn_manager)
+	s.tab_controller = controllers.NewTabController(s.tab_service, s.read_state_service, s.conn_manager)
+	s.message_controller = controllers.NewMessageController(s.message_service, s.tab_service, s.read_state_service, s.rate_limit_service, s.conn_manager)
+	s.server_controller = controllers.NewServerController(s.server_service, s.user_service, s.presence_service, s.read_state_service, s.conn_manager)
+	s.attachment_controller = controllers.NewAttachmentController(s.attachment_service, s.message_service, s.conn_manager)
+	s.profile_controller = controllers.NewProfileController(s.profile_service, s.user_service, s.conn_manager)
+	s.health_controller = controllers.NewHealthController(s.health_service)
+	s.admin_controller = controllers.NewAdminController(s.conn_manager)
+}
+
+// Seeds the storage with the fixture file at path, or the embedded dummy fixture when path is empty,
+// skipping whatever already exists.
+func (s *APIServer) Seed(path string) error {
+	var f *services.Fixture
+	var err error
+	if path == "" {
+		f, err = services.LoadFixtureFS(db.FS, db.DummyFixture)
+	} else {
+		f, err = services.LoadFixture(path)
 	}
+	if err != nil {
+		return err
+	}
+
+	return s.seed_service.Seed(f)
+}
+
+// Deletes all test data.
+//
+// Returns the number of deleted users and servers.
+func (s *APIServer) PurgeTestData() (int64, int64, error) {
+	return s.seed_service.PurgeTestData()
 }
@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/blob"
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/storage"
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Sets up the whole API over memory storage and local blobs in a temporary directory,
+// shut down when the test ends.
+func newTestAPI(t *testing.T) (*APIServer, *fiber.App) {
+	t.Helper()
+	common.Config.Blob.Path = t.TempDir()
+
+	s := NewAPIServer(storage.NewMemoryStorage(), blob.NewLocalStore())
+	app := s.SetupServer()
+	t.Cleanup(func() { s.Shutdown(app) })
+	return s, app
+}
+
+// Sends body as JSON to path under APIBasePath, with the session cookie when it isn't empty.
+//
+// Returns the response and its body.
+func request(t *testing.T, app *fiber.App, method string, path string, body any, session string) (*http.Response, []byte) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, APIBasePath+path, reader)
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if session != "" {
+		req.AddCookie(&http.Cookie{Name: common.CookieMessangerId, Value: session})
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, data
+}
+
+// Logs in and returns the session cookie
+func login(t *testing.T, app *fiber.App, username string, password string) string {
+	t.Helper()
+	resp, body := request(t, app, fiber.MethodPost, "/user/login", map[string]string{"username": username, "password": password}, "")
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected %s to log in, got %d: %s", username, resp.StatusCode, body)
+	}
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == common.CookieMessangerId {
+			return cookie.Value
+		}
+	}
+	t.Fatalf("login of %s set no session cookie", username)
+	return ""
+}
+
+// Creates a user with the password 123
+func newTestUser(t *testing.T, s *APIServer, username string) uuid.UUID {
+	t.Helper()
+	id, err := s.user_service.Create(&models.User{Username: username, DateCreated: time.Now()}, "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// Creates a server owned by owner_id with the members, and returns it with the id of its General tab
+func newTestServer(t *testing.T, s *APIServer, name string, owner_id uuid.UUID, member_ids ...uuid.UUID) (uuid.UUID, uuid.UUID) {
+	t.Helper()
+	server_id, err := s.server_service.CreateWithOwner(&models.Server{Name: name}, owner_id, member_ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tabs, err := s.server_service.GetTabs(server_id)
+	if err != nil || len(tabs) == 0 {
+		t.Fatalf("expected the General tab of %s, got %v, %v", name, tabs, err)
+	}
+	return server_id, tabs[0].Id
+}
+
+// Serves app on a free local port and returns its base url
+func listen(t *testing.T, app *fiber.App) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	return "http://" + ln.Addr().String()
+}
+
+// Opens /ws/messages with the session cookie
+func dialMessages(t *testing.T, base string, session string) *websocket.Conn {
+	t.Helper()
+	header := http.Header{}
+	header.Set("Cookie", common.CookieMessangerId+"="+session)
+	conn, _, err := websocket.DefaultDialer.Dial(strings.Replace(base, "http", "ws", 1)+"/ws/messages", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// Sends an op over the websocket
+func sendOp(t *testing.T, conn *websocket.Conn, op string, data any) {
+	t.Helper()
+	raw, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = conn.WriteJSON(models.ClientOp{Op: op, Data: raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Reads events until one of the type arrives, failing after 5 seconds
+func readEvent(t *testing.T, conn *websocket.Conn, event_type string) json.RawMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	defer conn.SetReadDeadline(time.Time{})
+	for {
+		event := struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}{}
+		err := conn.ReadJSON(&event)
+		if err != nil {
+			t.Fatalf("waiting for a %s event: %s", event_type, err)
+		}
+		if event.Type == event_type {
+			return event.Data
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/NikosGour/chatter/internal/blob"
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Sends the file as the multipart field named field, with the other fields, under APIBasePath.
+//
+// Returns the response and its body.
+func upload(t *testing.T, app *fiber.App, method string, path string, fields map[string]string, field string, filename string, data []byte, session string) (*http.Response, []byte) {
+	t.Helper()
+	form := &bytes.Buffer{}
+	w := multipart.NewWriter(form)
+	for name, value := range fields {
+		w.WriteField(name, value)
+	}
+	f, err := w.CreateFormFile(field, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(data)
+	w.Close()
+
+	req := httptest.NewRequest(method, APIBasePath+path, form)
+	req.Header.Set(fiber.HeaderContentType, w.FormDataContentType())
+	req.AddCookie(&http.Cookie{Name: common.CookieMessangerId, Value: session})
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+// Attaches a text file to a new message in the tab, with a thumbnail blob of its own.
+//
+// Returns the blob keys of the attachment.
+func attach(t *testing.T, s *APIServer, app *fiber.App, session string, tab_id uuid.UUID) []string {
+	t.Helper()
+	resp, body := upload(t, app, fiber.MethodPost, "/message/attachments", map[string]string{"tab_id": tab_id.String()}, "files", "notes.txt", []byte("kalhspera"), session)
+	msg := models.Message{}
+	json.Unmarshal(body, &msg)
+	if resp.StatusCode != fiber.StatusOK || len(msg.Attachments) != 1 {
+		t.Fatalf("expected the attachment to be stored, got %d: %s", resp.StatusCode, body)
+	}
+
+	id := msg.Attachments[0].Id
+	err := s.blobs.Put("thumbnails/"+id.String(), strings.NewReader("thumbnail"), 9, "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []string{"attachments/" + id.String(), "thumbnails/" + id.String()}
+}
+
+func expectBlobs(t *testing.T, s *APIServer, keys []string, exist bool) {
+	t.Helper()
+	for _, key := range keys {
+		r, err := s.blobs.Get(key)
+		if err == nil {
+			r.Close()
+		}
+		if exist && err != nil {
+			t.Fatalf("expected %s to be kept, got %s", key, err)
+		}
+		if !exist && !errors.Is(err, blob.ErrBlobNotFound) {
+			t.Fatalf("expected %s to be deleted, got %v", key, err)
+		}
+	}
+}
+
+func TestDeletesRemoveBlobs(t *testing.T) {
+	s, app := newTestAPI(t)
+
+	nikos := newTestUser(t, s, "nikos")
+	maria := newTestUser(t, s, "maria")
+	server_id, tab_id := newTestServer(t, s, "Gamiades", nikos, maria)
+	_, other_tab_id := newTestServer(t, s, "Kafeneio", nikos, maria)
+	owner := login(t, app, "nikos", "123")
+	member := login(t, app, "maria", "123")
+
+	other_tab := models.Tab{Name: "Offtopic", ServerId: server_id}
+	resp, body := request(t, app, fiber.MethodPost, "/tab", other_tab, owner)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected the tab to be created, got %d: %s", resp.StatusCode, body)
+	}
+	json.Unmarshal(body, &other_tab.Id)
+
+	in_tab := attach(t, s, app, owner, other_tab.Id)
+	in_server := attach(t, s, app, owner, tab_id)
+	by_member := attach(t, s, app, member, other_tab_id)
+	kept := attach(t, s, app, owner, other_tab_id)
+
+	resp, body = request(t, app, fiber.MethodDelete, "/tab/"+other_tab.Id.String(), nil, owner)
+	if resp.StatusCode != fiber.StatusNoContent {
+		t.Fatalf("expected the tab to be deleted, got %d: %s", resp.StatusCode, body)
+	}
+	expectBlobs(t, s, in_tab, false)
+	expectBlobs(t, s, in_server, true)
+
+	resp, body = request(t, app, fiber.MethodDelete, "/server/"+server_id.String(), nil, owner)
+	if resp.StatusCode != fiber.StatusNoContent {
+		t.Fatalf("expected the server to be deleted, got %d: %s", resp.StatusCode, body)
+	}
+	expectBlobs(t, s, in_server, false)
+	expectBlobs(t, s, by_member, true)
+
+	var avatar bytes.Buffer
+	err := png.Encode(&avatar, image.NewRGBA(image.Rect(0, 0, 8, 8)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, body = upload(t, app, fiber.MethodPut, "/user/me/avatar", nil, "avatar", "me.png", avatar.Bytes(), member)
+	profile := models.Profile{}
+	json.Unmarshal(body, &profile)
+	if resp.StatusCode != fiber.StatusOK || profile.AvatarUrl == "" {
+		t.Fatalf("expected the avatar to be stored, got %d: %s", resp.StatusCode, body)
+	}
+
+	resp, body = request(t, app, fiber.MethodDelete, "/user/"+maria.String(), nil, member)
+	if resp.StatusCode != fiber.StatusNoContent {
+		t.Fatalf("expected the user to be deleted, got %d: %s", resp.StatusCode, body)
+	}
+	expectBlobs(t, s, append(by_member, "avatars/"+path.Base(profile.AvatarUrl)), false)
+	expectBlobs(t, s, kept, true)
+}
@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMemberRoutesAuthorization(t *testing.T) {
+	s, app := newTestAPI(t)
+
+	nikos := newTestUser(t, s, "nikos")
+	maria := newTestUser(t, s, "maria")
+	eve := newTestUser(t, s, "eve")
+	server_id, tab_id := newTestServer(t, s, "Gamiades", nikos, maria)
+
+	owner := login(t, app, "nikos", "123")
+	member := login(t, app, "maria", "123")
+	outsider := login(t, app, "eve", "123")
+
+	new_tab := models.Tab{Name: "Offtopic", ServerId: server_id}
+	add_eve := map[string]any{"user_id": eve}
+	message := models.Message{Text: "kalhspera", Tab: &models.Tab{Id: tab_id}, DateSent: time.Now()}
+
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		body    any
+		session string
+		status  int
+	}{
+		{"tab without a session", fiber.MethodPost, "/tab", new_tab, "", fiber.StatusUnauthorized},
+		{"tab by a member", fiber.MethodPost, "/tab", new_tab, member, fiber.StatusForbidden},
+		{"tab by the owner", fiber.MethodPost, "/tab", new_tab, owner, fiber.StatusOK},
+		{"tab without a name", fiber.MethodPost, "/tab", models.Tab{ServerId: server_id}, owner, fiber.StatusUnprocessableEntity},
+		{"tab without a server", fiber.MethodPost, "/tab", models.Tab{Name: "Offtopic"}, owner, fiber.StatusUnprocessableEntity},
+		{"member add without a session", fiber.MethodPost, "/server/" + server_id.String(), add_eve, "", fiber.StatusUnauthorized},
+		{"member add by an outsider", fiber.MethodPost, "/server/" + server_id.String(), add_eve, outsider, fiber.StatusForbidden},
+		{"member add by a member", fiber.MethodPost, "/server/" + server_id.String(), add_eve, member, fiber.StatusForbidden},
+		{"message without a session", fiber.MethodPost, "/message", message, "", fiber.StatusUnauthorized},
+		{"message by an outsider", fiber.MethodPost, "/message", message, outsider, fiber.StatusForbidden},
+		{"message by a member", fiber.MethodPost, "/message", message, member, fiber.StatusOK},
+		{"member add by the owner", fiber.MethodPost, "/server/" + server_id.String(), add_eve, owner, fiber.StatusOK},
+		{"message by the added member", fiber.MethodPost, "/message", message, outsider, fiber.StatusOK},
+	}
+	for _, tc := range cases {
+		resp, body := request(t, app, tc.method, tc.path, tc.body, tc.session)
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s: expected %d, got %d: %s", tc.name, tc.status, resp.StatusCode, body)
+		}
+	}
+
+	tabs, err := s.server_service.GetTabs(server_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tabs) != 2 {
+		t.Fatalf("expected only the owner's tab to be created, got %#v", tabs)
+	}
+	for _, tab := range tabs {
+		if tab.DateCreated.IsZero() {
+			t.Fatalf("expected %s to be stored with its creation date", tab.Name)
+		}
+	}
+}
+
+func TestMessageReadAuthorization(t *testing.T) {
+	s, app := newTestAPI(t)
+
+	nikos := newTestUser(t, s, "nikos")
+	maria := newTestUser(t, s, "maria")
+	newTestUser(t, s, "eve")
+	_, tab_id := newTestServer(t, s, "Gamiades", nikos, maria)
+	_, other_tab_id := newTestServer(t, s, "Kafeneio", nikos)
+
+	message_id, err := s.message_service.Create(&models.Message{Text: "kalhspera", Sender: &models.User{Id: nikos}, Tab: &models.Tab{Id: tab_id}, DateSent: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.message_service.Create(&models.Message{Text: "kalhnyxta", Sender: &models.User{Id: nikos}, Tab: &models.Tab{Id: other_tab_id}, DateSent: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	member := login(t, app, "maria", "123")
+	outsider := login(t, app, "eve", "123")
+
+	message_path := "/message/" + strconv.FormatInt(message_id, 10)
+	tab_path := "/message/tab/" + tab_id.String()
+	cases := []struct {
+		name    string
+		path    string
+		session string
+		status  int
+	}{
+		{"messages without a session", "/message", "", fiber.StatusUnauthorized},
+		{"message without a session", message_path, "", fiber.StatusUnauthorized},
+		{"message by an outsider", message_path, outsider, fiber.StatusForbidden},
+		{"message by a member", message_path, member, fiber.StatusOK},
+		{"tab messages without a session", tab_path, "", fiber.StatusUnauthorized},
+		{"tab messages by an outsider", tab_path, outsider, fiber.StatusForbidden},
+		{"tab messages by a member", tab_path, member, fiber.StatusOK},
+	}
+	for _, tc := range cases {
+		resp, body := request(t, app, fiber.MethodGet, tc.path, nil, tc.session)
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s: expected %d, got %d: %s", tc.name, tc.status, resp.StatusCode, body)
+		}
+	}
+
+	// Only the messages of the servers one is a member of are listed
+	expected := map[string][]int64{member: {message_id}, outsider: {}}
+	for session, message_ids := range expected {
+		resp, body := request(t, app, fiber.MethodGet, "/message", nil, session)
+		if resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", resp.StatusCode, body)
+		}
+		messages := []models.Message{}
+		err = json.Unmarshal(body, &messages)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []int64{}
+		for _, m := range messages {
+			ids = append(ids, m.Id)
+		}
+		if !slices.Equal(ids, message_ids) {
+			t.Fatalf("expected the messages %v, got %v", message_ids, ids)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// Package blob stores the files uploaded to chatter, apart from the database.
+package blob
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/logging/log"
+)
+
+var (
+	ErrBlobNotFound = common.NewAPIError(http.StatusNotFound, "blob_not_found", "blob not found")
+)
+
+const (
+	DriverLocal = "local"
+	DriverS3    = "s3"
+)
+
+// Store is implemented by every backend blobs can be kept on.
+//
+// Keys are slash separated paths, e.g. attachments/<id>.
+type Store interface {
+	Put(key string, r io.Reader, size int64, content_type string) error
+	// Might return ErrBlobNotFound
+	Get(key string) (io.ReadCloser, error)
+	// Deleting a missing blob is not an error
+	Delete(key string) error
+}
+
+// Opens the backend selected by blob.driver.
+func NewStore() Store {
+	driver := common.Config.Blob.Driver
+	switch driver {
+	case DriverLocal:
+		return NewLocalStore()
+	case DriverS3:
+		return NewS3Store()
+	}
+
+	log.Fatal("unknown blob driver `%s`", driver)
+	return nil
+}
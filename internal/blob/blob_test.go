@@ -0,0 +1,100 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+)
+
+func TestLocalStore(t *testing.T) {
+	common.Config.Blob.Path = t.TempDir()
+	testStore(t, NewLocalStore())
+}
+
+// Runs against the minio at MINIO_ENDPOINT, host:port like the minio service of docker-compose.yaml,
+// with MINIO_ACCESS_KEY and MINIO_SECRET_KEY or minio's default credentials.
+// A bucket is created for the test and removed after it.
+func TestS3Store(t *testing.T) {
+	endpoint := os.Getenv("MINIO_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("MINIO_ENDPOINT is not set")
+	}
+	cfg := common.S3Config{Endpoint: endpoint, AccessKey: "minioadmin", SecretKey: "minioadmin", Bucket: "chatter-test-" + uuid.NewString()}
+	if key := os.Getenv("MINIO_ACCESS_KEY"); key != "" {
+		cfg.AccessKey = key
+	}
+	if key := os.Getenv("MINIO_SECRET_KEY"); key != "" {
+		cfg.SecretKey = key
+	}
+	common.Config.Blob.S3 = cfg
+
+	st := NewS3Store()
+	t.Cleanup(func() {
+		err := st.client.RemoveBucketWithOptions(context.Background(), st.bucket, minio.RemoveBucketOptions{ForceDelete: true})
+		if err != nil {
+			t.Errorf("on removing bucket %s: %s", st.bucket, err)
+		}
+	})
+	testStore(t, st)
+}
+
+func testStore(t *testing.T, st Store) {
+	key := "attachments/" + uuid.NewString()
+	data := bytes.Repeat([]byte("kalhspera"), 1<<10)
+
+	_, err := st.Get(key)
+	if !errors.Is(err, ErrBlobNotFound) {
+		t.Fatalf("expected a missing blob to be ErrBlobNotFound, got %v", err)
+	}
+
+	err = st.Put(key, bytes.NewReader(data), int64(len(data)), "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectBlob(t, st, key, data)
+
+	// Putting again replaces the blob
+	err = st.Put(key, strings.NewReader("kalhnuxta"), int64(len("kalhnuxta")), "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectBlob(t, st, key, []byte("kalhnuxta"))
+
+	err = st.Delete(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.Get(key)
+	if !errors.Is(err, ErrBlobNotFound) {
+		t.Fatalf("expected a deleted blob to be ErrBlobNotFound, got %v", err)
+	}
+	err = st.Delete(key)
+	if err != nil {
+		t.Fatalf("expected deleting a missing blob to succeed, got %s", err)
+	}
+}
+
+func expectBlob(t *testing.T, st Store, key string, data []byte) {
+	t.Helper()
+	r, err := st.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("expected %d bytes back from %s, got %d", len(data), key, len(got))
+	}
+}
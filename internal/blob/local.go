@@ -0,0 +1,103 @@
+package blob
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/logging/log"
+)
+
+// Keeps blobs as files under the blob.path directory.
+type LocalStore struct {
+	root string
+}
+
+func NewLocalStore() *LocalStore {
+	root := common.Config.Blob.Path
+	err := os.MkdirAll(root, 0o750)
+	if err != nil {
+		log.Fatal("%s", err)
+	}
+
+	st := &LocalStore{root: root}
+	return st
+}
+
+// Writes to a temporary file first, a blob is either missing or complete.
+func (st *LocalStore) Put(key string, r io.Reader, size int64, content_type string) error {
+	path, err := st.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o750)
+	if err != nil {
+		return fmt.Errorf("on MkdirAll(%s): %w", key, err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("on CreateTemp(%s): %w", key, err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("on writing blob `%s`: %w", key, err)
+	}
+	err = f.Close()
+	if err != nil {
+		return fmt.Errorf("on closing blob `%s`: %w", key, err)
+	}
+
+	err = os.Rename(f.Name(), path)
+	if err != nil {
+		return fmt.Errorf("on Rename(%s): %w", key, err)
+	}
+	return nil
+}
+
+// Might return ErrBlobNotFound
+func (st *LocalStore) Get(key string) (io.ReadCloser, error) {
+	path, err := st.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w:%s", ErrBlobNotFound, key)
+		}
+		return nil, fmt.Errorf("on Open(%s): %w", key, err)
+	}
+	return f, nil
+}
+
+func (st *LocalStore) Delete(key string) error {
+	path, err := st.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("on Remove(%s): %w", key, err)
+	}
+	return nil
+}
+
+// Keys are made by the services, this only guards against one escaping the root
+func (st *LocalStore) path(key string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(key)) || strings.HasPrefix(filepath.Base(key), ".") {
+		return "", fmt.Errorf("%w: invalid blob key `%s`", ErrBlobNotFound, key)
+	}
+	return filepath.Join(st.root, filepath.FromSlash(key)), nil
+}
@@ -0,0 +1,87 @@
+package blob
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/logging/log"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Keeps blobs in a bucket of any S3 compatible service, e.g. the minio service of docker-compose.yaml.
+type S3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+func NewS3Store() *S3Store {
+	st := &S3Store{}
+	st.init_bucket()
+	return st
+}
+
+func (st *S3Store) init_bucket() {
+	cfg := common.Config.Blob.S3
+	st.bucket = cfg.Bucket
+
+	var err error
+	st.client, err = minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+	})
+	if err != nil {
+		log.Fatal("%s", err)
+	}
+
+	ctx := context.Background()
+	exists, err := st.client.BucketExists(ctx, st.bucket)
+	if err != nil {
+		log.Fatal("on BucketExists(%s): %s", st.bucket, err)
+	}
+	if !exists {
+		err = st.client.MakeBucket(ctx, st.bucket, minio.MakeBucketOptions{})
+		if err != nil {
+			log.Fatal("on MakeBucket(%s): %s", st.bucket, err)
+		}
+		log.Info("created bucket `%s`", st.bucket)
+	}
+}
+
+func (st *S3Store) Put(key string, r io.Reader, size int64, content_type string) error {
+	_, err := st.client.PutObject(context.Background(), st.bucket, key, r, size, minio.PutObjectOptions{ContentType: content_type})
+	if err != nil {
+		return fmt.Errorf("on PutObject(%s): %w", key, err)
+	}
+	return nil
+}
+
+// Might return ErrBlobNotFound
+func (st *S3Store) Get(key string) (io.ReadCloser, error) {
+	ctx := context.Background()
+
+	// GetObject is lazy, Stat makes a missing key fail here instead of on the first Read
+	_, err := st.client.StatObject(ctx, st.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == minio.NoSuchKey {
+			return nil, fmt.Errorf("%w:%s", ErrBlobNotFound, key)
+		}
+		return nil, fmt.Errorf("on StatObject(%s): %w", key, err)
+	}
+
+	obj, err := st.client.GetObject(ctx, st.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("on GetObject(%s): %w", key, err)
+	}
+	return obj, nil
+}
+
+func (st *S3Store) Delete(key string) error {
+	err := st.client.RemoveObject(context.Background(), st.bucket, key, minio.RemoveObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("on RemoveObject(%s): %w", key, err)
+	}
+	return nil
+}
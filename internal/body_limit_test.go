@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// A JSON body of about size bytes
+func largeJSON(size int) string {
+	return `{"username": "nikos", "password": "123", "padding": "` + strings.Repeat("a", size) + `"}`
+}
+
+// POST /user/login with body, sent in chunks without a Content-Length when chunked
+func loginRequest(body string, chunked bool) *http.Request {
+	req := httptest.NewRequest(fiber.MethodPost, APIBasePath+"/user/login", strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if chunked {
+		req.ContentLength = -1
+		req.TransferEncoding = []string{"chunked"}
+	}
+	return req
+}
+
+func TestBodyLimit(t *testing.T) {
+	s, app := newTestAPI(t)
+
+	nikos := newTestUser(t, s, "nikos")
+	_, tab_id := newTestServer(t, s, "Gamiades", nikos)
+	session := login(t, app, "nikos", "123")
+
+	// Over the default limit on any other route, whether its length is known or not
+	for _, chunked := range []bool{false, true} {
+		req := loginRequest(largeJSON(fiber.DefaultBodyLimit), chunked)
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := common.ErrorResponse{}
+		json.NewDecoder(resp.Body).Decode(&res)
+		if resp.StatusCode != fiber.StatusRequestEntityTooLarge || res.Code != common.ErrBodyTooLarge.Code {
+			t.Fatalf("expected %d %s, got %d %#v", fiber.StatusRequestEntityTooLarge, common.ErrBodyTooLarge.Code, resp.StatusCode, res)
+		}
+	}
+
+	// Under it, without a known length
+	resp, err := app.Test(loginRequest(largeJSON(1<<10), true), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected a chunked body under the limit to be read, got %d", resp.StatusCode)
+	}
+
+	// Attachments can go over it
+	form := &bytes.Buffer{}
+	w := multipart.NewWriter(form)
+	w.WriteField("tab_id", tab_id.String())
+	f, err := w.CreateFormFile("files", "large.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(bytes.Repeat([]byte{1}, fiber.DefaultBodyLimit+1<<20))
+	w.Close()
+
+	req := httptest.NewRequest(fiber.MethodPost, APIBasePath+"/message/attachments", form)
+	req.Header.Set(fiber.HeaderContentType, w.FormDataContentType())
+	req.AddCookie(&http.Cookie{Name: common.CookieMessangerId, Value: session})
+	resp, err = app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := models.Message{}
+	json.NewDecoder(resp.Body).Decode(&msg)
+	if resp.StatusCode != fiber.StatusOK || len(msg.Attachments) != 1 || msg.Attachments[0].Size != int64(fiber.DefaultBodyLimit+1<<20) {
+		t.Fatalf("expected the attachment over the default limit to be stored, got %d %#v", resp.StatusCode, msg)
+	}
+}
@@ -0,0 +1,448 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NikosGour/chatter/build"
+	"github.com/NikosGour/logging/log"
+	"github.com/go-playground/validator/v10"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// Read from the working directory when neither -config nor CHATTER_CONFIG name a file
+	defaultConfigFile = "chatter.yaml"
+	envConfigFile     = "CHATTER_CONFIG"
+	// Optional, its variables count as environment variables but don't override the real ones
+	envFile = ".env"
+	// Start of the files git-crypt encrypted
+	gitCryptHeader = "\x00GITCRYPT\x00"
+
+	// What secrets are printed as
+	maskedSecret = "********"
+)
+
+// Every setting of chatter.
+//
+// Settings are layered, each layer overriding the ones before it: the defaults, the config file,
+// the environment and the command line flags.
+// The env tag names the environment variable of a setting, flags are named after the yaml path, e.g. -http.port.
+// Durations are written like 1m30s, environment variables and flags also take plain seconds.
+type Configuration struct {
+	HTTP    HTTPConfig    `yaml:"http"`
+	Storage StorageConfig `yaml:"storage"`
+	Blob    BlobConfig    `yaml:"blob"`
+	Limits  LimitsConfig  `yaml:"limits"`
+	Log     LogConfig     `yaml:"log"`
+}
+
+type HTTPConfig struct {
+	Host string `yaml:"host" env:"HOST_ADDRESS"`
+	Port int    `yaml:"port" env:"PORT" validate:"min=1,max=65535"`
+	// Origins allowed to make cross origin requests, * for any
+	CORSOrigins []string `yaml:"cors_origins" env:"CORS_ORIGINS" validate:"min=1"`
+	// Served over HTTPS when both are set
+	TLSCertFile string `yaml:"tls_cert_file" env:"TLS_CERT_FILE" validate:"required_with=TLSKeyFile"`
+	TLSKeyFile  string `yaml:"tls_key_file" env:"TLS_KEY_FILE" validate:"required_with=TLSCertFile"`
+	// Key the session cookie is encrypted with, generated on every start when empty
+	CookieKey string `yaml:"cookie_key" env:"ENCRYPTCOOKIE_KEY" secret:"true"`
+	// How long after logging in a session ends
+	SessionMaxAge   time.Duration `yaml:"session_max_age" env:"SESSION_MAX_AGE" validate:"gt=0"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" validate:"gt=0"`
+	// Bearer token of the admin API, which is off when empty
+	AdminToken string `yaml:"admin_token" env:"ADMIN_TOKEN" secret:"true"`
+	// Header a reverse proxy puts the client address in, e.g. X-Real-IP, clients are told apart
+	// by the address they connect from when empty. With X-Forwarded-For the first address counts,
+	// so the proxy has to overwrite it rather than append to it.
+	ProxyHeader string `yaml:"proxy_header" env:"PROXY_HEADER"`
+	// Addresses or CIDR ranges of the proxies the header is taken from, required with it
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES" validate:"dive,ip|cidr"`
+}
+
+type StorageConfig struct {
+	Driver     string         `yaml:"driver" env:"STORAGE_DRIVER" validate:"oneof=postgres sqlite memory"`
+	SQLitePath string         `yaml:"sqlite_path" env:"SQLITE_PATH" validate:"required"`
+	Postgres   PostgresConfig `yaml:"postgres"`
+
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS" validate:"min=1"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS" validate:"min=0,ltefield=MaxOpenConns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME" validate:"min=0"`
+	// How long to keep trying to connect at startup
+	ConnectTimeout time.Duration `yaml:"connect_timeout" env:"DB_CONNECT_TIMEOUT" validate:"gt=0"`
+}
+
+type PostgresConfig struct {
+	Host     string `yaml:"host" env:"POSTGRES_HOST_ADDRESS"`
+	Port     int    `yaml:"port" env:"POSTGRES_PORT" validate:"min=1,max=65535"`
+	User     string `yaml:"user" env:"POSTGRES_USER"`
+	Password string `yaml:"password" env:"POSTGRES_ROOT_PASSWORD" secret:"true"`
+	Database string `yaml:"database" env:"POSTGRES_DB"`
+}
+
+type BlobConfig struct {
+	Driver string   `yaml:"driver" env:"BLOB_DRIVER" validate:"oneof=local s3"`
+	Path   string   `yaml:"path" env:"BLOB_PATH" validate:"required"`
+	S3     S3Config `yaml:"s3"`
+}
+
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint" env:"S3_ENDPOINT"`
+	AccessKey string `yaml:"access_key" env:"S3_ACCESS_KEY" secret:"true"`
+	SecretKey string `yaml:"secret_key" env:"S3_SECRET_KEY" secret:"true"`
+	Bucket    string `yaml:"bucket" env:"S3_BUCKET" validate:"required"`
+	UseSSL    bool   `yaml:"use_ssl" env:"S3_USE_SSL"`
+}
+
+type LimitsConfig struct {
+	// Characters in the text of a message
+	MessageMaxLength int `yaml:"message_max_length" env:"MESSAGE_MAX_LENGTH" validate:"min=1"`
+	// Bytes in a websocket frame, larger ones close the connection
+	WSMaxFrameSize int `yaml:"ws_max_frame_size" env:"WS_MAX_FRAME_SIZE" validate:"min=1024"`
+}
+
+type LogConfig struct {
+	Level string `yaml:"level" env:"LOG_LEVEL" validate:"oneof=debug info warn error"`
+}
+
+// The settings in effect, the defaults until LoadConfig
+var Config = DefaultConfig()
+
+var configValidate = newConfigValidator()
+
+func DefaultConfig() *Configuration {
+	level := "info"
+	if build.DEBUG_MODE {
+		level = "debug"
+	}
+
+	return &Configuration{
+		HTTP: HTTPConfig{
+			Port:            8080,
+			CORSOrigins:     []string{"*"},
+			SessionMaxAge:   30 * 24 * time.Hour,
+			ShutdownTimeout: 15 * time.Second,
+		},
+		Storage: StorageConfig{
+			Driver:     "postgres",
+			SQLitePath: "chatter.db",
+			Postgres: PostgresConfig{
+				Host:     "localhost",
+				Port:     5432,
+				User:     "postgres",
+				Database: "chatter",
+			},
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnectTimeout:  time.Minute,
+		},
+		Blob: BlobConfig{
+			Driver: "local",
+			Path:   "uploads",
+			S3:     S3Config{Bucket: "chatter"},
+		},
+		Limits: LimitsConfig{
+			MessageMaxLength: 4000,
+			WSMaxFrameSize:   64 << 10,
+		},
+		Log: LogConfig{Level: level},
+	}
+}
+
+// Loads the settings of every layer into Config and applies the log level.
+//
+// The flags are parsed out of args with fs, which can hold the flags of a command as well.
+// Besides one flag per setting, -config names the config file.
+func LoadConfig(fs *flag.FlagSet, args []string) error {
+	cfg := DefaultConfig()
+
+	config_file := fs.String("config", "", "`path` of the config file, "+envConfigFile+" or ./"+defaultConfigFile+" when unset")
+	for _, s := range settings(cfg) {
+		usage := "env " + s.env
+		if s.secret {
+			usage += ", secret"
+		}
+		fs.String(s.path, "", usage)
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	err = cfg.loadFile(*config_file)
+	if err != nil {
+		return err
+	}
+
+	dotenv, err := readDotenv(envFile)
+	if err != nil {
+		return err
+	}
+	for _, s := range settings(cfg) {
+		v, ok := os.LookupEnv(s.env)
+		if !ok {
+			v, ok = dotenv[s.env]
+		}
+		if !ok {
+			continue
+		}
+		err := s.set(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.env, err)
+		}
+	}
+
+	by_path := map[string]setting{}
+	for _, s := range settings(cfg) {
+		by_path[s.path] = s
+	}
+	var flag_err error
+	fs.Visit(func(f *flag.Flag) {
+		s, ok := by_path[f.Name]
+		if !ok || flag_err != nil {
+			return
+		}
+		err := s.set(f.Value.String())
+		if err != nil {
+			flag_err = fmt.Errorf("-%s: %w", f.Name, err)
+		}
+	})
+	if flag_err != nil {
+		return flag_err
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return err
+	}
+
+	Config = cfg
+	InitLogging()
+	return nil
+}
+
+// Checks every setting is valid and that the ones that go together are set together.
+func (c *Configuration) Validate() error {
+	err := configValidate.Struct(c)
+	var validation_errs validator.ValidationErrors
+	if errors.As(err, &validation_errs) {
+		msgs := []string{}
+		for _, fe := range validation_errs {
+			path := strings.TrimPrefix(fe.Namespace(), "Configuration.")
+			msgs = append(msgs, fmt.Sprintf("%s: %s, got `%v`", path, configErrorMessage(fe), fe.Value()))
+		}
+		return fmt.Errorf("invalid config: %s", strings.Join(msgs, "; "))
+	}
+	if err != nil {
+		return err
+	}
+
+	if c.HTTP.ProxyHeader != "" && len(c.HTTP.TrustedProxies) == 0 {
+		return errors.New("invalid config: http.trusted_proxies: is required with proxy_header")
+	}
+	if c.Blob.Driver == "s3" && c.Blob.S3.Endpoint == "" {
+		return errors.New("invalid config: blob.s3.endpoint: is required with the s3 blob driver")
+	}
+	return nil
+}
+
+// A copy of the settings with the secrets that are set masked, safe to print
+func (c *Configuration) Masked() *Configuration {
+	masked := *c
+	masked.HTTP.CORSOrigins = append([]string{}, c.HTTP.CORSOrigins...)
+	masked.HTTP.TrustedProxies = append([]string{}, c.HTTP.TrustedProxies...)
+	for _, s := range settings(&masked) {
+		if s.secret && s.value.String() != "" {
+			s.value.SetString(maskedSecret)
+		}
+	}
+	return &masked
+}
+
+// Whether the server is served over HTTPS
+func (c *HTTPConfig) TLS() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// Reads the variables of the .env file at path.
+//
+// Returns none when it doesn't exist, or when git-crypt hasn't decrypted it, as in a clone without the key
+func readDotenv(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("on reading %s: %w", path, err)
+	}
+	if bytes.HasPrefix(data, []byte(gitCryptHeader)) {
+		log.Warn("%s is encrypted with git-crypt, ignoring it until the repository is unlocked", path)
+		return nil, nil
+	}
+
+	dotenv, err := godotenv.UnmarshalBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("on parsing %s: %w", path, err)
+	}
+	return dotenv, nil
+}
+
+// Reads the config file over the settings.
+//
+// A file named by path or CHATTER_CONFIG has to exist, the default one doesn't.
+func (c *Configuration) loadFile(path string) error {
+	if path == "" {
+		path = os.Getenv(envConfigFile)
+	}
+	required := path != ""
+	if path == "" {
+		path = defaultConfigFile
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("on reading config file: %w", err)
+	}
+
+	d := yaml.NewDecoder(bytes.NewReader(data))
+	d.KnownFields(true)
+	err = d.Decode(c)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("on parsing config file `%s`: %w", path, err)
+	}
+	return nil
+}
+
+// A single setting of a Configuration
+type setting struct {
+	// Dotted yaml path, also the name of its flag
+	path   string
+	env    string
+	secret bool
+	value  reflect.Value
+}
+
+// Every setting of cfg, in the order they are declared
+func settings(cfg *Configuration) []setting {
+	return appendSettings(nil, "", reflect.ValueOf(cfg).Elem())
+}
+
+func appendSettings(list []setting, prefix string, v reflect.Value) []setting {
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		path := prefix + name
+
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeFor[time.Duration]() {
+			list = appendSettings(list, path+".", v.Field(i))
+			continue
+		}
+		list = append(list, setting{path: path, env: field.Tag.Get("env"), secret: field.Tag.Get("secret") == "true", value: v.Field(i)})
+	}
+	return list
+}
+
+// Sets the setting from the text of an environment variable or flag
+func (s setting) set(text string) error {
+	switch s.value.Interface().(type) {
+	case string:
+		s.value.SetString(text)
+	case int:
+		n, err := strconv.Atoi(text)
+		if err != nil {
+			return fmt.Errorf("not an integer: `%s`", text)
+		}
+		s.value.SetInt(int64(n))
+	case bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("not a bool: `%s`", text)
+		}
+		s.value.SetBool(b)
+	case time.Duration:
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			seconds, err := strconv.Atoi(text)
+			if err != nil {
+				return fmt.Errorf("not a duration or a number of seconds: `%s`", text)
+			}
+			d = time.Duration(seconds) * time.Second
+		}
+		s.value.SetInt(int64(d))
+	case []string:
+		list := []string{}
+		for _, item := range strings.Split(text, ",") {
+			item = strings.TrimSpace(item)
+			if item != "" {
+				list = append(list, item)
+			}
+		}
+		s.value.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported setting type %s", s.value.Type())
+	}
+	return nil
+}
+
+func configErrorMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "required_with":
+		return fmt.Sprintf("is required with %s", yamlFieldName(reflect.TypeFor[Configuration](), fe.Param()))
+	case "min":
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "max":
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "gt":
+		return fmt.Sprintf("must be more than %s", fe.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of %s", fe.Param())
+	case "ip|cidr":
+		return "must be an IP address or a CIDR range"
+	case "ltefield":
+		return fmt.Sprintf("must be at most %s", yamlFieldName(reflect.TypeFor[Configuration](), fe.Param()))
+	}
+	return fmt.Sprintf("failed on the `%s` rule", fe.Tag())
+}
+
+// The yaml name of the field named name anywhere in t, rules that compare fields name them by their Go name
+func yamlFieldName(t reflect.Type, name string) string {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if field.Name == name {
+			yaml_name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			return yaml_name
+		}
+		if field.Type.Kind() == reflect.Struct {
+			yaml_name := yamlFieldName(field.Type, name)
+			if yaml_name != name {
+				return yaml_name
+			}
+		}
+	}
+	return name
+}
+
+// Validation errors name settings by their yaml path
+func newConfigValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		return name
+	})
+	return v
+}
@@ -0,0 +1,80 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadDotenv(t *testing.T) {
+	dir := t.TempDir()
+
+	dotenv, err := readDotenv(filepath.Join(dir, ".env"))
+	if err != nil || len(dotenv) != 0 {
+		t.Fatalf("expected nothing from a missing .env, got %v, %v", dotenv, err)
+	}
+
+	plain := filepath.Join(dir, "plain.env")
+	err = os.WriteFile(plain, []byte("CHATTER_HTTP_PORT=9000\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dotenv, err = readDotenv(plain)
+	if err != nil || dotenv["CHATTER_HTTP_PORT"] != "9000" {
+		t.Fatalf("expected the variables of the .env, got %v, %v", dotenv, err)
+	}
+
+	encrypted := filepath.Join(dir, "encrypted.env")
+	err = os.WriteFile(encrypted, []byte(gitCryptHeader+"\x3d\xb1\x1d\xc3\x4b\xa4\x00\x01"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dotenv, err = readDotenv(encrypted)
+	if err != nil || len(dotenv) != 0 {
+		t.Fatalf("expected an encrypted .env to be ignored, got %v, %v", dotenv, err)
+	}
+
+	// The one in the repository, encrypted unless it was unlocked
+	_, err = readDotenv(filepath.Join("..", "..", envFile))
+	if err != nil {
+		t.Fatalf("expected the repository's .env to load, got %s", err)
+	}
+}
+
+func TestProxyConfig(t *testing.T) {
+	cases := []struct {
+		name    string
+		header  string
+		trusted []string
+		err     string
+	}{
+		{"off", "", nil, ""},
+		{"trusted addresses", "X-Real-IP", []string{"10.0.0.1", "10.1.0.0/16", "::1"}, ""},
+		{"no trusted proxies", "X-Real-IP", []string{}, "http.trusted_proxies: is required with proxy_header"},
+		{"not an address", "X-Real-IP", []string{"proxy.local"}, "http.trusted_proxies[0]: must be an IP address or a CIDR range"},
+	}
+	for _, tc := range cases {
+		cfg := DefaultConfig()
+		cfg.HTTP.ProxyHeader = tc.header
+		cfg.HTTP.TrustedProxies = tc.trusted
+		err := cfg.Validate()
+		if (tc.err == "" && err != nil) || (tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err))) {
+			t.Errorf("%s: expected `%s`, got %v", tc.name, tc.err, err)
+		}
+	}
+
+	// Environment variables and flags list them separated by commas
+	cfg := DefaultConfig()
+	for _, s := range settings(cfg) {
+		if s.env == "TRUSTED_PROXIES" {
+			err := s.set("10.0.0.1, 10.0.0.2")
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if len(cfg.HTTP.TrustedProxies) != 2 || cfg.HTTP.TrustedProxies[1] != "10.0.0.2" {
+		t.Fatalf("expected both proxies, got %v", cfg.HTTP.TrustedProxies)
+	}
+}
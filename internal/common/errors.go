@@ -1,7 +1,68 @@
 package common
 
-import "errors"
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
 
 var (
 	ErrUnreachable = errors.New("unreachable")
 )
+
+var (
+	ErrBadRequest       = NewAPIError(http.StatusBadRequest, "bad_request", "bad request")
+	ErrInvalidBody      = NewAPIError(http.StatusBadRequest, "invalid_body", "invalid request body")
+	ErrInvalidParam     = NewAPIError(http.StatusBadRequest, "invalid_param", "invalid parameter")
+	ErrUnauthorized     = NewAPIError(http.StatusUnauthorized, "unauthorized", "unauthorized")
+	ErrForbidden        = NewAPIError(http.StatusForbidden, "forbidden", "forbidden")
+	ErrNotFound         = NewAPIError(http.StatusNotFound, "not_found", "not found")
+	ErrConflict         = NewAPIError(http.StatusConflict, "conflict", "conflict")
+	ErrValidationFailed = NewAPIError(http.StatusUnprocessableEntity, "validation_failed", "validation failed")
+	ErrBodyTooLarge     = NewAPIError(http.StatusRequestEntityTooLarge, "body_too_large", "request body is too large")
+	ErrInternal         = NewAPIError(http.StatusInternalServerError, "internal_error", "internal server error")
+)
+
+// An error that knows how it is reported to clients.
+//
+// Domain errors are declared as APIErrors and wrapped with fmt.Errorf("%w:...")
+// as usual, JSONErr finds them anywhere in the chain.
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func NewAPIError(status int, code string, message string) *APIError {
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// An error that tells the client how long to wait before trying again, e.g. a rate limit.
+//
+// Err decides how it is reported, After is added to the response as retry_after.
+type RetryError struct {
+	Err   error
+	After time.Duration
+}
+
+func (e *RetryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// Code for an http status that no APIError describes, e.g. "method_not_allowed"
+func statusCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return ErrInternal.Code
+	}
+	return strings.ReplaceAll(strings.ToLower(text), " ", "_")
+}
@@ -1,19 +1,115 @@
 package common
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"strconv"
 
+	"github.com/NikosGour/chatter/build"
 	"github.com/NikosGour/logging/log"
+	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 )
 
-func JSONErr(c *fiber.Ctx, message string, status ...int) error {
-	if len(status) > 0 {
-		return c.Status(status[0]).JSON(fiber.Map{"Error": message})
+const (
+	LocalsRequestId = "requestid"
+)
+
+// Body of every error response
+type ErrorResponse struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestId string       `json:"request_id,omitempty"`
+	// Seconds to wait before trying again
+	RetryAfter float64 `json:"retry_after,omitempty"`
+}
+
+// A single failed validation rule of a request body
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// Responds with the status and code of the APIError found in err's chain.
+//
+// Anything else is logged and reported as a generic internal error,
+// so no query text or other internals reach the client.
+func JSONErr(c *fiber.Ctx, err error) error {
+	status, res := NewErrorResponse(err, RequestId(c))
+	if res.RetryAfter > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(res.RetryAfter))))
 	}
-	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"Error": message})
+	return c.Status(status).JSON(res)
+}
+
+// The status and body JSONErr responds with, also used for errors sent over the websocket.
+func NewErrorResponse(err error, request_id string) (int, ErrorResponse) {
+	res := ErrorResponse{RequestId: request_id}
+	status := ErrInternal.Status
+
+	var api_err *APIError
+	var fiber_err *fiber.Error
+	var validation_errs validator.ValidationErrors
+	switch {
+	case errors.As(err, &validation_errs):
+		status, res.Code, res.Message = ErrValidationFailed.Status, ErrValidationFailed.Code, ErrValidationFailed.Message
+		res.Details = fieldErrors(validation_errs)
+	case errors.As(err, &api_err) && api_err.Status < fiber.StatusInternalServerError:
+		status, res.Code, res.Message = api_err.Status, api_err.Code, err.Error()
+	case errors.As(err, &fiber_err) && fiber_err.Code < fiber.StatusInternalServerError:
+		status, res.Code, res.Message = fiber_err.Code, statusCode(fiber_err.Code), fiber_err.Message
+	default:
+		log.Error("request_id=%s: %s", res.RequestId, err)
+		res.Code, res.Message = ErrInternal.Code, ErrInternal.Message
+	}
+
+	var retry_err *RetryError
+	if errors.As(err, &retry_err) && retry_err.After > 0 {
+		res.RetryAfter = math.Ceil(retry_err.After.Seconds()*1000) / 1000
+	}
+
+	return status, res
+}
+
+// Reports errors returned by handlers and by fiber itself (unknown routes, etc.) through JSONErr
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	return JSONErr(c, err)
+}
+
+// The id the requestid middleware assigned to this request
+func RequestId(c *fiber.Ctx) string {
+	id, _ := c.Locals(LocalsRequestId).(string)
+	return id
+}
+
+func fieldErrors(validation_errs validator.ValidationErrors) []FieldError {
+	field_errs := []FieldError{}
+	for _, fe := range validation_errs {
+		field_errs = append(field_errs, FieldError{
+			Field:   fe.Field(),
+			Rule:    fe.Tag(),
+			Param:   fe.Param(),
+			Message: fieldErrorMessage(fe),
+		})
+	}
+	return field_errs
+}
+
+func fieldErrorMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", fe.Field())
+	case "min":
+		return fmt.Sprintf("%s must be at least %s long", fe.Field(), fe.Param())
+	case "max":
+		return fmt.Sprintf("%s must be at most %s long", fe.Field(), fe.Param())
+	}
+	return fmt.Sprintf("%s failed on the `%s` rule", fe.Field(), fe.Tag())
 }
 
 type Validater interface {
@@ -24,21 +120,33 @@ func BodyParse[T Validater](c *fiber.Ctx) (*T, error) {
 	v := new(T)
 	err := c.BodyParser(v)
 	if err != nil {
-		msg := fmt.Errorf("on Unmarshal: %w, for body: `%s`", err, c.Body())
-		log.Error("%s", msg)
+		msg := fmt.Errorf("%w: %w", ErrInvalidBody, err)
+		logBodyError(c, "Unmarshal", err)
 		return nil, msg
 	}
 
 	err = (*v).Validate()
 	if err != nil {
-		msg := fmt.Errorf("on Validate: %w, for body: `%s`", err, c.Body())
-		log.Error("%s", msg)
+		msg := fmt.Errorf("%w: %w", ErrValidationFailed, err)
+		logBodyError(c, "Validate", err)
 		return nil, msg
 	}
 
 	return v, nil
 }
 
+// Logs why the body of the request was rejected.
+// Bodies can hold anything users send, so only debug builds log it, with its sensitive fields redacted
+func logBodyError(c *fiber.Ctx, on string, err error) {
+	log.Error("on %s: %s, request_id: %s", on, err, RequestId(c))
+	if !build.DEBUG_MODE {
+		return
+	}
+	if body, ok := RedactJSON(c.Body()); ok {
+		log.Debug("body of request %s: `%s`", RequestId(c), body)
+	}
+}
+
 type Ctx interface {
 	Params(key string, defaultValue ...string) string
 }
@@ -46,14 +154,14 @@ type Ctx interface {
 func ParamsParseInt(c Ctx, field string) (int, error) {
 	_v := c.Params(field)
 	if _v == "" {
-		msg := fmt.Errorf("No %s was provided", field)
+		msg := fmt.Errorf("%w: no %s was provided", ErrInvalidParam, field)
 		log.Error("%s", msg)
 		return 0, msg
 	}
 
 	v, err := strconv.Atoi(_v)
 	if err != nil {
-		msg := fmt.Errorf("Coulnd't convert `%s` to int", _v)
+		msg := fmt.Errorf("%w: couldn't convert `%s` to int", ErrInvalidParam, _v)
 		log.Error("%s", msg)
 		return 0, msg
 	}
@@ -64,14 +172,14 @@ func ParamsParseInt(c Ctx, field string) (int, error) {
 func ParamsParseUUID(c Ctx, field string) (uuid.UUID, error) {
 	_v := c.Params(field)
 	if _v == "" {
-		msg := fmt.Errorf("no %s was provided", field)
+		msg := fmt.Errorf("%w: no %s was provided", ErrInvalidParam, field)
 		log.Error("%s", msg)
 		return uuid.Nil, msg
 	}
 
 	id, err := uuid.Parse(_v)
 	if err != nil {
-		msg := fmt.Errorf("not a valid uuid (%s): `%s`", field, _v)
+		msg := fmt.Errorf("%w: not a valid uuid (%s): `%s`", ErrInvalidParam, field, _v)
 		log.Error("%s", msg)
 		return uuid.Nil, msg
 	}
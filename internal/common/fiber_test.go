@@ -0,0 +1,106 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+)
+
+type testBody struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password"`
+}
+
+func (b testBody) Validate() error {
+	return Validate.Struct(b)
+}
+
+// Runs f with os.Stdout, where the application logs go, redirected and returns what was written
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- string(data)
+	}()
+	f()
+	w.Close()
+	return <-out
+}
+
+func TestBodyParseDoesNotLogBody(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Use(requestid.New(requestid.Config{ContextKey: LocalsRequestId}))
+	app.Post("/", func(c *fiber.Ctx) error {
+		_, err := BodyParse[testBody](c)
+		return JSONErr(c, err)
+	})
+
+	for _, body := range []string{`{"password": "hunter2"}`, `{"password": "hunter2"`} {
+		var request_id string
+		logs := captureStdout(t, func() {
+			req := httptest.NewRequest(fiber.MethodPost, "/", strings.NewReader(body))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request_id = resp.Header.Get(fiber.HeaderXRequestID)
+		})
+
+		if strings.Contains(logs, "hunter2") {
+			t.Fatalf("expected the body to stay out of the logs, got: %s", logs)
+		}
+		if request_id == "" || !strings.Contains(logs, request_id) {
+			t.Fatalf("expected the error to be logged with request id `%s`, got: %s", request_id, logs)
+		}
+	}
+}
+
+func TestNewErrorResponse(t *testing.T) {
+	cases := []struct {
+		name    string
+		err     error
+		status  int
+		code    string
+		message string
+	}{
+		{"api error", ErrConflict, http.StatusConflict, ErrConflict.Code, ErrConflict.Message},
+		{"wrapped api error", fmt.Errorf("%w: user_id=1", ErrForbidden), http.StatusForbidden, ErrForbidden.Code, "forbidden: user_id=1"},
+		{"retry error", &RetryError{Err: ErrBadRequest, After: time.Second}, http.StatusBadRequest, ErrBadRequest.Code, ErrBadRequest.Message},
+		{"fiber error", fiber.ErrMethodNotAllowed, http.StatusMethodNotAllowed, "method_not_allowed", fiber.ErrMethodNotAllowed.Message},
+		{"validation error", Validate.Struct(testBody{}), http.StatusUnprocessableEntity, ErrValidationFailed.Code, ErrValidationFailed.Message},
+		{"server side api error", fmt.Errorf("%w: pq: relation does not exist", NewAPIError(http.StatusServiceUnavailable, "unavailable", "unavailable")), http.StatusInternalServerError, ErrInternal.Code, ErrInternal.Message},
+		{"other error", errors.New("pq: relation does not exist"), http.StatusInternalServerError, ErrInternal.Code, ErrInternal.Message},
+	}
+	for _, tc := range cases {
+		captureStdout(t, func() {
+			status, res := NewErrorResponse(tc.err, "1")
+			if status != tc.status || res.Code != tc.code || res.Message != tc.message || res.RequestId != "1" {
+				t.Errorf("%s: expected %d %s `%s`, got %d %#v", tc.name, tc.status, tc.code, tc.message, status, res)
+			}
+		})
+	}
+
+	_, res := NewErrorResponse(&RetryError{Err: ErrBadRequest, After: 1500 * time.Millisecond}, "")
+	if res.RetryAfter != 1.5 {
+		t.Fatalf("expected to retry after 1.5s, got %f", res.RetryAfter)
+	}
+}
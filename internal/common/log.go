@@ -0,0 +1,95 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/NikosGour/logging/log"
+	loglevel "github.com/NikosGour/logging/log/LogLevel"
+)
+
+const (
+	// What the values of sensitive fields are logged as
+	Redacted = "[REDACTED]"
+)
+
+var (
+	logLevel = new(slog.LevelVar)
+	// Structured logger for requests, written as JSON lines to stdout
+	Logger = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel}))
+
+	// Fields whose values never make it to the logs, matched as a part of the lowercased field name
+	sensitiveFields = []string{"password", "passwd", "secret", "token", "authorization", "cookie", "api_key", "access_key", "private_key"}
+)
+
+// Sets the level of both the request and the application logs to the configured one.
+func InitLogging() {
+	level := slog.LevelInfo
+	err := level.UnmarshalText([]byte(Config.Log.Level))
+	if err != nil {
+		log.Error("unknown log level `%s`, logging at %s", Config.Log.Level, level)
+	}
+
+	logLevel.Set(level)
+	switch {
+	case level <= slog.LevelDebug:
+		log.LOGLEVEL = loglevel.DEBUG
+	case level <= slog.LevelInfo:
+		log.LOGLEVEL = loglevel.INFO
+	case level <= slog.LevelWarn:
+		log.LOGLEVEL = loglevel.WARN
+	default:
+		log.LOGLEVEL = loglevel.ERROR
+	}
+}
+
+// Whether the value of the field has to be kept out of the logs
+func IsSensitive(field string) bool {
+	field = strings.ToLower(field)
+	for _, s := range sensitiveFields {
+		if strings.Contains(field, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// A copy of the JSON document with the values of sensitive fields replaced, at any depth.
+//
+// Returns false when the body isn't JSON.
+func RedactJSON(body []byte) (json.RawMessage, bool) {
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	var v any
+	err := d.Decode(&v)
+	if err != nil {
+		return nil, false
+	}
+
+	out, err := json.Marshal(redact(v))
+	if err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+func redact(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, field := range v {
+			if IsSensitive(k) {
+				v[k] = Redacted
+			} else {
+				v[k] = redact(field)
+			}
+		}
+	case []any:
+		for i := range v {
+			v[i] = redact(v[i])
+		}
+	}
+	return v
+}
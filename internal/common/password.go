@@ -0,0 +1,34 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Hashes a password to be stored in place of it.
+//
+// Might return ErrInvalidBody, bcrypt only takes passwords of up to 72 bytes
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return "", fmt.Errorf("%w: password is longer than 72 bytes", ErrInvalidBody)
+	}
+	if err != nil {
+		return "", fmt.Errorf("on GenerateFromPassword: %w", err)
+	}
+	return string(hash), nil
+}
+
+// Reports whether password is the one hash was made from
+func CheckPassword(hash string, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// Reports whether s is a bcrypt hash rather than a password stored before they were hashed
+func IsPasswordHash(s string) bool {
+	_, err := bcrypt.Cost([]byte(s))
+	return err == nil && strings.HasPrefix(s, "$2")
+}
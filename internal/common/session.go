@@ -1,5 +1,122 @@
 package common
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NikosGour/logging/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/encryptcookie"
+	"github.com/google/uuid"
+)
+
 const (
 	CookieMessangerId = "messanger_id"
+
+	LocalsUserId = "user_id"
 )
+
+// Key the messanger_id cookie is encrypted with.
+//
+// Without http.cookie_key a key is generated, so sessions don't survive a restart.
+var CookieKey = sync.OnceValue(func() string {
+	key := Config.HTTP.CookieKey
+	if key == "" {
+		log.Warn("http.cookie_key is not set, generating a key, sessions won't survive a restart")
+		key = encryptcookie.GenerateKey()
+	}
+	return key
+})
+
+// What the messanger_id cookie holds.
+//
+// It stops authenticating the user http.session_max_age after it was issued,
+// or once the user's session version moves past its own.
+type Session struct {
+	UserId   uuid.UUID
+	Version  int64
+	IssuedAt time.Time
+}
+
+// Sets the messanger_id cookie that authenticates the user on later requests,
+// for as long as the user's session version stays at version
+func SetSession(c *fiber.Ctx, user_id uuid.UUID, version int64) error {
+	now := time.Now()
+	session := fmt.Sprintf("%s:%d:%d", user_id, version, now.Unix())
+	value, err := encryptcookie.EncryptCookie(session, CookieKey())
+	if err != nil {
+		return err
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     CookieMessangerId,
+		Value:    value,
+		Expires:  now.Add(Config.HTTP.SessionMaxAge),
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+	return nil
+}
+
+func ClearSession(c *fiber.Ctx) {
+	c.ClearCookie(CookieMessangerId)
+}
+
+// Reads the session out of the messanger_id cookie, expired ones are rejected.
+// Whether the session version is still the user's is up to the caller.
+//
+// Might return ErrUnauthorized
+func ReadSession(c *fiber.Ctx) (*Session, error) {
+	cookie := c.Cookies(CookieMessangerId)
+	if cookie == "" {
+		return nil, ErrUnauthorized
+	}
+
+	decrypted, err := encryptcookie.DecryptCookie(cookie, CookieKey())
+	if err != nil {
+		return nil, ErrUnauthorized
+	}
+
+	parts := strings.Split(decrypted, ":")
+	if len(parts) != 3 {
+		return nil, ErrUnauthorized
+	}
+	id, err := uuid.Parse(parts[0])
+	if err != nil {
+		return nil, ErrUnauthorized
+	}
+	version, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, ErrUnauthorized
+	}
+	issued_at, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, ErrUnauthorized
+	}
+
+	session := &Session{UserId: id, Version: version, IssuedAt: time.Unix(issued_at, 0)}
+	if time.Since(session.IssuedAt) > Config.HTTP.SessionMaxAge {
+		return nil, fmt.Errorf("%w:session expired", ErrUnauthorized)
+	}
+	return session, nil
+}
+
+// Reads the user id out of the messanger_id cookie, without checking the user's session version.
+//
+// Might return ErrUnauthorized
+func SessionUserId(c *fiber.Ctx) (uuid.UUID, error) {
+	session, err := ReadSession(c)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return session.UserId, nil
+}
+
+// The id of the user the WithActiveUser middleware authenticated
+func UserId(c *fiber.Ctx) uuid.UUID {
+	id, _ := c.Locals(LocalsUserId).(uuid.UUID)
+	return id
+}
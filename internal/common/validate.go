@@ -0,0 +1,33 @@
+package common
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var (
+	Validate = newValidator()
+)
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(jsonFieldName)
+	return v
+}
+
+// Validation errors name fields the way clients send them, in the body or the query string
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		name, _, _ = strings.Cut(field.Tag.Get("query"), ",")
+	}
+	if name == "" {
+		return field.Name
+	}
+	if name == "-" {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,19 @@
+package controllers
+
+import (
+	"github.com/NikosGour/chatter/internal/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+type AdminController struct {
+	conn_manager *services.ConnManager
+}
+
+func NewAdminController(conn_manager *services.ConnManager) *AdminController {
+	ac := &AdminController{conn_manager: conn_manager}
+	return ac
+}
+
+func (ac *AdminController) Connections(c *fiber.Ctx) error {
+	return c.JSON(ac.conn_manager.Stats())
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type AttachmentController struct {
+	attachment_service *services.AttachmentService
+	message_service    *services.MessageService
+	conn_manager       *services.ConnManager
+}
+
+func NewAttachmentController(attachment_service *services.AttachmentService, message_service *services.MessageService, conn_manager *services.ConnManager) *AttachmentController {
+	ac := &AttachmentController{attachment_service: attachment_service, message_service: message_service, conn_manager: conn_manager}
+	return ac
+}
+
+func (ac *AttachmentController) Upload(c *fiber.Ctx) error {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return common.JSONErr(c, fmt.Errorf("%w: expected a multipart form: %s", common.ErrInvalidBody, err))
+	}
+
+	upload := &models.AttachmentUpload{Files: form.File["files"]}
+	if v := form.Value["tab_id"]; len(v) > 0 {
+		upload.TabId, err = uuid.Parse(v[0])
+		if err != nil {
+			return common.JSONErr(c, fmt.Errorf("%w: tab_id is not a valid uuid: `%s`", common.ErrInvalidBody, v[0]))
+		}
+	}
+	if v := form.Value["text"]; len(v) > 0 {
+		upload.Text = v[0]
+	}
+
+	message_id, err := ac.attachment_service.Upload(common.UserId(c), upload)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	ac.conn_manager.PublishMessage(message_id)
+
+	message, err := ac.message_service.GetByID(message_id)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+	return c.JSON(message)
+}
+
+func (ac *AttachmentController) Download(c *fiber.Ctx) error {
+	id, err := common.ParamsParseUUID(c, "id")
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	attachment, r, err := ac.attachment_service.Open(common.UserId(c), id)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	// Only media is shown inline, anything else, svg included, can't run as a page of the api's origin
+	disposition := "attachment"
+	media_type, _, _ := strings.Cut(attachment.ContentType, ";")
+	if strings.HasPrefix(media_type, "image/") && media_type != "image/svg+xml" || strings.HasPrefix(media_type, "video/") || strings.HasPrefix(media_type, "audio/") {
+		disposition = "inline"
+	}
+
+	c.Set(fiber.HeaderContentType, attachment.ContentType)
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	c.Set(fiber.HeaderContentSecurityPolicy, "default-src 'none'; sandbox")
+	c.Set(fiber.HeaderCacheControl, "private, max-age=86400")
+	return c.SendStream(r, int(attachment.Size))
+}
+
+func (ac *AttachmentController) Thumbnail(c *fiber.Ctx) error {
+	id, err := common.ParamsParseUUID(c, "id")
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	content_type, r, err := ac.attachment_service.OpenThumbnail(common.UserId(c), id)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	c.Set(fiber.HeaderContentType, content_type)
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	c.Set(fiber.HeaderContentSecurityPolicy, "default-src 'none'; sandbox")
+	c.Set(fiber.HeaderCacheControl, "private, max-age=86400")
+	return c.SendStream(r)
+}
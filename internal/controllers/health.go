@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+type HealthController struct {
+	health_service *services.HealthService
+}
+
+func NewHealthController(health_service *services.HealthService) *HealthController {
+	hc := &HealthController{health_service: health_service}
+	return hc
+}
+
+// Answers as long as the server does, restarting won't fix anything a dependency check would catch
+func (hc *HealthController) Health(c *fiber.Ctx) error {
+	return c.JSON(models.Health{Status: models.HealthOK})
+}
+
+func (hc *HealthController) Ready(c *fiber.Ctx) error {
+	readiness := hc.health_service.Readiness()
+	if !readiness.Ready() {
+		c.Status(fiber.StatusServiceUnavailable)
+	}
+	return c.JSON(readiness)
+}
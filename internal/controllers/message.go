@@ -1,6 +1,8 @@
 package controllers
 
 import (
+	"fmt"
+
 	"github.com/NikosGour/chatter/internal/common"
 	"github.com/NikosGour/chatter/internal/models"
 	"github.com/NikosGour/chatter/internal/services"
@@ -8,32 +10,57 @@ import (
 )
 
 type MessageController struct {
-	message_service *services.MessageService
+	message_service    *services.MessageService
+	tab_service        *services.TabService
+	read_state_service *services.ReadStateService
+	rate_limit_service *services.RateLimitService
+	conn_manager       *services.ConnManager
 }
 
-func NewMessageController(message_service *services.MessageService) *MessageController {
-	uc := &MessageController{message_service: message_service}
+func NewMessageController(message_service *services.MessageService, tab_service *services.TabService, read_state_service *services.ReadStateService, rate_limit_service *services.RateLimitService, conn_manager *services.ConnManager) *MessageController {
+	uc := &MessageController{message_service: message_service, tab_service: tab_service, read_state_service: read_state_service, rate_limit_service: rate_limit_service, conn_manager: conn_manager}
 	return uc
 }
 
 func (mc *MessageController) Create(c *fiber.Ctx) error {
 	m, err := common.BodyParse[models.Message](c)
 	if err != nil {
-		return common.JSONErr(c, err.Error())
+		return common.JSONErr(c, err)
+	}
+	if m.Tab == nil {
+		return common.JSONErr(c, fmt.Errorf("%w: message is missing its tab", common.ErrInvalidBody))
+	}
+	// Sent as the logged in user, whatever the body says
+	user_id := common.UserId(c)
+	m.Sender = &models.User{Id: user_id}
+
+	_, err = mc.tab_service.Authorize(m.Tab.Id, user_id, models.RoleMember)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+	err = mc.message_service.Clean(m)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+	err = mc.rate_limit_service.TakeMessage(user_id, m.Tab.Id)
+	if err != nil {
+		return common.JSONErr(c, err)
 	}
 
 	insert_id, err := mc.message_service.Create(m)
 	if err != nil {
-		return common.JSONErr(c, err.Error())
+		return common.JSONErr(c, err)
 	}
 
+	mc.conn_manager.PublishMessage(insert_id)
+
 	return c.JSON(insert_id)
 }
 
 func (mc *MessageController) GetAll(c *fiber.Ctx) error {
-	messages, err := mc.message_service.GetAll()
+	messages, err := mc.message_service.GetAllOf(common.UserId(c))
 	if err != nil {
-		return common.JSONErr(c, err.Error())
+		return common.JSONErr(c, err)
 	}
 
 	message_dtos := []services.MessageDTO{}
@@ -48,12 +75,19 @@ func (mc *MessageController) GetAll(c *fiber.Ctx) error {
 func (mc *MessageController) GetById(c *fiber.Ctx) error {
 	id, err := common.ParamsParseInt(c, "id")
 	if err != nil {
-		return common.JSONErr(c, err.Error(), fiber.StatusBadRequest)
+		return common.JSONErr(c, err)
 	}
 
 	message, err := mc.message_service.GetByID(int64(id))
 	if err != nil {
-		return common.JSONErr(c, err.Error())
+		return common.JSONErr(c, err)
+	}
+	if message.Tab == nil {
+		return common.JSONErr(c, fmt.Errorf("%w:message_id=%d", models.ErrMessageNotFound, id))
+	}
+	_, err = mc.tab_service.Authorize(message.Tab.Id, common.UserId(c), models.RoleMember)
+	if err != nil {
+		return common.JSONErr(c, err)
 	}
 
 	mdto := mc.message_service.MessageToDTO(message)
@@ -61,15 +95,46 @@ func (mc *MessageController) GetById(c *fiber.Ctx) error {
 	return c.JSON(mdto)
 }
 
+func (mc *MessageController) GetReceipts(c *fiber.Ctx) error {
+	id, err := common.ParamsParseInt(c, "id")
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	receipts, err := mc.read_state_service.GetReceipts(common.UserId(c), int64(id))
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	return c.JSON(receipts)
+}
+
 func (mc *MessageController) GetByTabId(c *fiber.Ctx) error {
 	tab_id, err := common.ParamsParseUUID(c, "tab_id")
 	if err != nil {
-		return common.JSONErr(c, err.Error(), fiber.StatusBadRequest)
+		return common.JSONErr(c, err)
+	}
+	_, err = mc.tab_service.Authorize(tab_id, common.UserId(c), models.RoleMember)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	page := models.MessagePage{}
+	err = c.QueryParser(&page)
+	if err != nil {
+		return common.JSONErr(c, fmt.Errorf("%w: %w", common.ErrInvalidParam, err))
+	}
+	err = page.Validate()
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+	if page.Limit == 0 {
+		page.Limit = models.MaxMessagePage
 	}
 
-	messages, err := mc.message_service.GetByTabID(tab_id)
+	messages, err := mc.message_service.GetPageByTabID(tab_id, page)
 	if err != nil {
-		return common.JSONErr(c, err.Error())
+		return common.JSONErr(c, err)
 	}
 
 	message_dtos := []services.MessageDTO{}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/services"
+	"github.com/NikosGour/logging/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type ProfileController struct {
+	profile_service *services.ProfileService
+	user_service    *services.UserService
+	conn_manager    *services.ConnManager
+}
+
+func NewProfileController(profile_service *services.ProfileService, user_service *services.UserService, conn_manager *services.ConnManager) *ProfileController {
+	pc := &ProfileController{profile_service: profile_service, user_service: user_service, conn_manager: conn_manager}
+	return pc
+}
+
+func (pc *ProfileController) Get(c *fiber.Ctx) error {
+	profile, err := pc.profile_service.Get(common.UserId(c))
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+	return c.JSON(profile)
+}
+
+func (pc *ProfileController) Update(c *fiber.Ctx) error {
+	patch, err := common.BodyParse[models.ProfilePatch](c)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	profile, err := pc.profile_service.Update(common.UserId(c), patch)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	pc.publishUpdate(profile.Id)
+	return c.JSON(profile)
+}
+
+func (pc *ProfileController) SetAvatar(c *fiber.Ctx) error {
+	f, err := c.FormFile("avatar")
+	if err != nil {
+		return common.JSONErr(c, fmt.Errorf("%w: expected a multipart form with an avatar: %s", common.ErrInvalidBody, err))
+	}
+
+	profile, err := pc.profile_service.SetAvatar(common.UserId(c), f)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	pc.publishUpdate(profile.Id)
+	return c.JSON(profile)
+}
+
+func (pc *ProfileController) DeleteAvatar(c *fiber.Ctx) error {
+	profile, err := pc.profile_service.DeleteAvatar(common.UserId(c))
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	pc.publishUpdate(profile.Id)
+	return c.JSON(profile)
+}
+
+func (pc *ProfileController) Avatar(c *fiber.Ctx) error {
+	id, err := common.ParamsParseUUID(c, "id")
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	r, err := pc.profile_service.OpenAvatar(id)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	// A new avatar gets a new id, so they never change
+	c.Set(fiber.HeaderContentType, "image/png")
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	c.Set(fiber.HeaderContentSecurityPolicy, "default-src 'none'; sandbox")
+	c.Set(fiber.HeaderCacheControl, "public, max-age=31536000, immutable")
+	return c.SendStream(r)
+}
+
+// Lets everyone sharing a server with the user know their profile changed
+func (pc *ProfileController) publishUpdate(user_id uuid.UUID) {
+	u, err := pc.user_service.GetByID(user_id)
+	if err != nil {
+		log.Error("on getting user `%s` after a profile update: %s", user_id, err)
+		return
+	}
+
+	u.Password = ""
+	pc.conn_manager.PublishToCoMembers(user_id, models.NewEvent(models.EventUserUpdate, u))
+}
@@ -1,43 +1,48 @@
 package controllers
 
 import (
-	"fmt"
+	"errors"
 
 	"github.com/NikosGour/chatter/internal/common"
 	"github.com/NikosGour/chatter/internal/models"
 	"github.com/NikosGour/chatter/internal/services"
-	"github.com/NikosGour/logging/log"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 )
 
 type ServerController struct {
-	server_service *services.ServerService
+	server_service     *services.ServerService
+	user_service       *services.UserService
+	presence_service   *services.PresenceService
+	read_state_service *services.ReadStateService
+	conn_manager       *services.ConnManager
 }
 
-func NewServerController(server_service *services.ServerService) *ServerController {
-	sc := &ServerController{server_service: server_service}
+func NewServerController(server_service *services.ServerService, user_service *services.UserService, presence_service *services.PresenceService, read_state_service *services.ReadStateService, conn_manager *services.ConnManager) *ServerController {
+	sc := &ServerController{server_service: server_service, user_service: user_service, presence_service: presence_service, read_state_service: read_state_service, conn_manager: conn_manager}
 	return sc
 }
 
 func (sc *ServerController) Create(c *fiber.Ctx) error {
 	server, err := common.BodyParse[models.Server](c)
 	if err != nil {
-		return common.JSONErr(c, err.Error())
+		return common.JSONErr(c, err)
 	}
 
-	insert_id, err := sc.server_service.Create(server)
+	insert_id, err := sc.server_service.CreateWithOwner(server, common.UserId(c), nil)
 	if err != nil {
-		return common.JSONErr(c, err.Error())
+		return common.JSONErr(c, err)
 	}
 
+	sc.conn_manager.Publish([]uuid.UUID{common.UserId(c)}, models.NewEvent(models.EventServerCreate, models.Server{Id: server.Id, Name: server.Name, DateCreated: server.DateCreated}))
+
 	return c.JSON(insert_id)
 }
 
 func (sc *ServerController) GetAll(c *fiber.Ctx) error {
 	servers, err := sc.server_service.GetAll()
 	if err != nil {
-		return common.JSONErr(c, err.Error())
+		return common.JSONErr(c, err)
 	}
 
 	return c.JSON(servers)
@@ -46,12 +51,12 @@ func (sc *ServerController) GetAll(c *fiber.Ctx) error {
 func (sc *ServerController) GetById(c *fiber.Ctx) error {
 	id, err := common.ParamsParseUUID(c, "id")
 	if err != nil {
-		return common.JSONErr(c, err.Error(), fiber.StatusBadRequest)
+		return common.JSONErr(c, err)
 	}
 
 	g, err := sc.server_service.GetByID(id)
 	if err != nil {
-		return common.JSONErr(c, err.Error())
+		return common.JSONErr(c, err)
 	}
 
 	return c.JSON(g)
@@ -60,12 +65,15 @@ func (sc *ServerController) GetById(c *fiber.Ctx) error {
 func (sc *ServerController) GetUsersById(c *fiber.Ctx) error {
 	id, err := common.ParamsParseUUID(c, "id")
 	if err != nil {
-		return common.JSONErr(c, err.Error(), fiber.StatusBadRequest)
+		return common.JSONErr(c, err)
 	}
 
 	users, err := sc.server_service.GetUsers(id)
 	if err != nil {
-		return common.JSONErr(c, err.Error())
+		return common.JSONErr(c, err)
+	}
+	for i := range users {
+		users[i].Presence = sc.presence_service.Get(users[i].Id)
 	}
 
 	return c.JSON(users)
@@ -74,39 +82,120 @@ func (sc *ServerController) GetUsersById(c *fiber.Ctx) error {
 func (sc *ServerController) GetTabsById(c *fiber.Ctx) error {
 	id, err := common.ParamsParseUUID(c, "id")
 	if err != nil {
-		return common.JSONErr(c, err.Error(), fiber.StatusBadRequest)
+		return common.JSONErr(c, err)
 	}
 
 	tabs, err := sc.server_service.GetTabs(id)
 	if err != nil {
-		return common.JSONErr(c, err.Error())
+		return common.JSONErr(c, err)
+	}
+
+	// Logged in members also get what they have read of each tab
+	session, err := common.ReadSession(c)
+	if err == nil && sc.user_service.CheckSession(session) == nil {
+		read_states, err := sc.read_state_service.GetByServerID(session.UserId, id)
+		if err != nil && !errors.Is(err, models.ErrNotServerMember) {
+			return common.JSONErr(c, err)
+		}
+		for i := range tabs {
+			if read_state, ok := read_states[tabs[i].Id]; ok {
+				tabs[i].ReadState = &read_state
+			}
+		}
 	}
 
 	return c.JSON(tabs)
 }
 
+type AddUserToServerBody struct {
+	User_id uuid.UUID `json:"user_id"`
+}
+
+func (b AddUserToServerBody) Validate() error {
+	return common.Validate.Struct(b)
+}
+
 func (sc *ServerController) AddUserToServer(c *fiber.Ctx) error {
 	server_id, err := common.ParamsParseUUID(c, "id")
 	if err != nil {
-		return common.JSONErr(c, err.Error(), fiber.StatusBadRequest)
+		return common.JSONErr(c, err)
+	}
+
+	body, err := common.BodyParse[AddUserToServerBody](c)
+	if err != nil {
+		return common.JSONErr(c, err)
 	}
 
-	body := &struct {
-		User_id uuid.UUID `json:"user_id"`
-	}{}
-	err = c.BodyParser(body)
+	err = sc.server_service.AddUserToServerAs(body.User_id, server_id, common.UserId(c))
 	if err != nil {
-		msg := fmt.Errorf("on Unmarshal: %w, for body: `%s`", err, c.Body())
-		log.Error("%s", msg)
-		return common.JSONErr(c, msg.Error(), fiber.StatusBadRequest)
+		return common.JSONErr(c, err)
 	}
-	log.Debug("server_id: %#v", server_id.String())
-	log.Debug("body.User_id.String(): %#v", body.User_id.String())
 
-	err = sc.server_service.AddUserToServer(body.User_id, server_id)
+	member, err := sc.server_service.GetMember(server_id, body.User_id)
 	if err != nil {
-		return common.JSONErr(c, err.Error())
+		return common.JSONErr(c, err)
 	}
+	sc.conn_manager.PublishToServer(server_id, models.NewEvent(models.EventMemberJoin, member))
 
 	return c.SendStatus(fiber.StatusOK)
 }
+
+func (sc *ServerController) Update(c *fiber.Ctx) error {
+	id, err := common.ParamsParseUUID(c, "id")
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	patch, err := common.BodyParse[models.ServerPatch](c)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	server, err := sc.server_service.Update(id, common.UserId(c), patch)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	sc.conn_manager.PublishToServer(id, models.NewEvent(models.EventServerUpdate, models.Server{Id: server.Id, Name: server.Name, DateCreated: server.DateCreated}))
+	return c.JSON(server)
+}
+
+func (sc *ServerController) Delete(c *fiber.Ctx) error {
+	id, err := common.ParamsParseUUID(c, "id")
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	server, err := sc.server_service.Delete(id, common.UserId(c))
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	// Memberships are deleted along with the server, so members are taken from the deleted one
+	member_ids := []uuid.UUID{}
+	for _, u := range server.Users {
+		member_ids = append(member_ids, u.Id)
+	}
+	sc.conn_manager.Publish(member_ids, models.NewEvent(models.EventServerDelete, models.Server{Id: server.Id, Name: server.Name, DateCreated: server.DateCreated}))
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (sc *ServerController) SetNickname(c *fiber.Ctx) error {
+	id, err := common.ParamsParseUUID(c, "id")
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	update, err := common.BodyParse[models.NicknameUpdate](c)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	member, err := sc.server_service.SetNickname(id, common.UserId(c), update)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	sc.conn_manager.PublishToServer(id, models.NewEvent(models.EventMemberUpdate, member))
+	return c.JSON(member)
+}
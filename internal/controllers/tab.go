@@ -5,35 +5,40 @@ import (
 	"github.com/NikosGour/chatter/internal/models"
 	"github.com/NikosGour/chatter/internal/services"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 )
 
 type TabController struct {
-	tab_service *services.TabService
+	tab_service        *services.TabService
+	read_state_service *services.ReadStateService
+	conn_manager       *services.ConnManager
 }
 
-func NewTabController(tab_service *services.TabService) *TabController {
-	tc := &TabController{tab_service: tab_service}
+func NewTabController(tab_service *services.TabService, read_state_service *services.ReadStateService, conn_manager *services.ConnManager) *TabController {
+	tc := &TabController{tab_service: tab_service, read_state_service: read_state_service, conn_manager: conn_manager}
 	return tc
 }
 
 func (tc *TabController) Create(c *fiber.Ctx) error {
 	tab, err := common.BodyParse[models.Tab](c)
 	if err != nil {
-		return common.JSONErr(c, err.Error())
+		return common.JSONErr(c, err)
 	}
 
-	insert_id, err := tc.tab_service.Create(tab)
+	insert_id, err := tc.tab_service.CreateAs(tab, common.UserId(c))
 	if err != nil {
-		return common.JSONErr(c, err.Error())
+		return common.JSONErr(c, err)
 	}
 
+	tc.conn_manager.PublishToServer(tab.ServerId, models.NewEvent(models.EventTabCreate, tab))
+
 	return c.JSON(insert_id)
 }
 
 func (tc *TabController) GetAll(c *fiber.Ctx) error {
 	tabs, err := tc.tab_service.GetAll()
 	if err != nil {
-		return common.JSONErr(c, err.Error())
+		return common.JSONErr(c, err)
 	}
 
 	return c.JSON(tabs)
@@ -42,13 +47,73 @@ func (tc *TabController) GetAll(c *fiber.Ctx) error {
 func (tc *TabController) GetById(c *fiber.Ctx) error {
 	id, err := common.ParamsParseUUID(c, "id")
 	if err != nil {
-		return common.JSONErr(c, err.Error(), fiber.StatusBadRequest)
+		return common.JSONErr(c, err)
 	}
 
 	tab, err := tc.tab_service.GetByID(id)
 	if err != nil {
-		return common.JSONErr(c, err.Error())
+		return common.JSONErr(c, err)
+	}
+
+	return c.JSON(tab)
+}
+
+func (tc *TabController) Update(c *fiber.Ctx) error {
+	id, err := common.ParamsParseUUID(c, "id")
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	patch, err := common.BodyParse[models.TabPatch](c)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	tab, err := tc.tab_service.Update(id, common.UserId(c), patch)
+	if err != nil {
+		return common.JSONErr(c, err)
 	}
 
+	tc.conn_manager.PublishToServer(tab.ServerId, models.NewEvent(models.EventTabUpdate, tab))
 	return c.JSON(tab)
 }
+
+func (tc *TabController) Delete(c *fiber.Ctx) error {
+	id, err := common.ParamsParseUUID(c, "id")
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	tab, err := tc.tab_service.Delete(id, common.UserId(c))
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	tc.conn_manager.PublishToServer(tab.ServerId, models.NewEvent(models.EventTabDelete, tab))
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (tc *TabController) Ack(c *fiber.Ctx) error {
+	id, err := common.ParamsParseUUID(c, "id")
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	ack, err := common.BodyParse[models.Ack](c)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	user_id := common.UserId(c)
+	read_state, receipts, err := tc.read_state_service.Ack(user_id, id, ack.MessageId)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	// Keeps the user's other clients in sync
+	tc.conn_manager.Publish([]uuid.UUID{user_id}, models.NewEvent(models.EventReadStateUpdate, read_state))
+	for _, receipt := range receipts {
+		tc.conn_manager.Publish([]uuid.UUID{receipt.SenderId}, models.NewEvent(models.EventReceipt, receipt))
+	}
+	return c.JSON(read_state)
+}
@@ -1,30 +1,37 @@
 package controllers
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/NikosGour/chatter/internal/common"
 	"github.com/NikosGour/chatter/internal/models"
 	"github.com/NikosGour/chatter/internal/services"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 )
 
 type UserController struct {
-	user_service *services.UserService
+	user_service   *services.UserService
+	server_service *services.ServerService
+	conn_manager   *services.ConnManager
 }
 
-func NewUserController(user_service *services.UserService) *UserController {
-	uc := &UserController{user_service: user_service}
+func NewUserController(user_service *services.UserService, server_service *services.ServerService, conn_manager *services.ConnManager) *UserController {
+	uc := &UserController{user_service: user_service, server_service: server_service, conn_manager: conn_manager}
 	return uc
 }
 
 func (uc *UserController) Create(c *fiber.Ctx) error {
-	u, err := common.BodyParse[models.User](c)
+	credentials, err := common.BodyParse[models.Credentials](c)
 	if err != nil {
-		return common.JSONErr(c, err.Error())
+		return common.JSONErr(c, err)
 	}
 
-	insert_id, err := uc.user_service.Create(u)
+	u := &models.User{Username: credentials.Username, DateCreated: time.Now()}
+	insert_id, err := uc.user_service.Create(u, credentials.Password)
 	if err != nil {
-		return common.JSONErr(c, err.Error())
+		return common.JSONErr(c, err)
 	}
 
 	return c.JSON(insert_id)
@@ -33,7 +40,7 @@ func (uc *UserController) Create(c *fiber.Ctx) error {
 func (uc *UserController) GetAll(c *fiber.Ctx) error {
 	us, err := uc.user_service.GetAll()
 	if err != nil {
-		return common.JSONErr(c, err.Error())
+		return common.JSONErr(c, err)
 	}
 
 	return c.JSON(us)
@@ -42,13 +49,124 @@ func (uc *UserController) GetAll(c *fiber.Ctx) error {
 func (uc *UserController) GetById(c *fiber.Ctx) error {
 	id, err := common.ParamsParseUUID(c, "id")
 	if err != nil {
-		return common.JSONErr(c, err.Error(), fiber.StatusBadRequest)
+		return common.JSONErr(c, err)
 	}
 
 	u, err := uc.user_service.GetByID(id)
 	if err != nil {
-		return common.JSONErr(c, err.Error())
+		return common.JSONErr(c, err)
+	}
+
+	return c.JSON(u)
+}
+
+func (uc *UserController) Login(c *fiber.Ctx) error {
+	credentials, err := common.BodyParse[models.Credentials](c)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	u, err := uc.user_service.Authenticate(credentials)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	err = common.SetSession(c, u.Id, u.SessionVersion)
+	if err != nil {
+		return common.JSONErr(c, err)
 	}
 
 	return c.JSON(u)
 }
+
+// Ends every session of the user, not only the one logging out, copies of the cookie included
+func (uc *UserController) Logout(c *fiber.Ctx) error {
+	session, err := common.ReadSession(c)
+	if err == nil && uc.user_service.CheckSession(session) == nil {
+		err = uc.user_service.RevokeSessions(session.UserId)
+		if err != nil {
+			return common.JSONErr(c, err)
+		}
+	}
+
+	common.ClearSession(c)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (uc *UserController) Update(c *fiber.Ctx) error {
+	id, err := uc.selfParam(c)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	patch, err := common.BodyParse[models.UserPatch](c)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	u, err := uc.user_service.Update(id, patch)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+	// A new password ends every session, the one that changed it goes on with a new cookie
+	if patch.Password != nil {
+		err = common.SetSession(c, id, u.SessionVersion)
+		if err != nil {
+			return common.JSONErr(c, err)
+		}
+	}
+
+	uc.conn_manager.PublishToCoMembers(id, models.NewEvent(models.EventUserUpdate, u))
+	return c.JSON(u)
+}
+
+func (uc *UserController) Delete(c *fiber.Ctx) error {
+	id, err := uc.selfParam(c)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	// Once deleted the user no longer shares a server with anyone
+	co_members, err := uc.server_service.GetCoMembers(id)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	err = uc.user_service.Delete(id)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	common.ClearSession(c)
+	uc.conn_manager.Publish(co_members, models.NewEvent(models.EventUserDelete, models.User{Id: id}))
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (uc *UserController) SetPresence(c *fiber.Ctx) error {
+	id, err := uc.selfParam(c)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	update, err := common.BodyParse[models.PresenceUpdate](c)
+	if err != nil {
+		return common.JSONErr(c, err)
+	}
+
+	uc.conn_manager.SetPresence(id, update)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Parses the id param, users can only change themselves.
+//
+// Might return ErrInvalidParam or ErrForbidden
+func (uc *UserController) selfParam(c *fiber.Ctx) (uuid.UUID, error) {
+	id, err := common.ParamsParseUUID(c, "id")
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if id != common.UserId(c) {
+		return uuid.Nil, fmt.Errorf("%w: users can only change themselves", common.ErrForbidden)
+	}
+	return id, nil
+}
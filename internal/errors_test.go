@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Every failure is reported with the status and code of its error, through the handlers and fiber alike
+func TestErrorStatuses(t *testing.T) {
+	s, app := newTestAPI(t)
+
+	nikos := newTestUser(t, s, "nikos")
+	maria := newTestUser(t, s, "maria")
+	newTestUser(t, s, "eve")
+	server_id, tab_id := newTestServer(t, s, "Gamiades", nikos, maria)
+
+	owner := login(t, app, "nikos", "123")
+	member := login(t, app, "maria", "123")
+	outsider := login(t, app, "eve", "123")
+
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		body    any
+		session string
+		status  int
+		code    string
+	}{
+		{"unknown user", fiber.MethodGet, "/user/" + uuid.NewString(), nil, "", fiber.StatusNotFound, models.ErrUserNotFound.Code},
+		{"unknown tab", fiber.MethodGet, "/tab/" + uuid.NewString(), nil, "", fiber.StatusNotFound, models.ErrTabNotFound.Code},
+		{"unknown route", fiber.MethodGet, "/nowhere", nil, "", fiber.StatusNotFound, "not_found"},
+		{"malformed id", fiber.MethodGet, "/user/nikos", nil, "", fiber.StatusBadRequest, common.ErrInvalidParam.Code},
+		{"malformed body", fiber.MethodPost, "/user", "{", "", fiber.StatusBadRequest, common.ErrInvalidBody.Code},
+		{"no session", fiber.MethodPost, "/tab", models.Tab{Name: "Offtopic", ServerId: server_id}, "", fiber.StatusUnauthorized, common.ErrUnauthorized.Code},
+		{"wrong password", fiber.MethodPost, "/user/login", models.Credentials{Username: "nikos", Password: "321"}, "", fiber.StatusUnauthorized, models.ErrWrongCredentials.Code},
+		{"outsider", fiber.MethodPost, "/tab", models.Tab{Name: "Offtopic", ServerId: server_id}, outsider, fiber.StatusForbidden, models.ErrNotServerMember.Code},
+		{"member", fiber.MethodPost, "/tab", models.Tab{Name: "Offtopic", ServerId: server_id}, member, fiber.StatusForbidden, models.ErrInsufficientRole.Code},
+		{"taken username", fiber.MethodPost, "/user", models.Credentials{Username: "maria", Password: "123"}, "", fiber.StatusConflict, models.ErrUserAlreadyExists.Code},
+		{"member twice", fiber.MethodPost, "/server/" + server_id.String(), map[string]any{"user_id": maria}, owner, fiber.StatusConflict, models.ErrUserAlreadyInServer.Code},
+		{"missing field", fiber.MethodPost, "/user", models.Credentials{Username: "eleni"}, "", fiber.StatusUnprocessableEntity, common.ErrValidationFailed.Code},
+		{"empty message", fiber.MethodPost, "/message", models.Message{Text: " ", Tab: &models.Tab{Id: tab_id}, DateSent: time.Now()}, member, fiber.StatusUnprocessableEntity, models.ErrEmptyMessage.Code},
+	}
+	for _, tc := range cases {
+		resp, body := request(t, app, tc.method, tc.path, tc.body, tc.session)
+		res := common.ErrorResponse{}
+		err := json.Unmarshal(body, &res)
+		if err != nil || resp.StatusCode != tc.status || res.Code != tc.code {
+			t.Errorf("%s: expected %d %s, got %d: %s", tc.name, tc.status, tc.code, resp.StatusCode, body)
+		}
+		if res.Message == "" || res.RequestId == "" {
+			t.Errorf("%s: expected a message and a request id, got %s", tc.name, body)
+		}
+	}
+
+	// Validation failures say which rule of which field failed
+	_, body := request(t, app, fiber.MethodPost, "/user", models.Credentials{Username: "eleni"}, "")
+	res := common.ErrorResponse{}
+	err := json.Unmarshal(body, &res)
+	if err != nil || len(res.Details) != 1 || res.Details[0].Field != "password" || res.Details[0].Rule != "required" {
+		t.Fatalf("expected the password to be reported as required, got %s", body)
+	}
+}
+
+// Rate limits are reported with how long to wait, in the body and in Retry-After
+func TestRetryAfter(t *testing.T) {
+	s, app := newTestAPI(t)
+
+	nikos := newTestUser(t, s, "nikos")
+	maria := newTestUser(t, s, "maria")
+	_, tab_id := newTestServer(t, s, "Gamiades", nikos, maria)
+	owner := login(t, app, "nikos", "123")
+	session := login(t, app, "maria", "123")
+
+	slow_mode := 30
+	resp, body := request(t, app, fiber.MethodPatch, "/tab/"+tab_id.String(), models.TabPatch{SlowMode: &slow_mode}, owner)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected slow mode to be set, got %d: %s", resp.StatusCode, body)
+	}
+
+	message := models.Message{Text: "kalhspera", Tab: &models.Tab{Id: tab_id}, DateSent: time.Now()}
+	resp, body = request(t, app, fiber.MethodPost, "/message", message, session)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected the first message to be sent, got %d: %s", resp.StatusCode, body)
+	}
+	resp, body = request(t, app, fiber.MethodPost, "/message", message, session)
+	res := common.ErrorResponse{}
+	err := json.Unmarshal(body, &res)
+	if err != nil || resp.StatusCode != fiber.StatusTooManyRequests || res.Code != models.ErrSlowMode.Code {
+		t.Fatalf("expected %d %s, got %d: %s", fiber.StatusTooManyRequests, models.ErrSlowMode.Code, resp.StatusCode, body)
+	}
+	if res.RetryAfter <= 0 || res.RetryAfter > float64(slow_mode) {
+		t.Fatalf("expected to wait at most %ds, got %f", slow_mode, res.RetryAfter)
+	}
+	retry_after, err := strconv.Atoi(resp.Header.Get(fiber.HeaderRetryAfter))
+	if err != nil || retry_after <= 0 || retry_after > slow_mode {
+		t.Fatalf("expected Retry-After of at most %ds, got `%s`", slow_mode, resp.Header.Get(fiber.HeaderRetryAfter))
+	}
+}
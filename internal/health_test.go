@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/chatter/internal/controllers"
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/services"
+	"github.com/NikosGour/chatter/internal/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+// A storage whose database stopped answering
+type unreachableStorage struct {
+	storage.Storage
+}
+
+func (unreachableStorage) Ping() error {
+	return errors.New("connection refused")
+}
+
+// Serves ReadyPath alone over the storage, along with a connection manager
+// whose broadcast loop is only running when started.
+func newReadyApp(t *testing.T, db storage.Storage, started bool) (*services.ConnManager, *fiber.App) {
+	t.Helper()
+	cm := services.NewConnManager(nil, nil, nil, services.NewPresenceService(), services.NewTypingService(), nil, 0)
+	if started {
+		go cm.HandleIncomingMessages()
+		deadline := time.Now().Add(5 * time.Second)
+		for cm.CheckBroadcast() != nil {
+			if time.Now().After(deadline) {
+				t.Fatal("the broadcast loop didn't start")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	app := fiber.New()
+	app.Get(ReadyPath, controllers.NewHealthController(services.NewHealthService(db, cm)).Ready)
+	return cm, app
+}
+
+// Returns the status code of ReadyPath and the readiness it answered with
+func ready(t *testing.T, app *fiber.App) (int, models.Readiness) {
+	t.Helper()
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, ReadyPath, nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readiness := models.Readiness{}
+	err = json.Unmarshal(body, &readiness)
+	if err != nil {
+		t.Fatalf("expected a readiness, got %s", body)
+	}
+	return resp.StatusCode, readiness
+}
+
+// Checks ReadyPath fails with 503 on the check alone
+func expectNotReady(t *testing.T, app *fiber.App, check string) {
+	t.Helper()
+	code, readiness := ready(t, app)
+	if code != fiber.StatusServiceUnavailable || readiness.Status != models.ReadinessNotReady {
+		t.Fatalf("expected %s to fail the readiness, got %d: %#v", check, code, readiness)
+	}
+	for name, result := range readiness.Checks {
+		if (name == check) != (result == models.HealthFailing) {
+			t.Fatalf("expected only %s to fail, got %#v", check, readiness.Checks)
+		}
+	}
+}
+
+func TestReady(t *testing.T) {
+	_, app := newTestAPI(t)
+
+	// The broadcast loop is started along with the server
+	code, readiness := ready(t, app)
+	deadline := time.Now().Add(5 * time.Second)
+	for code != fiber.StatusOK && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		code, readiness = ready(t, app)
+	}
+	if code != fiber.StatusOK || !readiness.Ready() {
+		t.Fatalf("expected the API to be ready, got %d: %#v", code, readiness)
+	}
+	for _, check := range []string{"database", "migrations", "broadcast"} {
+		if readiness.Checks[check] != models.HealthOK {
+			t.Fatalf("expected the %s check to pass, got %#v", check, readiness.Checks)
+		}
+	}
+}
+
+func TestNotReadyWithoutDatabase(t *testing.T) {
+	_, app := newReadyApp(t, unreachableStorage{storage.NewMemoryStorage()}, true)
+	expectNotReady(t, app, "database")
+}
+
+func TestNotReadyWithPendingMigration(t *testing.T) {
+	common.Config.Storage.SQLitePath = filepath.Join(t.TempDir(), "chatter.db")
+	st := storage.NewSQLiteStorage()
+	t.Cleanup(func() { st.Close() })
+	_, app := newReadyApp(t, st, true)
+
+	code, readiness := ready(t, app)
+	if code != fiber.StatusOK {
+		t.Fatalf("expected a migrated database to be ready, got %d: %#v", code, readiness)
+	}
+
+	// As if chatter was updated without migrating the database
+	_, err := st.Exec(`DELETE FROM schema_migrations WHERE version = (SELECT MAX(version) FROM schema_migrations);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectNotReady(t, app, "migrations")
+}
+
+func TestNotReadyWithoutBroadcast(t *testing.T) {
+	_, app := newReadyApp(t, storage.NewMemoryStorage(), false)
+	expectNotReady(t, app, "broadcast")
+
+	cm, app := newReadyApp(t, storage.NewMemoryStorage(), true)
+	code, readiness := ready(t, app)
+	if code != fiber.StatusOK {
+		t.Fatalf("expected the running loop to be ready, got %d: %#v", code, readiness)
+	}
+	err := cm.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectNotReady(t, app, "broadcast")
+}
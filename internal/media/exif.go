@@ -0,0 +1,205 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+)
+
+const (
+	tagOrientation = 0x0112
+	tagGPSInfo     = 0x8825
+)
+
+var (
+	jpegSOI     = []byte{0xFF, 0xD8}
+	pngMagic    = []byte("\x89PNG\r\n\x1a\n")
+	exifHeader  = []byte("Exif\x00\x00")
+	pngExifType = []byte("eXIf")
+)
+
+// Erases the GPS data of every EXIF block of a JPEG or PNG, in place.
+//
+// The rest of the EXIF data is kept and the file keeps its size,
+// only the GPS entries and their values are zeroed.
+// Returns whether anything was erased.
+func StripLocation(data []byte) bool {
+	stripped := false
+	for _, block := range exifBlocks(data) {
+		if stripGPS(block.tiff) {
+			block.changed()
+			stripped = true
+		}
+	}
+	return stripped
+}
+
+// The EXIF orientation of the image, 1 (as stored) when it has none
+func Orientation(data []byte) int {
+	for _, block := range exifBlocks(data) {
+		t, ok := parseTIFF(block.tiff)
+		if !ok {
+			continue
+		}
+		entry, ok := t.find(t.ifd0, tagOrientation)
+		if !ok {
+			continue
+		}
+		o := int(t.order.Uint16(t.b[entry+8:]))
+		if o >= 1 && o <= 8 {
+			return o
+		}
+	}
+	return 1
+}
+
+// TIFF data of an EXIF block, changed has to be called after modifying it
+type exifBlock struct {
+	tiff    []byte
+	changed func()
+}
+
+// Every EXIF block of a JPEG (APP1 segments) or PNG (eXIf chunks), as slices of data
+func exifBlocks(data []byte) []exifBlock {
+	blocks := []exifBlock{}
+	switch {
+	case bytes.HasPrefix(data, jpegSOI):
+		pos := len(jpegSOI)
+		for pos+4 <= len(data) && data[pos] == 0xFF {
+			marker := data[pos+1]
+			// Any number of 0xFF fill bytes can come before a marker, the last one starts it
+			if marker == 0xFF {
+				pos++
+				continue
+			}
+			// Standalone markers have no length
+			if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+				pos += 2
+				continue
+			}
+			// Image data starts, no more metadata
+			if marker == 0xDA || marker == 0xD9 {
+				break
+			}
+			length := int(binary.BigEndian.Uint16(data[pos+2:]))
+			end := pos + 2 + length
+			if length < 2 || end > len(data) {
+				break
+			}
+			segment := data[pos+4 : end]
+			if marker == 0xE1 && bytes.HasPrefix(segment, exifHeader) {
+				blocks = append(blocks, exifBlock{tiff: segment[len(exifHeader):], changed: func() {}})
+			}
+			pos = end
+		}
+	case bytes.HasPrefix(data, pngMagic):
+		pos := len(pngMagic)
+		for pos+12 <= len(data) {
+			length := int(binary.BigEndian.Uint32(data[pos:]))
+			end := pos + 12 + length
+			if end > len(data) {
+				break
+			}
+			chunk_type := data[pos+4 : pos+8]
+			if bytes.Equal(chunk_type, pngExifType) {
+				chunk := data[pos+4 : pos+8+length]
+				crc := data[pos+8+length : end]
+				blocks = append(blocks, exifBlock{tiff: data[pos+8 : pos+8+length], changed: func() {
+					binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(chunk))
+				}})
+			}
+			pos = end
+		}
+	}
+	return blocks
+}
+
+type tiff struct {
+	b     []byte
+	order binary.ByteOrder
+	ifd0  int
+}
+
+func parseTIFF(b []byte) (*tiff, bool) {
+	if len(b) < 8 {
+		return nil, false
+	}
+	t := &tiff{b: b}
+	switch string(b[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, false
+	}
+	if t.order.Uint16(b[2:]) != 42 {
+		return nil, false
+	}
+	t.ifd0 = int(t.order.Uint32(b[4:]))
+	if _, ok := t.entries(t.ifd0); !ok {
+		return nil, false
+	}
+	return t, true
+}
+
+// Number of entries of the IFD at offset, false if it doesn't fit in the data
+func (t *tiff) entries(offset int) (int, bool) {
+	if offset < 8 || offset+2 > len(t.b) {
+		return 0, false
+	}
+	n := int(t.order.Uint16(t.b[offset:]))
+	if offset+2+n*12 > len(t.b) {
+		return 0, false
+	}
+	return n, true
+}
+
+// Offset of the entry with the tag in the IFD at offset
+func (t *tiff) find(offset int, tag uint16) (int, bool) {
+	n, ok := t.entries(offset)
+	if !ok {
+		return 0, false
+	}
+	for i := range n {
+		entry := offset + 2 + i*12
+		if t.order.Uint16(t.b[entry:]) == tag {
+			return entry, true
+		}
+	}
+	return 0, false
+}
+
+// Bytes per value of each TIFF field type
+var typeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+func stripGPS(b []byte) bool {
+	t, ok := parseTIFF(b)
+	if !ok {
+		return false
+	}
+	pointer, ok := t.find(t.ifd0, tagGPSInfo)
+	if !ok {
+		return false
+	}
+	gps := int(t.order.Uint32(t.b[pointer+8:]))
+	n, ok := t.entries(gps)
+	if !ok || n == 0 {
+		return false
+	}
+
+	for i := range n {
+		entry := gps + 2 + i*12
+		size := typeSizes[t.order.Uint16(t.b[entry+2:])] * int(t.order.Uint32(t.b[entry+4:]))
+		// Values of up to 4 bytes are stored in the entry itself
+		if size > 4 {
+			value := int(t.order.Uint32(t.b[entry+8:]))
+			if value >= 8 && value+size <= len(t.b) && value+size > value {
+				clear(t.b[value : value+size])
+			}
+		}
+	}
+	clear(t.b[gps+2 : gps+2+n*12])
+	t.order.PutUint16(t.b[gps:], 0)
+	return true
+}
@@ -0,0 +1,301 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"slices"
+	"testing"
+)
+
+// Both TIFF byte orders, read and appended to
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+var byteOrders = []byteOrder{binary.LittleEndian, binary.BigEndian}
+
+// Where the parts of a TIFF built by newTIFF are, to break them
+type tiffFixture struct {
+	b     []byte
+	order byteOrder
+	// Offset of the value of the GPS pointer in IFD0
+	gpsPointer int
+	// Offset of the GPS IFD
+	gps int
+	// Offset of the GPSLatitude entry
+	latitude int
+}
+
+// Rational values of the coordinates, 37°58'12.34" and 23°43'56.78"
+func coordinates(order byteOrder) ([]byte, []byte) {
+	rationals := func(values ...uint32) []byte {
+		b := []byte{}
+		for _, v := range values {
+			b = order.AppendUint32(b, v)
+		}
+		return b
+	}
+	return rationals(37, 1, 58, 1, 1234, 100), rationals(23, 1, 43, 1, 5678, 100)
+}
+
+// A TIFF with the orientation in IFD0 and, when gps, a GPS IFD with the coordinates
+func newTIFF(order byteOrder, orientation uint16, gps bool) *tiffFixture {
+	f := &tiffFixture{order: order}
+	entry := func(b []byte, tag uint16, field_type uint16, count uint32, value []byte) []byte {
+		b = order.AppendUint16(b, tag)
+		b = order.AppendUint16(b, field_type)
+		b = order.AppendUint32(b, count)
+		return append(b, append(value, make([]byte, 4-len(value))...)...)
+	}
+
+	b := []byte("II")
+	if order.String() == binary.BigEndian.String() {
+		b = []byte("MM")
+	}
+	b = order.AppendUint16(b, 42)
+	b = order.AppendUint32(b, 8)
+
+	ifd0_entries := uint16(1)
+	if gps {
+		ifd0_entries++
+	}
+	f.gps = 8 + 2 + int(ifd0_entries)*12 + 4
+	b = order.AppendUint16(b, ifd0_entries)
+	b = entry(b, tagOrientation, 3, 1, order.AppendUint16(nil, orientation))
+	if gps {
+		f.gpsPointer = len(b) + 8
+		b = entry(b, tagGPSInfo, 4, 1, order.AppendUint32(nil, uint32(f.gps)))
+	}
+	b = order.AppendUint32(b, 0)
+	if !gps {
+		f.b = b
+		return f
+	}
+
+	latitude, longitude := coordinates(order)
+	values := f.gps + 2 + 4*12 + 4
+	b = order.AppendUint16(b, 4)
+	b = entry(b, 1, 2, 2, []byte("N\x00"))
+	f.latitude = len(b)
+	b = entry(b, 2, 5, 3, order.AppendUint32(nil, uint32(values)))
+	b = entry(b, 3, 2, 2, []byte("E\x00"))
+	b = entry(b, 4, 5, 3, order.AppendUint32(nil, uint32(values+len(latitude))))
+	b = order.AppendUint32(b, 0)
+	b = append(b, latitude...)
+	f.b = append(b, longitude...)
+	return f
+}
+
+func newImage(width int, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.SetRGBA(x, y, color.RGBA{R: uint8(x * 255 / width), G: uint8(y * 255 / height), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+// A JPEG of the image with the TIFF in an APP1 segment, after fill 0xFF fill bytes
+func newJPEG(t *testing.T, img image.Image, tiff []byte, fill int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, img, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if tiff == nil {
+		return data
+	}
+
+	segment := bytes.Repeat([]byte{0xFF}, fill)
+	segment = append(segment, 0xFF, 0xE1)
+	segment = binary.BigEndian.AppendUint16(segment, uint16(2+len(exifHeader)+len(tiff)))
+	segment = append(segment, exifHeader...)
+	segment = append(segment, tiff...)
+	return slices.Insert(data, len(jpegSOI), segment...)
+}
+
+// A PNG of the image with the TIFF in an eXIf chunk right after IHDR
+func newPNG(t *testing.T, img image.Image, tiff []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(tiff)))
+	chunk = append(chunk, pngExifType...)
+	chunk = append(chunk, tiff...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	ihdr_end := len(pngMagic) + 12 + 13
+	return slices.Insert(data, ihdr_end, chunk...)
+}
+
+// Checks the GPS IFD of every EXIF block is empty and the coordinates are gone from the file
+func expectNoLocation(t *testing.T, name string, data []byte, order byteOrder) {
+	t.Helper()
+	latitude, longitude := coordinates(order)
+	if bytes.Contains(data, latitude) || bytes.Contains(data, longitude) {
+		t.Errorf("%s: expected the coordinates to be erased", name)
+	}
+	blocks := exifBlocks(data)
+	if len(blocks) == 0 {
+		t.Errorf("%s: expected the EXIF block to be kept", name)
+	}
+	for _, block := range blocks {
+		tiff, ok := parseTIFF(block.tiff)
+		if !ok {
+			t.Errorf("%s: expected the EXIF block to stay valid", name)
+			continue
+		}
+		pointer, ok := tiff.find(tiff.ifd0, tagGPSInfo)
+		if !ok {
+			continue
+		}
+		n, ok := tiff.entries(int(tiff.order.Uint32(tiff.b[pointer+8:])))
+		if !ok || n != 0 {
+			t.Errorf("%s: expected the GPS IFD to have no entries, got %d", name, n)
+		}
+	}
+}
+
+func TestStripLocation(t *testing.T) {
+	img := newImage(16, 8)
+	for _, order := range byteOrders {
+		cases := []struct {
+			name   string
+			data   []byte
+			decode func(r *bytes.Reader) (image.Image, error)
+		}{
+			{"jpeg", newJPEG(t, img, newTIFF(order, 6, true).b, 0), func(r *bytes.Reader) (image.Image, error) { return jpeg.Decode(r) }},
+			{"jpeg after a fill byte", newJPEG(t, img, newTIFF(order, 6, true).b, 1), func(r *bytes.Reader) (image.Image, error) { return jpeg.Decode(r) }},
+			{"jpeg after fill bytes", newJPEG(t, img, newTIFF(order, 6, true).b, 3), func(r *bytes.Reader) (image.Image, error) { return jpeg.Decode(r) }},
+			{"png", newPNG(t, img, newTIFF(order, 6, true).b), func(r *bytes.Reader) (image.Image, error) { return png.Decode(r) }},
+		}
+		for _, tc := range cases {
+			name := tc.name + " " + order.String()
+			size := len(tc.data)
+			if !StripLocation(tc.data) {
+				t.Errorf("%s: expected the location to be stripped", name)
+			}
+			expectNoLocation(t, name, tc.data, order)
+			if len(tc.data) != size {
+				t.Errorf("%s: expected the size to stay %d, got %d", name, size, len(tc.data))
+			}
+			// The rest of the EXIF data is kept and the PNG checksum still matches
+			if o := Orientation(tc.data); o != 6 {
+				t.Errorf("%s: expected the orientation to be kept, got %d", name, o)
+			}
+			_, err := tc.decode(bytes.NewReader(tc.data))
+			if err != nil {
+				t.Errorf("%s: expected the image to still decode, got %s", name, err)
+			}
+			if StripLocation(tc.data) {
+				t.Errorf("%s: expected nothing left to strip", name)
+			}
+		}
+	}
+
+	// Without GPS data or EXIF nothing changes
+	for name, data := range map[string][]byte{
+		"no gps":  newJPEG(t, img, newTIFF(binary.LittleEndian, 1, false).b, 0),
+		"no exif": newJPEG(t, img, nil, 0),
+		"gif":     []byte("GIF89a"),
+	} {
+		original := slices.Clone(data)
+		if StripLocation(data) || !bytes.Equal(data, original) {
+			t.Errorf("%s: expected nothing to be stripped", name)
+		}
+	}
+}
+
+// Broken EXIF data is left as it is, or only what fits is erased, without reading out of bounds
+func TestStripLocationBrokenEXIF(t *testing.T) {
+	cases := []struct {
+		name     string
+		breaks   func(f *tiffFixture)
+		stripped bool
+	}{
+		{"byte order", func(f *tiffFixture) { copy(f.b, "XX") }, false},
+		{"magic number", func(f *tiffFixture) { f.order.PutUint16(f.b[2:], 43) }, false},
+		{"ifd0 offset out of range", func(f *tiffFixture) { f.order.PutUint32(f.b[4:], 0xFFFFFFFF) }, false},
+		{"ifd0 offset into the header", func(f *tiffFixture) { f.order.PutUint32(f.b[4:], 2) }, false},
+		{"ifd0 entries out of range", func(f *tiffFixture) { f.order.PutUint16(f.b[8:], 0xFFFF) }, false},
+		{"gps offset out of range", func(f *tiffFixture) { f.order.PutUint32(f.b[f.gpsPointer:], 0xFFFFFFF0) }, false},
+		{"gps offset into the header", func(f *tiffFixture) { f.order.PutUint32(f.b[f.gpsPointer:], 4) }, false},
+		{"gps offset at the end", func(f *tiffFixture) { f.order.PutUint32(f.b[f.gpsPointer:], uint32(len(f.b)-1)) }, false},
+		{"gps entries out of range", func(f *tiffFixture) { f.order.PutUint16(f.b[f.gps:], 0xFFFF) }, false},
+		{"huge count", func(f *tiffFixture) { f.order.PutUint32(f.b[f.latitude+4:], 0xFFFFFFFF) }, true},
+		{"value offset out of range", func(f *tiffFixture) { f.order.PutUint32(f.b[f.latitude+8:], 0xFFFFFFFF) }, true},
+		{"value past the end", func(f *tiffFixture) { f.order.PutUint32(f.b[f.latitude+8:], uint32(len(f.b)-8)) }, true},
+		{"unknown type", func(f *tiffFixture) { f.order.PutUint16(f.b[f.latitude+2:], 99) }, true},
+	}
+	img := newImage(4, 4)
+	for _, tc := range cases {
+		for _, order := range byteOrders {
+			f := newTIFF(order, 6, true)
+			tc.breaks(f)
+			for _, data := range [][]byte{newJPEG(t, img, f.b, 0), newPNG(t, img, f.b)} {
+				if StripLocation(data) != tc.stripped {
+					t.Errorf("%s %s: expected stripped to be %t", tc.name, order, tc.stripped)
+				}
+				Orientation(data)
+			}
+		}
+	}
+}
+
+// Every prefix of a file is handled, as uploads can be cut short
+func TestStripLocationTruncated(t *testing.T) {
+	img := newImage(4, 4)
+	tiff := newTIFF(binary.BigEndian, 6, true).b
+	for _, data := range [][]byte{newJPEG(t, img, tiff, 2), newPNG(t, img, tiff)} {
+		for i := range len(data) {
+			truncated := slices.Clone(data[:i])
+			StripLocation(truncated)
+			Orientation(truncated)
+		}
+	}
+
+	// A segment length past the end or below its own size ends the search
+	data := newJPEG(t, img, tiff, 0)
+	binary.BigEndian.PutUint16(data[len(jpegSOI)+2:], 0xFFFF)
+	if StripLocation(data) {
+		t.Fatal("expected a segment past the end to be ignored")
+	}
+	binary.BigEndian.PutUint16(data[len(jpegSOI)+2:], 1)
+	if StripLocation(data) {
+		t.Fatal("expected a segment shorter than its length field to be ignored")
+	}
+}
+
+func TestOrientation(t *testing.T) {
+	img := newImage(4, 4)
+	for _, order := range byteOrders {
+		for orientation := range uint16(10) {
+			expected := int(orientation)
+			if orientation < 1 || orientation > 8 {
+				expected = 1
+			}
+			tiff := newTIFF(order, orientation, orientation%2 == 0).b
+			for name, data := range map[string][]byte{"jpeg": newJPEG(t, img, tiff, 0), "png": newPNG(t, img, tiff)} {
+				if o := Orientation(data); o != expected {
+					t.Errorf("%s %s with %d: expected %d, got %d", name, order, orientation, expected, o)
+				}
+			}
+		}
+	}
+	if o := Orientation(newJPEG(t, img, nil, 0)); o != 1 {
+		t.Fatalf("expected 1 without EXIF, got %d", o)
+	}
+}
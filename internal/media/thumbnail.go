@@ -0,0 +1,170 @@
+// Package media extracts what clients need to preview uploaded images.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	// Thumbnails fit in a ThumbnailSize square
+	ThumbnailSize = 320
+	// Images with more pixels aren't decoded, it would take too much memory
+	maxPixels = 40_000_000
+)
+
+var (
+	ErrUnsupportedImage = errors.New("unsupported image")
+	ErrImageTooLarge    = errors.New("image too large")
+)
+
+// Content types Thumbnail can decode
+func IsImage(content_type string) bool {
+	return content_type == "image/png" || content_type == "image/jpeg" || content_type == "image/gif"
+}
+
+// Content type of the thumbnails of images of content_type, photos stay JPEGs
+func ThumbnailType(content_type string) string {
+	if content_type == "image/jpeg" {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+// A scaled down copy of an image and the size it is displayed at
+type Preview struct {
+	Thumbnail []byte
+	Width     int
+	Height    int
+}
+
+// Makes the thumbnail of a PNG, JPEG or GIF, see Scale.
+//
+// Might return ErrUnsupportedImage, ErrImageTooLarge or any decoding error
+func Thumbnail(data []byte, content_type string) (*Preview, error) {
+	thumb, width, height, err := Scale(data, content_type, ThumbnailSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if ThumbnailType(content_type) == "image/jpeg" {
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 80})
+	} else {
+		err = png.Encode(&buf, thumb)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Preview{Thumbnail: buf.Bytes(), Width: width, Height: height}
+	return p, nil
+}
+
+// Decodes a PNG, JPEG or the first frame of a GIF and scales it down to fit in a size square.
+//
+// The EXIF orientation is applied, so the image and the size it returns are as it is displayed,
+// the size being the one of the original.
+// Might return ErrUnsupportedImage, ErrImageTooLarge or any decoding error
+func Scale(data []byte, content_type string, size int) (image.Image, int, int, error) {
+	var decode func(r *bytes.Reader) (image.Image, error)
+	var decode_config func(r *bytes.Reader) (image.Config, error)
+	switch content_type {
+	case "image/png":
+		decode = func(r *bytes.Reader) (image.Image, error) { return png.Decode(r) }
+		decode_config = func(r *bytes.Reader) (image.Config, error) { return png.DecodeConfig(r) }
+	case "image/jpeg":
+		decode = func(r *bytes.Reader) (image.Image, error) { return jpeg.Decode(r) }
+		decode_config = func(r *bytes.Reader) (image.Config, error) { return jpeg.DecodeConfig(r) }
+	case "image/gif":
+		decode = func(r *bytes.Reader) (image.Image, error) { return gif.Decode(r) }
+		decode_config = func(r *bytes.Reader) (image.Config, error) { return gif.DecodeConfig(r) }
+	default:
+		return nil, 0, 0, fmt.Errorf("%w: `%s`", ErrUnsupportedImage, content_type)
+	}
+
+	config, err := decode_config(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, 0, 0, fmt.Errorf("%w: %dx%d", ErrImageTooLarge, config.Width, config.Height)
+	}
+
+	src, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	orientation := Orientation(data)
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+
+	// Scaled before it is turned, the stored width is the displayed height when the orientation swaps them
+	scaled_width, scaled_height := fit(width, height, size)
+	if orientation >= 5 {
+		scaled_height, scaled_width = fit(height, width, size)
+	}
+	scaled := image.NewRGBA(image.Rect(0, 0, scaled_width, scaled_height))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), src, src.Bounds(), draw.Src, nil)
+
+	if orientation >= 5 {
+		width, height = height, width
+	}
+	return orient(scaled, orientation), width, height, nil
+}
+
+// Size of a width x height image scaled down to fit in a size square, never scaled up
+func fit(width int, height int, size int) (int, int) {
+	if width <= size && height <= size {
+		return width, height
+	}
+	if width >= height {
+		return size, max(1, height*size/width)
+	}
+	return max(1, width*size/height), size
+}
+
+// Turns an image stored with an EXIF orientation the way it is displayed
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dst_w, dst_h := w, h
+	if orientation >= 5 {
+		dst_w, dst_h = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dst_w, dst_h))
+
+	for y := range h {
+		for x := range w {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.SetRGBA(dx, dy, src.RGBAAt(x, y))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,150 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestFit(t *testing.T) {
+	cases := []struct {
+		width, height, size             int
+		expected_width, expected_height int
+	}{
+		{100, 50, 320, 100, 50},
+		{320, 320, 320, 320, 320},
+		{640, 480, 320, 320, 240},
+		{480, 640, 320, 240, 320},
+		{1000, 1000, 320, 320, 320},
+		{10000, 1, 320, 320, 1},
+		{1, 10000, 320, 1, 320},
+	}
+	for _, tc := range cases {
+		width, height := fit(tc.width, tc.height, tc.size)
+		if width != tc.expected_width || height != tc.expected_height {
+			t.Errorf("%dx%d in %d: expected %dx%d, got %dx%d", tc.width, tc.height, tc.size, tc.expected_width, tc.expected_height, width, height)
+		}
+	}
+}
+
+// The corners of a 3x2 image each have their own color, orienting it moves them
+// where the EXIF orientation says the stored corners are displayed
+func TestOrient(t *testing.T) {
+	top_left := color.RGBA{R: 255, A: 255}
+	top_right := color.RGBA{G: 255, A: 255}
+	bottom_left := color.RGBA{B: 255, A: 255}
+	bottom_right := color.RGBA{R: 255, G: 255, A: 255}
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	src.SetRGBA(0, 0, top_left)
+	src.SetRGBA(2, 0, top_right)
+	src.SetRGBA(0, 1, bottom_left)
+	src.SetRGBA(2, 1, bottom_right)
+
+	// The stored corners displayed at the top left, top right and bottom left
+	cases := map[int][3]color.RGBA{
+		1: {top_left, top_right, bottom_left},
+		2: {top_right, top_left, bottom_right},
+		3: {bottom_right, bottom_left, top_right},
+		4: {bottom_left, bottom_right, top_left},
+		5: {top_left, bottom_left, top_right},
+		6: {bottom_left, top_left, bottom_right},
+		7: {bottom_right, top_right, bottom_left},
+		8: {top_right, bottom_right, top_left},
+	}
+	for orientation, corners := range cases {
+		dst := orient(src, orientation)
+		w, h := dst.Bounds().Dx(), dst.Bounds().Dy()
+		if (orientation >= 5 && (w != 2 || h != 3)) || (orientation < 5 && (w != 3 || h != 2)) {
+			t.Errorf("%d: unexpected size %dx%d", orientation, w, h)
+			continue
+		}
+		got := [3]color.RGBA{dst.RGBAAt(0, 0), dst.RGBAAt(w-1, 0), dst.RGBAAt(0, h-1)}
+		if got != corners {
+			t.Errorf("%d: expected the corners %v, got %v", orientation, corners, got)
+		}
+	}
+	if orient(src, 0) != src || orient(src, 9) != src {
+		t.Fatal("expected unknown orientations to leave the image as it is")
+	}
+}
+
+// The thumbnail and the size are as the image is displayed, the size being the original one
+func TestScale(t *testing.T) {
+	img := newImage(640, 320)
+	for orientation := range uint16(9) {
+		data := newJPEG(t, img, newTIFF(binary.LittleEndian, orientation, true).b, 0)
+		scaled, width, height, err := Scale(data, "image/jpeg", 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected_width, expected_height, scaled_width, scaled_height := 640, 320, 64, 32
+		if orientation >= 5 {
+			expected_width, expected_height, scaled_width, scaled_height = 320, 640, 32, 64
+		}
+		if width != expected_width || height != expected_height || scaled.Bounds().Dx() != scaled_width || scaled.Bounds().Dy() != scaled_height {
+			t.Errorf("%d: expected %dx%d scaled to %dx%d, got %dx%d scaled to %dx%d", orientation,
+				expected_width, expected_height, scaled_width, scaled_height, width, height, scaled.Bounds().Dx(), scaled.Bounds().Dy())
+		}
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	img := newImage(40, 20)
+	cases := []struct {
+		content_type string
+		data         []byte
+		decode       func(r *bytes.Reader) (image.Image, error)
+	}{
+		{"image/jpeg", newJPEG(t, img, nil, 0), func(r *bytes.Reader) (image.Image, error) { return jpeg.Decode(r) }},
+		{"image/png", newPNG(t, img, newTIFF(binary.BigEndian, 1, false).b), func(r *bytes.Reader) (image.Image, error) { return png.Decode(r) }},
+	}
+	for _, tc := range cases {
+		preview, err := Thumbnail(tc.data, tc.content_type)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.content_type, err)
+		}
+		thumb, err := tc.decode(bytes.NewReader(preview.Thumbnail))
+		if err != nil {
+			t.Fatalf("%s: expected a %s thumbnail, got %s", tc.content_type, ThumbnailType(tc.content_type), err)
+		}
+		if preview.Width != 40 || preview.Height != 20 || thumb.Bounds().Dx() != 40 || thumb.Bounds().Dy() != 20 {
+			t.Fatalf("%s: expected a small image to keep its size, got %dx%d", tc.content_type, thumb.Bounds().Dx(), thumb.Bounds().Dy())
+		}
+	}
+
+	_, err := Thumbnail(tooLargePNG(t), "image/png")
+	if !errors.Is(err, ErrImageTooLarge) {
+		t.Fatalf("expected ErrImageTooLarge, got %v", err)
+	}
+	_, err = Thumbnail([]byte("<svg/>"), "image/svg+xml")
+	if !errors.Is(err, ErrUnsupportedImage) {
+		t.Fatalf("expected ErrUnsupportedImage, got %v", err)
+	}
+	_, err = Thumbnail(newJPEG(t, img, nil, 0)[:100], "image/jpeg")
+	if err == nil {
+		t.Fatal("expected a truncated JPEG to fail to decode")
+	}
+}
+
+// A PNG whose header says it has more than maxPixels pixels, with no image data to decode
+func tooLargePNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	err := png.Encode(&buf, newImage(1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	ihdr := data[len(pngMagic)+4 : len(pngMagic)+8+13]
+	binary.BigEndian.PutUint32(ihdr[4:], 8000)
+	binary.BigEndian.PutUint32(ihdr[8:], 6000)
+	binary.BigEndian.PutUint32(data[len(pngMagic)+8+13:], crc32.ChecksumIEEE(ihdr))
+	return data
+}
@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestMentions(t *testing.T) {
+	s, _ := newTestAPI(t)
+
+	maria := newTestUser(t, s, "maria")
+	bob := newTestUser(t, s, "bob")
+	bobby := newTestUser(t, s, "bobby")
+	elodie := newTestUser(t, s, "élodie")
+	server_id, tab_id := newTestServer(t, s, "Gamiades", maria, bob, bobby, elodie)
+
+	for _, text := range []string{
+		"@bob",
+		"hey @BOB, look",
+		"@bobby only",
+		"bob@example.com",
+		"@b%b and @b_b",
+		"@bo%",
+		// Decomposed, it's only the same username once the text is normalized
+		"@E\u0301LODIE!",
+		"@élodies",
+	} {
+		_, err := s.message_service.Create(&models.Message{Text: text, Sender: &models.User{Id: maria}, Tab: &models.Tab{Id: tab_id}, DateSent: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for user_id, mentions := range map[uuid.UUID]int64{bob: 2, bobby: 1, elodie: 1, maria: 0} {
+		read_states, err := s.read_state_service.GetByServerID(user_id, server_id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if read_states[tab_id].Mentions != mentions {
+			t.Fatalf("expected %d mentions of %s, got %#v", mentions, user_id, read_states[tab_id])
+		}
+	}
+}
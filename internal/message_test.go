@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestMessageSenderIsTheSession(t *testing.T) {
+	s, app := newTestAPI(t)
+
+	nikos := newTestUser(t, s, "nikos")
+	maria := newTestUser(t, s, "maria")
+	_, tab_id := newTestServer(t, s, "Gamiades", nikos, maria)
+	session := login(t, app, "maria", "123")
+
+	// Naming someone else as the sender neither sends as them nor gets around the message limit
+	for i := range models.MessageRateLimit.Requests + 1 {
+		sender := &models.User{Id: uuid.New()}
+		if i == 0 {
+			sender.Id = nikos
+		}
+		message := models.Message{Text: "kalhspera", Sender: sender, Tab: &models.Tab{Id: tab_id}, DateSent: time.Now()}
+		resp, body := request(t, app, fiber.MethodPost, "/message", message, session)
+
+		if i < models.MessageRateLimit.Requests && resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("message %d: expected it to be sent, got %d: %s", i, resp.StatusCode, body)
+		}
+		if i == models.MessageRateLimit.Requests && resp.StatusCode != fiber.StatusTooManyRequests {
+			t.Fatalf("message %d: expected maria to be rate limited, got %d: %s", i, resp.StatusCode, body)
+		}
+	}
+
+	messages, err := s.message_service.GetByTabID(tab_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != models.MessageRateLimit.Requests {
+		t.Fatalf("expected %d messages, got %d", models.MessageRateLimit.Requests, len(messages))
+	}
+	for _, msg := range messages {
+		if msg.Sender == nil || msg.Sender.Id != maria {
+			t.Fatalf("expected every message to be sent by maria, got %#v", msg.Sender)
+		}
+	}
+}
+
+func TestMessagePageDefaultLimit(t *testing.T) {
+	s, app := newTestAPI(t)
+
+	nikos := newTestUser(t, s, "nikos")
+	_, tab_id := newTestServer(t, s, "Gamiades", nikos)
+	session := login(t, app, "nikos", "123")
+
+	ids := []int64{}
+	for range models.MaxMessagePage + 5 {
+		id, err := s.message_service.Create(&models.Message{Text: "kalhspera", Sender: &models.User{Id: nikos}, Tab: &models.Tab{Id: tab_id}, DateSent: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	// Without a limit it's the newest page, not the whole tab
+	resp, body := request(t, app, fiber.MethodGet, "/message/tab/"+tab_id.String(), nil, session)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected the messages, got %d: %s", resp.StatusCode, body)
+	}
+	messages := []models.Message{}
+	err := json.Unmarshal(body, &messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != models.MaxMessagePage || messages[0].Id != ids[5] || messages[len(messages)-1].Id != ids[len(ids)-1] {
+		t.Fatalf("expected the newest %d messages, from %d to %d, got %d", models.MaxMessagePage, ids[5], ids[len(ids)-1], len(messages))
+	}
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const (
+	namespace = "chatter"
+
+	// Values of the target label of WriteFailures
+	TargetDatabase  = "database"
+	TargetWebsocket = "websocket"
+)
+
+var (
+	// Everything served on /metrics, kept apart from the global registry so only chatter's metrics end up there
+	Registry = prometheus.NewRegistry()
+
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests answered, by route and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to answer HTTP requests, by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	WebsocketConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_connections",
+		Help:      "Open websocket connections.",
+	})
+
+	MessagesPersisted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_persisted_total",
+		Help:      "Messages stored, rate() gives messages per second.",
+	})
+
+	BroadcastDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "broadcast_fanout_seconds",
+		Help:      "Time taken to push a message to every connected member of its server.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	})
+
+	WriteFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "write_failures_total",
+		Help:      "Failed writes of messages to the database and of events to websocket connections.",
+	}, []string{"target"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		WebsocketConnections,
+		MessagesPersisted,
+		BroadcastDuration,
+		WriteFailures,
+	)
+	// Both targets show up from the start, even at zero
+	WriteFailures.WithLabelValues(TargetDatabase)
+	WriteFailures.WithLabelValues(TargetWebsocket)
+}
+
+// Exposes the stats of the connection pool, storages without one have none to expose.
+//
+// Might return an error when a pool is registered already
+func RegisterDBStats(db *sql.DB) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, namespace))
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/metrics"
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMessagesPersistedMetric(t *testing.T) {
+	s, _ := newTestAPI(t)
+
+	nikos := newTestUser(t, s, "nikos")
+	_, tab_id := newTestServer(t, s, "Gamiades", nikos)
+
+	before := testutil.ToFloat64(metrics.MessagesPersisted)
+	_, err := s.message_service.Create(&models.Message{Text: "kalhspera", Sender: &models.User{Id: nikos}, Tab: &models.Tab{Id: tab_id}, DateSent: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(metrics.MessagesPersisted); got != before+1 {
+		t.Fatalf("expected %s to go from %v to %v, got %v", "messages_persisted_total", before, before+1, got)
+	}
+
+	// Messages that fail to be stored aren't counted
+	_, err = s.message_service.Create(&models.Message{Text: " ", Sender: &models.User{Id: nikos}, Tab: &models.Tab{Id: tab_id}, DateSent: time.Now()})
+	if err == nil {
+		t.Fatal("expected an empty message to be refused")
+	}
+	if got := testutil.ToFloat64(metrics.MessagesPersisted); got != before+1 {
+		t.Fatalf("expected a refused message not to be counted, got %v", got)
+	}
+}
+
+func TestHTTPMetricsLabels(t *testing.T) {
+	s, app := newTestAPI(t)
+	nikos := newTestUser(t, s, "nikos")
+
+	route := APIBasePath + "/user/:id"
+	counted := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(fiber.MethodGet, route, "200"))
+	timed := observations(t, fiber.MethodGet, route)
+
+	resp, body := request(t, app, fiber.MethodGet, "/user/"+nikos.String(), nil, "")
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected the user, got %d: %s", resp.StatusCode, body)
+	}
+
+	// Under the route it matched, ids don't get series of their own
+	if got := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(fiber.MethodGet, route, "200")); got != counted+1 {
+		t.Fatalf("expected the request to be counted under %s, went from %v to %v", route, counted, got)
+	}
+	if got := observations(t, fiber.MethodGet, route); got != timed+1 {
+		t.Fatalf("expected the request to be timed under %s, went from %d to %d", route, timed, got)
+	}
+	if got := observations(t, fiber.MethodGet, APIBasePath+"/user/"+nikos.String()); got != 0 {
+		t.Fatalf("expected no series for the path, got %d observations", got)
+	}
+
+	problems, err := testutil.CollectAndLint(metrics.HTTPRequestDuration)
+	if err != nil || len(problems) != 0 {
+		t.Fatalf("expected the histogram to lint clean, got %v, %v", problems, err)
+	}
+}
+
+// Observations of the request duration histogram with the labels, from the registry served on /metrics
+func observations(t *testing.T, method string, route string) uint64 {
+	t.Helper()
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != "chatter_http_request_duration_seconds" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range m.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["method"] == method && labels["route"] == route {
+				return m.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Authenticates the admin API through the Authorization: Bearer <token> header.
+func AdminToken(token string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		got, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			return common.JSONErr(c, common.ErrUnauthorized)
+		}
+
+		return c.Next()
+	}
+}
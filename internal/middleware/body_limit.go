@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Rejects request bodies over limit, or over the limit of their route in raised, keyed by "METHOD /path".
+//
+// Meant for apps with fiber.Config.StreamRequestBody, so larger bodies are turned down
+// before they are read, bodies without a Content-Length are read up to the limit.
+func BodyLimit(limit int, raised map[string]int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		max := limit
+		if route_limit, ok := raised[c.Method()+" "+c.Path()]; ok {
+			max = route_limit
+		}
+
+		req := c.Request()
+		length := req.Header.ContentLength()
+		if length > max {
+			// The rest of the body is left unread, the connection can't be reused
+			c.Context().SetConnectionClose()
+			return common.JSONErr(c, fmt.Errorf("%w: %d bytes, at most %d are allowed", common.ErrBodyTooLarge, length, max))
+		}
+		if length == -1 && req.IsBodyStream() {
+			body, err := io.ReadAll(io.LimitReader(req.BodyStream(), int64(max)+1))
+			if err != nil {
+				return common.JSONErr(c, fmt.Errorf("%w: %w", common.ErrInvalidBody, err))
+			}
+			if len(body) > max {
+				c.Context().SetConnectionClose()
+				return common.JSONErr(c, fmt.Errorf("%w: at most %d bytes are allowed", common.ErrBodyTooLarge, max))
+			}
+			req.SetBody(body)
+		}
+
+		return c.Next()
+	}
+}
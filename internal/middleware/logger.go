@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	// Longest body logged, larger ones only have their size logged
+	maxLoggedBody = 16 << 10
+)
+
+// Logs every request as one JSON line with its request id, user and latency.
+//
+// Bodies are only logged with log_bodies, and only JSON ones with their sensitive fields redacted,
+// uploads and other binary bodies are logged by size.
+func Logger(logger *slog.Logger, log_bodies bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		err := c.Next()
+		if err != nil {
+			// Handled here so the status that is logged is the one sent
+			err = common.ErrorHandler(c, err)
+			if err != nil {
+				c.Status(fiber.StatusInternalServerError)
+			}
+		}
+
+		status := c.Response().StatusCode()
+		level := slog.LevelInfo
+		switch {
+		case status >= fiber.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= fiber.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		if !logger.Enabled(c.UserContext(), level) {
+			return nil
+		}
+
+		attrs := []slog.Attr{
+			slog.String("request_id", common.RequestId(c)),
+			slog.String("method", c.Method()),
+			slog.String("path", c.Path()),
+			slog.String("route", c.Route().Path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("ip", c.IP()),
+			slog.Int("bytes", len(c.Response().Body())),
+		}
+		if id := common.UserId(c); id != uuid.Nil {
+			attrs = append(attrs, slog.String("user_id", id.String()))
+		}
+		if query := redactQuery(c); query != "" {
+			attrs = append(attrs, slog.String("query", query))
+		}
+		if code := errorCode(status, c.Response().Body()); code != "" {
+			attrs = append(attrs, slog.String("error_code", code))
+		}
+		// Only bodies short enough to be logged are read, those turned down by BodyLimit are never read in full
+		if length := c.Request().Header.ContentLength(); log_bodies && length >= 0 && length <= maxLoggedBody {
+			attrs = appendBody(attrs, "req_body", string(c.Request().Header.ContentType()), c.Body())
+		}
+		if log_bodies {
+			attrs = appendBody(attrs, "res_body", string(c.Response().Header.ContentType()), c.Response().Body())
+		}
+
+		logger.LogAttrs(c.UserContext(), level, "request", attrs...)
+		return nil
+	}
+}
+
+// The query string with the values of sensitive parameters replaced
+func redactQuery(c *fiber.Ctx) string {
+	var b strings.Builder
+	c.Context().QueryArgs().VisitAll(func(key []byte, value []byte) {
+		if b.Len() > 0 {
+			b.WriteByte('&')
+		}
+		b.Write(key)
+		b.WriteByte('=')
+		if common.IsSensitive(string(key)) {
+			b.WriteString(common.Redacted)
+		} else {
+			b.Write(value)
+		}
+	})
+	return b.String()
+}
+
+// The code of the ErrorResponse a failed request was answered with
+func errorCode(status int, body []byte) string {
+	if status < fiber.StatusBadRequest {
+		return ""
+	}
+	res := common.ErrorResponse{}
+	_ = json.Unmarshal(body, &res)
+	return res.Code
+}
+
+func appendBody(attrs []slog.Attr, key string, content_type string, data []byte) []slog.Attr {
+	if len(data) == 0 {
+		return attrs
+	}
+	if len(data) <= maxLoggedBody && strings.HasPrefix(content_type, fiber.MIMEApplicationJSON) {
+		redacted, ok := common.RedactJSON(data)
+		if ok {
+			return append(attrs, slog.Any(key, redacted))
+		}
+	}
+	return append(attrs, slog.Group(key, slog.String("content_type", content_type), slog.Int("size", len(data))))
+}
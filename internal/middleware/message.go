@@ -1,20 +1,33 @@
 package middleware
 
-// import (
-// 	"fmt"
+import (
+	"errors"
 
-// 	"github.com/NikosGour/chatter/internal/common"
-// 	"github.com/NikosGour/logging/log"
-// 	"github.com/gofiber/fiber/v2"
-// )
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/services"
+	"github.com/gofiber/fiber/v2"
+)
 
-// func WithMessangerId(c *fiber.Ctx) error {
-// 	cookie := c.Cookies(common.CookieMessangerId)
-// 	if cookie == "" {
-// 		msg := fmt.Errorf("`%s` cookie is empty", common.CookieMessangerId)
-// 		log.Error("%s", msg)
-// 		return common.JSONErr(c, msg.Error())
-// 	}
+// Authenticates the request through the messanger_id cookie, the user id is then available through common.UserId.
+//
+// Expired and revoked sessions, and those of users that have since been deleted or disabled, are rejected.
+func WithActiveUser(user_service *services.UserService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		session, err := common.ReadSession(c)
+		if err != nil {
+			return common.JSONErr(c, err)
+		}
 
-// 	// decrypted,err := encryptcookie.DecryptCookie(cookie,common.Dotenv[common.])
-// }
+		err = user_service.CheckSession(session)
+		if errors.Is(err, models.ErrUserNotFound) {
+			err = common.ErrUnauthorized
+		}
+		if err != nil {
+			return common.JSONErr(c, err)
+		}
+
+		c.Locals(common.LocalsUserId, session.UserId)
+		return c.Next()
+	}
+}
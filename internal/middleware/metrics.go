@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/chatter/internal/metrics"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// Counts and times requests by the route they matched, so paths with ids don't each get their own series.
+func Metrics() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		err := c.Next()
+		if err != nil {
+			err = common.ErrorHandler(c, err)
+			if err != nil {
+				c.Status(fiber.StatusInternalServerError)
+			}
+		}
+
+		// Labels outlive the request, the method fiber returns points into a buffer that is reused
+		method, route := utils.CopyString(c.Method()), utils.CopyString(c.Route().Path)
+		metrics.HTTPRequests.WithLabelValues(method, route, strconv.Itoa(c.Response().StatusCode())).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+		return nil
+	}
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Limits requests per address and, for logged in users, per user wherever they come from.
+func RateLimit(rate_limit_service *services.RateLimitService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := rate_limit_service.Take("ip:"+c.IP(), models.IPRateLimit)
+		if err != nil {
+			return common.JSONErr(c, err)
+		}
+
+		id, err := common.SessionUserId(c)
+		if err == nil {
+			err = rate_limit_service.Take("user:"+id.String(), models.UserRateLimit)
+			if err != nil {
+				return common.JSONErr(c, err)
+			}
+		}
+
+		return c.Next()
+	}
+}
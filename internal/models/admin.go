@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/NikosGour/chatter/internal/common"
+)
+
+// The live websocket connections, from GET /admin/connections
+type ConnectionStats struct {
+	Connections int `json:"connections"`
+	// Users with at least one connection
+	Users int `json:"users"`
+}
+
+// Body of POST /admin/users/:id/password
+type PasswordReset struct {
+	Password string `json:"password" validate:"required"`
+}
+
+func (p PasswordReset) Validate() error {
+	return common.Validate.Struct(p)
+}
+
+// A server with its members, tabs and every message, passwords left out
+type ServerExport struct {
+	ExportedAt time.Time `json:"exported_at"`
+	Server     Server    `json:"server"`
+	Members    []Member  `json:"members"`
+	Tabs       []Tab     `json:"tabs"`
+	Messages   []Message `json:"messages"`
+}
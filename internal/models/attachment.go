@@ -0,0 +1,50 @@
+package models
+
+import (
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/google/uuid"
+)
+
+const (
+	MaxAttachmentSize = 10 << 20
+	MaxAttachments    = 5
+)
+
+var (
+	ErrAttachmentNotFound = common.NewAPIError(http.StatusNotFound, "attachment_not_found", "attachment not found")
+	ErrAttachmentTooLarge = common.NewAPIError(http.StatusRequestEntityTooLarge, "attachment_too_large", "attachments can be at most 10MiB")
+	ErrTooManyAttachments = common.NewAPIError(http.StatusUnprocessableEntity, "too_many_attachments", "a message can have at most 5 attachments")
+	ErrNoAttachments      = common.NewAPIError(http.StatusUnprocessableEntity, "no_attachments", "no files were uploaded")
+	ErrNoThumbnail        = common.NewAPIError(http.StatusNotFound, "no_thumbnail", "attachment has no thumbnail")
+)
+
+// File uploaded with a message, downloaded from Url by members of the message's server.
+//
+// Images get their size and a ThumbnailUrl once they are processed, a message.update event follows.
+type Attachment struct {
+	Id          uuid.UUID `json:"id" db:"id"`
+	MessageId   int64     `json:"message_id" db:"message_id"`
+	Position    int       `json:"-" db:"position"`
+	Filename    string    `json:"filename" db:"filename"`
+	ContentType string    `json:"content_type" db:"content_type"`
+	Size        int64     `json:"size" db:"size"`
+	Url         string    `json:"url" db:"-"`
+	DateCreated time.Time `json:"date_created" db:"date_created"`
+
+	Width         *int       `json:"width,omitempty" db:"width"`
+	Height        *int       `json:"height,omitempty" db:"height"`
+	HasThumbnail  bool       `json:"-" db:"has_thumbnail"`
+	ThumbnailUrl  string     `json:"thumbnail_url,omitempty" db:"-"`
+	DateProcessed *time.Time `json:"-" db:"date_processed"`
+}
+
+// Multipart form of POST /message/attachments
+type AttachmentUpload struct {
+	TabId uuid.UUID               `json:"tab_id" validate:"required"`
+	Text  string                  `json:"text"`
+	Files []*multipart.FileHeader `json:"files" validate:"required"`
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Kinds of events pushed to clients over the websocket
+const (
+	EventMessageCreate = "message.create"
+	// Sent when the attachments of a message have been processed
+	EventMessageUpdate = "message.update"
+
+	EventServerCreate = "server.create"
+	EventServerUpdate = "server.update"
+	EventServerDelete = "server.delete"
+
+	EventMemberJoin   = "member.join"
+	EventMemberUpdate = "member.update"
+
+	EventTabCreate = "tab.create"
+	EventTabUpdate = "tab.update"
+	EventTabDelete = "tab.delete"
+
+	EventUserUpdate = "user.update"
+	EventUserDelete = "user.delete"
+
+	EventPresenceUpdate = "presence.update"
+
+	EventTyping = "typing"
+
+	// Sent to the user's own connections when they ack a tab
+	EventReadStateUpdate = "read_state.update"
+	// Sent to a sender when someone reads their messages
+	EventReceipt = "receipt"
+
+	// Data is a common.ErrorResponse, sent to the client whose op failed
+	EventError = "error"
+)
+
+// Frame pushed to clients over the websocket, Data depends on Type
+type Event struct {
+	Type string `json:"type"`
+	Data any    `json:"data"`
+}
+
+func NewEvent(event_type string, data any) *Event {
+	return &Event{Type: event_type, Data: data}
+}
+
+// Kinds of ops clients send over the websocket
+const (
+	OpMessageCreate  = "message.create"
+	OpPresenceUpdate = "presence.update"
+	OpTabView        = "tab.view"
+	OpTypingStart    = "typing.start"
+)
+
+// Frame sent by clients over the websocket, Data depends on Op.
+//
+// Frames without an op are chat messages, as they were before ops existed.
+type ClientOp struct {
+	Op   string          `json:"op"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Data of the tab.view and typing.start ops, a nil tab_id in tab.view means no tab
+type TabOp struct {
+	TabId uuid.UUID `json:"tab_id"`
+}
+
+// Data of typing events, clients drop the indicator at ExpiresAt unless another one arrives
+type Typing struct {
+	TabId     uuid.UUID `json:"tab_id"`
+	UserId    uuid.UUID `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,24 @@
+package models
+
+const (
+	HealthOK      = "ok"
+	HealthFailing = "failing"
+
+	ReadinessReady    = "ready"
+	ReadinessNotReady = "not_ready"
+)
+
+type Health struct {
+	Status string `json:"status"`
+}
+
+// Result of every readiness check, HealthOK or HealthFailing
+type Readiness struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Whether every check passed
+func (r *Readiness) Ready() bool {
+	return r.Status == ReadinessReady
+}
@@ -1,22 +1,29 @@
 package models
 
 import (
-	"errors"
+	"net/http"
+	"slices"
 	"time"
+	"unicode"
 
 	"github.com/NikosGour/chatter/internal/common"
 )
 
 var (
-	ErrMessageNotFound = errors.New("message not found")
+	ErrMessageNotFound = common.NewAPIError(http.StatusNotFound, "message_not_found", "message not found")
+	ErrMessageNotInTab = common.NewAPIError(http.StatusUnprocessableEntity, "message_not_in_tab", "message is not in the tab")
+	ErrEmptyMessage    = common.NewAPIError(http.StatusUnprocessableEntity, "empty_message", "message has no text")
+	ErrMessageTooLong  = common.NewAPIError(http.StatusUnprocessableEntity, "message_too_long", "message is too long")
 )
 
 type Message struct {
 	Id       int64     `json:"id,omitempty"`
 	Text     string    `json:"text"`
 	Sender   *User     `json:"sender,omitempty"`
-	Tab      *Tab      `json:"tab,omitempty"`
+	Tab      *Tab      `json:"tab,omitempty" validate:"-"` // only its id is read from request bodies
 	DateSent time.Time `validate:"required" json:"date_sent,omitempty,omitzero"`
+
+	Attachments []Attachment `json:"attachments,omitempty"`
 }
 
 func (m Message) Validate() error {
@@ -26,3 +33,53 @@ func (m Message) Validate() error {
 	}
 	return nil
 }
+
+// Whether the text mentions the username with @username.
+//
+// The @ must not follow a letter, digit or _ and the username must not be followed by one,
+// so @Bob mentions bob but neither @bobby nor bob@example.com do. Letter case is ignored.
+func Mentions(text string, username string) bool {
+	if username == "" {
+		return false
+	}
+	t := foldRunes(text)
+	mention := append([]rune{'@'}, foldRunes(username)...)
+
+	for i := 0; i+len(mention) <= len(t); i++ {
+		if t[i] != '@' || (i > 0 && isWordRune(t[i-1])) || !slices.Equal(t[i:i+len(mention)], mention) {
+			continue
+		}
+		end := i + len(mention)
+		if end == len(t) || !isWordRune(t[end]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Lower cases every rune on its own, unlike strings.ToLower the result has as many runes as s
+func foldRunes(s string) []rune {
+	runes := []rune(s)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+	return runes
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Most messages GET /message/tab/:tab_id returns in one page
+const MaxMessagePage = 100
+
+// Query of GET /message/tab/:tab_id, pages hold MaxMessagePage messages when Limit is 0
+type MessagePage struct {
+	// Only messages with a lower id, the newest ones when 0
+	Before int64 `query:"before" validate:"min=0"`
+	Limit  int   `query:"limit" validate:"min=0,max=100"`
+}
+
+func (p MessagePage) Validate() error {
+	return common.Validate.Struct(p)
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/google/uuid"
+)
+
+// Status a user shows to others, online and offline follow their connections,
+// the rest are set by the user.
+type Status string
+
+const (
+	StatusOnline    Status = "online"
+	StatusIdle      Status = "idle"
+	StatusDND       Status = "dnd"
+	StatusInvisible Status = "invisible"
+	StatusOffline   Status = "offline"
+)
+
+type Presence struct {
+	UserId       uuid.UUID `json:"user_id"`
+	Status       Status    `json:"status"`
+	CustomStatus string    `json:"custom_status,omitempty"`
+}
+
+// Body of PUT /user/:id/presence and data of the presence.update socket op
+type PresenceUpdate struct {
+	Status       Status `json:"status" validate:"required,oneof=online idle dnd invisible"`
+	CustomStatus string `json:"custom_status" validate:"max=128"`
+}
+
+func (p PresenceUpdate) Validate() error {
+	return common.Validate.Struct(p)
+}
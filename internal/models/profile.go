@@ -0,0 +1,54 @@
+package models
+
+import (
+	"mime/multipart"
+	"net/http"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/google/uuid"
+)
+
+const (
+	MaxAvatarSize = 2 << 20
+	// Avatars are scaled down to fit in an AvatarSize square
+	AvatarSize = 256
+)
+
+var (
+	ErrAvatarTooLarge = common.NewAPIError(http.StatusRequestEntityTooLarge, "avatar_too_large", "avatars can be at most 2MiB")
+	ErrInvalidAvatar  = common.NewAPIError(http.StatusUnprocessableEntity, "invalid_avatar", "avatars have to be PNG, JPEG or GIF images")
+	ErrAvatarNotFound = common.NewAPIError(http.StatusNotFound, "avatar_not_found", "avatar not found")
+)
+
+// Response of GET /user/me/profile
+type Profile struct {
+	Id          uuid.UUID `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	AvatarUrl   string    `json:"avatar_url,omitempty"`
+}
+
+// Body of PATCH /user/me/profile, fields left out are not changed and empty ones are cleared
+type ProfilePatch struct {
+	DisplayName *string `json:"display_name,omitempty" validate:"omitempty,max=64"`
+	Bio         *string `json:"bio,omitempty" validate:"omitempty,max=512"`
+}
+
+func (p ProfilePatch) Validate() error {
+	return common.Validate.Struct(p)
+}
+
+// Multipart form of PUT /user/me/avatar
+type AvatarUpload struct {
+	Avatar *multipart.FileHeader `json:"avatar" validate:"required"`
+}
+
+// Body of PUT /server/:id/nickname, an empty nickname clears it
+type NicknameUpdate struct {
+	Nickname string `json:"nickname" validate:"max=32"`
+}
+
+func (n NicknameUpdate) Validate() error {
+	return common.Validate.Struct(n)
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/common"
+)
+
+var (
+	ErrRateLimited = common.NewAPIError(http.StatusTooManyRequests, "rate_limited", "too many requests, slow down")
+	ErrSlowMode    = common.NewAPIError(http.StatusTooManyRequests, "slow_mode", "the tab is in slow mode")
+)
+
+// At most Requests every Per, which can all be made at once after a quiet Per
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+}
+
+var (
+	// Every REST request from an address, logged in or not
+	IPRateLimit = RateLimit{Requests: 300, Per: time.Minute}
+	// Every REST request of a logged in user, from any address
+	UserRateLimit = RateLimit{Requests: 120, Per: time.Minute}
+	// Messages a user sends, through REST and the websocket alike
+	MessageRateLimit = RateLimit{Requests: 10, Per: 10 * time.Second}
+	// Frames a single websocket connection sends
+	SocketRateLimit = RateLimit{Requests: 20, Per: 10 * time.Second}
+)
+
+// Time one request takes up
+func (l RateLimit) Interval() time.Duration {
+	return l.Per / time.Duration(l.Requests)
+}
+
+// How far ahead of now requests can be taken up, what makes room for the burst
+func (l RateLimit) Tolerance() time.Duration {
+	return l.Interval() * time.Duration(l.Requests-1)
+}
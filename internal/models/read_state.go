@@ -0,0 +1,49 @@
+package models
+
+import (
+	"net/http"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/google/uuid"
+)
+
+// Read receipts are only kept for servers of up to this many members
+const MaxReceiptMembers = 50
+
+var (
+	ErrReceiptsUnavailable = common.NewAPIError(http.StatusUnprocessableEntity, "receipts_unavailable", "read receipts are only kept for servers of up to 50 members")
+)
+
+// What a user has read of a tab.
+//
+// Unread and Mentions count the messages of others after LastReadMessageId,
+// mentions being those that mention the user, as told by Mentions when they were sent.
+type ReadState struct {
+	TabId             uuid.UUID `json:"tab_id" db:"tab_id"`
+	LastReadMessageId int64     `json:"last_read_message_id" db:"last_read_message_id"`
+	Unread            int64     `json:"unread" db:"unread"`
+	Mentions          int64     `json:"mentions" db:"mentions"`
+}
+
+// Body of POST /tab/:id/ack
+type Ack struct {
+	MessageId int64 `json:"message_id" validate:"required"`
+}
+
+func (a Ack) Validate() error {
+	return common.Validate.Struct(a)
+}
+
+// Data of receipt events, User has read every message of the sender up to MessageId
+type Receipt struct {
+	TabId     uuid.UUID `json:"tab_id"`
+	MessageId int64     `json:"message_id"`
+	SenderId  uuid.UUID `json:"sender_id"`
+	User      User      `json:"user"`
+}
+
+// Response of GET /message/:id/receipts
+type Receipts struct {
+	MessageId int64  `json:"message_id"`
+	SeenBy    []User `json:"seen_by"`
+}
@@ -1,7 +1,7 @@
 package models
 
 import (
-	"errors"
+	"net/http"
 	"time"
 
 	"github.com/NikosGour/chatter/internal/common"
@@ -9,10 +9,30 @@ import (
 )
 
 var (
-	ErrServerNotFound   = errors.New("server not found")
-	ErrServerHasNoUsers = errors.New("server has no users")
+	ErrServerNotFound      = common.NewAPIError(http.StatusNotFound, "server_not_found", "server not found")
+	ErrServerHasNoUsers    = common.NewAPIError(http.StatusNotFound, "server_has_no_users", "server has no users")
+	ErrServerAlreadyExists = common.NewAPIError(http.StatusConflict, "server_already_exists", "server already exists")
+	ErrUserAlreadyInServer = common.NewAPIError(http.StatusConflict, "user_already_in_server", "user is already a member of the server")
+	ErrNotServerMember     = common.NewAPIError(http.StatusForbidden, "not_server_member", "user is not a member of the server")
+	ErrInsufficientRole    = common.NewAPIError(http.StatusForbidden, "insufficient_role", "user's role in the server doesn't allow this")
+	ErrCannotRemoveOwner   = common.NewAPIError(http.StatusConflict, "cannot_remove_owner", "the owner can't be removed from the server, delete it instead")
 )
 
+// Role of a member in a server, owners can do everything moderators can.
+type Role string
+
+const (
+	RoleOwner     Role = "owner"
+	RoleModerator Role = "moderator"
+	RoleMember    Role = "member"
+)
+
+// Reports whether r grants at least the permissions of other
+func (r Role) AtLeast(other Role) bool {
+	rank := map[Role]int{RoleMember: 0, RoleModerator: 1, RoleOwner: 2}
+	return rank[r] >= rank[other]
+}
+
 type Server struct {
 	Id          uuid.UUID `json:"id,omitempty" db:"id"`
 	Name        string    `json:"name,omitempty" db:"name"`
@@ -22,6 +42,22 @@ type Server struct {
 	IsTest      bool      `db:"is_test"`
 }
 
+// A user's membership in a server
+type Member struct {
+	ServerId uuid.UUID `json:"server_id"`
+	User     User      `json:"user"`
+	Role     Role      `json:"role"`
+}
+
+// Body of PATCH /server/:id
+type ServerPatch struct {
+	Name string `json:"name" validate:"required"`
+}
+
+func (s ServerPatch) Validate() error {
+	return common.Validate.Struct(s)
+}
+
 func (s Server) Validate() error {
 	err := common.Validate.Struct(s)
 	if err != nil {
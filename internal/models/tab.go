@@ -1,7 +1,7 @@
 package models
 
 import (
-	"errors"
+	"net/http"
 	"time"
 
 	"github.com/NikosGour/chatter/internal/common"
@@ -9,15 +9,31 @@ import (
 )
 
 var (
-	ErrTabNotFound = errors.New("tab not found")
+	ErrTabNotFound = common.NewAPIError(http.StatusNotFound, "tab_not_found", "tab not found")
 )
 
 type Tab struct {
 	Id          uuid.UUID `json:"id,omitempty" db:"id"`
-	Name        string    `json:"name,omitempty" db:"name"`
-	ServerId    uuid.UUID `json:"server_id,omitempty" db:"server_id"`
+	Name        string    `json:"name,omitempty" db:"name" validate:"required"`
+	ServerId    uuid.UUID `json:"server_id,omitempty" db:"server_id" validate:"required"`
 	Server      *Server   `json:"server,omitempty" db:"server"`
 	DateCreated time.Time `json:"date_created,omitempty,omitzero" db:"date_created"`
+
+	// Seconds members have to wait between their messages, 0 when off
+	SlowMode int `json:"slow_mode,omitempty" db:"slow_mode" validate:"min=0,max=21600"`
+
+	// Only filled in where it is documented to be
+	ReadState *ReadState `json:"read_state,omitempty" db:"-"`
+}
+
+// Body of PATCH /tab/:id, fields left out are not changed
+type TabPatch struct {
+	Name     *string `json:"name,omitempty" validate:"omitempty,min=1"`
+	SlowMode *int    `json:"slow_mode,omitempty" validate:"omitempty,min=0,max=21600"`
+}
+
+func (t TabPatch) Validate() error {
+	return common.Validate.Struct(t)
 }
 
 func (t Tab) Validate() error {
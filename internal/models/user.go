@@ -1,7 +1,7 @@
 package models
 
 import (
-	"errors"
+	"net/http"
 	"time"
 
 	"github.com/NikosGour/chatter/internal/common"
@@ -9,15 +9,62 @@ import (
 )
 
 var (
-	ErrUserNotFound = errors.New("user not found")
+	ErrUserNotFound      = common.NewAPIError(http.StatusNotFound, "user_not_found", "user not found")
+	ErrUserAlreadyExists = common.NewAPIError(http.StatusConflict, "user_already_exists", "user already exists")
+	ErrUserOwnsServers   = common.NewAPIError(http.StatusConflict, "user_owns_servers", "user still owns servers, delete them first")
+	ErrWrongCredentials  = common.NewAPIError(http.StatusUnauthorized, "wrong_credentials", "wrong username or password")
+	ErrUserDisabled      = common.NewAPIError(http.StatusForbidden, "user_disabled", "user is disabled")
 )
 
 type User struct {
-	Id          uuid.UUID `json:"id,omitempty" db:"id"`
-	Username    string    `json:"username,omitempty" db:"username"`
-	Password    string    `json:"password,omitempty" db:"password"`
+	Id       uuid.UUID `json:"id,omitempty" db:"id"`
+	Username string    `json:"username,omitempty" db:"username"`
+	// bcrypt hash of the password, never sent to clients
+	Password    string    `json:"-" db:"password"`
 	DateCreated time.Time `json:"date_created,omitempty,omitzero" db:"date_created"`
 	IsTest      bool      `db:"is_test"`
+
+	// Disabled users can't log in and their sessions are rejected, set by admins
+	Disabled bool `json:"disabled,omitempty" db:"disabled"`
+	// Sessions issued at another version are rejected, it moves on to end them all
+	SessionVersion int64 `json:"-" db:"session_version"`
+
+	// Keeps the user out of read receipts
+	HideReadReceipts bool `json:"hide_read_receipts" db:"hide_read_receipts"`
+
+	// Profile, clients show the display name instead of the username when it is set
+	DisplayName string     `json:"display_name,omitempty" db:"display_name"`
+	Bio         string     `json:"bio,omitempty" db:"bio"`
+	AvatarId    *uuid.UUID `json:"-" db:"avatar_id"`
+	AvatarUrl   string     `json:"avatar_url,omitempty" db:"-"`
+
+	// Name in a single server, only filled in where the server is known
+	Nickname string `json:"nickname,omitempty" db:"nickname"`
+
+	// Only filled in where it is documented to be
+	Presence *Presence `json:"presence,omitempty" db:"-"`
+}
+
+// Body of PATCH /user/:id, fields left out are not changed
+type UserPatch struct {
+	Username *string `json:"username,omitempty" validate:"omitempty,min=1"`
+	Password *string `json:"password,omitempty" validate:"omitempty,min=1,max=72"`
+
+	HideReadReceipts *bool `json:"hide_read_receipts,omitempty"`
+}
+
+func (u UserPatch) Validate() error {
+	return common.Validate.Struct(u)
+}
+
+// Body of POST /user and POST /user/login
+type Credentials struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required,max=72"`
+}
+
+func (c Credentials) Validate() error {
+	return common.Validate.Struct(c)
 }
 
 func (u User) Validate() error {
@@ -0,0 +1,263 @@
+// Package openapi describes the REST API as an OpenAPI 3 document.
+//
+// Routes are declared once, as Route values, and both registered on fiber
+// and added to the document from that declaration, so the two can't disagree.
+package openapi
+
+import (
+	"cmp"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	Version = "3.0.3"
+
+	CookieAuth = "cookieAuth"
+)
+
+// A REST endpoint, registered on a fiber router with Register.
+//
+// Body and Response are zero values of the types the handler parses and
+// returns, nil when there is none.
+// BodyType and ResponseType are their media types, JSON when empty, a
+// ResponseType without a Response is documented as raw bytes.
+// Auth, when set, runs before Handler and is documented as the session cookie.
+type Route struct {
+	Method  string
+	Path    string
+	Summary string
+	Tag     string
+	Handler fiber.Handler
+	Auth    fiber.Handler
+
+	Params   []Param
+	Query    []Param
+	Body     any
+	Response any
+	Status   int
+
+	BodyType     string
+	ResponseType string
+}
+
+// Path or query parameter, path parameters without one are documented as uuids
+type Param struct {
+	Name        string
+	Description string
+	Example     any
+	Schema      *Schema
+}
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Servers    []Server            `json:"servers,omitempty"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type Server struct {
+	Url string `json:"url"`
+}
+
+type PathItem map[string]*Operation
+
+type Operation struct {
+	Summary     string                `json:"summary,omitempty"`
+	OperationId string                `json:"operationId"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type string `json:"type"`
+	In   string `json:"in"`
+	Name string `json:"name"`
+}
+
+// Builds the document of an API mounted at base_path
+func New(title string, version string, base_path string) *Document {
+	d := &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: title, Version: version},
+		Servers: []Server{{Url: base_path}},
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas:         map[string]*Schema{},
+			SecuritySchemes: map[string]SecurityScheme{CookieAuth: {Type: "apiKey", In: "cookie", Name: common.CookieMessangerId}},
+		},
+	}
+	d.Components.Schemas["ErrorResponse"] = d.schemaOf(reflect.TypeFor[common.ErrorResponse]())
+	return d
+}
+
+// Registers every route on router and documents it.
+func (d *Document) Register(router fiber.Router, routes []Route) {
+	for _, r := range routes {
+		if r.Auth != nil {
+			router.Add(r.Method, r.Path, r.Auth, r.Handler)
+		} else {
+			router.Add(r.Method, r.Path, r.Handler)
+		}
+		d.Add(r)
+	}
+}
+
+var fiberParam = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+
+// Documents a route without registering it.
+func (d *Document) Add(r Route) {
+	path := specPath(r.Path)
+	if d.Paths[path] == nil {
+		d.Paths[path] = PathItem{}
+	}
+
+	op := &Operation{
+		Summary:     r.Summary,
+		OperationId: operationId(r.Method, r.Path),
+		Responses:   map[string]Response{},
+	}
+	if r.Tag != "" {
+		op.Tags = []string{r.Tag}
+	}
+	if r.Auth != nil {
+		op.Security = []map[string][]string{{CookieAuth: {}}}
+	}
+
+	for _, match := range fiberParam.FindAllStringSubmatch(r.Path, -1) {
+		p := Param{Name: match[1], Schema: &Schema{Type: "string", Format: "uuid"}}
+		if idx := slices.IndexFunc(r.Params, func(p Param) bool { return p.Name == match[1] }); idx != -1 {
+			p = r.Params[idx]
+		}
+		op.Parameters = append(op.Parameters, Parameter{Name: p.Name, In: "path", Description: p.Description, Required: true, Schema: p.Schema})
+	}
+	for _, p := range r.Query {
+		op.Parameters = append(op.Parameters, Parameter{Name: p.Name, In: "query", Description: p.Description, Schema: p.Schema})
+	}
+
+	if r.Body != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{cmp.Or(r.BodyType, fiber.MIMEApplicationJSON): {Schema: d.schemaOf(reflect.TypeOf(r.Body))}},
+		}
+	}
+
+	status := r.Status
+	if status == 0 {
+		status = fiber.StatusOK
+	}
+	res := Response{Description: "Success"}
+	if r.Response != nil {
+		res.Content = map[string]MediaType{cmp.Or(r.ResponseType, fiber.MIMEApplicationJSON): {Schema: d.schemaOf(reflect.TypeOf(r.Response))}}
+	} else if r.ResponseType != "" {
+		res.Content = map[string]MediaType{r.ResponseType: {Schema: &Schema{Type: "string", Format: "binary"}}}
+	}
+	op.Responses[fmt.Sprint(status)] = res
+	op.Responses["default"] = Response{
+		Description: "Error",
+		Content:     map[string]MediaType{fiber.MIMEApplicationJSON: {Schema: &Schema{Ref: "#/components/schemas/ErrorResponse"}}},
+	}
+
+	d.Paths[path][strings.ToLower(r.Method)] = op
+}
+
+// Reports every route registered on app under base_path that the document
+// doesn't describe, and every documented operation that app doesn't serve.
+func (d *Document) CheckRoutes(app *fiber.App, base_path string, ignore ...string) error {
+	served := map[string]bool{}
+	for _, r := range app.GetRoutes(true) {
+		if r.Method == fiber.MethodHead || !strings.HasPrefix(r.Path, base_path) {
+			continue
+		}
+		path := strings.TrimSuffix(strings.TrimPrefix(r.Path, base_path), "/")
+		if slices.Contains(ignore, path) {
+			continue
+		}
+		served[r.Method+" "+specPath(path)] = true
+	}
+
+	documented := map[string]bool{}
+	for path, item := range d.Paths {
+		for method := range item {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	problems := []string{}
+	for route := range served {
+		if !documented[route] {
+			problems = append(problems, fmt.Sprintf("`%s` is served but not documented", route))
+		}
+	}
+	for route := range documented {
+		if !served[route] {
+			problems = append(problems, fmt.Sprintf("`%s` is documented but not served", route))
+		}
+	}
+	if len(problems) != 0 {
+		slices.Sort(problems)
+		return fmt.Errorf("api drifted from its openapi document: %s", strings.Join(problems, ", "))
+	}
+
+	return nil
+}
+
+// Converts fiber's /server/:id to OpenAPI's /server/{id}
+func specPath(path string) string {
+	path = strings.TrimSuffix(path, "/")
+	if path == "" {
+		path = "/"
+	}
+	return fiberParam.ReplaceAllString(path, "{$1}")
+}
+
+// e.g. GET /server/:id/users -> getServerIdUsers
+func operationId(method string, path string) string {
+	id := strings.ToLower(method)
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == ':' || r == '_' }) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
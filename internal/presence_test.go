@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/fasthttp/websocket"
+	"github.com/google/uuid"
+)
+
+// Reads the next presence event and checks it's the user's with the status
+func expectPresence(t *testing.T, conn *websocket.Conn, user_id uuid.UUID, status models.Status) {
+	t.Helper()
+	presence := models.Presence{}
+	err := json.Unmarshal(readEvent(t, conn, models.EventPresenceUpdate), &presence)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if presence.UserId != user_id || presence.Status != status {
+		t.Fatalf("expected %s to be %s, got %#v", user_id, status, presence)
+	}
+}
+
+func TestPresence(t *testing.T) {
+	s, app := newTestAPI(t)
+	base := listen(t, app)
+
+	nikos := newTestUser(t, s, "nikos")
+	maria := newTestUser(t, s, "maria")
+	eve := newTestUser(t, s, "eve")
+	newTestServer(t, s, "Gamiades", nikos, maria)
+	newTestServer(t, s, "Other", eve)
+
+	// Everyone sees their own presence on connecting
+	nikos_conn := dialMessages(t, base, login(t, app, "nikos", "123"))
+	expectPresence(t, nikos_conn, nikos, models.StatusOnline)
+	eve_conn := dialMessages(t, base, login(t, app, "eve", "123"))
+	expectPresence(t, eve_conn, eve, models.StatusOnline)
+
+	maria_conn := dialMessages(t, base, login(t, app, "maria", "123"))
+	expectPresence(t, maria_conn, maria, models.StatusOnline)
+	expectPresence(t, nikos_conn, maria, models.StatusOnline)
+
+	sendOp(t, maria_conn, models.OpPresenceUpdate, models.PresenceUpdate{Status: models.StatusIdle})
+	expectPresence(t, maria_conn, maria, models.StatusIdle)
+	expectPresence(t, nikos_conn, maria, models.StatusIdle)
+
+	sendOp(t, maria_conn, models.OpPresenceUpdate, models.PresenceUpdate{Status: models.StatusDND, CustomStatus: "sto grafeio"})
+	expectPresence(t, maria_conn, maria, models.StatusDND)
+	presence := models.Presence{}
+	err := json.Unmarshal(readEvent(t, nikos_conn, models.EventPresenceUpdate), &presence)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if presence.UserId != maria || presence.Status != models.StatusDND || presence.CustomStatus != "sto grafeio" {
+		t.Fatalf("expected maria to be dnd with her custom status, got %#v", presence)
+	}
+
+	// Others see invisible users as offline
+	sendOp(t, maria_conn, models.OpPresenceUpdate, models.PresenceUpdate{Status: models.StatusInvisible})
+	expectPresence(t, maria_conn, maria, models.StatusInvisible)
+	expectPresence(t, nikos_conn, maria, models.StatusOffline)
+
+	sendOp(t, maria_conn, models.OpPresenceUpdate, models.PresenceUpdate{Status: models.StatusOnline})
+	expectPresence(t, maria_conn, maria, models.StatusOnline)
+	expectPresence(t, nikos_conn, maria, models.StatusOnline)
+
+	maria_conn.Close()
+	expectPresence(t, nikos_conn, maria, models.StatusOffline)
+
+	// Eve shares no server with them, the next presence she sees is her own
+	sendOp(t, eve_conn, models.OpPresenceUpdate, models.PresenceUpdate{Status: models.StatusIdle})
+	expectPresence(t, eve_conn, eve, models.StatusIdle)
+}
@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Behind a trusted proxy every client gets its own bucket, taken from the proxy header
+func TestIPRateLimitBehindProxy(t *testing.T) {
+	ip_limit, http_config := models.IPRateLimit, common.Config.HTTP
+	t.Cleanup(func() { models.IPRateLimit, common.Config.HTTP = ip_limit, http_config })
+	models.IPRateLimit = models.RateLimit{Requests: 2, Per: time.Hour}
+
+	cases := []struct {
+		name     string
+		trusted  []string
+		statuses map[string][]int
+	}{
+		// app.Test connects from 0.0.0.0
+		{"trusted proxy", []string{"0.0.0.0/32"}, map[string][]int{
+			"10.0.0.1": {fiber.StatusOK, fiber.StatusOK, fiber.StatusTooManyRequests},
+			"10.0.0.2": {fiber.StatusOK, fiber.StatusOK, fiber.StatusTooManyRequests},
+		}},
+		{"untrusted proxy", []string{"10.9.9.9"}, map[string][]int{
+			"10.0.0.1": {fiber.StatusOK, fiber.StatusOK, fiber.StatusTooManyRequests},
+			"10.0.0.2": {fiber.StatusTooManyRequests},
+		}},
+	}
+	for _, tc := range cases {
+		common.Config.HTTP.ProxyHeader = "X-Real-IP"
+		common.Config.HTTP.TrustedProxies = tc.trusted
+		_, app := newTestAPI(t)
+
+		for _, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+			for i, status := range tc.statuses[ip] {
+				req := httptest.NewRequest(fiber.MethodGet, APIBasePath+"/user", nil)
+				req.Header.Set("X-Real-IP", ip)
+				resp, err := app.Test(req, -1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp.StatusCode != status {
+					t.Errorf("%s: expected request %d from %s to get %d, got %d", tc.name, i+1, ip, status, resp.StatusCode)
+				}
+			}
+		}
+	}
+}
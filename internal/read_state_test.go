@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestAckReceipts(t *testing.T) {
+	s, _ := newTestAPI(t)
+
+	nikos := newTestUser(t, s, "nikos")
+	maria := newTestUser(t, s, "maria")
+	rinos := newTestUser(t, s, "rinos")
+	_, tab_id := newTestServer(t, s, "Gamiades", nikos, maria, rinos)
+
+	send := func(sender_id uuid.UUID) int64 {
+		t.Helper()
+		id, err := s.message_service.Create(&models.Message{Text: "kalhspera", Sender: &models.User{Id: sender_id}, Tab: &models.Tab{Id: tab_id}, DateSent: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	maria_first := send(maria)
+	maria_last := send(maria)
+	send(nikos)
+	rinos_first := send(rinos)
+	rinos_last := send(rinos)
+
+	// A receipt for the last read message of every other sender
+	_, receipts, err := s.read_state_service.Ack(nikos, tab_id, rinos_first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(receipts) != 2 || receipts[0].SenderId != maria || receipts[0].MessageId != maria_last || receipts[1].SenderId != rinos || receipts[1].MessageId != rinos_first {
+		t.Fatalf("expected receipts for %d of maria and %d of rinos, got %#v", maria_last, rinos_first, receipts)
+	}
+	if receipts[0].User.Id != nikos || receipts[0].TabId != tab_id {
+		t.Fatalf("expected receipts read by nikos in the tab, got %#v", receipts[0])
+	}
+
+	// Only the messages read since the previous ack
+	_, receipts, err = s.read_state_service.Ack(nikos, tab_id, rinos_last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(receipts) != 1 || receipts[0].SenderId != rinos || receipts[0].MessageId != rinos_last {
+		t.Fatalf("expected a receipt for %d of rinos only, got %#v", rinos_last, receipts)
+	}
+
+	// Nothing new when acking an older message
+	_, receipts, err = s.read_state_service.Ack(nikos, tab_id, maria_first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(receipts) != 0 {
+		t.Fatalf("expected no receipts, got %#v", receipts)
+	}
+}
@@ -0,0 +1,225 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/storage"
+	"github.com/NikosGour/logging/log"
+	"github.com/google/uuid"
+)
+
+type AttachmentRepository interface {
+	GetAll() ([]AttachmentDBO, error)
+	GetByID(id uuid.UUID) (*AttachmentDBO, error)
+	GetByMessageID(message_id int64) ([]AttachmentDBO, error)
+	GetByMessageIDs(message_ids []int64) ([]AttachmentDBO, error)
+	GetByTabID(tab_id uuid.UUID) ([]AttachmentDBO, error)
+	GetByServerID(server_id uuid.UUID) ([]AttachmentDBO, error)
+	GetBySenderID(sender_id uuid.UUID) ([]AttachmentDBO, error)
+	GetUnprocessedImages() ([]AttachmentDBO, error)
+	Create(attachment *AttachmentDBO) error
+	UpdatePreview(attachment *AttachmentDBO) error
+}
+
+type AttachmentDBO = models.Attachment
+
+type attachmentRepository struct {
+	db storage.SQLQuerier
+}
+
+func NewAttachmentRepository(db storage.SQLQuerier) AttachmentRepository {
+	ar := &attachmentRepository{db: db}
+	return ar
+}
+
+// Retrieves every attachment, in the order of their messages.
+//
+// Might return any sql error
+func (ar *attachmentRepository) GetAll() ([]AttachmentDBO, error) {
+	attachments := []AttachmentDBO{}
+	q := `SELECT * FROM attachments ORDER BY message_id, "position";`
+
+	err := ar.db.Select(&attachments, q)
+	if err != nil {
+		return nil, fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return attachments, nil
+}
+
+// Retrieves an attachment given the id.
+//
+// Might return ErrAttachmentNotFound or any other sql error
+func (ar *attachmentRepository) GetByID(id uuid.UUID) (*AttachmentDBO, error) {
+	attachment := AttachmentDBO{}
+	q := `SELECT * FROM attachments WHERE id = $1;`
+
+	err := ar.db.Get(&attachment, q, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w:%s", models.ErrAttachmentNotFound, id)
+		}
+
+		msg := fmt.Errorf("on q=`%s`,id=`%s`: %w", q, id, err)
+		log.Error("%s", msg)
+		return nil, msg
+	}
+
+	return &attachment, nil
+}
+
+// Retrieves the attachments of a message, in the order they were uploaded.
+//
+// Might return any sql error
+func (ar *attachmentRepository) GetByMessageID(message_id int64) ([]AttachmentDBO, error) {
+	attachments := []AttachmentDBO{}
+	q := `SELECT * FROM attachments WHERE message_id = $1 ORDER BY "position";`
+
+	err := ar.db.Select(&attachments, q, message_id)
+	if err != nil {
+		return nil, fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return attachments, nil
+}
+
+// Retrieves the attachments of the messages, in the order of their messages.
+//
+// Might return any sql error
+func (ar *attachmentRepository) GetByMessageIDs(message_ids []int64) ([]AttachmentDBO, error) {
+	attachments := []AttachmentDBO{}
+	if len(message_ids) == 0 {
+		return attachments, nil
+	}
+
+	placeholders := make([]string, len(message_ids))
+	args := make([]any, len(message_ids))
+	for i, id := range message_ids {
+		placeholders[i] = "$" + strconv.Itoa(i+1)
+		args[i] = id
+	}
+	q := `SELECT * FROM attachments
+		  WHERE message_id IN (` + strings.Join(placeholders, ", ") + `)
+		  ORDER BY message_id, "position";`
+
+	err := ar.db.Select(&attachments, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return attachments, nil
+}
+
+// Retrieves the attachments of every message in a tab, in the order of their messages.
+//
+// Might return any sql error
+func (ar *attachmentRepository) GetByTabID(tab_id uuid.UUID) ([]AttachmentDBO, error) {
+	attachments := []AttachmentDBO{}
+	q := `SELECT a.*
+		  FROM attachments a
+		  JOIN messages m ON m.id = a.message_id
+		  WHERE m.tab_id = $1
+		  ORDER BY a.message_id, a."position";`
+
+	err := ar.db.Select(&attachments, q, tab_id)
+	if err != nil {
+		return nil, fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return attachments, nil
+}
+
+// Retrieves the attachments of every message in the tabs of a server, in the order of their messages.
+//
+// Might return any sql error
+func (ar *attachmentRepository) GetByServerID(server_id uuid.UUID) ([]AttachmentDBO, error) {
+	attachments := []AttachmentDBO{}
+	q := `SELECT a.*
+		  FROM attachments a
+		  JOIN messages m ON m.id = a.message_id
+		  JOIN tabs t ON t.id = m.tab_id
+		  WHERE t.server_id = $1
+		  ORDER BY a.message_id, a."position";`
+
+	err := ar.db.Select(&attachments, q, server_id)
+	if err != nil {
+		return nil, fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return attachments, nil
+}
+
+// Retrieves the attachments of every message the user sent, in the order of their messages.
+//
+// Might return any sql error
+func (ar *attachmentRepository) GetBySenderID(sender_id uuid.UUID) ([]AttachmentDBO, error) {
+	attachments := []AttachmentDBO{}
+	q := `SELECT a.*
+		  FROM attachments a
+		  JOIN messages m ON m.id = a.message_id
+		  WHERE m.sender_id = $1
+		  ORDER BY a.message_id, a."position";`
+
+	err := ar.db.Select(&attachments, q, sender_id)
+	if err != nil {
+		return nil, fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return attachments, nil
+}
+
+// Retrieves the images that have no preview yet, oldest first.
+//
+// Might return any sql error
+func (ar *attachmentRepository) GetUnprocessedImages() ([]AttachmentDBO, error) {
+	attachments := []AttachmentDBO{}
+	q := `SELECT * FROM attachments
+		  WHERE date_processed IS NULL AND content_type IN ('image/png', 'image/jpeg', 'image/gif')
+		  ORDER BY message_id, "position";`
+
+	err := ar.db.Select(&attachments, q)
+	if err != nil {
+		return nil, fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return attachments, nil
+}
+
+// Inserts an attachment into a database.
+//
+// Might return ErrForeignKeyViolation or any other sql error
+func (ar *attachmentRepository) Create(attachment *AttachmentDBO) error {
+	q := `INSERT INTO attachments (id, message_id, "position", filename, content_type, "size", date_created)
+		  VALUES (:id, :message_id, :position, :filename, :content_type, :size, :date_created);`
+
+	_, err := ar.db.NamedExec(q, attachment)
+	if err != nil {
+		if ar.db.IsForeignKeyViolation(err) {
+			return fmt.Errorf("%w:message_id=%d", storage.ErrForeignKeyViolation, attachment.MessageId)
+		}
+		return fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return nil
+}
+
+// Records the size, thumbnail and processing date of an attachment.
+//
+// Might return ErrAttachmentNotFound or any other sql error
+func (ar *attachmentRepository) UpdatePreview(attachment *AttachmentDBO) error {
+	q := `UPDATE attachments
+		  SET width = :width, height = :height, has_thumbnail = :has_thumbnail, date_processed = :date_processed
+		  WHERE id = :id;`
+
+	res, err := ar.db.NamedExec(q, attachment)
+	if err != nil {
+		return fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return expectAffected(res, fmt.Errorf("%w:%s", models.ErrAttachmentNotFound, attachment.Id))
+}
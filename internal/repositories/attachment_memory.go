@@ -0,0 +1,151 @@
+package repositories
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/storage"
+	"github.com/google/uuid"
+)
+
+type memoryAttachmentRepository struct {
+	db *storage.MemoryStorage
+}
+
+func NewMemoryAttachmentRepository(db *storage.MemoryStorage) AttachmentRepository {
+	ar := &memoryAttachmentRepository{db: db}
+	return ar
+}
+
+// Retrieves every attachment, in the order of their messages.
+func (ar *memoryAttachmentRepository) GetAll() ([]AttachmentDBO, error) {
+	ar.db.Mu.RLock()
+	defer ar.db.Mu.RUnlock()
+
+	return ar.filter(func(a models.Attachment) bool { return true }), nil
+}
+
+// Retrieves an attachment given the id.
+//
+// Might return ErrAttachmentNotFound
+func (ar *memoryAttachmentRepository) GetByID(id uuid.UUID) (*AttachmentDBO, error) {
+	ar.db.Mu.RLock()
+	defer ar.db.Mu.RUnlock()
+
+	attachment, ok := ar.db.Attachments[id]
+	if !ok {
+		return nil, fmt.Errorf("%w:%s", models.ErrAttachmentNotFound, id)
+	}
+	return &attachment, nil
+}
+
+// Retrieves the attachments of a message, in the order they were uploaded.
+func (ar *memoryAttachmentRepository) GetByMessageID(message_id int64) ([]AttachmentDBO, error) {
+	ar.db.Mu.RLock()
+	defer ar.db.Mu.RUnlock()
+
+	return ar.filter(func(a models.Attachment) bool { return a.MessageId == message_id }), nil
+}
+
+// Retrieves the attachments of the messages, in the order of their messages.
+func (ar *memoryAttachmentRepository) GetByMessageIDs(message_ids []int64) ([]AttachmentDBO, error) {
+	ar.db.Mu.RLock()
+	defer ar.db.Mu.RUnlock()
+
+	return ar.filter(func(a models.Attachment) bool { return slices.Contains(message_ids, a.MessageId) }), nil
+}
+
+// Retrieves the attachments of every message in a tab, in the order of their messages.
+func (ar *memoryAttachmentRepository) GetByTabID(tab_id uuid.UUID) ([]AttachmentDBO, error) {
+	ar.db.Mu.RLock()
+	defer ar.db.Mu.RUnlock()
+
+	return ar.filter(func(a models.Attachment) bool { return ar.db.Messages[a.MessageId].TabId == tab_id }), nil
+}
+
+// Retrieves the attachments of every message in the tabs of a server, in the order of their messages.
+func (ar *memoryAttachmentRepository) GetByServerID(server_id uuid.UUID) ([]AttachmentDBO, error) {
+	ar.db.Mu.RLock()
+	defer ar.db.Mu.RUnlock()
+
+	return ar.filter(func(a models.Attachment) bool {
+		tab, ok := ar.db.Tabs[ar.db.Messages[a.MessageId].TabId]
+		return ok && tab.ServerId == server_id
+	}), nil
+}
+
+// Retrieves the attachments of every message the user sent, in the order of their messages.
+func (ar *memoryAttachmentRepository) GetBySenderID(sender_id uuid.UUID) ([]AttachmentDBO, error) {
+	ar.db.Mu.RLock()
+	defer ar.db.Mu.RUnlock()
+
+	return ar.filter(func(a models.Attachment) bool { return ar.db.Messages[a.MessageId].SenderId == sender_id }), nil
+}
+
+// Retrieves the images that have no preview yet, oldest first.
+func (ar *memoryAttachmentRepository) GetUnprocessedImages() ([]AttachmentDBO, error) {
+	ar.db.Mu.RLock()
+	defer ar.db.Mu.RUnlock()
+
+	return ar.filter(func(a models.Attachment) bool {
+		return a.DateProcessed == nil && slices.Contains([]string{"image/png", "image/jpeg", "image/gif"}, a.ContentType)
+	}), nil
+}
+
+// Inserts an attachment into the store.
+//
+// Might return ErrForeignKeyViolation or ErrUniqueViolation
+func (ar *memoryAttachmentRepository) Create(attachment *AttachmentDBO) error {
+	ar.db.Mu.Lock()
+	defer ar.db.Mu.Unlock()
+
+	_, ok := ar.db.Messages[attachment.MessageId]
+	if !ok {
+		return fmt.Errorf("%w:message_id=%d", storage.ErrForeignKeyViolation, attachment.MessageId)
+	}
+	_, exists := ar.db.Attachments[attachment.Id]
+	if exists {
+		return fmt.Errorf("%w:id=%s", storage.ErrUniqueViolation, attachment.Id)
+	}
+
+	a := *attachment
+	a.Url = ""
+	ar.db.Attachments[a.Id] = a
+	return nil
+}
+
+// Records the size, thumbnail and processing date of an attachment.
+//
+// Might return ErrAttachmentNotFound
+func (ar *memoryAttachmentRepository) UpdatePreview(attachment *AttachmentDBO) error {
+	ar.db.Mu.Lock()
+	defer ar.db.Mu.Unlock()
+
+	a, ok := ar.db.Attachments[attachment.Id]
+	if !ok {
+		return fmt.Errorf("%w:%s", models.ErrAttachmentNotFound, attachment.Id)
+	}
+
+	a.Width = attachment.Width
+	a.Height = attachment.Height
+	a.HasThumbnail = attachment.HasThumbnail
+	a.DateProcessed = attachment.DateProcessed
+	ar.db.Attachments[a.Id] = a
+	return nil
+}
+
+// Must be called with the read lock held
+func (ar *memoryAttachmentRepository) filter(keep func(a models.Attachment) bool) []AttachmentDBO {
+	attachments := []AttachmentDBO{}
+	for _, a := range ar.db.Attachments {
+		if keep(a) {
+			attachments = append(attachments, a)
+		}
+	}
+	slices.SortFunc(attachments, func(a, b AttachmentDBO) int {
+		return cmp.Or(cmp.Compare(a.MessageId, b.MessageId), cmp.Compare(a.Position, b.Position))
+	})
+	return attachments
+}
@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"math"
+	"slices"
 	"time"
 
 	"github.com/NikosGour/chatter/internal/models"
@@ -16,14 +18,17 @@ type MessageRepository interface {
 	GetAll() ([]MessageDBO, error)
 	GetByID(id int64) (*MessageDBO, error)
 	GetByTabID(tab_id uuid.UUID) ([]MessageDBO, error)
+	GetPageByTabID(tab_id uuid.UUID, before int64, limit int) ([]MessageDBO, error)
+	GetLastPerSender(tab_id uuid.UUID, after int64, until int64) ([]MessageDBO, error)
 	Create(group *MessageDBO) (int64, error)
+	AddMentions(message_id int64, user_ids []uuid.UUID) error
 }
 
 type messageRepository struct {
-	db *storage.PostgreSQLStorage
+	db storage.SQLQuerier
 }
 
-func NewMessageRepository(db *storage.PostgreSQLStorage) MessageRepository {
+func NewMessageRepository(db storage.SQLQuerier) MessageRepository {
 	mr := &messageRepository{db: db}
 	return mr
 }
@@ -44,14 +49,18 @@ type MessageDBO struct {
 func (mr *messageRepository) GetAll() ([]MessageDBO, error) {
 	mdbos := []MessageDBO{}
 	q := `SELECT m.*,
-       	         u.id        AS "user.id",
-       	         u.username  AS "user.username",
-       	         t.id        AS "tab.id",
-       	         t.server_id AS "tab.server_id",
-       	         t.name      AS "tab.name"
+       	         u.id                      AS "user.id",
+       	         u.username                AS "user.username",
+       	         u.display_name            AS "user.display_name",
+       	         u.avatar_id               AS "user.avatar_id",
+       	         COALESCE(sm.nickname, '') AS "user.nickname",
+       	         t.id                      AS "tab.id",
+       	         t.server_id               AS "tab.server_id",
+       	         t.name                    AS "tab.name"
 		  FROM messages m
 		  JOIN users u ON u.id = m.sender_id
-		  JOIN tabs t ON m.tab_id = t.id;`
+		  JOIN tabs t ON m.tab_id = t.id
+		  LEFT JOIN server_members sm ON sm.server_id = t.server_id AND sm.user_id = u.id;`
 
 	err := mr.db.Select(&mdbos, q)
 	if err != nil {
@@ -67,14 +76,18 @@ func (mr *messageRepository) GetAll() ([]MessageDBO, error) {
 func (mr *messageRepository) GetByID(id int64) (*MessageDBO, error) {
 	mdbo := MessageDBO{}
 	q := `SELECT m.*,
-       	         u.id        AS "user.id",
-       	         u.username  AS "user.username",
-       	         t.id        AS "tab.id",
-       	         t.server_id AS "tab.server_id",
-       	         t.name      AS "tab.name"
+       	         u.id                      AS "user.id",
+       	         u.username                AS "user.username",
+       	         u.display_name            AS "user.display_name",
+       	         u.avatar_id               AS "user.avatar_id",
+       	         COALESCE(sm.nickname, '') AS "user.nickname",
+       	         t.id                      AS "tab.id",
+       	         t.server_id               AS "tab.server_id",
+       	         t.name                    AS "tab.name"
 		  FROM messages m
 		  JOIN users u ON u.id = m.sender_id
 		  JOIN tabs t ON m.tab_id = t.id
+		  LEFT JOIN server_members sm ON sm.server_id = t.server_id AND sm.user_id = u.id
 	      WHERE m.id = $1;`
 
 	err := mr.db.Get(&mdbo, q, id)
@@ -94,15 +107,20 @@ func (mr *messageRepository) GetByID(id int64) (*MessageDBO, error) {
 func (mr *messageRepository) GetByTabID(tab_id uuid.UUID) ([]MessageDBO, error) {
 	mdbos := []MessageDBO{}
 	q := `SELECT m.*,
-       	         u.id        AS "user.id",
-       	         u.username  AS "user.username",
-       	         t.id        AS "tab.id",
-       	         t.server_id AS "tab.server_id",
-       	         t.name      AS "tab.name"
+       	         u.id                      AS "user.id",
+       	         u.username                AS "user.username",
+       	         u.display_name            AS "user.display_name",
+       	         u.avatar_id               AS "user.avatar_id",
+       	         COALESCE(sm.nickname, '') AS "user.nickname",
+       	         t.id                      AS "tab.id",
+       	         t.server_id               AS "tab.server_id",
+       	         t.name                    AS "tab.name"
 		  FROM messages m
 		  JOIN users u ON u.id = m.sender_id
 		  JOIN tabs t ON m.tab_id = t.id
-		  WHERE t.id = $1;`
+		  LEFT JOIN server_members sm ON sm.server_id = t.server_id AND sm.user_id = u.id
+		  WHERE t.id = $1
+		  ORDER BY m.id;`
 
 	err := mr.db.Select(&mdbos, q, tab_id)
 	if err != nil {
@@ -113,10 +131,77 @@ func (mr *messageRepository) GetByTabID(tab_id uuid.UUID) ([]MessageDBO, error)
 
 }
 
+// Retrieves the newest limit messages of the tab with an id below before, any id when before is 0.
+//
+// The page is ordered oldest first.
+func (mr *messageRepository) GetPageByTabID(tab_id uuid.UUID, before int64, limit int) ([]MessageDBO, error) {
+	if before <= 0 {
+		before = math.MaxInt64
+	}
+
+	mdbos := []MessageDBO{}
+	q := `SELECT m.*,
+       	         u.id                      AS "user.id",
+       	         u.username                AS "user.username",
+       	         u.display_name            AS "user.display_name",
+       	         u.avatar_id               AS "user.avatar_id",
+       	         COALESCE(sm.nickname, '') AS "user.nickname",
+       	         t.id                      AS "tab.id",
+       	         t.server_id               AS "tab.server_id",
+       	         t.name                    AS "tab.name"
+		  FROM messages m
+		  JOIN users u ON u.id = m.sender_id
+		  JOIN tabs t ON m.tab_id = t.id
+		  LEFT JOIN server_members sm ON sm.server_id = t.server_id AND sm.user_id = u.id
+		  WHERE t.id = $1 AND m.id < $2
+		  ORDER BY m.id DESC
+		  LIMIT $3;`
+
+	err := mr.db.Select(&mdbos, q, tab_id, before, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Reverse(mdbos)
+	return mdbos, nil
+}
+
+// Retrieves the last message of every sender among the messages of the tab with an id in (after, until].
+//
+// Ordered by id.
+func (mr *messageRepository) GetLastPerSender(tab_id uuid.UUID, after int64, until int64) ([]MessageDBO, error) {
+	mdbos := []MessageDBO{}
+	q := `SELECT m.*,
+       	         u.id                      AS "user.id",
+       	         u.username                AS "user.username",
+       	         u.display_name            AS "user.display_name",
+       	         u.avatar_id               AS "user.avatar_id",
+       	         COALESCE(sm.nickname, '') AS "user.nickname",
+       	         t.id                      AS "tab.id",
+       	         t.server_id               AS "tab.server_id",
+       	         t.name                    AS "tab.name"
+		  FROM messages m
+		  JOIN users u ON u.id = m.sender_id
+		  JOIN tabs t ON m.tab_id = t.id
+		  LEFT JOIN server_members sm ON sm.server_id = t.server_id AND sm.user_id = u.id
+		  WHERE m.id IN (SELECT MAX(id)
+		                   FROM messages
+		                  WHERE tab_id = $1 AND id > $2 AND id <= $3
+		                  GROUP BY sender_id)
+		  ORDER BY m.id;`
+
+	err := mr.db.Select(&mdbos, q, tab_id, after, until)
+	if err != nil {
+		return nil, err
+	}
+
+	return mdbos, nil
+}
+
 // Inserts a message into a database.
 //
 // Returns the id of the created message.
-// Might return any sql error
+// Might return ErrForeignKeyViolation or any other sql error
 func (mr *messageRepository) Create(message_dbo *MessageDBO) (int64, error) {
 	q := `INSERT INTO messages ("text", sender_id, tab_id, date_sent)
 		  VALUES (:text, :sender_id, :tab_id, :date_sent)
@@ -131,8 +216,31 @@ func (mr *messageRepository) Create(message_dbo *MessageDBO) (int64, error) {
 
 	err = stmt.Get(&insert_id, message_dbo)
 	if err != nil {
+		if mr.db.IsForeignKeyViolation(err) {
+			return 0, fmt.Errorf("%w:sender_id=%s,tab_id=%s", storage.ErrForeignKeyViolation, message_dbo.SenderId, message_dbo.TabId)
+		}
 		return 0, fmt.Errorf("On q=`%s`: %w", q, err)
 	}
 
 	return insert_id, nil
 }
+
+// Records that the message mentions the users.
+//
+// Might return ErrForeignKeyViolation or any other sql error
+func (mr *messageRepository) AddMentions(message_id int64, user_ids []uuid.UUID) error {
+	q := `INSERT INTO message_mentions (message_id, user_id)
+		  VALUES ($1, $2)
+		  ON CONFLICT DO NOTHING;`
+
+	for _, user_id := range user_ids {
+		_, err := mr.db.Exec(q, message_id, user_id)
+		if err != nil {
+			if mr.db.IsForeignKeyViolation(err) {
+				return fmt.Errorf("%w:message_id=%d,user_id=%s", storage.ErrForeignKeyViolation, message_id, user_id)
+			}
+			return fmt.Errorf("on q=`%s`: %w", q, err)
+		}
+	}
+	return nil
+}
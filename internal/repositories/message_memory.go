@@ -0,0 +1,164 @@
+package repositories
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/storage"
+	"github.com/google/uuid"
+)
+
+type memoryMessageRepository struct {
+	db *storage.MemoryStorage
+}
+
+func NewMemoryMessageRepository(db *storage.MemoryStorage) MessageRepository {
+	mr := &memoryMessageRepository{db: db}
+	return mr
+}
+
+// Retrieves all message records from the store.
+func (mr *memoryMessageRepository) GetAll() ([]MessageDBO, error) {
+	mr.db.Mu.RLock()
+	defer mr.db.Mu.RUnlock()
+
+	return mr.filter(func(m storage.MemoryMessage) bool { return true }), nil
+}
+
+// Retrieves a message given the id.
+//
+// Might return ErrMessageNotFound
+func (mr *memoryMessageRepository) GetByID(id int64) (*MessageDBO, error) {
+	mr.db.Mu.RLock()
+	defer mr.db.Mu.RUnlock()
+
+	m, ok := mr.db.Messages[id]
+	if !ok {
+		return nil, fmt.Errorf("%w:%d", models.ErrMessageNotFound, id)
+	}
+
+	mdbo := mr.join(m)
+	return &mdbo, nil
+}
+
+func (mr *memoryMessageRepository) GetByTabID(tab_id uuid.UUID) ([]MessageDBO, error) {
+	mr.db.Mu.RLock()
+	defer mr.db.Mu.RUnlock()
+
+	return mr.filter(func(m storage.MemoryMessage) bool { return m.TabId == tab_id }), nil
+}
+
+// Retrieves the newest limit messages of the tab with an id below before, any id when before is 0.
+//
+// The page is ordered oldest first.
+func (mr *memoryMessageRepository) GetPageByTabID(tab_id uuid.UUID, before int64, limit int) ([]MessageDBO, error) {
+	mr.db.Mu.RLock()
+	defer mr.db.Mu.RUnlock()
+
+	mdbos := mr.filter(func(m storage.MemoryMessage) bool { return m.TabId == tab_id && (before <= 0 || m.Id < before) })
+	if len(mdbos) > limit {
+		mdbos = mdbos[len(mdbos)-limit:]
+	}
+	return mdbos, nil
+}
+
+// Retrieves the last message of every sender among the messages of the tab with an id in (after, until].
+//
+// Ordered by id.
+func (mr *memoryMessageRepository) GetLastPerSender(tab_id uuid.UUID, after int64, until int64) ([]MessageDBO, error) {
+	mr.db.Mu.RLock()
+	defer mr.db.Mu.RUnlock()
+
+	last := map[uuid.UUID]int64{}
+	for _, m := range mr.db.Messages {
+		if m.TabId == tab_id && m.Id > after && m.Id <= until {
+			last[m.SenderId] = max(last[m.SenderId], m.Id)
+		}
+	}
+	return mr.filter(func(m storage.MemoryMessage) bool { return last[m.SenderId] == m.Id }), nil
+}
+
+// Inserts a message into the store.
+//
+// Returns the id of the created message.
+// Might return ErrForeignKeyViolation
+func (mr *memoryMessageRepository) Create(message_dbo *MessageDBO) (int64, error) {
+	mr.db.Mu.Lock()
+	defer mr.db.Mu.Unlock()
+
+	_, sender_ok := mr.db.Users[message_dbo.SenderId]
+	_, tab_ok := mr.db.Tabs[message_dbo.TabId]
+	if !sender_ok || !tab_ok {
+		return 0, fmt.Errorf("%w:sender_id=%s,tab_id=%s", storage.ErrForeignKeyViolation, message_dbo.SenderId, message_dbo.TabId)
+	}
+
+	mr.db.LastMessageId++
+	mr.db.Messages[mr.db.LastMessageId] = storage.MemoryMessage{
+		Id:       mr.db.LastMessageId,
+		Text:     message_dbo.Text,
+		SenderId: message_dbo.SenderId,
+		TabId:    message_dbo.TabId,
+		DateSent: message_dbo.DateSent,
+	}
+	return mr.db.LastMessageId, nil
+}
+
+// Records that the message mentions the users.
+//
+// Might return ErrForeignKeyViolation
+func (mr *memoryMessageRepository) AddMentions(message_id int64, user_ids []uuid.UUID) error {
+	mr.db.Mu.Lock()
+	defer mr.db.Mu.Unlock()
+
+	m, ok := mr.db.Messages[message_id]
+	if !ok {
+		return fmt.Errorf("%w:message_id=%d", storage.ErrForeignKeyViolation, message_id)
+	}
+	for _, user_id := range user_ids {
+		if _, ok := mr.db.Users[user_id]; !ok {
+			return fmt.Errorf("%w:message_id=%d,user_id=%s", storage.ErrForeignKeyViolation, message_id, user_id)
+		}
+		if !slices.Contains(m.Mentions, user_id) {
+			m.Mentions = append(slices.Clip(m.Mentions), user_id)
+		}
+	}
+	mr.db.Messages[message_id] = m
+	return nil
+}
+
+// Must be called with the read lock held
+func (mr *memoryMessageRepository) filter(keep func(m storage.MemoryMessage) bool) []MessageDBO {
+	mdbos := []MessageDBO{}
+	for _, m := range mr.db.Messages {
+		if keep(m) {
+			mdbos = append(mdbos, mr.join(m))
+		}
+	}
+	slices.SortFunc(mdbos, func(a, b MessageDBO) int { return cmp.Compare(a.Id, b.Id) })
+	return mdbos
+}
+
+// Attaches the sender and tab columns the sql repository joins in.
+//
+// Must be called with the read lock held
+func (mr *memoryMessageRepository) join(m storage.MemoryMessage) MessageDBO {
+	u := mr.db.Users[m.SenderId]
+	t := mr.db.Tabs[m.TabId]
+	mdbo := MessageDBO{
+		Id:       m.Id,
+		Text:     m.Text,
+		SenderId: m.SenderId,
+		User:     &models.User{Id: u.Id, Username: u.Username, DisplayName: u.DisplayName, AvatarId: u.AvatarId},
+		TabId:    m.TabId,
+		Tab:      &models.Tab{Id: t.Id, ServerId: t.ServerId, Name: t.Name},
+		DateSent: m.DateSent,
+	}
+	for _, member := range mr.db.ServerMembers[t.ServerId] {
+		if member.UserId == m.SenderId {
+			mdbo.User.Nickname = member.Nickname
+		}
+	}
+	return mdbo
+}
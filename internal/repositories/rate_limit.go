@@ -0,0 +1,80 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/storage"
+)
+
+// Rate limit buckets, shared by every instance using the same storage.
+//
+// Buckets follow the generic cell rate algorithm: each one only keeps the theoretical
+// arrival time (tat) of the next request, a request is let through when the tat is at most
+// tolerance ahead of now and then pushes it interval further.
+type RateLimitRepository interface {
+	Take(bucket string, now time.Time, interval time.Duration, tolerance time.Duration) (bool, time.Time, error)
+	DeleteExpired(now time.Time) (int64, error)
+}
+
+type rateLimitRepository struct {
+	db storage.SQLQuerier
+}
+
+func NewRateLimitRepository(db storage.SQLQuerier) RateLimitRepository {
+	rr := &rateLimitRepository{db: db}
+	return rr
+}
+
+// Lets a request through the bucket if it has room, in a single statement so concurrent
+// instances can't both take the last spot.
+//
+// Returns whether the request was let through and the tat of the bucket.
+// Might return any sql error
+func (rr *rateLimitRepository) Take(bucket string, now time.Time, interval time.Duration, tolerance time.Duration) (bool, time.Time, error) {
+	now_ms, interval_ms, tolerance_ms := now.UnixMilli(), interval.Milliseconds(), tolerance.Milliseconds()
+	tat_ms := int64(0)
+	q := `INSERT INTO rate_limits (bucket, tat)
+		  VALUES ($1, $2)
+		  ON CONFLICT (bucket) DO UPDATE
+		  SET tat = CASE WHEN rate_limits.tat > $3 THEN rate_limits.tat + $4 ELSE $2 END
+		  WHERE rate_limits.tat - $3 <= $5
+		  RETURNING tat;`
+
+	err := rr.db.Get(&tat_ms, q, bucket, now_ms+interval_ms, now_ms, interval_ms, tolerance_ms)
+	if err == nil {
+		return true, time.UnixMilli(tat_ms), nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, time.Time{}, fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	// Nothing was updated, the bucket is full
+	q = `SELECT tat
+		 FROM rate_limits
+		 WHERE bucket = $1;`
+
+	err = rr.db.Get(&tat_ms, q, bucket)
+	if err != nil {
+		return false, time.Time{}, fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+	return false, time.UnixMilli(tat_ms), nil
+}
+
+// Deletes the buckets whose tat has passed, they are as good as new.
+//
+// Returns the number of deleted buckets.
+// Might return any sql error
+func (rr *rateLimitRepository) DeleteExpired(now time.Time) (int64, error) {
+	q := `DELETE FROM rate_limits
+		  WHERE tat < $1;`
+
+	res, err := rr.db.Exec(q, now.UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return res.RowsAffected()
+}
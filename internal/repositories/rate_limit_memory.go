@@ -0,0 +1,51 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/NikosGour/chatter/internal/storage"
+)
+
+type memoryRateLimitRepository struct {
+	db *storage.MemoryStorage
+}
+
+func NewMemoryRateLimitRepository(db *storage.MemoryStorage) RateLimitRepository {
+	rr := &memoryRateLimitRepository{db: db}
+	return rr
+}
+
+// Lets a request through the bucket if it has room.
+//
+// Returns whether the request was let through and the tat of the bucket.
+func (rr *memoryRateLimitRepository) Take(bucket string, now time.Time, interval time.Duration, tolerance time.Duration) (bool, time.Time, error) {
+	rr.db.Mu.Lock()
+	defer rr.db.Mu.Unlock()
+
+	now_ms, interval_ms, tolerance_ms := now.UnixMilli(), interval.Milliseconds(), tolerance.Milliseconds()
+	tat_ms, ok := rr.db.RateLimits[bucket]
+	if ok && tat_ms-now_ms > tolerance_ms {
+		return false, time.UnixMilli(tat_ms), nil
+	}
+
+	tat_ms = max(tat_ms, now_ms) + interval_ms
+	rr.db.RateLimits[bucket] = tat_ms
+	return true, time.UnixMilli(tat_ms), nil
+}
+
+// Deletes the buckets whose tat has passed, they are as good as new.
+//
+// Returns the number of deleted buckets.
+func (rr *memoryRateLimitRepository) DeleteExpired(now time.Time) (int64, error) {
+	rr.db.Mu.Lock()
+	defer rr.db.Mu.Unlock()
+
+	deleted := int64(0)
+	for bucket, tat_ms := range rr.db.RateLimits {
+		if tat_ms < now.UnixMilli() {
+			delete(rr.db.RateLimits, bucket)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
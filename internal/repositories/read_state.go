@@ -0,0 +1,120 @@
+package repositories
+
+import (
+	"fmt"
+
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/storage"
+	"github.com/google/uuid"
+)
+
+type ReadStateRepository interface {
+	Ack(user_id uuid.UUID, tab_id uuid.UUID, message_id int64) error
+	GetForUpdate(user_id uuid.UUID, tab_id uuid.UUID) (int64, error)
+	GetByServerID(user_id uuid.UUID, server_id uuid.UUID) ([]ReadStateDBO, error)
+	GetReaders(tab_id uuid.UUID, message_id int64) ([]UserDBO, error)
+}
+
+type ReadStateDBO = models.ReadState
+
+type readStateRepository struct {
+	db storage.SQLQuerier
+}
+
+func NewReadStateRepository(db storage.SQLQuerier) ReadStateRepository {
+	rr := &readStateRepository{db: db}
+	return rr
+}
+
+// Marks everything up to message_id as read by the user, read states never move backwards.
+//
+// Might return ErrForeignKeyViolation or any other sql error
+func (rr *readStateRepository) Ack(user_id uuid.UUID, tab_id uuid.UUID, message_id int64) error {
+	q := `INSERT INTO read_states (user_id, tab_id, last_read_message_id)
+	      VALUES ($1, $2, $3)
+	      ON CONFLICT (user_id, tab_id) DO UPDATE
+	      SET last_read_message_id = excluded.last_read_message_id
+	      WHERE read_states.last_read_message_id < excluded.last_read_message_id;`
+
+	_, err := rr.db.Exec(q, user_id, tab_id, message_id)
+	if err != nil {
+		if rr.db.IsForeignKeyViolation(err) {
+			return fmt.Errorf("%w:user_id=%s,tab_id=%s", storage.ErrForeignKeyViolation, user_id, tab_id)
+		}
+		return fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return nil
+}
+
+// Get the last message the user read in the tab, 0 when none, and lock it until the transaction ends
+// so concurrent acks of the same tab by the same user take turns.
+//
+// Creates the read state when there is none, so there is a row to lock.
+// Might return ErrForeignKeyViolation or any other sql error
+func (rr *readStateRepository) GetForUpdate(user_id uuid.UUID, tab_id uuid.UUID) (int64, error) {
+	var last_read_message_id int64
+	q := `INSERT INTO read_states (user_id, tab_id, last_read_message_id)
+	      VALUES ($1, $2, 0)
+	      ON CONFLICT (user_id, tab_id) DO UPDATE
+	      SET last_read_message_id = read_states.last_read_message_id
+	      RETURNING last_read_message_id;`
+
+	err := rr.db.Get(&last_read_message_id, q, user_id, tab_id)
+	if err != nil {
+		if rr.db.IsForeignKeyViolation(err) {
+			return 0, fmt.Errorf("%w:user_id=%s,tab_id=%s", storage.ErrForeignKeyViolation, user_id, tab_id)
+		}
+		return 0, fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return last_read_message_id, nil
+}
+
+// Get the read state of the user for every tab of the server
+//
+// Might return any sql error
+func (rr *readStateRepository) GetByServerID(user_id uuid.UUID, server_id uuid.UUID) ([]ReadStateDBO, error) {
+	read_states := []ReadStateDBO{}
+	q := `SELECT t.id AS tab_id,
+		         COALESCE(rs.last_read_message_id, 0) AS last_read_message_id,
+		         COUNT(m.id) AS unread,
+		         COUNT(mm.message_id) AS mentions
+		  FROM tabs t
+		  JOIN users u ON u.id = $1
+		  LEFT JOIN read_states rs ON rs.tab_id = t.id AND rs.user_id = u.id
+		  LEFT JOIN messages m ON m.tab_id = t.id AND m.sender_id <> u.id AND m.id > COALESCE(rs.last_read_message_id, 0)
+		  LEFT JOIN message_mentions mm ON mm.message_id = m.id AND mm.user_id = u.id
+		  WHERE t.server_id = $2
+		  GROUP BY t.id, rs.last_read_message_id
+		  ORDER BY t.id;`
+
+	err := rr.db.Select(&read_states, q, user_id, server_id)
+	if err != nil {
+		return nil, fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return read_states, nil
+}
+
+// Get the members of the tab's server that have read the tab up to the message,
+// except those hiding their read receipts
+//
+// Might return any sql error
+func (rr *readStateRepository) GetReaders(tab_id uuid.UUID, message_id int64) ([]UserDBO, error) {
+	users := []UserDBO{}
+	q := `SELECT u.id, u.username, u.display_name, u.avatar_id
+		  FROM read_states rs
+		  JOIN users u ON u.id = rs.user_id
+		  JOIN tabs t ON t.id = rs.tab_id
+		  JOIN server_members sm ON sm.server_id = t.server_id AND sm.user_id = rs.user_id
+		  WHERE rs.tab_id = $1 AND rs.last_read_message_id >= $2 AND u.hide_read_receipts = FALSE
+		  ORDER BY u.username, u.id;`
+
+	err := rr.db.Select(&users, q, tab_id, message_id)
+	if err != nil {
+		return nil, fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return users, nil
+}
@@ -0,0 +1,111 @@
+package repositories
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/NikosGour/chatter/internal/storage"
+	"github.com/google/uuid"
+)
+
+type memoryReadStateRepository struct {
+	db *storage.MemoryStorage
+}
+
+func NewMemoryReadStateRepository(db *storage.MemoryStorage) ReadStateRepository {
+	rr := &memoryReadStateRepository{db: db}
+	return rr
+}
+
+// Marks everything up to message_id as read by the user, read states never move backwards.
+//
+// Might return ErrForeignKeyViolation
+func (rr *memoryReadStateRepository) Ack(user_id uuid.UUID, tab_id uuid.UUID, message_id int64) error {
+	rr.db.Mu.Lock()
+	defer rr.db.Mu.Unlock()
+
+	_, user_ok := rr.db.Users[user_id]
+	_, tab_ok := rr.db.Tabs[tab_id]
+	if !user_ok || !tab_ok {
+		return fmt.Errorf("%w:user_id=%s,tab_id=%s", storage.ErrForeignKeyViolation, user_id, tab_id)
+	}
+
+	key := storage.MemoryReadStateKey{UserId: user_id, TabId: tab_id}
+	rr.db.ReadStates[key] = max(rr.db.ReadStates[key], message_id)
+	return nil
+}
+
+// Get the last message the user read in the tab, 0 when none.
+// The memory storage is locked for a whole transaction, so there is nothing else to lock.
+//
+// Might return ErrForeignKeyViolation
+func (rr *memoryReadStateRepository) GetForUpdate(user_id uuid.UUID, tab_id uuid.UUID) (int64, error) {
+	rr.db.Mu.RLock()
+	defer rr.db.Mu.RUnlock()
+
+	_, user_ok := rr.db.Users[user_id]
+	_, tab_ok := rr.db.Tabs[tab_id]
+	if !user_ok || !tab_ok {
+		return 0, fmt.Errorf("%w:user_id=%s,tab_id=%s", storage.ErrForeignKeyViolation, user_id, tab_id)
+	}
+
+	return rr.db.ReadStates[storage.MemoryReadStateKey{UserId: user_id, TabId: tab_id}], nil
+}
+
+// Get the read state of the user for every tab of the server
+func (rr *memoryReadStateRepository) GetByServerID(user_id uuid.UUID, server_id uuid.UUID) ([]ReadStateDBO, error) {
+	rr.db.Mu.RLock()
+	defer rr.db.Mu.RUnlock()
+
+	read_states := []ReadStateDBO{}
+	_, ok := rr.db.Users[user_id]
+	if !ok {
+		return read_states, nil
+	}
+
+	for _, tab := range rr.db.Tabs {
+		if tab.ServerId != server_id {
+			continue
+		}
+
+		rs := ReadStateDBO{TabId: tab.Id, LastReadMessageId: rr.db.ReadStates[storage.MemoryReadStateKey{UserId: user_id, TabId: tab.Id}]}
+		for _, m := range rr.db.Messages {
+			if m.TabId != tab.Id || m.SenderId == user_id || m.Id <= rs.LastReadMessageId {
+				continue
+			}
+			rs.Unread++
+			if slices.Contains(m.Mentions, user_id) {
+				rs.Mentions++
+			}
+		}
+		read_states = append(read_states, rs)
+	}
+	slices.SortFunc(read_states, func(a, b ReadStateDBO) int { return strings.Compare(a.TabId.String(), b.TabId.String()) })
+	return read_states, nil
+}
+
+// Get the members of the tab's server that have read the tab up to the message,
+// except those hiding their read receipts
+func (rr *memoryReadStateRepository) GetReaders(tab_id uuid.UUID, message_id int64) ([]UserDBO, error) {
+	rr.db.Mu.RLock()
+	defer rr.db.Mu.RUnlock()
+
+	users := []UserDBO{}
+	members := rr.db.ServerMembers[rr.db.Tabs[tab_id].ServerId]
+	for key, last_read := range rr.db.ReadStates {
+		user := rr.db.Users[key.UserId]
+		if key.TabId != tab_id || last_read < message_id || user.HideReadReceipts {
+			continue
+		}
+		if !slices.ContainsFunc(members, func(m storage.MemoryMember) bool { return m.UserId == key.UserId }) {
+			continue
+		}
+		users = append(users, UserDBO{Id: user.Id, Username: user.Username, DisplayName: user.DisplayName, AvatarId: user.AvatarId})
+	}
+	slices.SortFunc(users, func(a, b UserDBO) int {
+		return cmp.Or(strings.Compare(a.Username, b.Username), strings.Compare(a.Id.String(), b.Id.String()))
+	})
+	return users, nil
+}
@@ -0,0 +1,119 @@
+package repositories
+
+import (
+	"cmp"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/chatter/internal/storage"
+	"github.com/google/uuid"
+)
+
+// The full set of repositories backed by a single storage.
+type Repositories struct {
+	User    UserRepository
+	Server  ServerRepository
+	Tab     TabRepository
+	Message MessageRepository
+
+	ReadState  ReadStateRepository
+	Attachment AttachmentRepository
+	RateLimit  RateLimitRepository
+
+	transact func(fn func(tx *Repositories) error) error
+}
+
+// Lets services run several repository calls atomically, implemented by Repositories.
+type UnitOfWork interface {
+	Transaction(fn func(tx *Repositories) error) error
+}
+
+// Builds every repository on top of the given storage backend.
+//
+// Might return ErrUnreachable if the backend has no repository implementation
+func NewRepositories(db storage.Storage) (*Repositories, error) {
+	switch db := db.(type) {
+	case storage.SQLStorage:
+		r := newSQLRepositories(db)
+		r.transact = func(fn func(tx *Repositories) error) error {
+			return db.Transact(func(tx *storage.SQLTx) error {
+				return fn(joinTransaction(newSQLRepositories(tx)))
+			})
+		}
+		return r, nil
+	case *storage.MemoryStorage:
+		r := newMemoryRepositories(db)
+		r.transact = func(fn func(tx *Repositories) error) error {
+			return db.Transact(func(tx *storage.MemoryStorage) error {
+				return fn(joinTransaction(newMemoryRepositories(tx)))
+			})
+		}
+		return r, nil
+	}
+
+	return nil, fmt.Errorf("%w: no repositories for storage %T", common.ErrUnreachable, db)
+}
+
+// Runs fn against repositories bound to a single transaction.
+//
+// Everything fn does through tx is committed if it returns nil and rolled back otherwise.
+// Only tx may be used inside fn, the storage can be locked until the transaction ends.
+func (r *Repositories) Transaction(fn func(tx *Repositories) error) error {
+	return r.transact(fn)
+}
+
+func newSQLRepositories(db storage.SQLQuerier) *Repositories {
+	r := &Repositories{
+		User:    NewUserRepository(db),
+		Server:  NewServerRepository(db),
+		Tab:     NewTabRepository(db),
+		Message: NewMessageRepository(db),
+
+		ReadState:  NewReadStateRepository(db),
+		Attachment: NewAttachmentRepository(db),
+		RateLimit:  NewRateLimitRepository(db),
+	}
+	return r
+}
+
+func newMemoryRepositories(db *storage.MemoryStorage) *Repositories {
+	r := &Repositories{
+		User:    NewMemoryUserRepository(db),
+		Server:  NewMemoryServerRepository(db),
+		Tab:     NewMemoryTabRepository(db),
+		Message: NewMemoryMessageRepository(db),
+
+		ReadState:  NewMemoryReadStateRepository(db),
+		Attachment: NewMemoryAttachmentRepository(db),
+		RateLimit:  NewMemoryRateLimitRepository(db),
+	}
+	return r
+}
+
+// Nested transactions run as part of the one they are started from
+func joinTransaction(tx *Repositories) *Repositories {
+	tx.transact = func(fn func(tx *Repositories) error) error {
+		return fn(tx)
+	}
+	return tx
+}
+
+// Orders rows of the memory repositories, whose maps have no stable iteration order
+func compareCreated(a_date time.Time, a_id uuid.UUID, b_date time.Time, b_id uuid.UUID) int {
+	return cmp.Or(a_date.Compare(b_date), strings.Compare(a_id.String(), b_id.String()))
+}
+
+// Returns not_found if the statement changed no rows
+func expectAffected(res sql.Result, not_found error) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("on RowsAffected: %w", err)
+	}
+	if affected == 0 {
+		return not_found
+	}
+	return nil
+}
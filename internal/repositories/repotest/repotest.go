@@ -0,0 +1,1197 @@
+// Package repotest is a conformance suite for the repository interfaces.
+//
+// Every storage backend is expected to pass it, so that services behave the
+// same no matter which one they are built on:
+//
+//	func TestMemoryRepositories(t *testing.T) {
+//		repotest.Run(t, func(t *testing.T) *repositories.Repositories {
+//			repos, err := repositories.NewRepositories(storage.NewMemoryStorage())
+//			if err != nil {
+//				t.Fatal(err)
+//			}
+//			return repos
+//		})
+//	}
+package repotest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/repositories"
+	"github.com/NikosGour/chatter/internal/storage"
+	"github.com/google/uuid"
+)
+
+// Must return repositories over an empty store, one per call.
+type Factory func(t *testing.T) *repositories.Repositories
+
+func Run(t *testing.T, new_repos Factory) {
+	t.Run("User", func(t *testing.T) { testUser(t, new_repos(t)) })
+	t.Run("Server", func(t *testing.T) { testServer(t, new_repos(t)) })
+	t.Run("Tab", func(t *testing.T) { testTab(t, new_repos(t)) })
+	t.Run("Message", func(t *testing.T) { testMessage(t, new_repos(t)) })
+	t.Run("Transaction", func(t *testing.T) { testTransaction(t, new_repos(t)) })
+	t.Run("Membership", func(t *testing.T) { testMembership(t, new_repos(t)) })
+	t.Run("UpdateDelete", func(t *testing.T) { testUpdateDelete(t, new_repos(t)) })
+	t.Run("ReadState", func(t *testing.T) { testReadState(t, new_repos(t)) })
+	t.Run("Attachment", func(t *testing.T) { testAttachment(t, new_repos(t)) })
+	t.Run("Profile", func(t *testing.T) { testProfile(t, new_repos(t)) })
+	t.Run("RateLimit", func(t *testing.T) { testRateLimit(t, new_repos(t)) })
+}
+
+// Timestamps are stored with microsecond precision and without a time zone
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func mustCreateUser(t *testing.T, r *repositories.Repositories, username string, is_test bool) uuid.UUID {
+	t.Helper()
+	id, err := r.User.Create(&repositories.UserDBO{Id: uuid.New(), Username: username, Password: "pass", DateCreated: now(), IsTest: is_test})
+	if err != nil {
+		t.Fatalf("on User.Create(%s): %s", username, err)
+	}
+	return id
+}
+
+func mustCreateServer(t *testing.T, r *repositories.Repositories, name string, is_test bool) uuid.UUID {
+	t.Helper()
+	id, err := r.Server.Create(&repositories.ServerDBO{Id: uuid.New(), Name: name, DateCreated: now(), IsTest: is_test})
+	if err != nil {
+		t.Fatalf("on Server.Create(%s): %s", name, err)
+	}
+	return id
+}
+
+func mustCreateTab(t *testing.T, r *repositories.Repositories, name string, server_id uuid.UUID) uuid.UUID {
+	t.Helper()
+	id, err := r.Tab.Create(&repositories.TabDBO{Id: uuid.New(), Name: name, ServerId: server_id, DateCreated: now()})
+	if err != nil {
+		t.Fatalf("on Tab.Create(%s): %s", name, err)
+	}
+	return id
+}
+
+func expectErr(t *testing.T, err error, target error) {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Fatalf("expected error %q, got: %v", target, err)
+	}
+}
+
+func expectLen[T any](t *testing.T, rows []T, n int) {
+	t.Helper()
+	if len(rows) != n {
+		t.Fatalf("expected %d rows, got %d: %#v", n, len(rows), rows)
+	}
+}
+
+func testUser(t *testing.T, r *repositories.Repositories) {
+	users, err := r.User.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, users, 0)
+
+	date_created := now()
+	id, err := r.User.Create(&repositories.UserDBO{Id: uuid.New(), Username: "nikos", Password: "123", DateCreated: date_created})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := r.User.GetByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Id != id || u.Username != "nikos" || u.Password != "123" || !u.DateCreated.Equal(date_created) {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+
+	_, err = r.User.GetByID(uuid.New())
+	expectErr(t, err, models.ErrUserNotFound)
+
+	_, err = r.User.Create(&repositories.UserDBO{Id: uuid.New(), Username: "nikos", Password: "456", DateCreated: now()})
+	expectErr(t, err, models.ErrUserAlreadyExists)
+
+	// The same username may exist once as a real and once as a test user
+	mustCreateUser(t, r, "nikos", true)
+	mustCreateUser(t, r, "maria", false)
+
+	users, err = r.User.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, users, 3)
+
+	users, err = r.User.GetByUsername("nikos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, users, 2)
+
+	users, err = r.User.GetByTestUsername("nikos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, users, 1)
+
+	users, err = r.User.GetByUsername("nobody")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, users, 0)
+}
+
+func testServer(t *testing.T, r *repositories.Repositories) {
+	servers, err := r.Server.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, servers, 0)
+
+	date_created := now()
+	id, err := r.Server.Create(&repositories.ServerDBO{Id: uuid.New(), Name: "Gamiades", DateCreated: date_created})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := r.Server.GetByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Id != id || s.Name != "Gamiades" || !s.DateCreated.Equal(date_created) {
+		t.Fatalf("unexpected server: %#v", s)
+	}
+
+	_, err = r.Server.GetByID(uuid.New())
+	expectErr(t, err, models.ErrServerNotFound)
+
+	_, err = r.Server.Create(&repositories.ServerDBO{Id: uuid.New(), Name: "Gamiades", DateCreated: now()})
+	expectErr(t, err, models.ErrServerAlreadyExists)
+
+	test_id := mustCreateServer(t, r, "Gamiades", true)
+
+	servers, err = r.Server.GetByName("Gamiades")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, servers, 2)
+
+	servers, err = r.Server.GetByTestName("Gamiades")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, servers, 1)
+	if servers[0].Id != test_id {
+		t.Fatalf("expected test server %s, got %s", test_id, servers[0].Id)
+	}
+
+	users, err := r.Server.GetUsers(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, users, 0)
+
+	user_id := mustCreateUser(t, r, "nikos", false)
+	err = r.Server.AddUserToServer(user_id, id, models.RoleMember)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Server.AddUserToServer(user_id, id, models.RoleMember)
+	expectErr(t, err, models.ErrUserAlreadyInServer)
+
+	err = r.Server.AddUserToServer(uuid.New(), id, models.RoleMember)
+	expectErr(t, err, storage.ErrForeignKeyViolation)
+
+	err = r.Server.AddUserToServer(user_id, uuid.New(), models.RoleMember)
+	expectErr(t, err, storage.ErrForeignKeyViolation)
+
+	users, err = r.Server.GetUsers(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, users, 1)
+	if users[0] != user_id {
+		t.Fatalf("expected member %s, got %s", user_id, users[0])
+	}
+}
+
+func testTab(t *testing.T, r *repositories.Repositories) {
+	tabs, err := r.Tab.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, tabs, 0)
+
+	server_id := mustCreateServer(t, r, "HUA", false)
+	other_server_id := mustCreateServer(t, r, "CTF", false)
+
+	date_created := now()
+	id, err := r.Tab.Create(&repositories.TabDBO{Id: uuid.New(), Name: "General", ServerId: server_id, DateCreated: date_created})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tab, err := r.Tab.GetByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tab.Id != id || tab.Name != "General" || tab.ServerId != server_id || !tab.DateCreated.Equal(date_created) {
+		t.Fatalf("unexpected tab: %#v", tab)
+	}
+
+	_, err = r.Tab.GetByID(uuid.New())
+	expectErr(t, err, models.ErrTabNotFound)
+
+	_, err = r.Tab.Create(&repositories.TabDBO{Id: uuid.New(), Name: "General", ServerId: uuid.New(), DateCreated: now()})
+	expectErr(t, err, models.ErrServerNotFound)
+
+	mustCreateTab(t, r, "Memes", server_id)
+	mustCreateTab(t, r, "General", other_server_id)
+
+	tabs, err = r.Tab.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, tabs, 3)
+	for _, tab := range tabs {
+		if tab.Server == nil || tab.Server.Id != tab.ServerId || tab.Server.Name == "" {
+			t.Fatalf("expected tab joined with its server, got: %#v", tab)
+		}
+	}
+
+	tabs, err = r.Tab.GetByServerID(server_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, tabs, 2)
+
+	tabs, err = r.Tab.GetByName("General")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, tabs, 2)
+
+	tabs, err = r.Tab.GetByName("Studying")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, tabs, 0)
+}
+
+func testMessage(t *testing.T, r *repositories.Repositories) {
+	messages, err := r.Message.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, messages, 0)
+
+	user_id := mustCreateUser(t, r, "nikos", false)
+	server_id := mustCreateServer(t, r, "ArchUsers", false)
+	tab_id := mustCreateTab(t, r, "General", server_id)
+	other_tab_id := mustCreateTab(t, r, "Memes", server_id)
+
+	date_sent := now()
+	id, err := r.Message.Create(&repositories.MessageDBO{Text: "hello", SenderId: user_id, TabId: tab_id, DateSent: date_sent})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := r.Message.GetByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Id != id || m.Text != "hello" || m.SenderId != user_id || m.TabId != tab_id || !m.DateSent.Equal(date_sent) {
+		t.Fatalf("unexpected message: %#v", m)
+	}
+	if m.User == nil || m.User.Id != user_id || m.User.Username != "nikos" {
+		t.Fatalf("expected message joined with its sender, got: %#v", m.User)
+	}
+	if m.Tab == nil || m.Tab.Id != tab_id || m.Tab.ServerId != server_id || m.Tab.Name != "General" {
+		t.Fatalf("expected message joined with its tab, got: %#v", m.Tab)
+	}
+
+	_, err = r.Message.GetByID(id + 1000)
+	expectErr(t, err, models.ErrMessageNotFound)
+
+	_, err = r.Message.Create(&repositories.MessageDBO{Text: "hello", SenderId: uuid.New(), TabId: tab_id, DateSent: now()})
+	expectErr(t, err, storage.ErrForeignKeyViolation)
+
+	_, err = r.Message.Create(&repositories.MessageDBO{Text: "hello", SenderId: user_id, TabId: uuid.New(), DateSent: now()})
+	expectErr(t, err, storage.ErrForeignKeyViolation)
+
+	second_id, err := r.Message.Create(&repositories.MessageDBO{Text: "world", SenderId: user_id, TabId: other_tab_id, DateSent: now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second_id <= id {
+		t.Fatalf("expected increasing message ids, got %d after %d", second_id, id)
+	}
+
+	messages, err = r.Message.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, messages, 2)
+
+	messages, err = r.Message.GetByTabID(tab_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, messages, 1)
+
+	messages, err = r.Message.GetByTabID(uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, messages, 0)
+
+	ids := []int64{id}
+	for _, text := range []string{"a", "b", "c"} {
+		page_id, err := r.Message.Create(&repositories.MessageDBO{Text: text, SenderId: user_id, TabId: tab_id, DateSent: now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, page_id)
+	}
+
+	messages, err = r.Message.GetPageByTabID(tab_id, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, messages, 2)
+	if messages[0].Id != ids[2] || messages[1].Id != ids[3] {
+		t.Fatalf("expected the newest page oldest first, got ids %d and %d", messages[0].Id, messages[1].Id)
+	}
+
+	messages, err = r.Message.GetPageByTabID(tab_id, ids[2], 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, messages, 2)
+	if messages[0].Id != ids[0] || messages[1].Id != ids[1] {
+		t.Fatalf("expected the page before %d, got ids %d and %d", ids[2], messages[0].Id, messages[1].Id)
+	}
+	if messages[0].User == nil || messages[0].User.Id != user_id || messages[0].Tab == nil || messages[0].Tab.Id != tab_id {
+		t.Fatalf("expected paged messages joined with their sender and tab, got: %#v", messages[0])
+	}
+
+	messages, err = r.Message.GetPageByTabID(tab_id, ids[0], 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, messages, 0)
+
+	other_user_id := mustCreateUser(t, r, "maria", false)
+	other_id, err := r.Message.Create(&repositories.MessageDBO{Text: "d", SenderId: other_user_id, TabId: tab_id, DateSent: now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	last_id, err := r.Message.Create(&repositories.MessageDBO{Text: "e", SenderId: user_id, TabId: tab_id, DateSent: now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err = r.Message.GetLastPerSender(tab_id, ids[0], other_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, messages, 2)
+	if messages[0].Id != ids[3] || messages[1].Id != other_id || messages[1].User == nil || messages[1].User.Id != other_user_id {
+		t.Fatalf("expected the last message of each sender up to %d, got %#v", other_id, messages)
+	}
+
+	messages, err = r.Message.GetLastPerSender(tab_id, other_id, last_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, messages, 1)
+	if messages[0].Id != last_id {
+		t.Fatalf("expected only the message after %d, got %d", other_id, messages[0].Id)
+	}
+
+	messages, err = r.Message.GetLastPerSender(other_tab_id, 0, last_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, messages, 1)
+	if messages[0].Id != second_id {
+		t.Fatalf("expected only the message of the other tab, got %d", messages[0].Id)
+	}
+}
+
+func testTransaction(t *testing.T, r *repositories.Repositories) {
+	user_id := mustCreateUser(t, r, "nikos", false)
+
+	committed_id := uuid.Nil
+	err := r.Transaction(func(tx *repositories.Repositories) error {
+		id, err := tx.Server.Create(&repositories.ServerDBO{Id: uuid.New(), Name: "Gamiades", DateCreated: now()})
+		if err != nil {
+			return err
+		}
+		committed_id = id
+
+		err = tx.Server.AddUserToServer(user_id, id, models.RoleMember)
+		if err != nil {
+			return err
+		}
+
+		// Nested transactions join the outer one
+		return tx.Transaction(func(tx *repositories.Repositories) error {
+			_, err := tx.Tab.Create(&repositories.TabDBO{Id: uuid.New(), Name: "General", ServerId: id, DateCreated: now()})
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = r.Server.GetByID(committed_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tabs, err := r.Tab.GetByServerID(committed_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, tabs, 1)
+
+	rolled_back_id := uuid.New()
+	err = r.Transaction(func(tx *repositories.Repositories) error {
+		_, err := tx.Server.Create(&repositories.ServerDBO{Id: rolled_back_id, Name: "HUA", DateCreated: now()})
+		if err != nil {
+			return err
+		}
+
+		err = tx.Server.AddUserToServer(user_id, rolled_back_id, models.RoleOwner)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Tab.Create(&repositories.TabDBO{Id: uuid.New(), Name: "General", ServerId: rolled_back_id, DateCreated: now()})
+		if err != nil {
+			return err
+		}
+
+		// Fails on the duplicate name, which has to undo everything above
+		_, err = tx.Server.Create(&repositories.ServerDBO{Id: uuid.New(), Name: "Gamiades", DateCreated: now()})
+		return err
+	})
+	expectErr(t, err, models.ErrServerAlreadyExists)
+
+	_, err = r.Server.GetByID(rolled_back_id)
+	expectErr(t, err, models.ErrServerNotFound)
+
+	tabs, err = r.Tab.GetByServerID(rolled_back_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, tabs, 0)
+
+	users, err := r.Server.GetUsers(rolled_back_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, users, 0)
+}
+
+func testMembership(t *testing.T, r *repositories.Repositories) {
+	owner_id := mustCreateUser(t, r, "nikos", false)
+	member_id := mustCreateUser(t, r, "giorgos", false)
+	stranger_id := mustCreateUser(t, r, "maria", false)
+	server_id := mustCreateServer(t, r, "Gamiades", false)
+	other_server_id := mustCreateServer(t, r, "HUA", false)
+
+	for user_id, role := range map[uuid.UUID]models.Role{owner_id: models.RoleOwner, member_id: models.RoleModerator} {
+		err := r.Server.AddUserToServer(user_id, server_id, role)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := r.Server.AddUserToServer(stranger_id, other_server_id, models.RoleOwner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	role, err := r.Server.GetRole(server_id, member_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role != models.RoleModerator {
+		t.Fatalf("expected role %s, got %s", models.RoleModerator, role)
+	}
+
+	_, err = r.Server.GetRole(server_id, stranger_id)
+	expectErr(t, err, models.ErrNotServerMember)
+
+	memberships, err := r.Server.GetMemberships(owner_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, memberships, 1)
+	if memberships[0].ServerId != server_id || memberships[0].Role != models.RoleOwner {
+		t.Fatalf("unexpected membership: %#v", memberships[0])
+	}
+
+	co_members, err := r.Server.GetCoMembers(member_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, co_members, 2)
+	for _, id := range co_members {
+		if id == stranger_id {
+			t.Fatalf("expected %s not to share a server with %s", stranger_id, member_id)
+		}
+	}
+
+	err = r.Server.RemoveUserFromServer(member_id, server_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.Server.GetRole(server_id, member_id)
+	expectErr(t, err, models.ErrNotServerMember)
+	members, err := r.Server.GetMembers(server_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, members, 1)
+
+	err = r.Server.RemoveUserFromServer(member_id, server_id)
+	expectErr(t, err, models.ErrNotServerMember)
+	err = r.Server.RemoveUserFromServer(stranger_id, server_id)
+	expectErr(t, err, models.ErrNotServerMember)
+}
+
+func testUpdateDelete(t *testing.T, r *repositories.Repositories) {
+	user_id := mustCreateUser(t, r, "nikos", false)
+	other_user_id := mustCreateUser(t, r, "giorgos", false)
+	server_id := mustCreateServer(t, r, "Gamiades", false)
+	mustCreateServer(t, r, "HUA", false)
+	tab_id := mustCreateTab(t, r, "General", server_id)
+	other_tab_id := mustCreateTab(t, r, "Memes", server_id)
+
+	err := r.User.Update(&repositories.UserDBO{Id: user_id, Username: "nikosgour", Password: "456"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := r.User.GetByID(user_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Username != "nikosgour" || u.Password != "456" || u.Disabled {
+		t.Fatalf("unexpected user after update: %#v", u)
+	}
+
+	err = r.User.Update(&repositories.UserDBO{Id: user_id, Username: "nikosgour", Password: "456", Disabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err = r.User.GetByID(user_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !u.Disabled {
+		t.Fatalf("expected the user to be disabled: %#v", u)
+	}
+	disabled_users, err := r.User.GetByUsername("nikosgour")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, disabled_users, 1)
+	if !disabled_users[0].Disabled {
+		t.Fatalf("expected the user to be disabled: %#v", disabled_users[0])
+	}
+
+	// Updates leave the session version as it is
+	for expected := int64(1); expected <= 2; expected++ {
+		version, err := r.User.RevokeSessions(user_id)
+		if err != nil || version != expected {
+			t.Fatalf("expected session version %d, got %d: %v", expected, version, err)
+		}
+	}
+	err = r.User.Update(&repositories.UserDBO{Id: user_id, Username: "nikosgour", Password: "456"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err = r.User.GetByID(user_id)
+	if err != nil || u.SessionVersion != 2 {
+		t.Fatalf("expected session version 2 after the update, got %#v: %v", u, err)
+	}
+	_, err = r.User.RevokeSessions(uuid.New())
+	expectErr(t, err, models.ErrUserNotFound)
+
+	err = r.User.Update(&repositories.UserDBO{Id: user_id, Username: "giorgos", Password: "456"})
+	expectErr(t, err, models.ErrUserAlreadyExists)
+
+	err = r.User.Update(&repositories.UserDBO{Id: uuid.New(), Username: "maria", Password: "456"})
+	expectErr(t, err, models.ErrUserNotFound)
+
+	err = r.Server.Update(&repositories.ServerDBO{Id: server_id, Name: "Gamiades2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := r.Server.GetByID(server_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.Name != "Gamiades2" {
+		t.Fatalf("unexpected server after update: %#v", server)
+	}
+
+	err = r.Server.Update(&repositories.ServerDBO{Id: server_id, Name: "HUA"})
+	expectErr(t, err, models.ErrServerAlreadyExists)
+
+	err = r.Server.Update(&repositories.ServerDBO{Id: uuid.New(), Name: "CTF"})
+	expectErr(t, err, models.ErrServerNotFound)
+
+	err = r.Tab.Update(&repositories.TabDBO{Id: tab_id, Name: "Lobby", SlowMode: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab, err := r.Tab.GetByID(tab_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tab.Name != "Lobby" || tab.ServerId != server_id || tab.SlowMode != 30 {
+		t.Fatalf("unexpected tab after update: %#v", tab)
+	}
+
+	err = r.Tab.Update(&repositories.TabDBO{Id: uuid.New(), Name: "Lobby"})
+	expectErr(t, err, models.ErrTabNotFound)
+
+	for _, id := range []uuid.UUID{user_id, other_user_id} {
+		err := r.Server.AddUserToServer(id, server_id, models.RoleMember)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tab_id := range []uuid.UUID{tab_id, other_tab_id} {
+			_, err := r.Message.Create(&repositories.MessageDBO{Text: "hello", SenderId: id, TabId: tab_id, DateSent: now()})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Deleting a tab deletes its messages
+	err = r.Tab.Delete(other_tab_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Tab.Delete(other_tab_id)
+	expectErr(t, err, models.ErrTabNotFound)
+	messages, err := r.Message.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, messages, 2)
+
+	// Deleting a user deletes their memberships and messages
+	err = r.User.Delete(other_user_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.User.Delete(other_user_id)
+	expectErr(t, err, models.ErrUserNotFound)
+	users, err := r.Server.GetUsers(server_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, users, 1)
+	messages, err = r.Message.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, messages, 1)
+
+	// Deleting a server deletes its memberships, tabs and messages
+	err = r.Server.Delete(server_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Server.Delete(server_id)
+	expectErr(t, err, models.ErrServerNotFound)
+	_, err = r.Tab.GetByID(tab_id)
+	expectErr(t, err, models.ErrTabNotFound)
+	memberships, err := r.Server.GetMemberships(user_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, memberships, 0)
+	messages, err = r.Message.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, messages, 0)
+}
+
+func testReadState(t *testing.T, r *repositories.Repositories) {
+	user_id := mustCreateUser(t, r, "nikos", false)
+	other_user_id := mustCreateUser(t, r, "maria", false)
+	server_id := mustCreateServer(t, r, "Gamiades", false)
+	tab_id := mustCreateTab(t, r, "General", server_id)
+	other_tab_id := mustCreateTab(t, r, "Memes", server_id)
+	err := r.Server.AddUserToServer(user_id, server_id, models.RoleMember)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message_ids := []int64{}
+	for _, text := range []string{"hello", "hey @Nikos", "@nikos?", "bye"} {
+		id, err := r.Message.Create(&repositories.MessageDBO{Text: text, SenderId: other_user_id, TabId: tab_id, DateSent: now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		message_ids = append(message_ids, id)
+	}
+	own_id, err := r.Message.Create(&repositories.MessageDBO{Text: "mine @nikos", SenderId: user_id, TabId: tab_id, DateSent: now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Mentions are only what was recorded, whatever the text says
+	for _, id := range []int64{message_ids[1], message_ids[2], message_ids[2], own_id} {
+		err = r.Message.AddMentions(id, []uuid.UUID{user_id})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = r.Message.AddMentions(message_ids[0], []uuid.UUID{uuid.New()})
+	expectErr(t, err, storage.ErrForeignKeyViolation)
+	err = r.Message.AddMentions(own_id+1, []uuid.UUID{user_id})
+	expectErr(t, err, storage.ErrForeignKeyViolation)
+
+	read_state := func(tab_id uuid.UUID) repositories.ReadStateDBO {
+		t.Helper()
+		read_states, err := r.ReadState.GetByServerID(user_id, server_id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectLen(t, read_states, 2)
+		for _, rs := range read_states {
+			if rs.TabId == tab_id {
+				return rs
+			}
+		}
+		t.Fatalf("expected a read state for tab %s, got: %#v", tab_id, read_states)
+		return repositories.ReadStateDBO{}
+	}
+
+	// Own messages are never unread
+	rs := read_state(tab_id)
+	if rs.LastReadMessageId != 0 || rs.Unread != 4 || rs.Mentions != 2 {
+		t.Fatalf("unexpected read state before any ack: %#v", rs)
+	}
+	rs = read_state(other_tab_id)
+	if rs.Unread != 0 || rs.Mentions != 0 {
+		t.Fatalf("unexpected read state of an empty tab: %#v", rs)
+	}
+
+	// Reading the read state to update it creates it, without changing it
+	last_read, err := r.ReadState.GetForUpdate(user_id, tab_id)
+	if err != nil || last_read != 0 {
+		t.Fatalf("expected nothing read, got %d: %v", last_read, err)
+	}
+	rs = read_state(tab_id)
+	if rs.LastReadMessageId != 0 || rs.Unread != 4 || rs.Mentions != 2 {
+		t.Fatalf("unexpected read state after GetForUpdate: %#v", rs)
+	}
+	readers, err := r.ReadState.GetReaders(tab_id, message_ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, readers, 0)
+
+	err = r.ReadState.Ack(user_id, tab_id, message_ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs = read_state(tab_id)
+	if rs.LastReadMessageId != message_ids[1] || rs.Unread != 2 || rs.Mentions != 1 {
+		t.Fatalf("unexpected read state after ack: %#v", rs)
+	}
+	last_read, err = r.ReadState.GetForUpdate(user_id, tab_id)
+	if err != nil || last_read != message_ids[1] {
+		t.Fatalf("expected %d to be read, got %d: %v", message_ids[1], last_read, err)
+	}
+	_, err = r.ReadState.GetForUpdate(uuid.New(), tab_id)
+	expectErr(t, err, storage.ErrForeignKeyViolation)
+	_, err = r.ReadState.GetForUpdate(user_id, uuid.New())
+	expectErr(t, err, storage.ErrForeignKeyViolation)
+
+	// Read states never move backwards
+	err = r.ReadState.Ack(user_id, tab_id, message_ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs = read_state(tab_id)
+	if rs.LastReadMessageId != message_ids[1] {
+		t.Fatalf("expected the read state to stay at %d, got: %#v", message_ids[1], rs)
+	}
+
+	err = r.ReadState.Ack(uuid.New(), tab_id, message_ids[0])
+	expectErr(t, err, storage.ErrForeignKeyViolation)
+
+	err = r.ReadState.Ack(user_id, uuid.New(), message_ids[0])
+	expectErr(t, err, storage.ErrForeignKeyViolation)
+
+	read_states, err := r.ReadState.GetByServerID(user_id, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, read_states, 0)
+
+	readers, err = r.ReadState.GetReaders(tab_id, message_ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, readers, 1)
+	if readers[0].Id != user_id || readers[0].Username != "nikos" {
+		t.Fatalf("unexpected reader: %#v", readers[0])
+	}
+
+	// Users who left the server are no longer readers
+	err = r.Server.RemoveUserFromServer(user_id, server_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readers, err = r.ReadState.GetReaders(tab_id, message_ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, readers, 0)
+	err = r.Server.AddUserToServer(user_id, server_id, models.RoleMember)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readers, err = r.ReadState.GetReaders(tab_id, message_ids[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, readers, 0)
+
+	// Users hiding their read receipts are never readers
+	err = r.User.Update(&repositories.UserDBO{Id: user_id, Username: "nikos", Password: "pass", HideReadReceipts: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := r.User.GetByID(user_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !u.HideReadReceipts {
+		t.Fatalf("expected the user to hide their read receipts: %#v", u)
+	}
+	readers, err = r.ReadState.GetReaders(tab_id, message_ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, readers, 0)
+}
+
+func testAttachment(t *testing.T, r *repositories.Repositories) {
+	user_id := mustCreateUser(t, r, "nikos", false)
+	server_id := mustCreateServer(t, r, "Gamiades", false)
+	tab_id := mustCreateTab(t, r, "General", server_id)
+	other_tab_id := mustCreateTab(t, r, "Memes", server_id)
+
+	message_id, err := r.Message.Create(&repositories.MessageDBO{Text: "look", SenderId: user_id, TabId: tab_id, DateSent: now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other_message_id, err := r.Message.Create(&repositories.MessageDBO{Text: "", SenderId: user_id, TabId: other_tab_id, DateSent: now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Created out of order, they come back by position
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	for _, position := range []int{1, 0} {
+		err := r.Attachment.Create(&repositories.AttachmentDBO{Id: ids[position], MessageId: message_id, Position: position, Filename: "cat.png", ContentType: "image/png", Size: 42, DateCreated: now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = r.Attachment.Create(&repositories.AttachmentDBO{Id: ids[2], MessageId: other_message_id, Filename: "notes.txt", ContentType: "text/plain; charset=utf-8", Size: 7, DateCreated: now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := r.Attachment.GetByID(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.MessageId != message_id || a.Filename != "cat.png" || a.ContentType != "image/png" || a.Size != 42 {
+		t.Fatalf("unexpected attachment: %#v", a)
+	}
+
+	_, err = r.Attachment.GetByID(uuid.New())
+	expectErr(t, err, models.ErrAttachmentNotFound)
+
+	attachments, err := r.Attachment.GetByMessageID(message_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, attachments, 2)
+	if attachments[0].Id != ids[0] || attachments[1].Id != ids[1] {
+		t.Fatalf("expected attachments in position order, got: %#v", attachments)
+	}
+
+	attachments, err = r.Attachment.GetByTabID(other_tab_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, attachments, 1)
+
+	attachments, err = r.Attachment.GetByServerID(server_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, attachments, 3)
+	attachments, err = r.Attachment.GetByServerID(uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, attachments, 0)
+
+	attachments, err = r.Attachment.GetBySenderID(user_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, attachments, 3)
+	if attachments[0].Id != ids[0] || attachments[1].Id != ids[1] || attachments[2].Id != ids[2] {
+		t.Fatalf("expected attachments in message and position order, got: %#v", attachments)
+	}
+	attachments, err = r.Attachment.GetBySenderID(uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, attachments, 0)
+
+	attachments, err = r.Attachment.GetByMessageIDs([]int64{other_message_id, message_id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, attachments, 3)
+	if attachments[0].Id != ids[0] || attachments[1].Id != ids[1] || attachments[2].Id != ids[2] {
+		t.Fatalf("expected attachments in message and position order, got: %#v", attachments)
+	}
+	attachments, err = r.Attachment.GetByMessageIDs([]int64{other_message_id, other_message_id + 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, attachments, 1)
+	attachments, err = r.Attachment.GetByMessageIDs(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, attachments, 0)
+
+	attachments, err = r.Attachment.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, attachments, 3)
+
+	err = r.Attachment.Create(&repositories.AttachmentDBO{Id: uuid.New(), MessageId: other_message_id + 100, Filename: "x", ContentType: "text/plain", DateCreated: now()})
+	expectErr(t, err, storage.ErrForeignKeyViolation)
+
+	// Only images are processed, until they have a preview
+	unprocessed, err := r.Attachment.GetUnprocessedImages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, unprocessed, 2)
+
+	width, height, processed := 640, 480, now()
+	err = r.Attachment.UpdatePreview(&repositories.AttachmentDBO{Id: ids[0], Width: &width, Height: &height, HasThumbnail: true, DateProcessed: &processed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err = r.Attachment.GetByID(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Width == nil || *a.Width != 640 || a.Height == nil || *a.Height != 480 || !a.HasThumbnail || a.DateProcessed == nil {
+		t.Fatalf("unexpected attachment after UpdatePreview: %#v", a)
+	}
+	if a.Filename != "cat.png" {
+		t.Fatalf("expected UpdatePreview to keep the filename, got: %#v", a)
+	}
+
+	unprocessed, err = r.Attachment.GetUnprocessedImages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, unprocessed, 1)
+	if unprocessed[0].Id != ids[1] {
+		t.Fatalf("unexpected unprocessed image: %#v", unprocessed[0])
+	}
+
+	err = r.Attachment.UpdatePreview(&repositories.AttachmentDBO{Id: uuid.New(), DateProcessed: &processed})
+	expectErr(t, err, models.ErrAttachmentNotFound)
+
+	// Deleting a tab deletes the attachments of its messages
+	err = r.Tab.Delete(tab_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.Attachment.GetByID(ids[0])
+	expectErr(t, err, models.ErrAttachmentNotFound)
+	attachments, err = r.Attachment.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, attachments, 1)
+}
+
+func testProfile(t *testing.T, r *repositories.Repositories) {
+	user_id := mustCreateUser(t, r, "nikos", false)
+	other_id := mustCreateUser(t, r, "maria", false)
+	server_id := mustCreateServer(t, r, "Gamiades", false)
+	tab_id := mustCreateTab(t, r, "General", server_id)
+	for _, id := range []uuid.UUID{user_id, other_id} {
+		err := r.Server.AddUserToServer(id, server_id, models.RoleMember)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	avatar_id := uuid.New()
+	err := r.User.UpdateProfile(&repositories.UserDBO{Id: user_id, DisplayName: "Nikos Gour", Bio: "hi", AvatarId: &avatar_id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := r.User.GetByID(user_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.DisplayName != "Nikos Gour" || u.Bio != "hi" || u.AvatarId == nil || *u.AvatarId != avatar_id {
+		t.Fatalf("unexpected user after UpdateProfile: %#v", u)
+	}
+	if u.Username != "nikos" || u.Password != "pass" {
+		t.Fatalf("expected UpdateProfile to keep the username and password, got: %#v", u)
+	}
+
+	err = r.User.UpdateProfile(&repositories.UserDBO{Id: uuid.New()})
+	expectErr(t, err, models.ErrUserNotFound)
+
+	err = r.Server.SetNickname(server_id, user_id, "nik")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Server.SetNickname(server_id, uuid.New(), "nobody")
+	expectErr(t, err, models.ErrNotServerMember)
+
+	members, err := r.Server.GetMembers(server_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, members, 2)
+	for _, m := range members {
+		if m.Role != models.RoleMember || (m.UserId == user_id) != (m.Nickname == "nik") || (m.UserId == user_id) != (m.Username == "nikos") {
+			t.Fatalf("unexpected member: %#v", m)
+		}
+	}
+
+	// Messages carry the profile of the sender and their nickname in the server of the tab
+	message_id, err := r.Message.Create(&repositories.MessageDBO{Text: "hello", SenderId: user_id, TabId: tab_id, DateSent: now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := r.Message.GetByID(message_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.User.DisplayName != "Nikos Gour" || m.User.Nickname != "nik" || m.User.AvatarId == nil || *m.User.AvatarId != avatar_id {
+		t.Fatalf("unexpected sender: %#v", m.User)
+	}
+	if m.User.Bio != "" || m.User.Password != "" {
+		t.Fatalf("expected the sender to only have the public profile, got: %#v", m.User)
+	}
+
+	_, err = r.Message.Create(&repositories.MessageDBO{Text: "hey", SenderId: other_id, TabId: tab_id, DateSent: now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := r.Message.GetByTabID(tab_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLen(t, messages, 2)
+	for _, m := range messages {
+		if m.SenderId == other_id && (m.User.Nickname != "" || m.User.AvatarId != nil) {
+			t.Fatalf("unexpected sender without a profile: %#v", m.User)
+		}
+	}
+
+	err = r.User.UpdateProfile(&repositories.UserDBO{Id: user_id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err = r.User.GetByID(user_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.DisplayName != "" || u.Bio != "" || u.AvatarId != nil {
+		t.Fatalf("expected the profile to be cleared, got: %#v", u)
+	}
+}
+
+func testRateLimit(t *testing.T, r *repositories.Repositories) {
+	start := time.UnixMilli(now().UnixMilli())
+	interval, tolerance := time.Second, 2*time.Second
+
+	take := func(bucket string, at time.Time) (bool, time.Time) {
+		t.Helper()
+		ok, tat, err := r.RateLimit.Take(bucket, at, interval, tolerance)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok, tat
+	}
+
+	// A burst of tolerance/interval + 1 goes through, the next one has to wait
+	for i := range 3 {
+		ok, tat := take("user:nikos", start)
+		if !ok || !tat.Equal(start.Add(time.Duration(i+1)*interval)) {
+			t.Fatalf("expected request %d to go through, got ok=%v tat=%s", i, ok, tat)
+		}
+	}
+	ok, tat := take("user:nikos", start)
+	if ok || !tat.Equal(start.Add(3*interval)) {
+		t.Fatalf("expected the bucket to be full, got ok=%v tat=%s", ok, tat)
+	}
+
+	// Buckets are independent
+	ok, _ = take("user:maria", start)
+	if !ok {
+		t.Fatal("expected another bucket to have room")
+	}
+
+	// One interval later there is room for one more
+	ok, _ = take("user:nikos", start.Add(interval))
+	if !ok {
+		t.Fatal("expected room after an interval")
+	}
+	ok, _ = take("user:nikos", start.Add(interval))
+	if ok {
+		t.Fatal("expected the bucket to be full again")
+	}
+
+	// Only buckets whose tat has passed are deleted
+	deleted, err := r.RateLimit.DeleteExpired(start.Add(2 * interval))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 {
+		t.Fatalf("expected 1 expired bucket, got %d", deleted)
+	}
+	ok, _ = take("user:nikos", start.Add(interval))
+	if ok {
+		t.Fatal("expected the bucket to survive DeleteExpired")
+	}
+}
@@ -17,21 +17,44 @@ type ServerRepository interface {
 	GetByName(name string) ([]ServerDBO, error)
 	GetByTestName(name string) ([]ServerDBO, error)
 	Create(Server *ServerDBO) (uuid.UUID, error)
-	AddUserToServer(user_id uuid.UUID, server_id uuid.UUID) error
+	Update(server *ServerDBO) error
+	Delete(id uuid.UUID) error
+	AddUserToServer(user_id uuid.UUID, server_id uuid.UUID, role models.Role) error
+	RemoveUserFromServer(user_id uuid.UUID, server_id uuid.UUID) error
 	GetUsers(server_id uuid.UUID) ([]uuid.UUID, error)
+	GetRole(server_id uuid.UUID, user_id uuid.UUID) (models.Role, error)
+	GetMembers(server_id uuid.UUID) ([]MemberDBO, error)
+	SetNickname(server_id uuid.UUID, user_id uuid.UUID, nickname string) error
+	GetMemberships(user_id uuid.UUID) ([]MembershipDBO, error)
+	GetCoMembers(user_id uuid.UUID) ([]uuid.UUID, error)
+	DeleteTest() (int64, error)
 }
 
 type serverRepository struct {
-	db *storage.PostgreSQLStorage
+	db storage.SQLQuerier
 }
 
-func NewServerRepository(db *storage.PostgreSQLStorage) ServerRepository {
+func NewServerRepository(db storage.SQLQuerier) ServerRepository {
 	sr := &serverRepository{db: db}
 	return sr
 }
 
 type ServerDBO = models.Server
 
+// A server a user is a member of, and their role in it
+type MembershipDBO struct {
+	ServerId uuid.UUID   `db:"server_id"`
+	Role     models.Role `db:"role"`
+}
+
+// A member of a server, with their username and their role and nickname in it
+type MemberDBO struct {
+	UserId   uuid.UUID   `db:"user_id"`
+	Username string      `db:"username"`
+	Role     models.Role `db:"role"`
+	Nickname string      `db:"nickname"`
+}
+
 // Retrieves all servers from the database.
 //
 // Might return any sql error.
@@ -108,7 +131,7 @@ func (sr *serverRepository) GetByTestName(name string) ([]ServerDBO, error) {
 // Inserts a server into a database.
 //
 // Returns the UUID of the created server.
-// Might return any sql error
+// Might return ErrServerAlreadyExists or any other sql error
 func (sr *serverRepository) Create(server *ServerDBO) (uuid.UUID, error) {
 	q := `INSERT INTO servers (id, name, date_created, is_test)
 		  VALUES (:id, :name, :date_created, :is_test)
@@ -123,30 +146,55 @@ func (sr *serverRepository) Create(server *ServerDBO) (uuid.UUID, error) {
 
 	err = stmt.Get(&insert_id, server)
 	if err != nil {
+		if sr.db.IsUniqueViolation(err) {
+			return uuid.Nil, fmt.Errorf("%w:%s", models.ErrServerAlreadyExists, server.Name)
+		}
 		return uuid.Nil, fmt.Errorf("On q=`%s`: %w", q, err)
 	}
 
 	return insert_id, nil
 }
 
-// Adds a the user of the given UUID to the list of subscribed users of the server
+// Adds a the user of the given UUID to the list of subscribed users of the server, with the given role
 //
-// Might return ErrServerNotFound or any other sql error
-func (sr *serverRepository) AddUserToServer(user_id uuid.UUID, server_id uuid.UUID) error {
-	q := `INSERT INTO server_members (server_id, user_id)
-		  VALUES (:server,:user)`
+// Might return ErrUserAlreadyInServer, ErrForeignKeyViolation or any other sql error
+func (sr *serverRepository) AddUserToServer(user_id uuid.UUID, server_id uuid.UUID, role models.Role) error {
+	q := `INSERT INTO server_members (server_id, user_id, "role")
+		  VALUES (:server,:user,:role)`
 
 	_, err := sr.db.NamedExec(q, struct {
-		Server uuid.UUID `db:"server"`
-		User   uuid.UUID `db:"user"`
-	}{Server: server_id, User: user_id})
+		Server uuid.UUID   `db:"server"`
+		User   uuid.UUID   `db:"user"`
+		Role   models.Role `db:"role"`
+	}{Server: server_id, User: user_id, Role: role})
 	if err != nil {
+		if sr.db.IsUniqueViolation(err) {
+			return fmt.Errorf("%w:%s", models.ErrUserAlreadyInServer, user_id)
+		}
+		if sr.db.IsForeignKeyViolation(err) {
+			return fmt.Errorf("%w:server_id=%s,user_id=%s", storage.ErrForeignKeyViolation, server_id, user_id)
+		}
 		return fmt.Errorf("On q=`%s`: %w", q, err)
 	}
 
 	return nil
 }
 
+// Removes the user of the given UUID from the members of the server
+//
+// Might return ErrNotServerMember or any other sql error
+func (sr *serverRepository) RemoveUserFromServer(user_id uuid.UUID, server_id uuid.UUID) error {
+	q := `DELETE FROM server_members
+	      WHERE server_id = $1 AND user_id = $2;`
+
+	res, err := sr.db.Exec(q, server_id, user_id)
+	if err != nil {
+		return fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return expectAffected(res, fmt.Errorf("%w:server_id=%s,user_id=%s", models.ErrNotServerMember, server_id, user_id))
+}
+
 // Get all the user UUIDs from a server's user list
 //
 // Might return ErrServerHasNoUsers or any other sql error
@@ -165,3 +213,142 @@ func (sr *serverRepository) GetUsers(server_id uuid.UUID) ([]uuid.UUID, error) {
 
 	return user_ids, nil
 }
+
+// Renames the server with the same UUID.
+//
+// Might return ErrServerNotFound, ErrServerAlreadyExists or any other sql error
+func (sr *serverRepository) Update(server *ServerDBO) error {
+	q := `UPDATE servers
+	      SET name = :name
+	      WHERE id = :id;`
+
+	res, err := sr.db.NamedExec(q, server)
+	if err != nil {
+		if sr.db.IsUniqueViolation(err) {
+			return fmt.Errorf("%w:%s", models.ErrServerAlreadyExists, server.Name)
+		}
+		return fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return expectAffected(res, fmt.Errorf("%w:%s", models.ErrServerNotFound, server.Id))
+}
+
+// Deletes a server given the UUID, along with its memberships, tabs and messages.
+//
+// Might return ErrServerNotFound or any other sql error
+func (sr *serverRepository) Delete(id uuid.UUID) error {
+	q := `DELETE FROM servers
+	      WHERE id = $1;`
+
+	res, err := sr.db.Exec(q, id)
+	if err != nil {
+		return fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return expectAffected(res, fmt.Errorf("%w:%s", models.ErrServerNotFound, id))
+}
+
+// Get the role of a user in a server
+//
+// Might return ErrNotServerMember or any other sql error
+func (sr *serverRepository) GetRole(server_id uuid.UUID, user_id uuid.UUID) (models.Role, error) {
+	role := models.Role("")
+	q := `SELECT "role"
+		  FROM server_members
+		  WHERE server_id = $1 AND user_id = $2;`
+
+	err := sr.db.Get(&role, q, server_id, user_id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("%w:server_id=%s,user_id=%s", models.ErrNotServerMember, server_id, user_id)
+		}
+		return "", fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return role, nil
+}
+
+// Get every member of a server, with their username
+//
+// Might return any sql error
+func (sr *serverRepository) GetMembers(server_id uuid.UUID) ([]MemberDBO, error) {
+	members := []MemberDBO{}
+	q := `SELECT sm.user_id, u.username, sm."role", sm.nickname
+		  FROM server_members sm
+		  JOIN users u ON u.id = sm.user_id
+		  WHERE sm.server_id = $1;`
+
+	err := sr.db.Select(&members, q, server_id)
+	if err != nil {
+		return nil, fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return members, nil
+}
+
+// Sets the nickname of a user in a server, an empty nickname clears it
+//
+// Might return ErrNotServerMember or any other sql error
+func (sr *serverRepository) SetNickname(server_id uuid.UUID, user_id uuid.UUID, nickname string) error {
+	q := `UPDATE server_members
+		  SET nickname = $1
+		  WHERE server_id = $2 AND user_id = $3;`
+
+	res, err := sr.db.Exec(q, nickname, server_id, user_id)
+	if err != nil {
+		return fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return expectAffected(res, fmt.Errorf("%w:server_id=%s,user_id=%s", models.ErrNotServerMember, server_id, user_id))
+}
+
+// Get every server the user is a member of
+//
+// Might return any sql error
+func (sr *serverRepository) GetMemberships(user_id uuid.UUID) ([]MembershipDBO, error) {
+	memberships := []MembershipDBO{}
+	q := `SELECT server_id, "role"
+		  FROM server_members
+		  WHERE user_id = $1;`
+
+	err := sr.db.Select(&memberships, q, user_id)
+	if err != nil {
+		return nil, fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return memberships, nil
+}
+
+// Get the UUIDs of every user that shares at least one server with the user, the user included
+//
+// Might return any sql error
+func (sr *serverRepository) GetCoMembers(user_id uuid.UUID) ([]uuid.UUID, error) {
+	user_ids := []uuid.UUID{}
+	q := `SELECT DISTINCT other.user_id
+		  FROM server_members own
+		  JOIN server_members other ON other.server_id = own.server_id
+		  WHERE own.user_id = $1;`
+
+	err := sr.db.Select(&user_ids, q, user_id)
+	if err != nil {
+		return nil, fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return user_ids, nil
+}
+
+// Deletes every server flagged as test data, along with their memberships, tabs and messages.
+//
+// Returns the number of deleted servers.
+// Might return any sql error
+func (sr *serverRepository) DeleteTest() (int64, error) {
+	q := `DELETE FROM servers
+	      WHERE is_test = true;`
+
+	res, err := sr.db.Exec(q)
+	if err != nil {
+		return 0, fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,288 @@
+package repositories
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/storage"
+	"github.com/google/uuid"
+)
+
+type memoryServerRepository struct {
+	db *storage.MemoryStorage
+}
+
+func NewMemoryServerRepository(db *storage.MemoryStorage) ServerRepository {
+	sr := &memoryServerRepository{db: db}
+	return sr
+}
+
+// Retrieves all servers from the store.
+func (sr *memoryServerRepository) GetAll() ([]ServerDBO, error) {
+	sr.db.Mu.RLock()
+	defer sr.db.Mu.RUnlock()
+
+	return sr.filter(func(s models.Server) bool { return true }), nil
+}
+
+// Retrieves a server given the UUID.
+//
+// Might return ErrServerNotFound
+func (sr *memoryServerRepository) GetByID(id uuid.UUID) (*ServerDBO, error) {
+	sr.db.Mu.RLock()
+	defer sr.db.Mu.RUnlock()
+
+	s, ok := sr.db.Servers[id]
+	if !ok {
+		return nil, fmt.Errorf("%w:%s", models.ErrServerNotFound, id)
+	}
+
+	server_dbo := selectServer(s)
+	return &server_dbo, nil
+}
+
+func (sr *memoryServerRepository) GetByName(name string) ([]ServerDBO, error) {
+	sr.db.Mu.RLock()
+	defer sr.db.Mu.RUnlock()
+
+	return sr.filter(func(s models.Server) bool { return s.Name == name }), nil
+}
+
+func (sr *memoryServerRepository) GetByTestName(name string) ([]ServerDBO, error) {
+	sr.db.Mu.RLock()
+	defer sr.db.Mu.RUnlock()
+
+	return sr.filter(func(s models.Server) bool { return s.Name == name && s.IsTest }), nil
+}
+
+// Inserts a server into the store.
+//
+// Returns the UUID of the created server.
+// Might return ErrServerAlreadyExists
+func (sr *memoryServerRepository) Create(server *ServerDBO) (uuid.UUID, error) {
+	sr.db.Mu.Lock()
+	defer sr.db.Mu.Unlock()
+
+	for _, s := range sr.db.Servers {
+		if s.Id == server.Id || (s.Name == server.Name && s.IsTest == server.IsTest) {
+			return uuid.Nil, fmt.Errorf("%w:%s", models.ErrServerAlreadyExists, server.Name)
+		}
+	}
+
+	sr.db.Servers[server.Id] = models.Server{
+		Id:          server.Id,
+		Name:        server.Name,
+		DateCreated: server.DateCreated,
+		IsTest:      server.IsTest,
+	}
+	return server.Id, nil
+}
+
+// Renames the server with the same UUID.
+//
+// Might return ErrServerNotFound or ErrServerAlreadyExists
+func (sr *memoryServerRepository) Update(server *ServerDBO) error {
+	sr.db.Mu.Lock()
+	defer sr.db.Mu.Unlock()
+
+	stored, ok := sr.db.Servers[server.Id]
+	if !ok {
+		return fmt.Errorf("%w:%s", models.ErrServerNotFound, server.Id)
+	}
+	for _, s := range sr.db.Servers {
+		if s.Id != server.Id && s.Name == server.Name && s.IsTest == stored.IsTest {
+			return fmt.Errorf("%w:%s", models.ErrServerAlreadyExists, server.Name)
+		}
+	}
+
+	stored.Name = server.Name
+	sr.db.Servers[server.Id] = stored
+	return nil
+}
+
+// Deletes a server given the UUID, along with its memberships, tabs and messages.
+//
+// Might return ErrServerNotFound
+func (sr *memoryServerRepository) Delete(id uuid.UUID) error {
+	sr.db.Mu.Lock()
+	defer sr.db.Mu.Unlock()
+
+	if _, ok := sr.db.Servers[id]; !ok {
+		return fmt.Errorf("%w:%s", models.ErrServerNotFound, id)
+	}
+
+	sr.db.DeleteServer(id)
+	return nil
+}
+
+// Adds a the user of the given UUID to the list of subscribed users of the server, with the given role
+//
+// Might return ErrUserAlreadyInServer or ErrForeignKeyViolation
+func (sr *memoryServerRepository) AddUserToServer(user_id uuid.UUID, server_id uuid.UUID, role models.Role) error {
+	sr.db.Mu.Lock()
+	defer sr.db.Mu.Unlock()
+
+	_, server_ok := sr.db.Servers[server_id]
+	_, user_ok := sr.db.Users[user_id]
+	if !server_ok || !user_ok {
+		return fmt.Errorf("%w:server_id=%s,user_id=%s", storage.ErrForeignKeyViolation, server_id, user_id)
+	}
+
+	if slices.ContainsFunc(sr.db.ServerMembers[server_id], func(m storage.MemoryMember) bool { return m.UserId == user_id }) {
+		return fmt.Errorf("%w:%s", models.ErrUserAlreadyInServer, user_id)
+	}
+
+	sr.db.ServerMembers[server_id] = append(sr.db.ServerMembers[server_id], storage.MemoryMember{UserId: user_id, Role: role})
+	return nil
+}
+
+// Removes the user of the given UUID from the members of the server
+//
+// Might return ErrNotServerMember
+func (sr *memoryServerRepository) RemoveUserFromServer(user_id uuid.UUID, server_id uuid.UUID) error {
+	sr.db.Mu.Lock()
+	defer sr.db.Mu.Unlock()
+
+	members := sr.db.ServerMembers[server_id]
+	i := slices.IndexFunc(members, func(m storage.MemoryMember) bool { return m.UserId == user_id })
+	if i < 0 {
+		return fmt.Errorf("%w:server_id=%s,user_id=%s", models.ErrNotServerMember, server_id, user_id)
+	}
+
+	sr.db.ServerMembers[server_id] = slices.Delete(members, i, i+1)
+	return nil
+}
+
+// Get all the user UUIDs from a server's user list
+func (sr *memoryServerRepository) GetUsers(server_id uuid.UUID) ([]uuid.UUID, error) {
+	sr.db.Mu.RLock()
+	defer sr.db.Mu.RUnlock()
+
+	user_ids := []uuid.UUID{}
+	for _, m := range sr.db.ServerMembers[server_id] {
+		user_ids = append(user_ids, m.UserId)
+	}
+	return user_ids, nil
+}
+
+// Get the role of a user in a server
+//
+// Might return ErrNotServerMember
+func (sr *memoryServerRepository) GetRole(server_id uuid.UUID, user_id uuid.UUID) (models.Role, error) {
+	sr.db.Mu.RLock()
+	defer sr.db.Mu.RUnlock()
+
+	for _, m := range sr.db.ServerMembers[server_id] {
+		if m.UserId == user_id {
+			return m.Role, nil
+		}
+	}
+	return "", fmt.Errorf("%w:server_id=%s,user_id=%s", models.ErrNotServerMember, server_id, user_id)
+}
+
+// Get every member of a server, with their username
+func (sr *memoryServerRepository) GetMembers(server_id uuid.UUID) ([]MemberDBO, error) {
+	sr.db.Mu.RLock()
+	defer sr.db.Mu.RUnlock()
+
+	members := []MemberDBO{}
+	for _, m := range sr.db.ServerMembers[server_id] {
+		members = append(members, MemberDBO{UserId: m.UserId, Username: sr.db.Users[m.UserId].Username, Role: m.Role, Nickname: m.Nickname})
+	}
+	return members, nil
+}
+
+// Sets the nickname of a user in a server, an empty nickname clears it
+//
+// Might return ErrNotServerMember
+func (sr *memoryServerRepository) SetNickname(server_id uuid.UUID, user_id uuid.UUID, nickname string) error {
+	sr.db.Mu.Lock()
+	defer sr.db.Mu.Unlock()
+
+	members := sr.db.ServerMembers[server_id]
+	for i := range members {
+		if members[i].UserId == user_id {
+			members[i].Nickname = nickname
+			return nil
+		}
+	}
+	return fmt.Errorf("%w:server_id=%s,user_id=%s", models.ErrNotServerMember, server_id, user_id)
+}
+
+// Get every server the user is a member of
+func (sr *memoryServerRepository) GetMemberships(user_id uuid.UUID) ([]MembershipDBO, error) {
+	sr.db.Mu.RLock()
+	defer sr.db.Mu.RUnlock()
+
+	memberships := []MembershipDBO{}
+	for server_id, members := range sr.db.ServerMembers {
+		for _, m := range members {
+			if m.UserId == user_id {
+				memberships = append(memberships, MembershipDBO{ServerId: server_id, Role: m.Role})
+			}
+		}
+	}
+	return memberships, nil
+}
+
+// Get the UUIDs of every user that shares at least one server with the user, the user included
+func (sr *memoryServerRepository) GetCoMembers(user_id uuid.UUID) ([]uuid.UUID, error) {
+	sr.db.Mu.RLock()
+	defer sr.db.Mu.RUnlock()
+
+	seen := map[uuid.UUID]bool{}
+	user_ids := []uuid.UUID{}
+	for _, members := range sr.db.ServerMembers {
+		if !slices.ContainsFunc(members, func(m storage.MemoryMember) bool { return m.UserId == user_id }) {
+			continue
+		}
+		for _, m := range members {
+			if !seen[m.UserId] {
+				seen[m.UserId] = true
+				user_ids = append(user_ids, m.UserId)
+			}
+		}
+	}
+	return user_ids, nil
+}
+
+// Deletes every server flagged as test data, along with their memberships, tabs and messages.
+//
+// Returns the number of deleted servers.
+func (sr *memoryServerRepository) DeleteTest() (int64, error) {
+	sr.db.Mu.Lock()
+	defer sr.db.Mu.Unlock()
+
+	deleted := int64(0)
+	for id, s := range sr.db.Servers {
+		if s.IsTest {
+			sr.db.DeleteServer(id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Must be called with the read lock held
+func (sr *memoryServerRepository) filter(keep func(s models.Server) bool) []ServerDBO {
+	server_dbos := []ServerDBO{}
+	for _, s := range sr.db.Servers {
+		if keep(s) {
+			server_dbos = append(server_dbos, selectServer(s))
+		}
+	}
+	slices.SortFunc(server_dbos, func(a, b ServerDBO) int {
+		return compareCreated(a.DateCreated, a.Id, b.DateCreated, b.Id)
+	})
+	return server_dbos
+}
+
+// Projects a stored server onto the columns the sql repository selects
+func selectServer(s models.Server) ServerDBO {
+	return ServerDBO{
+		Id:          s.Id,
+		Name:        s.Name,
+		DateCreated: s.DateCreated,
+	}
+}
@@ -16,13 +16,15 @@ type TabRepository interface {
 	GetByServerID(server_id uuid.UUID) ([]TabDBO, error)
 	GetByName(name string) ([]TabDBO, error)
 	Create(Tab *TabDBO) (uuid.UUID, error)
+	Update(tab *TabDBO) error
+	Delete(id uuid.UUID) error
 }
 
 type tabRepository struct {
-	db *storage.PostgreSQLStorage
+	db storage.SQLQuerier
 }
 
-func NewTabRepository(db *storage.PostgreSQLStorage) TabRepository {
+func NewTabRepository(db storage.SQLQuerier) TabRepository {
 	tr := &tabRepository{db: db}
 	return tr
 }
@@ -53,7 +55,7 @@ func (tr *tabRepository) GetAll() ([]TabDBO, error) {
 // Might return ErrTabNotFound or any other sql error
 func (tr *tabRepository) GetByID(id uuid.UUID) (*TabDBO, error) {
 	tab_dbo := TabDBO{}
-	q := `SELECT id, name, server_id, date_created
+	q := `SELECT id, name, server_id, date_created, slow_mode
 		  FROM tabs
 	      WHERE id = $1`
 
@@ -73,7 +75,7 @@ func (tr *tabRepository) GetByID(id uuid.UUID) (*TabDBO, error) {
 // Might return ErrTabNotFound or any other sql error
 func (tr *tabRepository) GetByServerID(server_id uuid.UUID) ([]TabDBO, error) {
 	tab_dbos := []TabDBO{}
-	q := `SELECT id, name, server_id, date_created
+	q := `SELECT id, name, server_id, date_created, slow_mode
 		  FROM tabs
 	      WHERE server_id = $1`
 
@@ -87,7 +89,7 @@ func (tr *tabRepository) GetByServerID(server_id uuid.UUID) ([]TabDBO, error) {
 
 func (tr *tabRepository) GetByName(name string) ([]TabDBO, error) {
 	tab_dbos := []TabDBO{}
-	q := `SELECT id, name, server_id, date_created
+	q := `SELECT id, name, server_id, date_created, slow_mode
 		  FROM tabs
 	      WHERE name = $1`
 
@@ -106,7 +108,7 @@ func (tr *tabRepository) GetByName(name string) ([]TabDBO, error) {
 // Inserts a tab into a database.
 //
 // Returns the UUID of the created Tab.
-// Might return any sql error
+// Might return ErrServerNotFound or any other sql error
 func (tr *tabRepository) Create(Tab *TabDBO) (uuid.UUID, error) {
 	q := `INSERT INTO Tabs (id, name, server_id, date_created)
 		  VALUES (:id, :name, :server_id, :date_created)
@@ -121,8 +123,45 @@ func (tr *tabRepository) Create(Tab *TabDBO) (uuid.UUID, error) {
 
 	err = stmt.Get(&insert_id, Tab)
 	if err != nil {
+		if tr.db.IsForeignKeyViolation(err) {
+			return uuid.Nil, fmt.Errorf("%w:%s", models.ErrServerNotFound, Tab.ServerId)
+		}
+		if tr.db.IsUniqueViolation(err) {
+			return uuid.Nil, fmt.Errorf("%w:tab_id=%s", storage.ErrUniqueViolation, Tab.Id)
+		}
 		return uuid.Nil, fmt.Errorf("On q=`%s`: %w", q, err)
 	}
 
 	return insert_id, nil
 }
+
+// Updates the name and slow mode of the tab with the same UUID.
+//
+// Might return ErrTabNotFound or any other sql error
+func (tr *tabRepository) Update(tab *TabDBO) error {
+	q := `UPDATE tabs
+	      SET name = :name, slow_mode = :slow_mode
+	      WHERE id = :id;`
+
+	res, err := tr.db.NamedExec(q, tab)
+	if err != nil {
+		return fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return expectAffected(res, fmt.Errorf("%w:%s", models.ErrTabNotFound, tab.Id))
+}
+
+// Deletes a tab given the UUID, along with its messages.
+//
+// Might return ErrTabNotFound or any other sql error
+func (tr *tabRepository) Delete(id uuid.UUID) error {
+	q := `DELETE FROM tabs
+	      WHERE id = $1;`
+
+	res, err := tr.db.Exec(q, id)
+	if err != nil {
+		return fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return expectAffected(res, fmt.Errorf("%w:%s", models.ErrTabNotFound, id))
+}
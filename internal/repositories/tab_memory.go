@@ -0,0 +1,145 @@
+package repositories
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/storage"
+	"github.com/google/uuid"
+)
+
+type memoryTabRepository struct {
+	db *storage.MemoryStorage
+}
+
+func NewMemoryTabRepository(db *storage.MemoryStorage) TabRepository {
+	tr := &memoryTabRepository{db: db}
+	return tr
+}
+
+// Retrieves all Tab records from the store, joined with their server.
+func (tr *memoryTabRepository) GetAll() ([]TabDBO, error) {
+	tr.db.Mu.RLock()
+	defer tr.db.Mu.RUnlock()
+
+	tab_dbos := tr.filter(func(t models.Tab) bool { return true })
+	for i := range tab_dbos {
+		s := tr.db.Servers[tab_dbos[i].ServerId]
+		tab_dbos[i].Server = &models.Server{Id: s.Id, Name: s.Name}
+	}
+	return tab_dbos, nil
+}
+
+// Retrieves a tab given the UUID.
+//
+// Might return ErrTabNotFound
+func (tr *memoryTabRepository) GetByID(id uuid.UUID) (*TabDBO, error) {
+	tr.db.Mu.RLock()
+	defer tr.db.Mu.RUnlock()
+
+	t, ok := tr.db.Tabs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w:%s", models.ErrTabNotFound, id)
+	}
+
+	tab_dbo := selectTab(t)
+	return &tab_dbo, nil
+}
+
+// Retrieves the tabs of the given server UUID.
+func (tr *memoryTabRepository) GetByServerID(server_id uuid.UUID) ([]TabDBO, error) {
+	tr.db.Mu.RLock()
+	defer tr.db.Mu.RUnlock()
+
+	return tr.filter(func(t models.Tab) bool { return t.ServerId == server_id }), nil
+}
+
+func (tr *memoryTabRepository) GetByName(name string) ([]TabDBO, error) {
+	tr.db.Mu.RLock()
+	defer tr.db.Mu.RUnlock()
+
+	return tr.filter(func(t models.Tab) bool { return t.Name == name }), nil
+}
+
+// Inserts a tab into the store.
+//
+// Returns the UUID of the created Tab.
+// Might return ErrServerNotFound
+func (tr *memoryTabRepository) Create(tab *TabDBO) (uuid.UUID, error) {
+	tr.db.Mu.Lock()
+	defer tr.db.Mu.Unlock()
+
+	if _, ok := tr.db.Servers[tab.ServerId]; !ok {
+		return uuid.Nil, fmt.Errorf("%w:%s", models.ErrServerNotFound, tab.ServerId)
+	}
+	if _, ok := tr.db.Tabs[tab.Id]; ok {
+		return uuid.Nil, fmt.Errorf("%w:tab_id=%s", storage.ErrUniqueViolation, tab.Id)
+	}
+
+	tr.db.Tabs[tab.Id] = models.Tab{
+		Id:          tab.Id,
+		Name:        tab.Name,
+		ServerId:    tab.ServerId,
+		DateCreated: tab.DateCreated,
+	}
+	return tab.Id, nil
+}
+
+// Updates the name and slow mode of the tab with the same UUID.
+//
+// Might return ErrTabNotFound
+func (tr *memoryTabRepository) Update(tab *TabDBO) error {
+	tr.db.Mu.Lock()
+	defer tr.db.Mu.Unlock()
+
+	stored, ok := tr.db.Tabs[tab.Id]
+	if !ok {
+		return fmt.Errorf("%w:%s", models.ErrTabNotFound, tab.Id)
+	}
+
+	stored.Name = tab.Name
+	stored.SlowMode = tab.SlowMode
+	tr.db.Tabs[tab.Id] = stored
+	return nil
+}
+
+// Deletes a tab given the UUID, along with its messages.
+//
+// Might return ErrTabNotFound
+func (tr *memoryTabRepository) Delete(id uuid.UUID) error {
+	tr.db.Mu.Lock()
+	defer tr.db.Mu.Unlock()
+
+	if _, ok := tr.db.Tabs[id]; !ok {
+		return fmt.Errorf("%w:%s", models.ErrTabNotFound, id)
+	}
+
+	tr.db.DeleteTab(id)
+	return nil
+}
+
+// Must be called with the read lock held
+func (tr *memoryTabRepository) filter(keep func(t models.Tab) bool) []TabDBO {
+	tab_dbos := []TabDBO{}
+	for _, t := range tr.db.Tabs {
+		if keep(t) {
+			tab_dbos = append(tab_dbos, selectTab(t))
+		}
+	}
+	slices.SortFunc(tab_dbos, func(a, b TabDBO) int {
+		return compareCreated(a.DateCreated, a.Id, b.DateCreated, b.Id)
+	})
+	return tab_dbos
+}
+
+// Projects a stored tab onto the columns the sql repository selects
+func selectTab(t models.Tab) TabDBO {
+	return TabDBO{
+		Id:          t.Id,
+		Name:        t.Name,
+		ServerId:    t.ServerId,
+		DateCreated: t.DateCreated,
+		SlowMode:    t.SlowMode,
+	}
+}
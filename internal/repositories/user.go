@@ -16,13 +16,18 @@ type UserRepository interface {
 	GetByUsername(username string) ([]UserDBO, error)
 	GetByTestUsername(username string) ([]UserDBO, error)
 	Create(user *UserDBO) (uuid.UUID, error)
+	Update(user *UserDBO) error
+	UpdateProfile(user *UserDBO) error
+	RevokeSessions(id uuid.UUID) (int64, error)
+	Delete(id uuid.UUID) error
+	DeleteTest() (int64, error)
 }
 
 type userRepository struct {
-	db *storage.PostgreSQLStorage
+	db storage.SQLQuerier
 }
 
-func NewUserRepository(db *storage.PostgreSQLStorage) UserRepository {
+func NewUserRepository(db storage.SQLQuerier) UserRepository {
 	ur := &userRepository{db: db}
 	return ur
 }
@@ -34,7 +39,7 @@ type UserDBO = models.User
 // Might return any sql error.
 func (ur *userRepository) GetAll() ([]UserDBO, error) {
 	udbos := []UserDBO{}
-	q := `SELECT id, username, password, date_created
+	q := `SELECT id, username, password, date_created, hide_read_receipts, display_name, bio, avatar_id, disabled, session_version
 		  FROM users`
 
 	err := ur.db.Select(&udbos, q)
@@ -49,7 +54,7 @@ func (ur *userRepository) GetAll() ([]UserDBO, error) {
 // Might return ErrGroupNotFound or any other sql error
 func (ur *userRepository) GetByID(id uuid.UUID) (*UserDBO, error) {
 	udbo := UserDBO{}
-	q := `SELECT id, username, password, date_created
+	q := `SELECT id, username, password, date_created, hide_read_receipts, display_name, bio, avatar_id, disabled, session_version
 		  FROM users
 	      WHERE id = $1`
 
@@ -65,7 +70,7 @@ func (ur *userRepository) GetByID(id uuid.UUID) (*UserDBO, error) {
 }
 func (ur *userRepository) GetByUsername(username string) ([]UserDBO, error) {
 	udbos := []UserDBO{}
-	q := `SELECT id, username, password, date_created
+	q := `SELECT id, username, password, date_created, hide_read_receipts, display_name, bio, avatar_id, disabled, session_version
 		  FROM users
 	      WHERE username = $1;`
 
@@ -82,7 +87,7 @@ func (ur *userRepository) GetByUsername(username string) ([]UserDBO, error) {
 
 func (ur *userRepository) GetByTestUsername(username string) ([]UserDBO, error) {
 	udbos := []UserDBO{}
-	q := `SELECT id, username, password, date_created
+	q := `SELECT id, username, password, date_created, hide_read_receipts, display_name, bio, avatar_id, disabled, session_version
 		  FROM users
 	      WHERE username = $1 and is_test = true;`
 
@@ -100,10 +105,10 @@ func (ur *userRepository) GetByTestUsername(username string) ([]UserDBO, error)
 // Inserts a userinto a database.
 //
 // Returns the UUID of the created user.
-// Might return any sql error
+// Might return ErrUserAlreadyExists or any other sql error
 func (ur *userRepository) Create(user *UserDBO) (uuid.UUID, error) {
-	q := `INSERT INTO users (id, username, password, date_created, is_test)
-		  VALUES (:id, :username, :password, :date_created, :is_test)
+	q := `INSERT INTO users (id, username, password, date_created, is_test, hide_read_receipts)
+		  VALUES (:id, :username, :password, :date_created, :is_test, :hide_read_receipts)
 		  RETURNING id;`
 
 	insert_id := uuid.Nil
@@ -115,8 +120,97 @@ func (ur *userRepository) Create(user *UserDBO) (uuid.UUID, error) {
 
 	err = stmt.Get(&insert_id, user)
 	if err != nil {
+		if ur.db.IsUniqueViolation(err) {
+			return uuid.Nil, fmt.Errorf("%w:%s", models.ErrUserAlreadyExists, user.Username)
+		}
 		return uuid.Nil, fmt.Errorf("On q=`%s`: %w", q, err)
 	}
 
 	return insert_id, nil
 }
+
+// Updates the username, password, settings and disabled flag of the user with the same UUID.
+//
+// Might return ErrUserNotFound, ErrUserAlreadyExists or any other sql error
+func (ur *userRepository) Update(user *UserDBO) error {
+	q := `UPDATE users
+	      SET username = :username, password = :password, hide_read_receipts = :hide_read_receipts, disabled = :disabled
+	      WHERE id = :id;`
+
+	res, err := ur.db.NamedExec(q, user)
+	if err != nil {
+		if ur.db.IsUniqueViolation(err) {
+			return fmt.Errorf("%w:%s", models.ErrUserAlreadyExists, user.Username)
+		}
+		return fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return expectAffected(res, fmt.Errorf("%w:%s", models.ErrUserNotFound, user.Id))
+}
+
+// Moves the session version of the user on, so the sessions issued before are rejected.
+// Update leaves the version as it is, so a concurrent update can't move it back.
+//
+// Returns the new version.
+// Might return ErrUserNotFound or any other sql error
+func (ur *userRepository) RevokeSessions(id uuid.UUID) (int64, error) {
+	var version int64
+	q := `UPDATE users SET session_version = session_version + 1 WHERE id = $1 RETURNING session_version;`
+
+	err := ur.db.Get(&version, q, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("%w:%s", models.ErrUserNotFound, id)
+		}
+		return 0, fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return version, nil
+}
+
+// Updates the display name, bio and avatar of the user with the same UUID.
+//
+// Might return ErrUserNotFound or any other sql error
+func (ur *userRepository) UpdateProfile(user *UserDBO) error {
+	q := `UPDATE users
+	      SET display_name = :display_name, bio = :bio, avatar_id = :avatar_id
+	      WHERE id = :id;`
+
+	res, err := ur.db.NamedExec(q, user)
+	if err != nil {
+		return fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return expectAffected(res, fmt.Errorf("%w:%s", models.ErrUserNotFound, user.Id))
+}
+
+// Deletes a user given the UUID, along with their memberships and messages.
+//
+// Might return ErrUserNotFound or any other sql error
+func (ur *userRepository) Delete(id uuid.UUID) error {
+	q := `DELETE FROM users
+	      WHERE id = $1;`
+
+	res, err := ur.db.Exec(q, id)
+	if err != nil {
+		return fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return expectAffected(res, fmt.Errorf("%w:%s", models.ErrUserNotFound, id))
+}
+
+// Deletes every user flagged as test data, along with their memberships and messages.
+//
+// Returns the number of deleted users.
+// Might return any sql error
+func (ur *userRepository) DeleteTest() (int64, error) {
+	q := `DELETE FROM users
+	      WHERE is_test = true;`
+
+	res, err := ur.db.Exec(q)
+	if err != nil {
+		return 0, fmt.Errorf("on q=`%s`: %w", q, err)
+	}
+
+	return res.RowsAffected()
+}
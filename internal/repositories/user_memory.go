@@ -0,0 +1,220 @@
+package repositories
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/storage"
+	"github.com/google/uuid"
+)
+
+type memoryUserRepository struct {
+	db *storage.MemoryStorage
+}
+
+func NewMemoryUserRepository(db *storage.MemoryStorage) UserRepository {
+	ur := &memoryUserRepository{db: db}
+	return ur
+}
+
+// Retrieves all user records from the store.
+func (ur *memoryUserRepository) GetAll() ([]UserDBO, error) {
+	ur.db.Mu.RLock()
+	defer ur.db.Mu.RUnlock()
+
+	udbos := []UserDBO{}
+	for _, u := range ur.db.Users {
+		udbos = append(udbos, selectUser(u))
+	}
+	slices.SortFunc(udbos, func(a, b UserDBO) int {
+		return compareCreated(a.DateCreated, a.Id, b.DateCreated, b.Id)
+	})
+	return udbos, nil
+}
+
+// Retrieves a user given the UUID.
+//
+// Might return ErrUserNotFound
+func (ur *memoryUserRepository) GetByID(id uuid.UUID) (*UserDBO, error) {
+	ur.db.Mu.RLock()
+	defer ur.db.Mu.RUnlock()
+
+	u, ok := ur.db.Users[id]
+	if !ok {
+		return nil, fmt.Errorf("%w:%s", models.ErrUserNotFound, id)
+	}
+
+	udbo := selectUser(u)
+	return &udbo, nil
+}
+
+func (ur *memoryUserRepository) GetByUsername(username string) ([]UserDBO, error) {
+	ur.db.Mu.RLock()
+	defer ur.db.Mu.RUnlock()
+
+	udbos := []UserDBO{}
+	for _, u := range ur.db.Users {
+		if u.Username == username {
+			udbos = append(udbos, selectUser(u))
+		}
+	}
+	slices.SortFunc(udbos, func(a, b UserDBO) int {
+		return compareCreated(a.DateCreated, a.Id, b.DateCreated, b.Id)
+	})
+	return udbos, nil
+}
+
+func (ur *memoryUserRepository) GetByTestUsername(username string) ([]UserDBO, error) {
+	ur.db.Mu.RLock()
+	defer ur.db.Mu.RUnlock()
+
+	udbos := []UserDBO{}
+	for _, u := range ur.db.Users {
+		if u.Username == username && u.IsTest {
+			udbos = append(udbos, selectUser(u))
+		}
+	}
+	slices.SortFunc(udbos, func(a, b UserDBO) int {
+		return compareCreated(a.DateCreated, a.Id, b.DateCreated, b.Id)
+	})
+	return udbos, nil
+}
+
+// Inserts a user into the store.
+//
+// Returns the UUID of the created user.
+// Might return ErrUserAlreadyExists
+func (ur *memoryUserRepository) Create(user *UserDBO) (uuid.UUID, error) {
+	ur.db.Mu.Lock()
+	defer ur.db.Mu.Unlock()
+
+	for _, u := range ur.db.Users {
+		if u.Id == user.Id || (u.Username == user.Username && u.IsTest == user.IsTest) {
+			return uuid.Nil, fmt.Errorf("%w:%s", models.ErrUserAlreadyExists, user.Username)
+		}
+	}
+
+	ur.db.Users[user.Id] = models.User{
+		Id:          user.Id,
+		Username:    user.Username,
+		Password:    user.Password,
+		DateCreated: user.DateCreated,
+		IsTest:      user.IsTest,
+
+		HideReadReceipts: user.HideReadReceipts,
+	}
+	return user.Id, nil
+}
+
+// Updates the username, password, settings and disabled flag of the user with the same UUID.
+//
+// Might return ErrUserNotFound or ErrUserAlreadyExists
+func (ur *memoryUserRepository) Update(user *UserDBO) error {
+	ur.db.Mu.Lock()
+	defer ur.db.Mu.Unlock()
+
+	stored, ok := ur.db.Users[user.Id]
+	if !ok {
+		return fmt.Errorf("%w:%s", models.ErrUserNotFound, user.Id)
+	}
+	for _, u := range ur.db.Users {
+		if u.Id != user.Id && u.Username == user.Username && u.IsTest == stored.IsTest {
+			return fmt.Errorf("%w:%s", models.ErrUserAlreadyExists, user.Username)
+		}
+	}
+
+	stored.Username = user.Username
+	stored.Password = user.Password
+	stored.HideReadReceipts = user.HideReadReceipts
+	stored.Disabled = user.Disabled
+	ur.db.Users[user.Id] = stored
+	return nil
+}
+
+// Moves the session version of the user on, so the sessions issued before are rejected.
+//
+// Returns the new version.
+// Might return ErrUserNotFound
+func (ur *memoryUserRepository) RevokeSessions(id uuid.UUID) (int64, error) {
+	ur.db.Mu.Lock()
+	defer ur.db.Mu.Unlock()
+
+	stored, ok := ur.db.Users[id]
+	if !ok {
+		return 0, fmt.Errorf("%w:%s", models.ErrUserNotFound, id)
+	}
+
+	stored.SessionVersion++
+	ur.db.Users[id] = stored
+	return stored.SessionVersion, nil
+}
+
+// Updates the display name, bio and avatar of the user with the same UUID.
+//
+// Might return ErrUserNotFound
+func (ur *memoryUserRepository) UpdateProfile(user *UserDBO) error {
+	ur.db.Mu.Lock()
+	defer ur.db.Mu.Unlock()
+
+	stored, ok := ur.db.Users[user.Id]
+	if !ok {
+		return fmt.Errorf("%w:%s", models.ErrUserNotFound, user.Id)
+	}
+
+	stored.DisplayName = user.DisplayName
+	stored.Bio = user.Bio
+	stored.AvatarId = user.AvatarId
+	ur.db.Users[user.Id] = stored
+	return nil
+}
+
+// Deletes a user given the UUID, along with their memberships and messages.
+//
+// Might return ErrUserNotFound
+func (ur *memoryUserRepository) Delete(id uuid.UUID) error {
+	ur.db.Mu.Lock()
+	defer ur.db.Mu.Unlock()
+
+	if _, ok := ur.db.Users[id]; !ok {
+		return fmt.Errorf("%w:%s", models.ErrUserNotFound, id)
+	}
+
+	ur.db.DeleteUser(id)
+	return nil
+}
+
+// Deletes every user flagged as test data, along with their memberships and messages.
+//
+// Returns the number of deleted users.
+func (ur *memoryUserRepository) DeleteTest() (int64, error) {
+	ur.db.Mu.Lock()
+	defer ur.db.Mu.Unlock()
+
+	deleted := int64(0)
+	for id, u := range ur.db.Users {
+		if u.IsTest {
+			ur.db.DeleteUser(id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Projects a stored user onto the columns the sql repository selects
+func selectUser(u models.User) UserDBO {
+	return UserDBO{
+		Id:          u.Id,
+		Username:    u.Username,
+		Password:    u.Password,
+		DateCreated: u.DateCreated,
+
+		HideReadReceipts: u.HideReadReceipts,
+		Disabled:         u.Disabled,
+		SessionVersion:   u.SessionVersion,
+
+		DisplayName: u.DisplayName,
+		Bio:         u.Bio,
+		AvatarId:    u.AvatarId,
+	}
+}
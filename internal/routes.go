@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"github.com/NikosGour/chatter/internal/controllers"
+	"github.com/NikosGour/chatter/internal/middleware"
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/openapi"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Every REST endpoint, mounted under APIBasePath and documented in the openapi document
+func (s *APIServer) Routes() []openapi.Route {
+	message_id := []openapi.Param{{Name: "id", Schema: &openapi.Schema{Type: "integer", Format: "int64"}}}
+	message_page := []openapi.Param{
+		{Name: "before", Description: "Only messages with a lower id, the newest ones when left out", Schema: &openapi.Schema{Type: "integer", Format: "int64"}},
+		{Name: "limit", Description: "Most messages to return, up to 100, which is also the default", Schema: &openapi.Schema{Type: "integer"}},
+	}
+	auth := middleware.WithActiveUser(s.user_service)
+
+	return []openapi.Route{
+		{Method: fiber.MethodPost, Path: "/user", Tag: "user", Summary: "Create a user", Handler: s.user_controller.Create, Body: models.Credentials{}, Response: uuid.UUID{}},
+		{Method: fiber.MethodGet, Path: "/user", Tag: "user", Summary: "List all users", Handler: s.user_controller.GetAll, Response: []models.User{}},
+		{Method: fiber.MethodGet, Path: "/user/:id", Tag: "user", Summary: "Get a user", Handler: s.user_controller.GetById, Response: models.User{}},
+		{Method: fiber.MethodPatch, Path: "/user/:id", Tag: "user", Summary: "Update your user", Handler: s.user_controller.Update, Auth: auth, Body: models.UserPatch{}, Response: models.User{}},
+		{Method: fiber.MethodDelete, Path: "/user/:id", Tag: "user", Summary: "Delete your user", Handler: s.user_controller.Delete, Auth: auth, Status: fiber.StatusNoContent},
+		{Method: fiber.MethodPut, Path: "/user/:id/presence", Tag: "user", Summary: "Set your status, shown while you are connected", Handler: s.user_controller.SetPresence, Auth: auth, Body: models.PresenceUpdate{}, Status: fiber.StatusNoContent},
+		{Method: fiber.MethodPost, Path: "/user/login", Tag: "user", Summary: "Log in, sets the session cookie", Handler: s.user_controller.Login, Body: models.Credentials{}, Response: models.User{}},
+		{Method: fiber.MethodGet, Path: "/user/me/profile", Tag: "user", Summary: "Get your profile", Handler: s.profile_controller.Get, Auth: auth, Response: models.Profile{}},
+		{Method: fiber.MethodPatch, Path: "/user/me/profile", Tag: "user", Summary: "Update your display name and bio", Handler: s.profile_controller.Update, Auth: auth, Body: models.ProfilePatch{}, Response: models.Profile{}},
+		{Method: fiber.MethodPut, Path: "/user/me/avatar", Tag: "user", Summary: "Upload your avatar, a PNG, JPEG or GIF of at most 2MiB", Handler: s.profile_controller.SetAvatar, Auth: auth, Body: models.AvatarUpload{}, BodyType: fiber.MIMEMultipartForm, Response: models.Profile{}},
+		{Method: fiber.MethodDelete, Path: "/user/me/avatar", Tag: "user", Summary: "Remove your avatar", Handler: s.profile_controller.DeleteAvatar, Auth: auth, Response: models.Profile{}},
+		{Method: fiber.MethodPost, Path: "/user/logout", Tag: "user", Summary: "Log out of every session, clears the session cookie", Handler: s.user_controller.Logout, Status: fiber.StatusNoContent},
+
+		{Method: fiber.MethodPost, Path: "/server", Tag: "server", Summary: "Create a server you own", Handler: s.server_controller.Create, Auth: auth, Body: models.Server{}, Response: uuid.UUID{}},
+		{Method: fiber.MethodGet, Path: "/server", Tag: "server", Summary: "List all servers", Handler: s.server_controller.GetAll, Response: []models.Server{}},
+		{Method: fiber.MethodGet, Path: "/server/:id", Tag: "server", Summary: "Get a server", Handler: s.server_controller.GetById, Response: models.Server{}},
+		{Method: fiber.MethodGet, Path: "/server/:id/users", Tag: "server", Summary: "List the members of a server, with their presence", Handler: s.server_controller.GetUsersById, Response: []models.User{}},
+		{Method: fiber.MethodGet, Path: "/server/:id/tabs", Tag: "server", Summary: "List the tabs of a server, with your read state when logged in", Handler: s.server_controller.GetTabsById, Response: []models.Tab{}},
+		{Method: fiber.MethodPost, Path: "/server/:id", Tag: "server", Summary: "Add a member to a server, moderators only", Handler: s.server_controller.AddUserToServer, Auth: auth, Body: controllers.AddUserToServerBody{}},
+		{Method: fiber.MethodPatch, Path: "/server/:id", Tag: "server", Summary: "Rename a server, moderators only", Handler: s.server_controller.Update, Auth: auth, Body: models.ServerPatch{}, Response: models.Server{}},
+		{Method: fiber.MethodPut, Path: "/server/:id/nickname", Tag: "server", Summary: "Set your nickname in a server", Handler: s.server_controller.SetNickname, Auth: auth, Body: models.NicknameUpdate{}, Response: models.Member{}},
+		{Method: fiber.MethodDelete, Path: "/server/:id", Tag: "server", Summary: "Delete a server, owners only", Handler: s.server_controller.Delete, Auth: auth, Status: fiber.StatusNoContent},
+
+		{Method: fiber.MethodPost, Path: "/message", Tag: "message", Summary: "Send a message to a tab of a server you are a member of", Handler: s.message_controller.Create, Auth: auth, Body: models.Message{}, Response: int64(0)},
+		{Method: fiber.MethodGet, Path: "/message", Tag: "message", Summary: "List the messages of the servers you are a member of", Handler: s.message_controller.GetAll, Auth: auth, Response: []models.Message{}},
+		{Method: fiber.MethodGet, Path: "/message/:id", Tag: "message", Summary: "Get a message of a server you are a member of", Handler: s.message_controller.GetById, Auth: auth, Params: message_id, Response: models.Message{}},
+		{Method: fiber.MethodGet, Path: "/message/:id/receipts", Tag: "message", Summary: "List who has seen a message", Handler: s.message_controller.GetReceipts, Auth: auth, Params: message_id, Response: models.Receipts{}},
+		{Method: fiber.MethodPost, Path: "/message/attachments", Tag: "message", Summary: "Send a message with attachments", Handler: s.attachment_controller.Upload, Auth: auth, Body: models.AttachmentUpload{}, BodyType: fiber.MIMEMultipartForm, Response: models.Message{}},
+		{Method: fiber.MethodGet, Path: "/message/tab/:tab_id", Tag: "message", Summary: "List the messages of a tab of a server you are a member of, oldest first", Handler: s.message_controller.GetByTabId, Auth: auth, Query: message_page, Response: []models.Message{}},
+
+		{Method: fiber.MethodPost, Path: "/tab", Tag: "tab", Summary: "Create a tab, moderators only", Handler: s.tab_controller.Create, Auth: auth, Body: models.Tab{}, Response: uuid.UUID{}},
+		{Method: fiber.MethodGet, Path: "/tab", Tag: "tab", Summary: "List all tabs", Handler: s.tab_controller.GetAll, Response: []models.Tab{}},
+		{Method: fiber.MethodGet, Path: "/tab/:id", Tag: "tab", Summary: "Get a tab", Handler: s.tab_controller.GetById, Response: models.Tab{}},
+		{Method: fiber.MethodPatch, Path: "/tab/:id", Tag: "tab", Summary: "Rename a tab or set its slow mode, moderators only", Handler: s.tab_controller.Update, Auth: auth, Body: models.TabPatch{}, Response: models.Tab{}},
+		{Method: fiber.MethodPost, Path: "/tab/:id/ack", Tag: "tab", Summary: "Mark a tab as read up to a message", Handler: s.tab_controller.Ack, Auth: auth, Body: models.Ack{}, Response: models.ReadState{}},
+		{Method: fiber.MethodDelete, Path: "/tab/:id", Tag: "tab", Summary: "Delete a tab, moderators only", Handler: s.tab_controller.Delete, Auth: auth, Status: fiber.StatusNoContent},
+
+		{Method: fiber.MethodGet, Path: AttachmentPath + "/:id", Tag: "attachment", Summary: "Download an attachment, members of its server only", Handler: s.attachment_controller.Download, Auth: auth, ResponseType: fiber.MIMEOctetStream},
+		{Method: fiber.MethodGet, Path: AttachmentPath + "/:id/thumbnail", Tag: "attachment", Summary: "Download the thumbnail of an image attachment", Handler: s.attachment_controller.Thumbnail, Auth: auth, ResponseType: "image/*"},
+
+		{Method: fiber.MethodGet, Path: AvatarPath + "/:id", Tag: "user", Summary: "Download an avatar", Handler: s.profile_controller.Avatar, ResponseType: "image/png"},
+	}
+}
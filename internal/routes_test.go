@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var routeParam = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+
+// Every route of Routes is in the served openapi document and everything the document lists is served,
+// so the two can't drift apart without failing CI.
+func TestRoutesMatchOpenAPIDocument(t *testing.T) {
+	s, app := newTestAPI(t)
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, APIBasePath+OpenAPIPath, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected the openapi document, got %d", resp.StatusCode)
+	}
+	doc := struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}{}
+	err = json.NewDecoder(resp.Body).Decode(&doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	documented := map[string]bool{}
+	for path, item := range doc.Paths {
+		for method := range item {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	routes := map[string]bool{}
+	for _, r := range s.Routes() {
+		route := r.Method + " " + routeParam.ReplaceAllString(r.Path, "{$1}")
+		if routes[route] {
+			t.Errorf("`%s` is routed twice", route)
+		}
+		routes[route] = true
+		if !documented[route] {
+			t.Errorf("`%s` is routed but not documented", route)
+		}
+	}
+	for route := range documented {
+		if !routes[route] {
+			t.Errorf("`%s` is documented but not routed", route)
+		}
+	}
+
+	for _, r := range app.GetRoutes(true) {
+		path, ok := strings.CutPrefix(r.Path, APIBasePath)
+		if !ok || r.Method == fiber.MethodHead || path == OpenAPIPath {
+			continue
+		}
+		route := r.Method + " " + routeParam.ReplaceAllString(path, "{$1}")
+		if !documented[route] {
+			t.Errorf("`%s` is served but not documented", route)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package sanitize
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Prepares text written by a user to be stored and shown to others.
+//
+// The text is normalized to NFC so the same words compare equal however they were typed,
+// CRLF line endings become LF and control characters other than newlines and tabs are dropped.
+// Bidi embeddings, overrides and isolates are dropped too, they make text display in a
+// different order than it reads. The marks used in right to left text are kept.
+// Surrounding whitespace is trimmed.
+func Text(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = norm.NFC.String(s)
+	s = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return r
+		}
+		if unicode.IsControl(r) || isBidiControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+	return strings.TrimSpace(s)
+}
+
+// The explicit bidi formatting characters, U+202A to U+202E and U+2066 to U+2069
+func isBidiControl(r rune) bool {
+	return (r >= '\u202A' && r <= '\u202E') || (r >= '\u2066' && r <= '\u2069')
+}
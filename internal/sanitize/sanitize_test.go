@@ -0,0 +1,33 @@
+package sanitize
+
+import "testing"
+
+func TestText(t *testing.T) {
+	cases := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{"plain", "kalhspera", "kalhspera"},
+		{"decomposed accent", "cafe\u0301", "caf\u00e9"},
+		{"composed accent", "caf\u00e9", "caf\u00e9"},
+		{"greek tonos", "\u03b1\u0301\u03bd\u03c4\u03b5", "\u03ac\u03bd\u03c4\u03b5"},
+		{"crlf", "one\r\ntwo\r\n\r\nthree", "one\ntwo\n\nthree"},
+		{"lone cr", "one\rtwo", "onetwo"},
+		{"newlines and tabs", "one\n\ttwo", "one\n\ttwo"},
+		{"control characters", "a\x00b\x07c\x1bd\x7fe\u0085f", "abcdef"},
+		{"embeddings and overrides", "\u202aa\u202bb\u202cc\u202dd\u202ee", "abcde"},
+		{"isolates", "\u2066a\u2067b\u2068c\u2069", "abc"},
+		{"override spoofing a file name", "invoice\u202egpj.exe", "invoicegpj.exe"},
+		{"direction marks", "\u200fשלום\u200e abc", "\u200fשלום\u200e abc"},
+		{"surrounding whitespace", " \t\n kalhspera \r\n ", "kalhspera"},
+		{"whitespace left by dropped characters", "\u202e \x00kalhspera\x00 \u2069", "kalhspera"},
+		{"only control characters", "\x00\u202e\r\n", ""},
+	}
+	for _, tc := range cases {
+		text := Text(tc.text)
+		if text != tc.expected {
+			t.Errorf("%s: expected %+q, got %+q", tc.name, tc.expected, text)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/blob"
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/chatter/internal/media"
+	"github.com/NikosGour/chatter/internal/metrics"
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/repositories"
+	"github.com/NikosGour/logging/log"
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/google/uuid"
+)
+
+const (
+	// Bytes read from the start of an upload to detect its content type
+	sniffSize = 3072
+	// Longest filename kept, longer ones keep their extension
+	maxFilename = 255
+)
+
+type AttachmentService struct {
+	attachment_repo repositories.AttachmentRepository
+	server_repo     repositories.ServerRepository
+	uow             repositories.UnitOfWork
+	blobs           blob.Store
+
+	tab_service        *TabService
+	message_service    *MessageService
+	thumbnail_service  *ThumbnailService
+	rate_limit_service *RateLimitService
+}
+
+func NewAttachmentService(attachment_repo repositories.AttachmentRepository, server_repo repositories.ServerRepository, uow repositories.UnitOfWork, blobs blob.Store, tab_service *TabService, message_service *MessageService, thumbnail_service *ThumbnailService, rate_limit_service *RateLimitService) *AttachmentService {
+	s := &AttachmentService{attachment_repo: attachment_repo, server_repo: server_repo, uow: uow, blobs: blobs, tab_service: tab_service, message_service: message_service, thumbnail_service: thumbnail_service, rate_limit_service: rate_limit_service}
+	return s
+}
+
+// Sends a message with the uploaded files attached, members of the tab's server only.
+//
+// The content type of every file is sniffed from its contents, whatever the client claimed.
+// Images lose their EXIF location before they are stored and are queued for their previews.
+// Returns the id of the created message.
+// Might return ErrTabNotFound, ErrNotServerMember, ErrNoAttachments, ErrTooManyAttachments,
+// ErrAttachmentTooLarge, ErrMessageTooLong, ErrRateLimited, ErrSlowMode or any other sql or blob error
+func (s *AttachmentService) Upload(sender_id uuid.UUID, upload *models.AttachmentUpload) (int64, error) {
+	if len(upload.Files) == 0 {
+		return 0, models.ErrNoAttachments
+	}
+	err := common.Validate.Struct(upload)
+	if err != nil {
+		return 0, err
+	}
+	if len(upload.Files) > models.MaxAttachments {
+		return 0, fmt.Errorf("%w:got=%d", models.ErrTooManyAttachments, len(upload.Files))
+	}
+	for _, f := range upload.Files {
+		if f.Size > models.MaxAttachmentSize {
+			return 0, fmt.Errorf("%w:filename=%s,size=%d", models.ErrAttachmentTooLarge, f.Filename, f.Size)
+		}
+	}
+	text, err := s.message_service.CleanText(upload.Text, true)
+	if err != nil {
+		return 0, err
+	}
+
+	tab, err := s.tab_service.GetByID(upload.TabId)
+	if err != nil {
+		return 0, err
+	}
+	err = authorize(s.server_repo, tab.ServerId, sender_id, models.RoleMember)
+	if err != nil {
+		return 0, err
+	}
+	err = s.rate_limit_service.TakeMessage(sender_id, tab.Id)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	attachments := []models.Attachment{}
+	// Blobs aren't part of the transaction, the ones already stored are removed if anything fails
+	defer func() {
+		if err != nil {
+			deleteAttachmentBlobs(s.blobs, attachments)
+		}
+	}()
+	for i, f := range upload.Files {
+		var a *models.Attachment
+		a, err = s.store(f)
+		if err != nil {
+			return 0, err
+		}
+		a.Position = i
+		a.DateCreated = now
+		attachments = append(attachments, *a)
+	}
+
+	mentions, err := s.message_service.Mentioned(text, tab.Id)
+	if err != nil {
+		return 0, err
+	}
+
+	var message_id int64
+	err = s.uow.Transaction(func(tx *repositories.Repositories) error {
+		message := &models.Message{Text: text, Sender: &models.User{Id: sender_id}, Tab: tab, DateSent: now}
+		message_id, err = tx.Message.Create(messageToDBO(message))
+		if err != nil {
+			return err
+		}
+		err = tx.Message.AddMentions(message_id, mentions)
+		if err != nil {
+			return err
+		}
+
+		for i := range attachments {
+			attachments[i].MessageId = message_id
+			err = tx.Attachment.Create(&attachments[i])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		metrics.WriteFailures.WithLabelValues(metrics.TargetDatabase).Inc()
+		return 0, err
+	}
+	metrics.MessagesPersisted.Inc()
+
+	if slices.ContainsFunc(attachments, func(a models.Attachment) bool { return media.IsImage(a.ContentType) }) {
+		s.thumbnail_service.Enqueue(message_id)
+	}
+	return message_id, nil
+}
+
+// Opens an attachment for download, members of its message's server only.
+//
+// The caller has to close the returned reader.
+// Might return ErrAttachmentNotFound, ErrNotServerMember or any other sql or blob error
+func (s *AttachmentService) Open(user_id uuid.UUID, id uuid.UUID) (*models.Attachment, io.ReadCloser, error) {
+	attachment, err := s.attachment_repo.GetByID(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	message, err := s.message_service.GetByID(attachment.MessageId)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = authorize(s.server_repo, message.Tab.ServerId, user_id, models.RoleMember)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r, err := s.blobs.Get(attachmentKey(id))
+	if err != nil {
+		return nil, nil, err
+	}
+	return attachment, r, nil
+}
+
+// Opens the thumbnail of an image attachment, members of its message's server only.
+//
+// The caller has to close the returned reader.
+// Returns the content type of the thumbnail.
+// Might return ErrAttachmentNotFound, ErrNoThumbnail, ErrNotServerMember or any other sql or blob error
+func (s *AttachmentService) OpenThumbnail(user_id uuid.UUID, id uuid.UUID) (string, io.ReadCloser, error) {
+	attachment, err := s.attachment_repo.GetByID(id)
+	if err != nil {
+		return "", nil, err
+	}
+	if !attachment.HasThumbnail {
+		return "", nil, fmt.Errorf("%w:%s", models.ErrNoThumbnail, id)
+	}
+
+	message, err := s.message_service.GetByID(attachment.MessageId)
+	if err != nil {
+		return "", nil, err
+	}
+	err = authorize(s.server_repo, message.Tab.ServerId, user_id, models.RoleMember)
+	if err != nil {
+		return "", nil, err
+	}
+
+	r, err := s.blobs.Get(thumbnailKey(id))
+	if err != nil {
+		return "", nil, err
+	}
+	return media.ThumbnailType(attachment.ContentType), r, nil
+}
+
+// Sniffs the content type of an uploaded file and stores it as a blob
+func (s *AttachmentService) store(f *multipart.FileHeader) (*models.Attachment, error) {
+	file, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("on opening upload `%s`: %w", f.Filename, err)
+	}
+	defer file.Close()
+
+	head := make([]byte, sniffSize)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("on reading upload `%s`: %w", f.Filename, err)
+	}
+	head = head[:n]
+	content_type := mimetype.Detect(head).String()
+
+	a := &models.Attachment{
+		Id:          uuid.New(),
+		Filename:    cleanFilename(f.Filename),
+		ContentType: content_type,
+		Size:        f.Size,
+	}
+
+	body := io.MultiReader(bytes.NewReader(head), file)
+	// EXIF is only read in full from images, everything else is streamed to the store
+	if media.IsImage(content_type) {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, fmt.Errorf("on reading upload `%s`: %w", f.Filename, err)
+		}
+		media.StripLocation(data)
+		body = bytes.NewReader(data)
+	}
+
+	err = s.blobs.Put(attachmentKey(a.Id), body, f.Size, content_type)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Removes the blobs of the attachments along with their thumbnails.
+// Blobs aren't part of any transaction, so this is called once the attachments are gone from the database.
+func deleteAttachmentBlobs(blobs blob.Store, attachments []models.Attachment) {
+	for _, a := range attachments {
+		err := blobs.Delete(attachmentKey(a.Id))
+		if err != nil {
+			log.Error("on deleting the blob of attachment `%s`: %s", a.Id, err)
+		}
+		err = blobs.Delete(thumbnailKey(a.Id))
+		if err != nil {
+			log.Error("on deleting the thumbnail of attachment `%s`: %s", a.Id, err)
+		}
+	}
+}
+
+func attachmentKey(id uuid.UUID) string {
+	return "attachments/" + id.String()
+}
+
+func thumbnailKey(id uuid.UUID) string {
+	return "thumbnails/" + id.String()
+}
+
+// Keeps only the base name of a client supplied filename, without control characters
+func cleanFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == "" {
+		return "file"
+	}
+
+	if len(name) > maxFilename {
+		ext := filepath.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		name = strings.ToValidUTF8(name[:maxFilename-len(ext)], "") + ext
+	}
+	return name
+}
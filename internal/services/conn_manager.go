@@ -1,155 +1,732 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
 	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/chatter/internal/metrics"
 	"github.com/NikosGour/chatter/internal/models"
 	"github.com/NikosGour/logging/log"
 	"github.com/gofiber/contrib/websocket"
 	"github.com/google/uuid"
 )
 
+// A websocket connection of a user.
+//
+// Frames are queued and written by a goroutine of its own, so the broadcast loop and request handlers
+// can push to it concurrently without waiting on a slow client.
+type Client struct {
+	UserId uuid.UUID
+
+	conn *websocket.Conn
+	send chan outgoing
+	// Guards closing dropping and done, the connection is only used from elsewhere than the handler
+	// and the writer while done is open
+	state_mu sync.Mutex
+	// Closed to have the writer drop the connection
+	dropping chan struct{}
+	// Closed once the connection is removed, stopping its writer
+	done chan struct{}
+	// Closed once the writer returned
+	stopped chan struct{}
+
+	viewing_mu sync.RWMutex
+	viewing    uuid.UUID
+
+	// Only touched by the goroutine reading the connection
+	frames_tat time.Time
+}
+
+// The tab the client has open, uuid.Nil when none
+func (cl *Client) Viewing() uuid.UUID {
+	cl.viewing_mu.RLock()
+	defer cl.viewing_mu.RUnlock()
+
+	return cl.viewing
+}
+
+func (cl *Client) setViewing(tab_id uuid.UUID) {
+	cl.viewing_mu.Lock()
+	defer cl.viewing_mu.Unlock()
+
+	cl.viewing = tab_id
+}
+
+// A frame waiting to be written
+type outgoing struct {
+	data []byte
+	// Close frames are the last ones written, the connection is then closed when close_conn is set
+	close      bool
+	close_conn bool
+}
+
+func newClient(user_id uuid.UUID, conn *websocket.Conn) *Client {
+	client := &Client{
+		UserId:   user_id,
+		conn:     conn,
+		send:     make(chan outgoing, clientSendQueueSize),
+		dropping: make(chan struct{}),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go client.writeQueued()
+	return client
+}
+
+// Queues a frame to be written.
+//
+// Might return ErrClientTooSlow
+func (cl *Client) Write(data []byte) error {
+	return cl.queue(outgoing{data: data})
+}
+
+// Queues a close frame telling the client why, after the frames already queued.
+// With close_conn the connection is closed once it's written, otherwise the client is left to close it.
+//
+// Might return ErrClientTooSlow
+func (cl *Client) close(code int, reason string, close_conn bool) error {
+	return cl.queue(outgoing{data: websocket.FormatCloseMessage(code, reason), close: true, close_conn: close_conn})
+}
+
+// A client that has clientSendQueueSize frames waiting isn't reading them, its connection is closed.
+func (cl *Client) queue(frame outgoing) error {
+	if isClosed(cl.done) || isClosed(cl.dropping) {
+		// There's no one left to write to
+		return nil
+	}
+
+	select {
+	case cl.send <- frame:
+		return nil
+	default:
+		metrics.WriteFailures.WithLabelValues(metrics.TargetWebsocket).Inc()
+		cl.abort()
+		return ErrClientTooSlow
+	}
+}
+
+// Writes the queued frames until the connection is removed or closed.
+// A connection that fails a write, or takes longer than clientWriteTimeout, is closed and its reader then removes it.
+func (cl *Client) writeQueued() {
+	defer close(cl.stopped)
+	for {
+		select {
+		case frame := <-cl.send:
+			var err error
+			if frame.close {
+				err = cl.conn.WriteControl(websocket.CloseMessage, frame.data, time.Now().Add(clientCloseTimeout))
+			} else {
+				cl.conn.SetWriteDeadline(time.Now().Add(clientWriteTimeout))
+				err = cl.conn.WriteMessage(websocket.TextMessage, frame.data)
+			}
+			if err != nil {
+				metrics.WriteFailures.WithLabelValues(metrics.TargetWebsocket).Inc()
+				log.Warn("on writing to user %s: %s", cl.UserId, err)
+				cl.drop()
+				return
+			}
+			if frame.close {
+				if frame.close_conn {
+					cl.drop()
+				}
+				return
+			}
+		case <-cl.dropping:
+			cl.drop()
+			return
+		case <-cl.done:
+			return
+		}
+	}
+}
+
+// Closes the connection so its reader returns and removes it.
+// Hijacked connections are only closed once the handler returns, so the pending read is ended by a deadline.
+func (cl *Client) drop() {
+	cl.conn.SetReadDeadline(time.Now())
+	cl.conn.Close()
+}
+
+// Has the writer drop the connection, cutting short the write and read in progress
+func (cl *Client) abort() {
+	cl.state_mu.Lock()
+	defer cl.state_mu.Unlock()
+
+	if isClosed(cl.done) || isClosed(cl.dropping) {
+		return
+	}
+	close(cl.dropping)
+	cl.conn.NetConn().SetDeadline(time.Now())
+}
+
+// Stops the writer, cutting short a write in progress, and waits for it to return.
+// Called by the handler before it returns, the connection is reused after that.
+func (cl *Client) stop() {
+	cl.state_mu.Lock()
+	if !isClosed(cl.done) {
+		close(cl.done)
+	}
+	cl.state_mu.Unlock()
+
+	cl.conn.NetConn().SetWriteDeadline(time.Now())
+	<-cl.stopped
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// Sends an event to this connection only.
+func (cl *Client) Send(event *models.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return cl.Write(data)
+}
+
 type ConnManager struct {
 	clients_mu sync.RWMutex
-	Clients    map[uuid.UUID]*websocket.Conn
-	broadcast  chan *MessageDTO
+	Clients    map[uuid.UUID][]*Client
+
+	// Held for reading while queueing a message, so broadcast isn't closed under a sender
+	broadcast_mu   sync.RWMutex
+	broadcast      chan *MessageDTO
+	closing        bool
+	broadcast_done chan struct{}
+	// Closed when Shutdown starts, releasing the senders waiting on broadcast so it can be closed
+	stopping chan struct{}
+
+	message_service    *MessageService
+	tab_service        *TabService
+	server_service     *ServerService
+	presence_service   *PresenceService
+	typing_service     *TypingService
+	rate_limit_service *RateLimitService
 
-	message_service *MessageService
-	tab_service     *TabService
-	server_service  *ServerService
+	// Larger frames close the connection
+	max_frame_size int64
+
+	// Whether HandleIncomingMessages is running, and since when in unix milliseconds
+	// it's been storing the message it's on, 0 while it waits for one
+	broadcast_running    atomic.Bool
+	broadcast_busy_since atomic.Int64
 }
 
 var (
 	ErrConnectionNotFound = errors.New("connection not found")
+	ErrClientTooSlow      = errors.New("client isn't reading its frames")
+
+	ErrUnknownOp     = common.NewAPIError(http.StatusBadRequest, "unknown_op", "unknown op")
+	ErrNotViewingTab = common.NewAPIError(http.StatusConflict, "not_viewing_tab", "the tab has to be opened with tab.view first")
+
+	ErrShuttingDown = common.NewAPIError(http.StatusServiceUnavailable, "shutting_down", "the server is shutting down, reconnect and send again")
+
+	ErrBroadcastStopped = errors.New("broadcast loop is not running")
+	ErrBroadcastStuck   = errors.New("broadcast loop is stuck")
 )
 
-func NewConnManager(message_service *MessageService, tab_service *TabService, server_service *ServerService) *ConnManager {
+const (
+	// Longest a message can take to be stored before the broadcast loop is considered stuck
+	broadcastStuckAfter = 30 * time.Second
+	// Longest a close frame can take to be written
+	clientCloseTimeout = time.Second
+	// Longest any other frame can take to be written, a client that doesn't read for this long is disconnected
+	clientWriteTimeout = 10 * time.Second
+	// Frames a client can have waiting to be written before it's disconnected
+	clientSendQueueSize = 256
+	// How often Shutdown checks whether every client disconnected
+	drainPollInterval = 50 * time.Millisecond
+)
+
+func NewConnManager(message_service *MessageService, tab_service *TabService, server_service *ServerService, presence_service *PresenceService, typing_service *TypingService, rate_limit_service *RateLimitService, max_frame_size int64) *ConnManager {
 	cm := &ConnManager{
-		Clients:         make(map[uuid.UUID]*websocket.Conn),
-		broadcast:       make(chan *MessageDTO),
-		message_service: message_service,
-		tab_service:     tab_service,
-		server_service:  server_service,
+		Clients:            make(map[uuid.UUID][]*Client),
+		broadcast:          make(chan *MessageDTO),
+		broadcast_done:     make(chan struct{}),
+		stopping:           make(chan struct{}),
+		message_service:    message_service,
+		tab_service:        tab_service,
+		server_service:     server_service,
+		presence_service:   presence_service,
+		typing_service:     typing_service,
+		rate_limit_service: rate_limit_service,
+		max_frame_size:     max_frame_size,
 	}
 	return cm
 }
 
-func (cm *ConnManager) AddClient(user_id uuid.UUID, conn *websocket.Conn) {
+// Registers a new connection of the user, users can be connected from many clients at once.
+func (cm *ConnManager) AddClient(user_id uuid.UUID, conn *websocket.Conn) *Client {
+	conn.SetReadLimit(cm.max_frame_size)
+
+	client := newClient(user_id, conn)
 	cm.clients_mu.Lock()
-	defer cm.clients_mu.Unlock()
+	cm.Clients[user_id] = append(cm.Clients[user_id], client)
+	cm.clients_mu.Unlock()
+	metrics.WebsocketConnections.Inc()
 
-	cm.Clients[user_id] = conn
+	if cm.presence_service.Connect(user_id) {
+		cm.PublishPresence(user_id)
+	}
+	return client
 }
 
-func (cm *ConnManager) RemoveClient(user_id uuid.UUID) error {
-	_, err := cm.GetConn(user_id)
-	if err != nil {
-		return err
+// Counts the live connections and the users they belong to
+func (cm *ConnManager) Stats() models.ConnectionStats {
+	cm.clients_mu.RLock()
+	defer cm.clients_mu.RUnlock()
+
+	stats := models.ConnectionStats{}
+	for _, clients := range cm.Clients {
+		if len(clients) > 0 {
+			stats.Users++
+			stats.Connections += len(clients)
+		}
 	}
-	cm.clients_mu.Lock()
-	defer cm.clients_mu.Unlock()
+	return stats
+}
 
-	delete(cm.Clients, user_id)
+func (cm *ConnManager) RemoveClient(client *Client) error {
+	client.stop()
 
+	cm.clients_mu.Lock()
+	clients := cm.Clients[client.UserId]
+	idx := slices.Index(clients, client)
+	if idx == -1 {
+		cm.clients_mu.Unlock()
+		return ErrConnectionNotFound
+	}
+	clients = slices.Delete(clients, idx, idx+1)
+	if len(clients) == 0 {
+		delete(cm.Clients, client.UserId)
+	} else {
+		cm.Clients[client.UserId] = clients
+	}
+	cm.clients_mu.Unlock()
+	metrics.WebsocketConnections.Dec()
+
+	if cm.presence_service.Disconnect(client.UserId) {
+		cm.PublishPresence(client.UserId)
+	}
 	return nil
 }
 
-func (cm *ConnManager) GetConn(user_id uuid.UUID) (*websocket.Conn, error) {
+// Closes every connection of the user with a close frame telling why, after the frames already queued
+func (cm *ConnManager) Disconnect(user_id uuid.UUID, code int, reason string) {
+	for _, client := range cm.clientsOf([]uuid.UUID{user_id}) {
+		err := client.close(code, reason, true)
+		if err != nil {
+			log.Warn("on closing the connection of user %s: %s", user_id, err)
+		}
+	}
+}
+
+// Every open connection of the user.
+//
+// Might return ErrConnectionNotFound
+func (cm *ConnManager) GetClients(user_id uuid.UUID) ([]*Client, error) {
 	cm.clients_mu.RLock()
 	defer cm.clients_mu.RUnlock()
-	conn, ok := cm.Clients[user_id]
+	clients, ok := cm.Clients[user_id]
 	if !ok {
 		return nil, ErrConnectionNotFound
 	}
-	return conn, nil
+	return slices.Clone(clients), nil
+}
+
+// The connections of the users, copied so they are written to without holding clients_mu
+func (cm *ConnManager) clientsOf(user_ids []uuid.UUID) []*Client {
+	cm.clients_mu.RLock()
+	defer cm.clients_mu.RUnlock()
+
+	clients := []*Client{}
+	for _, user_id := range user_ids {
+		clients = append(clients, cm.Clients[user_id]...)
+	}
+	return clients
+}
+
+// The connections of everyone else than the user that have the tab open, copied like clientsOf
+func (cm *ConnManager) viewersOf(tab_id uuid.UUID, except uuid.UUID) []*Client {
+	cm.clients_mu.RLock()
+	defer cm.clients_mu.RUnlock()
 
+	viewers := []*Client{}
+	for user_id, clients := range cm.Clients {
+		if user_id == except {
+			continue
+		}
+		for _, client := range clients {
+			if client.Viewing() == tab_id {
+				viewers = append(viewers, client)
+			}
+		}
+	}
+	return viewers
 }
 
-func (cm *ConnManager) ClientReadIncoming(uid uuid.UUID) {
-	conn, err := cm.GetConn(uid)
-	if err != nil {
-		log.Error("on read message: %s", err)
-		return
+// Every connection, copied like clientsOf
+func (cm *ConnManager) allClients() []*Client {
+	cm.clients_mu.RLock()
+	defer cm.clients_mu.RUnlock()
+
+	all := []*Client{}
+	for _, clients := range cm.Clients {
+		all = append(all, clients...)
 	}
+	return all
+}
 
+func (cm *ConnManager) ClientReadIncoming(client *Client) {
 	for {
-		mt, data, err := conn.ReadMessage()
+		mt, data, err := client.conn.ReadMessage()
 		if err != nil {
-			// if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseServiceRestart) {
+				log.Debug("connection of user %s closed: %s", client.UserId, err)
+				return
+			}
 			log.Error("on read message: %s", err)
 			return
-			// }
 		}
 		if mt > 0 {
-			log.Debug("mt: %#v ,data: %#v", mt, string(data))
-
-			var msg MessageDTO
-			err := json.Unmarshal(data, &msg)
+			// Frames over the limit are dropped, the client is told when to send again
+			var err error
+			retry_after, ok := takeLocal(&client.frames_tat, time.Now(), models.SocketRateLimit)
+			if ok {
+				err = cm.handleOp(client, data)
+			} else {
+				err = &common.RetryError{Err: fmt.Errorf("%w: too many frames on this connection", models.ErrRateLimited), After: retry_after}
+			}
 			if err != nil {
-				log.Error("on unmarshal: %s", err)
-				continue
+				log.Error("on op from user %s: %s", client.UserId, err)
+				_, res := common.NewErrorResponse(err, "")
+				err := client.Send(models.NewEvent(models.EventError, res))
+				if err != nil {
+					log.Error("couldn't inform the client of the failed op: %s", err)
+				}
 			}
-
-			cm.broadcast <- &msg
 		}
 	}
 }
 
-func (cm *ConnManager) HandleIncomingMessages() {
-	for msg := range cm.broadcast {
-		msg_id, err := cm.message_service.Create(msg)
+func (cm *ConnManager) handleOp(client *Client, data []byte) error {
+	op := models.ClientOp{}
+	err := json.Unmarshal(data, &op)
+	if err != nil {
+		return fmt.Errorf("%w: %w", common.ErrInvalidBody, err)
+	}
+	if op.Op == "" {
+		op = models.ClientOp{Op: models.OpMessageCreate, Data: data}
+	}
+
+	switch op.Op {
+	case models.OpMessageCreate:
+		var msg MessageDTO
+		err := json.Unmarshal(op.Data, &msg)
 		if err != nil {
-			log.Error("could not insert message to db: %s", err)
-			continue
+			return fmt.Errorf("%w: %w", common.ErrInvalidBody, err)
+		}
+		if msg.Tab == nil {
+			return fmt.Errorf("%w: message is missing its tab", common.ErrInvalidBody)
+		}
+		// Sent as the user the connection belongs to, whatever the payload says
+		msg.Sender = &models.User{Id: client.UserId}
+
+		// Checked here as well, the sender won't hear back once it's queued
+		_, err = cm.tab_service.Authorize(msg.Tab.Id, client.UserId, models.RoleMember)
+		if err != nil {
+			return err
+		}
+		err = cm.message_service.Clean(&msg)
+		if err != nil {
+			return err
 		}
-		db_msg, err := cm.message_service.GetByID(msg_id)
+		err = cm.rate_limit_service.TakeMessage(client.UserId, msg.Tab.Id)
 		if err != nil {
-			log.Error("could not find msg with id: %d, %s", msg_id, err)
+			return err
 		}
 
-		msg_dto := cm.message_service.MessageToDTO(db_msg)
-		j_msg, err := json.Marshal(msg_dto)
+		return cm.queue(&msg)
+	case models.OpPresenceUpdate:
+		update := models.PresenceUpdate{}
+		err := json.Unmarshal(op.Data, &update)
 		if err != nil {
-			log.Warn("message failed to be encoded to json: `%#v`, %s", msg, err)
-			continue
+			return fmt.Errorf("%w: %w", common.ErrInvalidBody, err)
+		}
+		err = update.Validate()
+		if err != nil {
+			return err
 		}
 
-		tab, err := cm.tab_service.GetByID(msg.Tab.Id)
+		cm.SetPresence(client.UserId, &update)
+		return nil
+	case models.OpTabView:
+		tab_op := models.TabOp{}
+		err := json.Unmarshal(op.Data, &tab_op)
 		if err != nil {
-			log.Warn("couldn't find corresponding message tab: `%#v`, %s", msg, err)
+			return fmt.Errorf("%w: %w", common.ErrInvalidBody, err)
 		}
 
-		server, err := cm.server_service.GetByID(tab.ServerId)
+		return cm.viewTab(client, tab_op.TabId)
+	case models.OpTypingStart:
+		tab_op := models.TabOp{}
+		err := json.Unmarshal(op.Data, &tab_op)
 		if err != nil {
-			log.Warn("couldn't find corresponding server: `%#v`, %s", tab, err)
+			return fmt.Errorf("%w: %w", common.ErrInvalidBody, err)
 		}
 
-		users, err := cm.server_service.GetUsers(server.Id)
+		return cm.startTyping(client, tab_op.TabId)
+	default:
+		return fmt.Errorf("%w: `%s`", ErrUnknownOp, op.Op)
+	}
+}
+
+// Stores and publishes the messages sent over websockets until Shutdown.
+func (cm *ConnManager) HandleIncomingMessages() {
+	cm.broadcast_running.Store(true)
+	defer close(cm.broadcast_done)
+	defer cm.broadcast_running.Store(false)
+
+	for msg := range cm.broadcast {
+		cm.broadcast_busy_since.Store(time.Now().UnixMilli())
+		cm.storeIncoming(msg)
+		cm.broadcast_busy_since.Store(0)
+	}
+}
+
+// Hands a message to HandleIncomingMessages.
+//
+// Might return ErrShuttingDown, also when Shutdown starts while waiting for the loop to take it
+func (cm *ConnManager) queue(msg *MessageDTO) error {
+	cm.broadcast_mu.RLock()
+	defer cm.broadcast_mu.RUnlock()
+	if cm.closing {
+		return ErrShuttingDown
+	}
+
+	select {
+	case cm.broadcast <- msg:
+		return nil
+	case <-cm.stopping:
+		return ErrShuttingDown
+	}
+}
+
+func (cm *ConnManager) storeIncoming(msg *MessageDTO) {
+	msg_id, err := cm.message_service.Create(msg)
+	if err != nil {
+		log.Error("could not insert message to db: %s", err)
+		return
+	}
+	cm.typing_service.Stop(msg.Sender.Id, msg.Tab.Id)
+
+	cm.PublishMessage(msg_id)
+}
+
+// Checks the loop storing the messages sent over websockets is running and getting through them.
+//
+// Might return ErrBroadcastStopped or ErrBroadcastStuck
+func (cm *ConnManager) CheckBroadcast() error {
+	if !cm.broadcast_running.Load() {
+		return ErrBroadcastStopped
+	}
+	busy_since := cm.broadcast_busy_since.Load()
+	if busy_since != 0 && time.Since(time.UnixMilli(busy_since)) > broadcastStuckAfter {
+		return fmt.Errorf("%w: on the same message for %s", ErrBroadcastStuck, time.Since(time.UnixMilli(busy_since)).Round(time.Second))
+	}
+	return nil
+}
+
+// Drains the connections before the server stops.
+//
+// Messages are no longer accepted over websockets, the queued ones are stored and published,
+// then every client is told to reconnect elsewhere.
+// Returns once they all disconnected, or closes the remaining connections and returns ctx's error
+func (cm *ConnManager) Shutdown(ctx context.Context) error {
+	close(cm.stopping)
+	cm.broadcast_mu.Lock()
+	cm.closing = true
+	close(cm.broadcast)
+	cm.broadcast_mu.Unlock()
+
+	select {
+	case <-cm.broadcast_done:
+	case <-ctx.Done():
+		log.Warn("queued messages weren't all stored before the shutdown deadline")
+	}
+
+	for _, client := range cm.allClients() {
+		err := client.close(websocket.CloseServiceRestart, "server restarting, reconnect", false)
 		if err != nil {
-			log.Warn("couldn't find users for server: `%#v`, %s", server, err)
+			log.Warn("on closing the connection of user %s: %s", client.UserId, err)
 		}
+	}
 
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
 		cm.clients_mu.RLock()
-		log.Debug("users: %#v", users)
-		for uid, conn := range cm.Clients {
-			if !slices.ContainsFunc(users, func(u models.User) bool { return u.Id == uid }) {
-				continue
+		remaining := len(cm.Clients)
+		cm.clients_mu.RUnlock()
+		if remaining == 0 {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			for _, client := range cm.allClients() {
+				client.abort()
 			}
+			return ctx.Err()
+		}
+	}
+}
 
-			// if !ok {
-			// 	log.Warn("tried to write message to offline user: %s", msg.Recipient.GetId())
-			// 	continue
-			// }
+// Pushes a stored message to every connected member of its tab's server.
+func (cm *ConnManager) PublishMessage(msg_id int64) {
+	cm.publishMessage(msg_id, models.EventMessageCreate)
+}
 
-			err := conn.WriteMessage(websocket.TextMessage, j_msg)
-			if err != nil {
-				log.Error("failed on write: %s", err)
-				continue
-			}
+// Pushes a changed message to every connected member of its tab's server.
+func (cm *ConnManager) PublishMessageUpdate(msg_id int64) {
+	cm.publishMessage(msg_id, models.EventMessageUpdate)
+}
+
+func (cm *ConnManager) publishMessage(msg_id int64, event_type string) {
+	db_msg, err := cm.message_service.GetByID(msg_id)
+	if err != nil {
+		log.Error("could not find msg with id: %d, %s", msg_id, err)
+		return
+	}
+
+	msg_dto := cm.message_service.MessageToDTO(db_msg)
+	start := time.Now()
+	cm.PublishToServer(db_msg.Tab.ServerId, models.NewEvent(event_type, msg_dto))
+	metrics.BroadcastDuration.Observe(time.Since(start).Seconds())
+}
+
+// Pushes the event to every connected user out of user_ids.
+func (cm *ConnManager) Publish(user_ids []uuid.UUID, event *models.Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Warn("event failed to be encoded to json: `%#v`, %s", event, err)
+		return
+	}
+
+	for _, client := range cm.clientsOf(user_ids) {
+		err := client.Write(data)
+		if err != nil {
+			log.Error("failed on write to user %s: %s", client.UserId, err)
 		}
-		cm.clients_mu.RUnlock()
 	}
 }
+
+// Pushes the event to every connected member of the server.
+func (cm *ConnManager) PublishToServer(server_id uuid.UUID, event *models.Event) {
+	user_ids, err := cm.server_service.GetUserIds(server_id)
+	if err != nil {
+		log.Warn("couldn't find users for server: %s, %s", server_id, err)
+		return
+	}
+
+	cm.Publish(user_ids, event)
+}
+
+// Pushes the event to every connected user that shares a server with the user, the user included.
+func (cm *ConnManager) PublishToCoMembers(user_id uuid.UUID, event *models.Event) {
+	user_ids, err := cm.server_service.GetCoMembers(user_id)
+	if err != nil {
+		log.Warn("couldn't find co-members of user: %s, %s", user_id, err)
+		return
+	}
+	if len(user_ids) == 0 {
+		user_ids = append(user_ids, user_id)
+	}
+
+	cm.Publish(user_ids, event)
+}
+
+// Sets the status the user chose and pushes it to everyone that shares a server with them.
+func (cm *ConnManager) SetPresence(user_id uuid.UUID, update *models.PresenceUpdate) {
+	cm.presence_service.Set(user_id, update)
+	cm.PublishPresence(user_id)
+}
+
+// Pushes the presence of the user to everyone that shares a server with them.
+// The user's own connections see it as they set it, invisible included.
+func (cm *ConnManager) PublishPresence(user_id uuid.UUID) {
+	user_ids, err := cm.server_service.GetCoMembers(user_id)
+	if err != nil {
+		log.Warn("couldn't find co-members of user: %s, %s", user_id, err)
+		return
+	}
+
+	others := slices.DeleteFunc(user_ids, func(id uuid.UUID) bool { return id == user_id })
+	cm.Publish(others, models.NewEvent(models.EventPresenceUpdate, cm.presence_service.Get(user_id)))
+	cm.Publish([]uuid.UUID{user_id}, models.NewEvent(models.EventPresenceUpdate, cm.presence_service.Own(user_id)))
+}
+
+// Marks the tab as the one the client has open, members of its server only.
+//
+// Might return ErrTabNotFound, ErrNotServerMember or any other sql error
+func (cm *ConnManager) viewTab(client *Client, tab_id uuid.UUID) error {
+	if tab_id == uuid.Nil {
+		client.setViewing(uuid.Nil)
+		return nil
+	}
+
+	tab, err := cm.tab_service.GetByID(tab_id)
+	if err != nil {
+		return err
+	}
+	err = cm.server_service.Authorize(tab.ServerId, client.UserId, models.RoleMember)
+	if err != nil {
+		return err
+	}
+
+	client.setViewing(tab_id)
+	return nil
+}
+
+// Pushes a typing event to the other users that have the tab open.
+// Calls within TypingThrottle of the last one are dropped.
+//
+// Might return ErrNotViewingTab
+func (cm *ConnManager) startTyping(client *Client, tab_id uuid.UUID) error {
+	if tab_id == uuid.Nil || client.Viewing() != tab_id {
+		return fmt.Errorf("%w:tab_id=%s", ErrNotViewingTab, tab_id)
+	}
+
+	expires_at, ok := cm.typing_service.Start(client.UserId, tab_id)
+	if !ok {
+		return nil
+	}
+
+	data, err := json.Marshal(models.NewEvent(models.EventTyping, models.Typing{TabId: tab_id, UserId: client.UserId, ExpiresAt: expires_at}))
+	if err != nil {
+		return err
+	}
+
+	for _, other := range cm.viewersOf(tab_id, client.UserId) {
+		err := other.Write(data)
+		if err != nil {
+			log.Error("failed on write to user %s: %s", other.UserId, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestShutdownReleasesWaitingSenders(t *testing.T) {
+	// Nothing takes the queued messages, like a loop stuck storing one
+	cm := NewConnManager(nil, nil, nil, NewPresenceService(), NewTypingService(), nil, 0)
+
+	queued := make(chan error, 1)
+	go func() {
+		queued <- cm.queue(&MessageDTO{Text: "kalhspera"})
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- cm.Shutdown(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected Shutdown to finish without clients, got %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown hung on a sender waiting to queue a message")
+	}
+	select {
+	case err := <-queued:
+		if !errors.Is(err, ErrShuttingDown) {
+			t.Fatalf("expected the waiting sender to get ErrShuttingDown, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the waiting sender wasn't released")
+	}
+
+	err := cm.queue(&MessageDTO{Text: "kalhspera"})
+	if !errors.Is(err, ErrShuttingDown) {
+		t.Fatalf("expected messages after Shutdown to be refused, got %v", err)
+	}
+}
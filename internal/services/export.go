@@ -0,0 +1,54 @@
+package services
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/google/uuid"
+)
+
+type ExportService struct {
+	server_service  *ServerService
+	tab_service     *TabService
+	message_service *MessageService
+}
+
+func NewExportService(server_service *ServerService, tab_service *TabService, message_service *MessageService) *ExportService {
+	s := &ExportService{server_service: server_service, tab_service: tab_service, message_service: message_service}
+	return s
+}
+
+// Gathers a server with its members, tabs and the messages of every tab, in the order they were sent.
+//
+// Might return ErrServerNotFound or any other sql error
+func (s *ExportService) Export(server_id uuid.UUID) (*models.ServerExport, error) {
+	server, err := s.server_service.GetByID(server_id)
+	if err != nil {
+		return nil, err
+	}
+	// The members are exported with their roles instead
+	server.Users = nil
+
+	members, err := s.server_service.GetMembers(server_id)
+	if err != nil {
+		return nil, err
+	}
+
+	tabs, err := s.tab_service.GetByServerID(server_id)
+	if err != nil {
+		return nil, err
+	}
+	messages := []models.Message{}
+	for _, tab := range tabs {
+		tab_messages, err := s.message_service.GetByTabID(tab.Id)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, tab_messages...)
+	}
+	slices.SortFunc(messages, func(a, b models.Message) int { return cmp.Compare(a.Id, b.Id) })
+
+	return &models.ServerExport{ExportedAt: time.Now(), Server: *server, Members: members, Tabs: tabs, Messages: messages}, nil
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/storage"
+	"github.com/NikosGour/logging/log"
+)
+
+type HealthService struct {
+	db storage.Storage
+
+	conn_manager *ConnManager
+}
+
+func NewHealthService(db storage.Storage, conn_manager *ConnManager) *HealthService {
+	s := &HealthService{db: db, conn_manager: conn_manager}
+	return s
+}
+
+// Checks whether chatter can serve requests: the storage answers, its schema is up to date
+// and messages sent over websockets are being stored.
+func (s *HealthService) Readiness() *models.Readiness {
+	checks := map[string]string{
+		"database":   checkResult("database", s.db.Ping()),
+		"migrations": checkResult("migrations", s.checkMigrations()),
+		"broadcast":  checkResult("broadcast", s.conn_manager.CheckBroadcast()),
+	}
+
+	status := models.ReadinessReady
+	for _, check := range checks {
+		if check != models.HealthOK {
+			status = models.ReadinessNotReady
+		}
+	}
+	return &models.Readiness{Status: status, Checks: checks}
+}
+
+func (s *HealthService) checkMigrations() error {
+	pending, err := storage.PendingMigrations(s.db)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("pending: %s", strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// The errors are only logged, the endpoint is public and they can name hosts and paths
+func checkResult(name string, err error) string {
+	if err != nil {
+		log.Warn("readiness check `%s` failed: %s", name, err)
+		return models.HealthFailing
+	}
+	return models.HealthOK
+}
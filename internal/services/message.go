@@ -1,20 +1,36 @@
 package services
 
 import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/NikosGour/chatter/internal/metrics"
 	"github.com/NikosGour/chatter/internal/models"
 	"github.com/NikosGour/chatter/internal/repositories"
+	"github.com/NikosGour/chatter/internal/sanitize"
 	"github.com/google/uuid"
 )
 
 type MessageDTO = models.Message
 type MessageService struct {
-	message_repo repositories.MessageRepository
+	message_repo    repositories.MessageRepository
+	attachment_repo repositories.AttachmentRepository
+	server_repo     repositories.ServerRepository
+	uow             repositories.UnitOfWork
+
+	user_service *UserService
+	tab_service  *TabService
 
-	tab_service *TabService
+	// Attachments are downloaded from attachment_url/<id>
+	attachment_url string
+	// Most characters in the text of a message
+	max_length int
 }
 
-func NewMessageService(message_repo repositories.MessageRepository, tab_service *TabService) *MessageService {
-	s := &MessageService{message_repo: message_repo, tab_service: tab_service}
+func NewMessageService(message_repo repositories.MessageRepository, attachment_repo repositories.AttachmentRepository, server_repo repositories.ServerRepository, uow repositories.UnitOfWork, user_service *UserService, tab_service *TabService, attachment_url string, max_length int) *MessageService {
+	s := &MessageService{message_repo: message_repo, attachment_repo: attachment_repo, server_repo: server_repo, uow: uow, user_service: user_service, tab_service: tab_service, attachment_url: attachment_url, max_length: max_length}
 	return s
 }
 
@@ -26,10 +42,15 @@ func (s *MessageService) GetAll() ([]models.Message, error) {
 	if err != nil {
 		return nil, err
 	}
+	attachments, err := s.attachment_repo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	by_message := s.groupAttachments(attachments)
 
 	messages := []models.Message{}
 	for _, message_dbo := range message_dbos {
-		message, err := s.toMessage(message_dbo)
+		message, err := s.toMessage(message_dbo, by_message[message_dbo.Id])
 		if err != nil {
 			return nil, err
 		}
@@ -38,6 +59,26 @@ func (s *MessageService) GetAll() ([]models.Message, error) {
 	return messages, nil
 }
 
+// Retrieves the messages of every server the user is a member of.
+//
+// Might return any sql error.
+func (s *MessageService) GetAllOf(user_id uuid.UUID) ([]models.Message, error) {
+	memberships, err := s.server_repo.GetMemberships(user_id)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := s.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	server_ids := map[uuid.UUID]bool{}
+	for _, membership := range memberships {
+		server_ids[membership.ServerId] = true
+	}
+	return slices.DeleteFunc(messages, func(m models.Message) bool { return m.Tab == nil || !server_ids[m.Tab.ServerId] }), nil
+}
+
 // Retrieves a message given the id.
 //
 // Might return ErrGroupNotFound or any other sql error
@@ -46,8 +87,12 @@ func (s *MessageService) GetByID(id int64) (*models.Message, error) {
 	if err != nil {
 		return nil, err
 	}
+	attachments, err := s.attachment_repo.GetByMessageID(id)
+	if err != nil {
+		return nil, err
+	}
 
-	message, err := s.toMessage(*message_dbo)
+	message, err := s.toMessage(*message_dbo, s.withUrls(attachments))
 	if err != nil {
 		return nil, err
 	}
@@ -55,19 +100,65 @@ func (s *MessageService) GetByID(id int64) (*models.Message, error) {
 }
 
 func (s *MessageService) GetByTabID(tab_id uuid.UUID) ([]models.Message, error) {
+	return s.GetPageByTabID(tab_id, models.MessagePage{})
+}
+
+// Retrieves a page of the messages of the tab, oldest first, or all of them when page.Limit is 0.
+//
+// Only the attachments of the page's messages are fetched.
+// Might return ErrTabNotFound
+func (s *MessageService) GetPageByTabID(tab_id uuid.UUID, page models.MessagePage) ([]models.Message, error) {
 	_, err := s.tab_service.GetByID(tab_id)
 	if err != nil {
 		return nil, err
 	}
 
-	message_dbos, err := s.message_repo.GetByTabID(tab_id)
+	var message_dbos []repositories.MessageDBO
+	var attachments []repositories.AttachmentDBO
+	if page.Limit == 0 {
+		message_dbos, err = s.message_repo.GetByTabID(tab_id)
+		if err != nil {
+			return nil, err
+		}
+		attachments, err = s.attachment_repo.GetByTabID(tab_id)
+	} else {
+		message_dbos, err = s.message_repo.GetPageByTabID(tab_id, page.Before, page.Limit)
+		if err != nil {
+			return nil, err
+		}
+		message_ids := []int64{}
+		for _, message_dbo := range message_dbos {
+			message_ids = append(message_ids, message_dbo.Id)
+		}
+		attachments, err = s.attachment_repo.GetByMessageIDs(message_ids)
+	}
+	if err != nil {
+		return nil, err
+	}
+	by_message := s.groupAttachments(attachments)
+
+	messages := []models.Message{}
+	for _, message_dbo := range message_dbos {
+		message, err := s.toMessage(message_dbo, by_message[message_dbo.Id])
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *message)
+	}
+	return messages, nil
+}
+
+// Retrieves the last message of every sender among the messages of the tab with an id in (after, until],
+// without their attachments. Ordered by id.
+func (s *MessageService) GetLastPerSender(tab_id uuid.UUID, after int64, until int64) ([]models.Message, error) {
+	message_dbos, err := s.message_repo.GetLastPerSender(tab_id, after, until)
 	if err != nil {
 		return nil, err
 	}
 
 	messages := []models.Message{}
 	for _, message_dbo := range message_dbos {
-		message, err := s.toMessage(message_dbo)
+		message, err := s.toMessage(message_dbo, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -76,27 +167,121 @@ func (s *MessageService) GetByTabID(tab_id uuid.UUID) ([]models.Message, error)
 	return messages, nil
 }
 
-// Inserts a message into a database.
+// Inserts a message into a database along with the members it mentions, its text is cleaned first.
 //
 // Returns the id of the created message.
-// Might return any sql error
+// Might return ErrEmptyMessage, ErrMessageTooLong, ErrTabNotFound or any other sql error
 func (s *MessageService) Create(message *models.Message) (int64, error) {
+	err := s.Clean(message)
+	if err != nil {
+		return 0, err
+	}
+	mentions, err := s.Mentioned(message.Text, message.Tab.Id)
+	if err != nil {
+		return 0, err
+	}
+
 	message_dbo := messageToDBO(message)
-	return s.message_repo.Create(message_dbo)
+	id := int64(0)
+	err = s.uow.Transaction(func(tx *repositories.Repositories) error {
+		id, err = tx.Message.Create(message_dbo)
+		if err != nil {
+			return err
+		}
+		return tx.Message.AddMentions(id, mentions)
+	})
+	if err != nil {
+		metrics.WriteFailures.WithLabelValues(metrics.TargetDatabase).Inc()
+		return 0, err
+	}
+	metrics.MessagesPersisted.Inc()
+	return id, nil
+}
+
+// The members of the tab's server that the cleaned text mentions, see models.Mentions
+//
+// Might return ErrTabNotFound or any other sql error
+func (s *MessageService) Mentioned(text string, tab_id uuid.UUID) ([]uuid.UUID, error) {
+	if !strings.Contains(text, "@") {
+		return nil, nil
+	}
+	tab, err := s.tab_service.GetByID(tab_id)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.server_repo.GetMembers(tab.ServerId)
+	if err != nil {
+		return nil, err
+	}
+
+	mentioned := []uuid.UUID{}
+	for _, member := range members {
+		if models.Mentions(text, member.Username) {
+			mentioned = append(mentioned, member.UserId)
+		}
+	}
+	return mentioned, nil
 }
 
-// Transforms a message DBO to a message model
-func (s *MessageService) toMessage(message_dbo repositories.MessageDBO) (*models.Message, error) {
+// Sanitizes the text of the message in place and checks what's left of it.
+// Only messages with attachments may have no text.
+//
+// Might return ErrEmptyMessage or ErrMessageTooLong
+func (s *MessageService) Clean(message *models.Message) error {
+	text, err := s.CleanText(message.Text, len(message.Attachments) > 0)
+	if err != nil {
+		return err
+	}
+	message.Text = text
+	return nil
+}
+
+// Sanitizes the text of a message and checks it isn't too long, or empty unless allow_empty.
+//
+// Might return ErrEmptyMessage or ErrMessageTooLong
+func (s *MessageService) CleanText(text string, allow_empty bool) (string, error) {
+	text = sanitize.Text(text)
+	if text == "" && !allow_empty {
+		return "", models.ErrEmptyMessage
+	}
+	if length := utf8.RuneCountInString(text); length > s.max_length {
+		return "", fmt.Errorf("%w: %d characters, at most %d are allowed", models.ErrMessageTooLong, length, s.max_length)
+	}
+	return text, nil
+}
+
+// Transforms a message DBO and its attachments to a message model
+func (s *MessageService) toMessage(message_dbo repositories.MessageDBO, attachments []models.Attachment) (*models.Message, error) {
 	message := &models.Message{
-		Id:       message_dbo.Id,
-		Text:     message_dbo.Text,
-		DateSent: message_dbo.DateSent,
+		Id:          message_dbo.Id,
+		Text:        message_dbo.Text,
+		DateSent:    message_dbo.DateSent,
+		Attachments: attachments,
 	}
-	message.Sender = message_dbo.User
+	message.Sender = s.user_service.ToUser(message_dbo.User)
 	message.Tab = message_dbo.Tab
 	return message, nil
 }
 
+// Sets the download urls of every attachment
+func (s *MessageService) withUrls(attachments []repositories.AttachmentDBO) []models.Attachment {
+	for i := range attachments {
+		attachments[i].Url = s.attachment_url + "/" + attachments[i].Id.String()
+		if attachments[i].HasThumbnail {
+			attachments[i].ThumbnailUrl = attachments[i].Url + "/thumbnail"
+		}
+	}
+	return attachments
+}
+
+func (s *MessageService) groupAttachments(attachments []repositories.AttachmentDBO) map[int64][]models.Attachment {
+	by_message := map[int64][]models.Attachment{}
+	for _, a := range s.withUrls(attachments) {
+		by_message[a.MessageId] = append(by_message[a.MessageId], a)
+	}
+	return by_message
+}
+
 func (s *MessageService) MessageToDTO(m *models.Message) *MessageDTO {
 
 	return m
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/NikosGour/chatter/internal/models"
+)
+
+// The length limit counts characters of the sanitized text, not bytes of what was sent
+func TestCleanTextLength(t *testing.T) {
+	s := NewMessageService(nil, nil, nil, nil, nil, nil, "", 5)
+
+	cases := []struct {
+		name        string
+		text        string
+		allow_empty bool
+		expected    string
+		err         error
+	}{
+		{"at the limit", "abcde", false, "abcde", nil},
+		{"over the limit", "abcdef", false, "", models.ErrMessageTooLong},
+		{"multibyte at the limit", "\u03ac\u03bb\u03c6\u03b1!", false, "\u03ac\u03bb\u03c6\u03b1!", nil},
+		{"decomposed at the limit", "cafe\u0301s", false, "caf\u00e9s", nil},
+		{"trimmed to the limit", "  abcde\r\n", false, "abcde", nil},
+		{"dropped controls", "ab\u202ec\x00de", false, "abcde", nil},
+		{"crlf counted once", "ab\r\ncd", false, "ab\ncd", nil},
+		{"empty after sanitizing", " \u202e\x00 ", false, "", models.ErrEmptyMessage},
+		{"empty with attachments", " \u202e\x00 ", true, "", nil},
+	}
+	for _, tc := range cases {
+		text, err := s.CleanText(tc.text, tc.allow_empty)
+		if text != tc.expected || !errors.Is(err, tc.err) {
+			t.Errorf("%s: expected %+q, %v, got %+q, %v", tc.name, tc.expected, tc.err, text, err)
+		}
+	}
+
+	_, err := s.CleanText(strings.Repeat("a", 6), false)
+	if err == nil || !strings.Contains(err.Error(), "6 characters, at most 5") {
+		t.Fatalf("expected the lengths in the error, got %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"sync"
+
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/google/uuid"
+)
+
+// Tracks who is online, derived from their websocket connections,
+// along with the status they chose. Nothing is stored in the database.
+type PresenceService struct {
+	mu    sync.RWMutex
+	users map[uuid.UUID]*presence
+}
+
+type presence struct {
+	connections   int
+	status        models.Status
+	custom_status string
+}
+
+func NewPresenceService() *PresenceService {
+	s := &PresenceService{users: make(map[uuid.UUID]*presence)}
+	return s
+}
+
+// Counts a new connection of the user.
+//
+// Reports whether the user just came online.
+func (s *PresenceService) Connect(user_id uuid.UUID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.get(user_id)
+	p.connections++
+	return p.connections == 1
+}
+
+// Counts a closed connection of the user.
+//
+// Reports whether the user just went offline.
+func (s *PresenceService) Disconnect(user_id uuid.UUID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.get(user_id)
+	if p.connections == 0 {
+		return false
+	}
+	p.connections--
+	if p.connections != 0 {
+		return false
+	}
+
+	if p.status == models.StatusOnline && p.custom_status == "" {
+		delete(s.users, user_id)
+	}
+	return true
+}
+
+// Sets the status the user chose, kept across reconnects.
+func (s *PresenceService) Set(user_id uuid.UUID, update *models.PresenceUpdate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.get(user_id)
+	p.status = update.Status
+	p.custom_status = update.CustomStatus
+}
+
+// The presence of the user as they see it themselves, invisible included.
+func (s *PresenceService) Own(user_id uuid.UUID) *models.Presence {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.users[user_id]
+	if !ok || p.connections == 0 {
+		return &models.Presence{UserId: user_id, Status: models.StatusOffline}
+	}
+	return &models.Presence{UserId: user_id, Status: p.status, CustomStatus: p.custom_status}
+}
+
+// The presence of the user as everyone else sees it, invisible users appear offline.
+func (s *PresenceService) Get(user_id uuid.UUID) *models.Presence {
+	p := s.Own(user_id)
+	if p.Status == models.StatusInvisible {
+		return &models.Presence{UserId: user_id, Status: models.StatusOffline}
+	}
+	return p
+}
+
+// Must be called with the lock held
+func (s *PresenceService) get(user_id uuid.UUID) *presence {
+	p, ok := s.users[user_id]
+	if !ok {
+		p = &presence{status: models.StatusOnline}
+		s.users[user_id] = p
+	}
+	return p
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"strings"
+
+	"github.com/NikosGour/chatter/internal/blob"
+	"github.com/NikosGour/chatter/internal/media"
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/repositories"
+	"github.com/NikosGour/logging/log"
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/google/uuid"
+)
+
+type ProfileService struct {
+	user_repo repositories.UserRepository
+	blobs     blob.Store
+
+	user_service *UserService
+}
+
+func NewProfileService(user_repo repositories.UserRepository, blobs blob.Store, user_service *UserService) *ProfileService {
+	s := &ProfileService{user_repo: user_repo, blobs: blobs, user_service: user_service}
+	return s
+}
+
+// Get the profile of a user
+//
+// Might return ErrUserNotFound or any other sql error
+func (s *ProfileService) Get(user_id uuid.UUID) (*models.Profile, error) {
+	user, err := s.user_service.GetByID(user_id)
+	if err != nil {
+		return nil, err
+	}
+	return toProfile(user), nil
+}
+
+// Applies the fields set in the patch to the profile of the user.
+//
+// Returns the updated profile.
+// Might return ErrUserNotFound or any other sql error
+func (s *ProfileService) Update(user_id uuid.UUID, patch *models.ProfilePatch) (*models.Profile, error) {
+	user, err := s.user_service.GetByID(user_id)
+	if err != nil {
+		return nil, err
+	}
+
+	if patch.DisplayName != nil {
+		user.DisplayName = strings.TrimSpace(*patch.DisplayName)
+	}
+	if patch.Bio != nil {
+		user.Bio = strings.TrimSpace(*patch.Bio)
+	}
+
+	err = s.user_repo.UpdateProfile(user)
+	if err != nil {
+		return nil, err
+	}
+	return toProfile(user), nil
+}
+
+// Replaces the avatar of the user with the uploaded image.
+//
+// The image is scaled down to fit in an AvatarSize square and stored as a PNG,
+// so nothing but the pixels of the upload is kept.
+// Returns the updated profile.
+// Might return ErrAvatarTooLarge, ErrInvalidAvatar, ErrUserNotFound or any other sql or blob error
+func (s *ProfileService) SetAvatar(user_id uuid.UUID, f *multipart.FileHeader) (*models.Profile, error) {
+	if f.Size > models.MaxAvatarSize {
+		return nil, fmt.Errorf("%w:size=%d", models.ErrAvatarTooLarge, f.Size)
+	}
+	user, err := s.user_service.GetByID(user_id)
+	if err != nil {
+		return nil, err
+	}
+
+	avatar, err := s.scale(f)
+	if err != nil {
+		return nil, err
+	}
+
+	avatar_id := uuid.New()
+	err = s.blobs.Put(avatarKey(avatar_id), bytes.NewReader(avatar), int64(len(avatar)), "image/png")
+	if err != nil {
+		return nil, err
+	}
+
+	old_id := user.AvatarId
+	user.AvatarId = &avatar_id
+	err = s.user_repo.UpdateProfile(user)
+	if err != nil {
+		s.deleteAvatar(avatar_id)
+		return nil, err
+	}
+	if old_id != nil {
+		s.deleteAvatar(*old_id)
+	}
+
+	return toProfile(s.user_service.ToUser(user)), nil
+}
+
+// Removes the avatar of the user.
+//
+// Returns the updated profile.
+// Might return ErrUserNotFound or any other sql error
+func (s *ProfileService) DeleteAvatar(user_id uuid.UUID) (*models.Profile, error) {
+	user, err := s.user_service.GetByID(user_id)
+	if err != nil {
+		return nil, err
+	}
+	if user.AvatarId == nil {
+		return toProfile(user), nil
+	}
+
+	old_id := *user.AvatarId
+	user.AvatarId = nil
+	user.AvatarUrl = ""
+	err = s.user_repo.UpdateProfile(user)
+	if err != nil {
+		return nil, err
+	}
+	s.deleteAvatar(old_id)
+
+	return toProfile(user), nil
+}
+
+// Opens an avatar, they are public like the usernames they go with.
+//
+// The caller has to close the returned reader.
+// Might return ErrAvatarNotFound or any other blob error
+func (s *ProfileService) OpenAvatar(id uuid.UUID) (io.ReadCloser, error) {
+	r, err := s.blobs.Get(avatarKey(id))
+	if err != nil {
+		if errors.Is(err, blob.ErrBlobNotFound) {
+			return nil, fmt.Errorf("%w:%s", models.ErrAvatarNotFound, id)
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reads an uploaded image and encodes it scaled down as a PNG
+func (s *ProfileService) scale(f *multipart.FileHeader) ([]byte, error) {
+	file, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("on opening upload `%s`: %w", f.Filename, err)
+	}
+	defer file.Close()
+
+	// The header size is the client's word, the reader is capped as well
+	data, err := io.ReadAll(io.LimitReader(file, models.MaxAvatarSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("on reading upload `%s`: %w", f.Filename, err)
+	}
+	if len(data) > models.MaxAvatarSize {
+		return nil, fmt.Errorf("%w:size=%d", models.ErrAvatarTooLarge, len(data))
+	}
+
+	content_type := mimetype.Detect(data).String()
+	if !media.IsImage(content_type) {
+		return nil, fmt.Errorf("%w:content_type=%s", models.ErrInvalidAvatar, content_type)
+	}
+
+	scaled, _, _, err := media.Scale(data, content_type, models.AvatarSize)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", models.ErrInvalidAvatar, err)
+	}
+
+	var buf bytes.Buffer
+	err = png.Encode(&buf, scaled)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *ProfileService) deleteAvatar(id uuid.UUID) {
+	err := s.blobs.Delete(avatarKey(id))
+	if err != nil {
+		log.Error("on deleting avatar `%s`: %s", id, err)
+	}
+}
+
+func toProfile(user *models.User) *models.Profile {
+	return &models.Profile{
+		Id:          user.Id,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarUrl:   user.AvatarUrl,
+	}
+}
+
+func avatarKey(id uuid.UUID) string {
+	return "avatars/" + id.String()
+}
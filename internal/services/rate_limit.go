@@ -0,0 +1,113 @@
+package services
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/repositories"
+	"github.com/NikosGour/logging/log"
+	"github.com/google/uuid"
+)
+
+const (
+	// How often buckets that are full again are deleted
+	rateLimitPruneEvery = time.Minute
+)
+
+// Rate limits kept in the storage, so every instance sharing it enforces the same ones
+type RateLimitService struct {
+	rate_limit_repo repositories.RateLimitRepository
+	server_repo     repositories.ServerRepository
+
+	tab_service *TabService
+
+	// Unix milliseconds of the last prune
+	last_prune atomic.Int64
+}
+
+func NewRateLimitService(rate_limit_repo repositories.RateLimitRepository, server_repo repositories.ServerRepository, tab_service *TabService) *RateLimitService {
+	s := &RateLimitService{rate_limit_repo: rate_limit_repo, server_repo: server_repo, tab_service: tab_service}
+	return s
+}
+
+// Counts a request against the bucket.
+//
+// A failing storage lets the request through, the limits aren't worth an outage.
+// Might return ErrRateLimited wrapped in a RetryError
+func (s *RateLimitService) Take(bucket string, limit models.RateLimit) error {
+	return s.take(bucket, limit.Interval(), limit.Tolerance(), models.ErrRateLimited)
+}
+
+// Counts a message the user sends to the tab against their message limit and the tab's slow mode.
+// Moderators aren't held to the slow mode.
+//
+// Might return ErrTabNotFound, ErrRateLimited or ErrSlowMode wrapped in a RetryError, or any other sql error
+func (s *RateLimitService) TakeMessage(user_id uuid.UUID, tab_id uuid.UUID) error {
+	err := s.Take("message:"+user_id.String(), models.MessageRateLimit)
+	if err != nil {
+		return err
+	}
+
+	tab, err := s.tab_service.GetByID(tab_id)
+	if err != nil {
+		return err
+	}
+	if tab.SlowMode <= 0 {
+		return nil
+	}
+	role, err := s.server_repo.GetRole(tab.ServerId, user_id)
+	if err == nil && role.AtLeast(models.RoleModerator) {
+		return nil
+	}
+
+	bucket := "slow_mode:" + tab.Id.String() + ":" + user_id.String()
+	return s.take(bucket, time.Duration(tab.SlowMode)*time.Second, 0, models.ErrSlowMode)
+}
+
+func (s *RateLimitService) take(bucket string, interval time.Duration, tolerance time.Duration, limited error) error {
+	now := time.Now()
+	s.prune(now)
+
+	ok, tat, err := s.rate_limit_repo.Take(bucket, now, interval, tolerance)
+	if err != nil {
+		log.Error("on taking from rate limit bucket `%s`, letting the request through: %s", bucket, err)
+		return nil
+	}
+	if !ok {
+		return &common.RetryError{Err: fmt.Errorf("%w:bucket=%s", limited, bucket), After: tat.Add(-tolerance).Sub(now)}
+	}
+	return nil
+}
+
+// Deletes the buckets that are full again, at most once every rateLimitPruneEvery
+func (s *RateLimitService) prune(now time.Time) {
+	last := s.last_prune.Load()
+	if now.UnixMilli()-last < rateLimitPruneEvery.Milliseconds() || !s.last_prune.CompareAndSwap(last, now.UnixMilli()) {
+		return
+	}
+
+	deleted, err := s.rate_limit_repo.DeleteExpired(now)
+	if err != nil {
+		log.Error("on pruning rate limit buckets: %s", err)
+		return
+	}
+	log.Debug("pruned %d rate limit buckets", deleted)
+}
+
+// Counts a request against a bucket that only lives on this instance, like the one of a single connection.
+//
+// Returns how long to wait when the request is over the limit
+func takeLocal(tat *time.Time, now time.Time, limit models.RateLimit) (time.Duration, bool) {
+	if tat.Sub(now) > limit.Tolerance() {
+		return tat.Add(-limit.Tolerance()).Sub(now), false
+	}
+
+	if tat.Before(now) {
+		*tat = now
+	}
+	*tat = tat.Add(limit.Interval())
+	return 0, true
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/repositories"
+	"github.com/google/uuid"
+)
+
+type ReadStateService struct {
+	read_state_repo repositories.ReadStateRepository
+	server_repo     repositories.ServerRepository
+	uow             repositories.UnitOfWork
+
+	user_service    *UserService
+	tab_service     *TabService
+	message_service *MessageService
+}
+
+func NewReadStateService(read_state_repo repositories.ReadStateRepository, server_repo repositories.ServerRepository, uow repositories.UnitOfWork, user_service *UserService, tab_service *TabService, message_service *MessageService) *ReadStateService {
+	s := &ReadStateService{read_state_repo: read_state_repo, server_repo: server_repo, uow: uow, user_service: user_service, tab_service: tab_service, message_service: message_service}
+	return s
+}
+
+// Marks the tab as read by the user up to and including the message, members of its server only.
+//
+// Returns the new read state of the tab, and a receipt for every sender with newly read messages.
+// Might return ErrTabNotFound, ErrNotServerMember, ErrMessageNotFound, ErrMessageNotInTab or any other sql error
+func (s *ReadStateService) Ack(user_id uuid.UUID, tab_id uuid.UUID, message_id int64) (*models.ReadState, []models.Receipt, error) {
+	tab, err := s.tab_service.GetByID(tab_id)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = authorize(s.server_repo, tab.ServerId, user_id, models.RoleMember)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	message, err := s.message_service.GetByID(message_id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if message.Tab == nil || message.Tab.Id != tab_id {
+		return nil, nil, fmt.Errorf("%w:message_id=%d,tab_id=%s", models.ErrMessageNotInTab, message_id, tab_id)
+	}
+
+	// Concurrent acks take turns, so each sees the read state the other left and no message is receipted twice
+	var previous int64
+	var read_state *models.ReadState
+	err = s.uow.Transaction(func(tx *repositories.Repositories) error {
+		last_read, err := tx.ReadState.GetForUpdate(user_id, tab_id)
+		if err != nil {
+			return err
+		}
+		previous = last_read
+		err = tx.ReadState.Ack(user_id, tab_id, message_id)
+		if err != nil {
+			return err
+		}
+		read_states, err := tx.ReadState.GetByServerID(user_id, tab.ServerId)
+		if err != nil {
+			return err
+		}
+		read_state, err = readStateOf(read_states, tab_id)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	receipts, err := s.newReceipts(user_id, tab, previous, read_state.LastReadMessageId)
+	if err != nil {
+		return nil, nil, err
+	}
+	return read_state, receipts, nil
+}
+
+// Get who has seen a message, members of its server only.
+// The sender and users hiding their read receipts are left out.
+//
+// Might return ErrMessageNotFound, ErrNotServerMember, ErrReceiptsUnavailable or any other sql error
+func (s *ReadStateService) GetReceipts(user_id uuid.UUID, message_id int64) (*models.Receipts, error) {
+	message, err := s.message_service.GetByID(message_id)
+	if err != nil {
+		return nil, err
+	}
+	if message.Tab == nil || message.Sender == nil {
+		return nil, fmt.Errorf("%w:message_id=%d", models.ErrMessageNotFound, message_id)
+	}
+	err = authorize(s.server_repo, message.Tab.ServerId, user_id, models.RoleMember)
+	if err != nil {
+		return nil, err
+	}
+
+	keeps, err := s.keepsReceipts(message.Tab.ServerId)
+	if err != nil {
+		return nil, err
+	}
+	if !keeps {
+		return nil, fmt.Errorf("%w:server_id=%s", models.ErrReceiptsUnavailable, message.Tab.ServerId)
+	}
+
+	readers, err := s.read_state_repo.GetReaders(message.Tab.Id, message_id)
+	if err != nil {
+		return nil, err
+	}
+
+	receipts := &models.Receipts{MessageId: message_id, SeenBy: []models.User{}}
+	for _, reader := range readers {
+		if reader.Id != message.Sender.Id {
+			receipts.SeenBy = append(receipts.SeenBy, *s.user_service.ToUser(&reader))
+		}
+	}
+	return receipts, nil
+}
+
+// Receipts for the messages of others the user read by moving their read state from previous to current
+func (s *ReadStateService) newReceipts(user_id uuid.UUID, tab *models.Tab, previous int64, current int64) ([]models.Receipt, error) {
+	receipts := []models.Receipt{}
+	if current <= previous {
+		return receipts, nil
+	}
+
+	user, err := s.user_service.GetByID(user_id)
+	if err != nil {
+		return nil, err
+	}
+	if user.HideReadReceipts {
+		return receipts, nil
+	}
+
+	keeps, err := s.keepsReceipts(tab.ServerId)
+	if err != nil {
+		return nil, err
+	}
+	if !keeps {
+		return receipts, nil
+	}
+
+	// One receipt per sender, for the last of their messages that was read
+	last_read, err := s.message_service.GetLastPerSender(tab.Id, previous, current)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := models.User{Id: user.Id, Username: user.Username}
+	for _, m := range last_read {
+		if m.Sender == nil || m.Sender.Id == user_id {
+			continue
+		}
+		receipts = append(receipts, models.Receipt{TabId: tab.Id, MessageId: m.Id, SenderId: m.Sender.Id, User: reader})
+	}
+	return receipts, nil
+}
+
+func (s *ReadStateService) keepsReceipts(server_id uuid.UUID) (bool, error) {
+	member_ids, err := s.server_repo.GetUsers(server_id)
+	if err != nil {
+		return false, err
+	}
+	return len(member_ids) <= models.MaxReceiptMembers, nil
+}
+
+// The read state of the tab among the read states of its server
+func readStateOf(read_states []repositories.ReadStateDBO, tab_id uuid.UUID) (*models.ReadState, error) {
+	for _, rs := range read_states {
+		if rs.TabId == tab_id {
+			return &rs, nil
+		}
+	}
+	return nil, fmt.Errorf("%w:tab_id=%s", models.ErrTabNotFound, tab_id)
+}
+
+// Get the read state of the user for every tab of the server, members of the server only.
+//
+// Returns the read states keyed by tab.
+// Might return ErrServerNotFound, ErrNotServerMember or any other sql error
+func (s *ReadStateService) GetByServerID(user_id uuid.UUID, server_id uuid.UUID) (map[uuid.UUID]models.ReadState, error) {
+	err := authorize(s.server_repo, server_id, user_id, models.RoleMember)
+	if err != nil {
+		return nil, err
+	}
+
+	read_state_dbos, err := s.read_state_repo.GetByServerID(user_id, server_id)
+	if err != nil {
+		return nil, err
+	}
+
+	read_states := map[uuid.UUID]models.ReadState{}
+	for _, rs := range read_state_dbos {
+		read_states[rs.TabId] = rs
+	}
+	return read_states, nil
+}
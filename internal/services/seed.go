@@ -0,0 +1,259 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/repositories"
+	"github.com/NikosGour/logging/log"
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// Test data to seed an instance with, read from a YAML or JSON file.
+//
+// Servers and messages refer to users, servers and tabs by name.
+type Fixture struct {
+	Users    []FixtureUser    `json:"users" yaml:"users"`
+	Servers  []FixtureServer  `json:"servers" yaml:"servers"`
+	Messages []FixtureMessage `json:"messages" yaml:"messages"`
+}
+
+type FixtureUser struct {
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+}
+
+// The first member owns the server
+type FixtureServer struct {
+	Name    string   `json:"name" yaml:"name"`
+	Members []string `json:"members" yaml:"members"`
+	Tabs    []string `json:"tabs" yaml:"tabs"`
+}
+
+type FixtureMessage struct {
+	Server string `json:"server" yaml:"server"`
+	Tab    string `json:"tab" yaml:"tab"`
+	Sender string `json:"sender" yaml:"sender"`
+	Text   string `json:"text" yaml:"text"`
+}
+
+// Reads a fixture, the format is picked from the file extension.
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("on ReadFile: %w", err)
+	}
+
+	return parseFixture(path, data)
+}
+
+// Reads a fixture out of fsys, like the ones embedded from db/fixtures.
+func LoadFixtureFS(fsys fs.FS, name string) (*Fixture, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("on ReadFile: %w", err)
+	}
+
+	return parseFixture(name, data)
+}
+
+func parseFixture(path string, data []byte) (*Fixture, error) {
+	var err error
+	f := &Fixture{}
+	switch ext := filepath.Ext(path); ext {
+	case ".json":
+		err = json.Unmarshal(data, f)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, f)
+	default:
+		return nil, fmt.Errorf("unsupported fixture format `%s`, expected .json, .yaml or .yml", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("on Unmarshal(%s): %w", path, err)
+	}
+
+	return f, nil
+}
+
+type SeedService struct {
+	uow repositories.UnitOfWork
+
+	user_service    *UserService
+	server_service  *ServerService
+	tab_service     *TabService
+	message_service *MessageService
+}
+
+func NewSeedService(uow repositories.UnitOfWork, user_service *UserService, server_service *ServerService, tab_service *TabService, message_service *MessageService) *SeedService {
+	s := &SeedService{uow: uow, user_service: user_service, server_service: server_service, tab_service: tab_service, message_service: message_service}
+	return s
+}
+
+// Creates everything in the fixture that doesn't exist yet, flagged as test data.
+//
+// Running it again with the same fixture changes nothing.
+func (s *SeedService) Seed(f *Fixture) error {
+	user_ids := map[string]uuid.UUID{}
+	for _, fu := range f.Users {
+		id, err := s.seedUser(fu)
+		if err != nil {
+			return err
+		}
+		user_ids[fu.Username] = id
+	}
+
+	server_ids := map[string]uuid.UUID{}
+	for _, fixture := range f.Servers {
+		member_ids := []uuid.UUID{}
+		for _, username := range fixture.Members {
+			user_id, ok := user_ids[username]
+			if !ok {
+				return fmt.Errorf("server `%s` lists unknown member `%s`", fixture.Name, username)
+			}
+			member_ids = append(member_ids, user_id)
+		}
+
+		id, err := s.seedServer(fixture, member_ids)
+		if err != nil {
+			return err
+		}
+		server_ids[fixture.Name] = id
+	}
+
+	for _, fm := range f.Messages {
+		server_id, ok := server_ids[fm.Server]
+		if !ok {
+			return fmt.Errorf("message `%s` is in unknown server `%s`", fm.Text, fm.Server)
+		}
+		sender_id, ok := user_ids[fm.Sender]
+		if !ok {
+			return fmt.Errorf("message `%s` has unknown sender `%s`", fm.Text, fm.Sender)
+		}
+
+		err := s.seedMessage(fm, server_id, sender_id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Deletes every user and server flagged as test data.
+// Their memberships, tabs and messages are deleted with them.
+//
+// Returns the number of deleted users and servers.
+func (s *SeedService) PurgeTestData() (int64, int64, error) {
+	users, servers := int64(0), int64(0)
+	err := s.uow.Transaction(func(tx *repositories.Repositories) error {
+		var err error
+		servers, err = tx.Server.DeleteTest()
+		if err != nil {
+			return err
+		}
+
+		users, err = tx.User.DeleteTest()
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return users, servers, nil
+}
+
+func (s *SeedService) seedUser(fu FixtureUser) (uuid.UUID, error) {
+	users, err := s.user_service.GetByTestUsername(fu.Username)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if len(users) != 0 {
+		return users[0].Id, nil
+	}
+
+	id, err := s.user_service.Create(&models.User{Username: fu.Username, DateCreated: time.Now(), IsTest: true}, fu.Password)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	log.Info("seeded user `%s`", fu.Username)
+	return id, nil
+}
+
+func (s *SeedService) seedServer(fixture FixtureServer, member_ids []uuid.UUID) (uuid.UUID, error) {
+	servers, err := s.server_service.GetByTestName(fixture.Name)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	id := uuid.Nil
+	if len(servers) == 0 {
+		if len(member_ids) == 0 {
+			return uuid.Nil, fmt.Errorf("server `%s` has no members, the first one becomes its owner", fixture.Name)
+		}
+		id, err = s.server_service.CreateWithOwner(&models.Server{Name: fixture.Name, DateCreated: time.Now(), IsTest: true}, member_ids[0], member_ids[1:])
+		if err != nil {
+			return uuid.Nil, err
+		}
+		log.Info("seeded server `%s`", fixture.Name)
+	} else {
+		id = servers[0].Id
+		for _, member_id := range member_ids {
+			if slices.ContainsFunc(servers[0].Users, func(u models.User) bool { return u.Id == member_id }) {
+				continue
+			}
+
+			err := s.server_service.AddUserToServer(member_id, id)
+			if err != nil {
+				return uuid.Nil, err
+			}
+		}
+	}
+
+	tabs, err := s.server_service.GetTabs(id)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	for _, name := range fixture.Tabs {
+		if slices.ContainsFunc(tabs, func(t models.Tab) bool { return t.Name == name }) {
+			continue
+		}
+
+		_, err := s.tab_service.Create(&models.Tab{Name: name, ServerId: id, DateCreated: time.Now()})
+		if err != nil {
+			return uuid.Nil, err
+		}
+		log.Info("seeded tab `%s` of server `%s`", name, fixture.Name)
+	}
+
+	return id, nil
+}
+
+func (s *SeedService) seedMessage(fm FixtureMessage, server_id uuid.UUID, sender_id uuid.UUID) error {
+	tabs, err := s.server_service.GetTabs(server_id)
+	if err != nil {
+		return err
+	}
+	idx := slices.IndexFunc(tabs, func(t models.Tab) bool { return t.Name == fm.Tab })
+	if idx == -1 {
+		return fmt.Errorf("message `%s` is in unknown tab `%s` of server `%s`", fm.Text, fm.Tab, fm.Server)
+	}
+	tab := tabs[idx]
+
+	messages, err := s.message_service.GetByTabID(tab.Id)
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(messages, func(m models.Message) bool { return m.Sender.Id == sender_id && m.Text == fm.Text }) {
+		return nil
+	}
+
+	_, err = s.message_service.Create(&models.Message{Text: fm.Text, Sender: &models.User{Id: sender_id}, Tab: &tab, DateSent: time.Now()})
+	return err
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/NikosGour/chatter/db"
+)
+
+const jsonFixture = `{
+	"users": [{"username": "nikos", "password": "123"}, {"username": "maria", "password": "123"}],
+	"servers": [{"name": "Gamiades", "members": ["nikos", "maria"], "tabs": ["General"]}],
+	"messages": [{"server": "Gamiades", "tab": "General", "sender": "nikos", "text": "kalhspera"}]
+}`
+
+const yamlFixture = `
+users:
+  - { username: nikos, password: "123" }
+  - { username: maria, password: "123" }
+servers:
+  - name: Gamiades
+    members: [nikos, maria]
+    tabs: [General]
+messages:
+  - { server: Gamiades, tab: General, sender: nikos, text: kalhspera }
+`
+
+func TestParseFixtureFormats(t *testing.T) {
+	from_json, err := parseFixture("dummy.json", []byte(jsonFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	from_yaml, err := parseFixture("dummy.yaml", []byte(yamlFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(from_json, from_yaml) {
+		t.Fatalf("expected the JSON and YAML fixtures to match\njson: %#v\nyaml: %#v", from_json, from_yaml)
+	}
+	if len(from_json.Users) != 2 || from_json.Servers[0].Members[1] != "maria" || from_json.Messages[0].Text != "kalhspera" {
+		t.Fatalf("unexpected fixture: %#v", from_json)
+	}
+
+	_, err = parseFixture("dummy.toml", []byte(jsonFixture))
+	if err == nil {
+		t.Fatal("expected an error for an unsupported format")
+	}
+	_, err = parseFixture("dummy.json", []byte(yamlFixture))
+	if err == nil {
+		t.Fatal("expected an error for YAML in a .json file")
+	}
+}
+
+func TestEmbeddedFixture(t *testing.T) {
+	f, err := LoadFixtureFS(db.FS, db.DummyFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Users) == 0 || len(f.Servers) == 0 || len(f.Messages) == 0 {
+		t.Fatalf("expected the dummy fixture to have users, servers and messages, got: %#v", f)
+	}
+}
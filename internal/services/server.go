@@ -3,22 +3,32 @@ package services
 import (
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/NikosGour/chatter/internal/blob"
 	"github.com/NikosGour/chatter/internal/models"
 	"github.com/NikosGour/chatter/internal/repositories"
 	"github.com/NikosGour/logging/log"
 	"github.com/google/uuid"
 )
 
+const (
+	DefaultTabName = "General"
+)
+
 type ServerService struct {
 	server_repo repositories.ServerRepository
+	uow         repositories.UnitOfWork
+	blobs       blob.Store
 
 	user_service *UserService
 	tab_service  *TabService
 }
 
-func NewServerService(server_repo repositories.ServerRepository, user_service *UserService, tab_service *TabService) *ServerService {
-	s := &ServerService{server_repo: server_repo, user_service: user_service, tab_service: tab_service}
+func NewServerService(server_repo repositories.ServerRepository, uow repositories.UnitOfWork, blobs blob.Store, user_service *UserService, tab_service *TabService) *ServerService {
+	s := &ServerService{server_repo: server_repo, uow: uow, blobs: blobs, user_service: user_service, tab_service: tab_service}
 	return s
 }
 
@@ -107,6 +117,65 @@ func (s *ServerService) Create(server *models.Server) (uuid.UUID, error) {
 
 }
 
+// Creates a server owned by owner_id, along with its members and a default General tab.
+//
+// Either everything is created or, on any error, nothing is.
+// Returns the UUID of the created server.
+// Might return ErrUserNotFound, ErrServerAlreadyExists or any other sql error
+func (s *ServerService) CreateWithOwner(server *models.Server, owner_id uuid.UUID, member_ids []uuid.UUID) (uuid.UUID, error) {
+	id, err := s.generateUUID()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	tab_id, err := s.tab_service.generateUUID()
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	server.Id = id
+	if server.DateCreated.IsZero() {
+		server.DateCreated = time.Now()
+	}
+	server_dbo := ServerToDBO(server)
+	tab := &models.Tab{Id: tab_id, Name: DefaultTabName, ServerId: id, DateCreated: time.Now()}
+
+	err = s.uow.Transaction(func(tx *repositories.Repositories) error {
+		_, err := tx.Server.Create(server_dbo)
+		if err != nil {
+			return err
+		}
+
+		roles := map[uuid.UUID]models.Role{owner_id: models.RoleOwner}
+		user_ids := []uuid.UUID{owner_id}
+		for _, member_id := range member_ids {
+			if _, ok := roles[member_id]; !ok {
+				roles[member_id] = models.RoleMember
+				user_ids = append(user_ids, member_id)
+			}
+		}
+
+		for _, user_id := range user_ids {
+			_, err := tx.User.GetByID(user_id)
+			if err != nil {
+				return err
+			}
+
+			err = tx.Server.AddUserToServer(user_id, id, roles[user_id])
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Tab.Create(TabToDBO(tab))
+		return err
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return id, nil
+}
+
 // Adds a the user of the given UUID to the list of subscribed users of the server
 //
 // Might return ErrServerNotFound or any other sql error
@@ -121,28 +190,216 @@ func (s *ServerService) AddUserToServer(user_id uuid.UUID, server_id uuid.UUID)
 		return err
 	}
 
-	return s.server_repo.AddUserToServer(user_id, server_id)
+	return s.server_repo.AddUserToServer(user_id, server_id, models.RoleMember)
+}
+
+// Adds the user to the server on behalf of actor_id, moderators and owners only
+//
+// Might return ErrServerNotFound, ErrNotServerMember, ErrInsufficientRole, ErrUserNotFound or any other sql error
+func (s *ServerService) AddUserToServerAs(user_id uuid.UUID, server_id uuid.UUID, actor_id uuid.UUID) error {
+	err := s.Authorize(server_id, actor_id, models.RoleModerator)
+	if err != nil {
+		return err
+	}
+
+	return s.AddUserToServer(user_id, server_id)
+}
+
+// Removes the user of the given UUID from the members of the server, the owner can't be removed
+//
+// Might return ErrServerNotFound, ErrNotServerMember, ErrCannotRemoveOwner or any other sql error
+func (s *ServerService) RemoveUserFromServer(user_id uuid.UUID, server_id uuid.UUID) error {
+	return s.uow.Transaction(func(tx *repositories.Repositories) error {
+		_, err := tx.Server.GetByID(server_id)
+		if err != nil {
+			return err
+		}
+
+		role, err := tx.Server.GetRole(server_id, user_id)
+		if err != nil {
+			return err
+		}
+		if role == models.RoleOwner {
+			return fmt.Errorf("%w:server_id=%s,user_id=%s", models.ErrCannotRemoveOwner, server_id, user_id)
+		}
+
+		return tx.Server.RemoveUserFromServer(user_id, server_id)
+	})
+}
+
+// Renames a server, moderators and owners only.
+//
+// Returns the updated server.
+// Might return ErrServerNotFound, ErrNotServerMember, ErrInsufficientRole, ErrServerAlreadyExists or any other sql error
+func (s *ServerService) Update(id uuid.UUID, user_id uuid.UUID, patch *models.ServerPatch) (*models.Server, error) {
+	err := s.Authorize(id, user_id, models.RoleModerator)
+	if err != nil {
+		return nil, err
+	}
+
+	server_dbo, err := s.server_repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	server_dbo.Name = patch.Name
+
+	err = s.server_repo.Update(server_dbo)
+	if err != nil {
+		return nil, err
+	}
+	return s.toServer(*server_dbo)
+}
+
+// Deletes a server along with its memberships, tabs and messages, owners only.
+//
+// Returns the deleted server, with the members it had.
+// Might return ErrServerNotFound, ErrNotServerMember, ErrInsufficientRole or any other sql error
+func (s *ServerService) Delete(id uuid.UUID, user_id uuid.UUID) (*models.Server, error) {
+	err := s.Authorize(id, user_id, models.RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// The tabs and their messages go with the server, their attachments' blobs are removed once they are gone
+	var attachments []repositories.AttachmentDBO
+	err = s.uow.Transaction(func(tx *repositories.Repositories) error {
+		attachments, err = tx.Attachment.GetByServerID(id)
+		if err != nil {
+			return err
+		}
+		return tx.Server.Delete(id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	deleteAttachmentBlobs(s.blobs, attachments)
+	return server, nil
+}
+
+// Checks that the user is a member of the server with at least the given role.
+//
+// Might return ErrServerNotFound, ErrNotServerMember, ErrInsufficientRole or any other sql error
+func (s *ServerService) Authorize(server_id uuid.UUID, user_id uuid.UUID, role models.Role) error {
+	return authorize(s.server_repo, server_id, user_id, role)
+}
+
+func authorize(server_repo repositories.ServerRepository, server_id uuid.UUID, user_id uuid.UUID, role models.Role) error {
+	_, err := server_repo.GetByID(server_id)
+	if err != nil {
+		return err
+	}
+
+	user_role, err := server_repo.GetRole(server_id, user_id)
+	if err != nil {
+		return err
+	}
+	if !user_role.AtLeast(role) {
+		return fmt.Errorf("%w:has=%s,needs=%s", models.ErrInsufficientRole, user_role, role)
+	}
+	return nil
+}
+
+// Get the membership of a user in a server, without the user's password
+//
+// Might return ErrNotServerMember, ErrUserNotFound or any other sql error
+func (s *ServerService) GetMember(server_id uuid.UUID, user_id uuid.UUID) (*models.Member, error) {
+	members, err := s.server_repo.GetMembers(server_id)
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(members, func(m repositories.MemberDBO) bool { return m.UserId == user_id })
+	if i < 0 {
+		return nil, fmt.Errorf("%w:server_id=%s,user_id=%s", models.ErrNotServerMember, server_id, user_id)
+	}
+
+	user, err := s.user_service.GetByID(user_id)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = ""
+	user.Nickname = members[i].Nickname
+
+	return &models.Member{ServerId: server_id, User: *user, Role: members[i].Role}, nil
+}
+
+// Get every membership of a server, without the users' passwords
+//
+// Might return ErrUserNotFound or any other sql error
+func (s *ServerService) GetMembers(server_id uuid.UUID) ([]models.Member, error) {
+	member_dbos, err := s.server_repo.GetMembers(server_id)
+	if err != nil {
+		return nil, err
+	}
+
+	members := []models.Member{}
+	for _, member_dbo := range member_dbos {
+		user, err := s.user_service.GetByID(member_dbo.UserId)
+		if err != nil {
+			return nil, err
+		}
+		user.Password = ""
+		user.Nickname = member_dbo.Nickname
+		members = append(members, models.Member{ServerId: server_id, User: *user, Role: member_dbo.Role})
+	}
+	return members, nil
+}
+
+// Sets the nickname of the user in a server, an empty nickname clears it.
+//
+// Returns the updated membership.
+// Might return ErrServerNotFound, ErrNotServerMember or any other sql error
+func (s *ServerService) SetNickname(server_id uuid.UUID, user_id uuid.UUID, update *models.NicknameUpdate) (*models.Member, error) {
+	err := s.Authorize(server_id, user_id, models.RoleMember)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.server_repo.SetNickname(server_id, user_id, strings.TrimSpace(update.Nickname))
+	if err != nil {
+		return nil, err
+	}
+	return s.GetMember(server_id, user_id)
+}
+
+// Get the UUIDs of the members of a server
+//
+// Might return any sql error
+func (s *ServerService) GetUserIds(server_id uuid.UUID) ([]uuid.UUID, error) {
+	return s.server_repo.GetUsers(server_id)
+}
+
+// Get the UUIDs of every user that shares a server with the user, the user included
+//
+// Might return any sql error
+func (s *ServerService) GetCoMembers(user_id uuid.UUID) ([]uuid.UUID, error) {
+	return s.server_repo.GetCoMembers(user_id)
 }
 
 // Get all the user UUIDs from a Server's user list
 //
 // Might return ErrServerHasNoUsers or any other sql error
 func (s *ServerService) GetUsers(server_id uuid.UUID) ([]models.User, error) {
-	user_ids, err := s.server_repo.GetUsers(server_id)
+	members, err := s.server_repo.GetMembers(server_id)
 	if err != nil {
 		return nil, err
 	}
 
 	users := []models.User{}
-	for _, user_id := range user_ids {
-		user_dbo, err := s.user_service.GetByID(user_id)
+	for _, member := range members {
+		user_dbo, err := s.user_service.GetByID(member.UserId)
 		if err != nil {
 			if errors.Is(err, models.ErrUserNotFound) {
-				log.Warn("while getting users for Server: %s, tried to get missing user: %s", server_id, user_id)
+				log.Warn("while getting users for Server: %s, tried to get missing user: %s", server_id, member.UserId)
 			}
 			return nil, err
 		}
 		user := s.user_service.ToUser(user_dbo)
+		user.Nickname = member.Nickname
 		users = append(users, *user)
 	}
 	return users, nil
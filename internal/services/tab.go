@@ -3,18 +3,23 @@ package services
 import (
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/NikosGour/chatter/internal/blob"
 	"github.com/NikosGour/chatter/internal/models"
 	"github.com/NikosGour/chatter/internal/repositories"
 	"github.com/google/uuid"
 )
 
 type TabService struct {
-	tab_repo repositories.TabRepository
+	tab_repo    repositories.TabRepository
+	server_repo repositories.ServerRepository
+	uow         repositories.UnitOfWork
+	blobs       blob.Store
 }
 
-func NewTabService(tab_repo repositories.TabRepository) *TabService {
-	s := &TabService{tab_repo: tab_repo}
+func NewTabService(tab_repo repositories.TabRepository, server_repo repositories.ServerRepository, uow repositories.UnitOfWork, blobs blob.Store) *TabService {
+	s := &TabService{tab_repo: tab_repo, server_repo: server_repo, uow: uow, blobs: blobs}
 	return s
 }
 
@@ -78,11 +83,100 @@ func (s *TabService) Create(tab *models.Tab) (uuid.UUID, error) {
 		return uuid.Nil, err
 	}
 	tab.Id = id
+	if tab.DateCreated.IsZero() {
+		tab.DateCreated = time.Now()
+	}
 
 	tab_dbo := TabToDBO(tab)
 	return s.tab_repo.Create(tab_dbo)
 }
 
+// Creates a tab in its server, moderators and owners of the server only.
+//
+// Returns the UUID of the created tab.
+// Might return ErrServerNotFound, ErrNotServerMember, ErrInsufficientRole or any other sql error
+func (s *TabService) CreateAs(tab *models.Tab, user_id uuid.UUID) (uuid.UUID, error) {
+	err := authorize(s.server_repo, tab.ServerId, user_id, models.RoleModerator)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return s.Create(tab)
+}
+
+// Checks that the user is a member of the tab's server with at least the given role.
+//
+// Returns the tab.
+// Might return ErrTabNotFound, ErrNotServerMember, ErrInsufficientRole or any other sql error
+func (s *TabService) Authorize(id uuid.UUID, user_id uuid.UUID, role models.Role) (*models.Tab, error) {
+	tab, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	err = authorize(s.server_repo, tab.ServerId, user_id, role)
+	if err != nil {
+		return nil, err
+	}
+	return tab, nil
+}
+
+// Renames a tab or changes its slow mode, moderators and owners of its server only.
+//
+// Returns the updated tab.
+// Might return ErrTabNotFound, ErrNotServerMember, ErrInsufficientRole or any other sql error
+func (s *TabService) Update(id uuid.UUID, user_id uuid.UUID, patch *models.TabPatch) (*models.Tab, error) {
+	tab, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	err = authorize(s.server_repo, tab.ServerId, user_id, models.RoleModerator)
+	if err != nil {
+		return nil, err
+	}
+
+	if patch.Name != nil {
+		tab.Name = *patch.Name
+	}
+	if patch.SlowMode != nil {
+		tab.SlowMode = *patch.SlowMode
+	}
+	err = s.tab_repo.Update(TabToDBO(tab))
+	if err != nil {
+		return nil, err
+	}
+	return tab, nil
+}
+
+// Deletes a tab along with its messages, moderators and owners of its server only.
+//
+// Returns the deleted tab.
+// Might return ErrTabNotFound, ErrNotServerMember, ErrInsufficientRole or any other sql error
+func (s *TabService) Delete(id uuid.UUID, user_id uuid.UUID) (*models.Tab, error) {
+	tab, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	err = authorize(s.server_repo, tab.ServerId, user_id, models.RoleModerator)
+	if err != nil {
+		return nil, err
+	}
+
+	// The messages go with the tab, their attachments' blobs are removed once they are gone
+	var attachments []repositories.AttachmentDBO
+	err = s.uow.Transaction(func(tx *repositories.Repositories) error {
+		attachments, err = tx.Attachment.GetByTabID(id)
+		if err != nil {
+			return err
+		}
+		return tx.Tab.Delete(id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	deleteAttachmentBlobs(s.blobs, attachments)
+	return tab, nil
+}
+
 func (s *TabService) ToTab(tab_dbo *repositories.TabDBO) *models.Tab {
 	return tab_dbo
 }
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/blob"
+	"github.com/NikosGour/chatter/internal/media"
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/repositories"
+	"github.com/NikosGour/logging/log"
+)
+
+const (
+	// Messages waiting for their previews, more are picked up on the next start
+	thumbnailQueueSize = 256
+)
+
+// Background worker that makes the previews of image attachments.
+//
+// Every image gets its displayed size and a thumbnail, or is marked as processed
+// without them when it can't be decoded, then the message is pushed again as message.update.
+type ThumbnailService struct {
+	attachment_repo repositories.AttachmentRepository
+	blobs           blob.Store
+
+	conn_manager *ConnManager
+
+	queue chan int64
+	// Closed to stop Run, which closes done once it returns
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewThumbnailService(attachment_repo repositories.AttachmentRepository, blobs blob.Store, conn_manager *ConnManager) *ThumbnailService {
+	s := &ThumbnailService{attachment_repo: attachment_repo, blobs: blobs, conn_manager: conn_manager, queue: make(chan int64, thumbnailQueueSize), stop: make(chan struct{}), done: make(chan struct{})}
+	return s
+}
+
+// Queues the images of a message for processing, never blocks.
+func (s *ThumbnailService) Enqueue(message_id int64) {
+	select {
+	case s.queue <- message_id:
+	default:
+		log.Warn("thumbnail queue is full, message %d will be processed on the next start", message_id)
+	}
+}
+
+// Processes the images left over from the last run, then every queued message until Stop is called.
+func (s *ThumbnailService) Run() {
+	defer close(s.done)
+
+	pending, err := s.attachment_repo.GetUnprocessedImages()
+	if err != nil {
+		log.Error("could not find unprocessed images: %s", err)
+	}
+	message_ids := []int64{}
+	for _, a := range pending {
+		if len(message_ids) == 0 || message_ids[len(message_ids)-1] != a.MessageId {
+			message_ids = append(message_ids, a.MessageId)
+		}
+	}
+	for _, message_id := range message_ids {
+		if s.stopped() {
+			return
+		}
+		s.process(message_id)
+	}
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case message_id := <-s.queue:
+			s.process(message_id)
+		}
+	}
+}
+
+// Stops Run after the message it's on, the queued ones are processed on the next start.
+//
+// Returns ctx's error if Run doesn't stop in time
+func (s *ThumbnailService) Stop(ctx context.Context) error {
+	close(s.stop)
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *ThumbnailService) stopped() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *ThumbnailService) process(message_id int64) {
+	attachments, err := s.attachment_repo.GetByMessageID(message_id)
+	if err != nil {
+		log.Error("could not find the attachments of message %d: %s", message_id, err)
+		return
+	}
+
+	processed := false
+	for _, a := range attachments {
+		if a.DateProcessed != nil || !media.IsImage(a.ContentType) {
+			continue
+		}
+
+		err := s.preview(&a)
+		if err != nil {
+			log.Warn("no preview for attachment %s: %s", a.Id, err)
+		}
+
+		now := time.Now()
+		a.DateProcessed = &now
+		err = s.attachment_repo.UpdatePreview(&a)
+		if err != nil {
+			// Deleted while its thumbnail was made, nothing else would remove the thumbnail
+			if errors.Is(err, models.ErrAttachmentNotFound) {
+				deleteAttachmentBlobs(s.blobs, []models.Attachment{a})
+				continue
+			}
+			log.Error("could not record the preview of attachment %s: %s", a.Id, err)
+			continue
+		}
+		processed = true
+	}
+
+	if processed {
+		s.conn_manager.PublishMessageUpdate(message_id)
+	}
+}
+
+// Stores the thumbnail of an image and sets its size
+func (s *ThumbnailService) preview(a *models.Attachment) error {
+	r, err := s.blobs.Get(attachmentKey(a.Id))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(io.LimitReader(r, models.MaxAttachmentSize+1))
+	if err != nil {
+		return fmt.Errorf("on reading blob: %w", err)
+	}
+
+	p, err := media.Thumbnail(data, a.ContentType)
+	if err != nil {
+		return err
+	}
+
+	err = s.blobs.Put(thumbnailKey(a.Id), bytes.NewReader(p.Thumbnail), int64(len(p.Thumbnail)), media.ThumbnailType(a.ContentType))
+	if err != nil {
+		return err
+	}
+
+	a.Width, a.Height, a.HasThumbnail = &p.Width, &p.Height, true
+	return nil
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// How long a typing event lasts unless it is sent again
+	TypingExpiry = 5 * time.Second
+	// Minimum time between two typing events of the same user in the same tab
+	TypingThrottle = 3 * time.Second
+)
+
+// Throttles typing indicators, kept in memory only.
+type TypingService struct {
+	mu   sync.Mutex
+	last map[typingKey]time.Time
+}
+
+type typingKey struct {
+	user_id uuid.UUID
+	tab_id  uuid.UUID
+}
+
+func NewTypingService() *TypingService {
+	s := &TypingService{last: make(map[typingKey]time.Time)}
+	return s
+}
+
+// Records that the user is typing in the tab.
+//
+// Returns when the indicator expires, reports false when the user
+// already started typing there less than TypingThrottle ago.
+func (s *TypingService) Start(user_id uuid.UUID, tab_id uuid.UUID) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, last := range s.last {
+		if now.Sub(last) >= TypingThrottle {
+			delete(s.last, key)
+		}
+	}
+
+	key := typingKey{user_id: user_id, tab_id: tab_id}
+	if _, ok := s.last[key]; ok {
+		return time.Time{}, false
+	}
+	s.last[key] = now
+	return now.Add(TypingExpiry), true
+}
+
+// Forgets that the user is typing in the tab, e.g. once their message is sent.
+func (s *TypingService) Stop(user_id uuid.UUID, tab_id uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.last, typingKey{user_id: user_id, tab_id: tab_id})
+}
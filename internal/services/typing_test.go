@@ -0,0 +1,47 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestTypingThrottle(t *testing.T) {
+	s := NewTypingService()
+	user_id, tab_id, other_tab_id := uuid.New(), uuid.New(), uuid.New()
+
+	_, ok := s.Start(user_id, tab_id)
+	if !ok {
+		t.Fatal("expected the first start to be pushed")
+	}
+	_, ok = s.Start(user_id, tab_id)
+	if ok {
+		t.Fatal("expected a start within TypingThrottle to be dropped")
+	}
+	_, ok = s.Start(user_id, other_tab_id)
+	if !ok {
+		t.Fatal("expected the throttle to be per tab")
+	}
+
+	// As if the first start happened TypingThrottle ago
+	s.mu.Lock()
+	s.last[typingKey{user_id: user_id, tab_id: tab_id}] = time.Now().Add(-TypingThrottle)
+	s.mu.Unlock()
+	expires_at, ok := s.Start(user_id, tab_id)
+	if !ok {
+		t.Fatal("expected a start after TypingThrottle to be pushed")
+	}
+	if until := time.Until(expires_at); until <= TypingExpiry-time.Second || until > TypingExpiry {
+		t.Fatalf("expected the indicator to expire in %s, got %s", TypingExpiry, until)
+	}
+	if len(s.last) != 2 {
+		t.Fatalf("expected one entry per tab, got %d", len(s.last))
+	}
+
+	s.Stop(user_id, tab_id)
+	_, ok = s.Start(user_id, tab_id)
+	if !ok {
+		t.Fatal("expected a start after Stop to be pushed")
+	}
+}
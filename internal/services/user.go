@@ -4,17 +4,25 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/NikosGour/chatter/internal/blob"
+	"github.com/NikosGour/chatter/internal/common"
 	"github.com/NikosGour/chatter/internal/models"
 	"github.com/NikosGour/chatter/internal/repositories"
+	"github.com/NikosGour/logging/log"
 	"github.com/google/uuid"
 )
 
 type UserService struct {
 	user_repo repositories.UserRepository
+	uow       repositories.UnitOfWork
+	blobs     blob.Store
+
+	// Avatars are downloaded from avatar_url/<id>
+	avatar_url string
 }
 
-func NewUserService(user_repo repositories.UserRepository) *UserService {
-	s := &UserService{user_repo: user_repo}
+func NewUserService(user_repo repositories.UserRepository, uow repositories.UnitOfWork, blobs blob.Store, avatar_url string) *UserService {
+	s := &UserService{user_repo: user_repo, uow: uow, blobs: blobs, avatar_url: avatar_url}
 	return s
 }
 
@@ -71,18 +79,193 @@ func (s *UserService) GetByTestUsername(username string) ([]models.User, error)
 	return us, nil
 }
 
-func (s *UserService) Create(user *models.User) (uuid.UUID, error) {
+// Inserts a user, only the hash of the password is stored.
+//
+// Might return ErrInvalidBody, ErrUserAlreadyExists or any other sql error
+func (s *UserService) Create(user *models.User, password string) (uuid.UUID, error) {
 	id, err := s.generateUUID()
 	if err != nil {
 		return uuid.Nil, err
 	}
 	user.Id = id
 
+	user.Password, err = common.HashPassword(password)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
 	udbo := userToDBO(user)
 	return s.user_repo.Create(udbo)
 }
 
+// Finds the user the credentials belong to.
+//
+// Might return ErrWrongCredentials, ErrUserDisabled or any other sql error
+func (s *UserService) Authenticate(credentials *models.Credentials) (*models.User, error) {
+	udbos, err := s.user_repo.GetByUsername(credentials.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, udbo := range udbos {
+		if common.CheckPassword(udbo.Password, credentials.Password) {
+			if udbo.Disabled {
+				return nil, fmt.Errorf("%w:%s", models.ErrUserDisabled, udbo.Id)
+			}
+			return s.ToUser(&udbo), nil
+		}
+	}
+	return nil, models.ErrWrongCredentials
+}
+
+// Applies the fields set in the patch to the user, a new password is hashed
+// and ends every session of the user.
+//
+// Returns the updated user, with the session version sessions are issued at from then on.
+// Might return ErrInvalidBody, ErrUserNotFound, ErrUserAlreadyExists or any other sql error
+func (s *UserService) Update(id uuid.UUID, patch *models.UserPatch) (*models.User, error) {
+	user, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if patch.Username != nil {
+		user.Username = *patch.Username
+	}
+	if patch.Password != nil {
+		user.Password, err = common.HashPassword(*patch.Password)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if patch.HideReadReceipts != nil {
+		user.HideReadReceipts = *patch.HideReadReceipts
+	}
+
+	err = s.uow.Transaction(func(tx *repositories.Repositories) error {
+		err := tx.User.Update(userToDBO(user))
+		if err != nil {
+			return err
+		}
+		if patch.Password != nil {
+			user.SessionVersion, err = tx.User.RevokeSessions(id)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Ends every session of the user.
+//
+// Might return ErrUserNotFound or any other sql error
+func (s *UserService) RevokeSessions(id uuid.UUID) error {
+	_, err := s.user_repo.RevokeSessions(id)
+	return err
+}
+
+// Disables a user or enables them again.
+//
+// Returns the updated user.
+// Might return ErrUserNotFound or any other sql error
+func (s *UserService) SetDisabled(id uuid.UUID, disabled bool) (*models.User, error) {
+	user, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Disabled = disabled
+	err = s.user_repo.Update(userToDBO(user))
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Checks that the user still exists and hasn't been disabled, sessions outlive both.
+//
+// Might return ErrUserNotFound, ErrUserDisabled or any other sql error
+func (s *UserService) CheckActive(id uuid.UUID) error {
+	_, err := s.active(id)
+	return err
+}
+
+// Checks that the session's user is active and that the session hasn't been revoked since it was issued,
+// by a password change or a logout.
+//
+// Might return ErrUnauthorized, ErrUserNotFound, ErrUserDisabled or any other sql error
+func (s *UserService) CheckSession(session *common.Session) error {
+	user, err := s.active(session.UserId)
+	if err != nil {
+		return err
+	}
+	if user.SessionVersion != session.Version {
+		return fmt.Errorf("%w:session_version=%d,user_session_version=%d", common.ErrUnauthorized, session.Version, user.SessionVersion)
+	}
+	return nil
+}
+
+func (s *UserService) active(id uuid.UUID) (*models.User, error) {
+	user, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, fmt.Errorf("%w:%s", models.ErrUserDisabled, id)
+	}
+	return user, nil
+}
+
+// Deletes a user along with their memberships and messages.
+// Users that still own servers can't be deleted.
+// The blobs of their avatar and attachments are removed once they are gone.
+//
+// Might return ErrUserNotFound, ErrUserOwnsServers or any other sql error
+func (s *UserService) Delete(id uuid.UUID) error {
+	var avatar_id *uuid.UUID
+	var attachments []repositories.AttachmentDBO
+	err := s.uow.Transaction(func(tx *repositories.Repositories) error {
+		memberships, err := tx.Server.GetMemberships(id)
+		if err != nil {
+			return err
+		}
+		for _, m := range memberships {
+			if m.Role == models.RoleOwner {
+				return fmt.Errorf("%w:server_id=%s", models.ErrUserOwnsServers, m.ServerId)
+			}
+		}
+
+		user, err := tx.User.GetByID(id)
+		if err != nil {
+			return err
+		}
+		avatar_id = user.AvatarId
+		attachments, err = tx.Attachment.GetBySenderID(id)
+		if err != nil {
+			return err
+		}
+		return tx.User.Delete(id)
+	})
+	if err != nil {
+		return err
+	}
+
+	deleteAttachmentBlobs(s.blobs, attachments)
+	if avatar_id != nil {
+		err = s.blobs.Delete(avatarKey(*avatar_id))
+		if err != nil {
+			log.Error("on deleting avatar `%s`: %s", *avatar_id, err)
+		}
+	}
+	return nil
+}
+
 func (s *UserService) ToUser(udb *repositories.UserDBO) *models.User {
+	if udb.AvatarId != nil {
+		udb.AvatarUrl = s.avatar_url + "/" + udb.AvatarId.String()
+	}
 	return udb
 }
 func userToDBO(u *models.User) *repositories.UserDBO {
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/google/uuid"
+)
+
+// In-memory backend, intended for tests and throwaway instances.
+// Every repository built on the same MemoryStorage shares its tables.
+type MemoryStorage struct {
+	Mu sync.RWMutex
+
+	Users         map[uuid.UUID]models.User
+	Servers       map[uuid.UUID]models.Server
+	ServerMembers map[uuid.UUID][]MemoryMember
+	Tabs          map[uuid.UUID]models.Tab
+	Messages      map[int64]MemoryMessage
+	ReadStates    map[MemoryReadStateKey]int64
+	Attachments   map[uuid.UUID]models.Attachment
+	RateLimits    map[string]int64
+
+	LastMessageId int64
+}
+
+// Row of the server_members table, keyed by server
+type MemoryMember struct {
+	UserId   uuid.UUID
+	Role     models.Role
+	Nickname string
+}
+
+// Primary key of the read_states table, the value is the last read message id
+type MemoryReadStateKey struct {
+	UserId uuid.UUID
+	TabId  uuid.UUID
+}
+
+// Row of the messages table, mirrors the columns of db/create_messages.sql
+type MemoryMessage struct {
+	Id       int64
+	Text     string
+	SenderId uuid.UUID
+	TabId    uuid.UUID
+	DateSent time.Time
+
+	// The users of its rows in message_mentions
+	Mentions []uuid.UUID
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	m := &MemoryStorage{
+		Users:         make(map[uuid.UUID]models.User),
+		Servers:       make(map[uuid.UUID]models.Server),
+		ServerMembers: make(map[uuid.UUID][]MemoryMember),
+		Tabs:          make(map[uuid.UUID]models.Tab),
+		Messages:      make(map[int64]MemoryMessage),
+		ReadStates:    make(map[MemoryReadStateKey]int64),
+		Attachments:   make(map[uuid.UUID]models.Attachment),
+		RateLimits:    make(map[string]int64),
+	}
+	return m
+}
+
+func (m *MemoryStorage) Ping() error {
+	return nil
+}
+
+func (m *MemoryStorage) Close() error {
+	return nil
+}
+
+// Runs fn against a view of the store that keeps it locked for the whole call.
+//
+// If fn returns an error every change it made is undone, except for the
+// message id counter, which like a sql sequence is never rolled back.
+func (m *MemoryStorage) Transact(fn func(tx *MemoryStorage) error) error {
+	m.Mu.Lock()
+	defer m.Mu.Unlock()
+
+	snapshot := m.clone()
+	tx := &MemoryStorage{
+		Users:         m.Users,
+		Servers:       m.Servers,
+		ServerMembers: m.ServerMembers,
+		Tabs:          m.Tabs,
+		Messages:      m.Messages,
+		ReadStates:    m.ReadStates,
+		Attachments:   m.Attachments,
+		RateLimits:    m.RateLimits,
+		LastMessageId: m.LastMessageId,
+	}
+
+	err := fn(tx)
+	if err != nil {
+		m.Users = snapshot.Users
+		m.Servers = snapshot.Servers
+		m.ServerMembers = snapshot.ServerMembers
+		m.Tabs = snapshot.Tabs
+		m.Messages = snapshot.Messages
+		m.ReadStates = snapshot.ReadStates
+		m.Attachments = snapshot.Attachments
+		m.RateLimits = snapshot.RateLimits
+	}
+	m.LastMessageId = tx.LastMessageId
+
+	return err
+}
+
+// Must be called with the lock held
+func (m *MemoryStorage) clone() *MemoryStorage {
+	c := &MemoryStorage{
+		Users:         maps.Clone(m.Users),
+		Servers:       maps.Clone(m.Servers),
+		ServerMembers: make(map[uuid.UUID][]MemoryMember, len(m.ServerMembers)),
+		Tabs:          maps.Clone(m.Tabs),
+		Messages:      maps.Clone(m.Messages),
+		ReadStates:    maps.Clone(m.ReadStates),
+		Attachments:   maps.Clone(m.Attachments),
+		RateLimits:    maps.Clone(m.RateLimits),
+		LastMessageId: m.LastMessageId,
+	}
+	for server_id, members := range m.ServerMembers {
+		c.ServerMembers[server_id] = slices.Clone(members)
+	}
+	return c
+}
+
+// Deletes a user and, like ON DELETE CASCADE, their memberships, messages and read states.
+//
+// Must be called with the lock held
+func (m *MemoryStorage) DeleteUser(id uuid.UUID) {
+	delete(m.Users, id)
+	for server_id, members := range m.ServerMembers {
+		m.ServerMembers[server_id] = slices.DeleteFunc(members, func(member MemoryMember) bool { return member.UserId == id })
+	}
+	m.deleteMessages(func(msg MemoryMessage) bool { return msg.SenderId == id })
+	maps.DeleteFunc(m.ReadStates, func(key MemoryReadStateKey, _ int64) bool { return key.UserId == id })
+}
+
+// Deletes a server and, like ON DELETE CASCADE, its memberships, tabs and their messages.
+//
+// Must be called with the lock held
+func (m *MemoryStorage) DeleteServer(id uuid.UUID) {
+	delete(m.Servers, id)
+	delete(m.ServerMembers, id)
+	for tab_id, tab := range m.Tabs {
+		if tab.ServerId == id {
+			m.DeleteTab(tab_id)
+		}
+	}
+}
+
+// Deletes a tab and, like ON DELETE CASCADE, its messages and read states.
+//
+// Must be called with the lock held
+func (m *MemoryStorage) DeleteTab(id uuid.UUID) {
+	delete(m.Tabs, id)
+	m.deleteMessages(func(msg MemoryMessage) bool { return msg.TabId == id })
+	maps.DeleteFunc(m.ReadStates, func(key MemoryReadStateKey, _ int64) bool { return key.TabId == id })
+}
+
+// Deletes the matching messages and, like ON DELETE CASCADE, their attachments.
+//
+// Must be called with the lock held
+func (m *MemoryStorage) deleteMessages(del func(msg MemoryMessage) bool) {
+	maps.DeleteFunc(m.Messages, func(_ int64, msg MemoryMessage) bool { return del(msg) })
+	maps.DeleteFunc(m.Attachments, func(_ uuid.UUID, a models.Attachment) bool {
+		_, ok := m.Messages[a.MessageId]
+		return !ok
+	})
+}
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/logging/log"
+	"github.com/jmoiron/sqlx"
+)
+
+// Migrations that can't be written in SQL valid for both PostgreSQL and sqlite.
+// They are ordered along with the files in db/migrations by their version.
+var codeMigrations = map[string]func(tx *sqlx.Tx) error{
+	"0009_hash_passwords": hashPasswords,
+	"0011_parse_mentions": parseMentions,
+}
+
+// Replaces the passwords stored before they were hashed by their bcrypt hash
+func hashPasswords(tx *sqlx.Tx) error {
+	users := []struct {
+		Id       string `db:"id"`
+		Password string `db:"password"`
+	}{}
+	err := tx.Select(&users, `SELECT id, password FROM users;`)
+	if err != nil {
+		return fmt.Errorf("on Select(users): %w", err)
+	}
+
+	for _, u := range users {
+		if common.IsPasswordHash(u.Password) {
+			continue
+		}
+		hash, err := common.HashPassword(u.Password)
+		if err != nil {
+			return fmt.Errorf("on HashPassword of user %s: %w", u.Id, err)
+		}
+		_, err = tx.Exec(tx.Rebind(`UPDATE users SET password = ? WHERE id = ?;`), hash, u.Id)
+		if err != nil {
+			return fmt.Errorf("on Update(users): %w", err)
+		}
+	}
+	return nil
+}
+
+// Fills message_mentions for the messages sent before it existed,
+// when mentions were counted by matching the text in sql
+func parseMentions(tx *sqlx.Tx) error {
+	messages := []struct {
+		Id       int64  `db:"id"`
+		Text     string `db:"text"`
+		ServerId string `db:"server_id"`
+	}{}
+	err := tx.Select(&messages, `SELECT m.id, m."text", t.server_id FROM messages m JOIN tabs t ON t.id = m.tab_id WHERE m."text" LIKE '%@%';`)
+	if err != nil {
+		return fmt.Errorf("on Select(messages): %w", err)
+	}
+
+	type member struct {
+		UserId   string `db:"user_id"`
+		Username string `db:"username"`
+	}
+	members := map[string][]member{}
+	for _, m := range messages {
+		if _, ok := members[m.ServerId]; !ok {
+			server_members := []member{}
+			err := tx.Select(&server_members, tx.Rebind(`SELECT sm.user_id, u.username FROM server_members sm JOIN users u ON u.id = sm.user_id WHERE sm.server_id = ?;`), m.ServerId)
+			if err != nil {
+				return fmt.Errorf("on Select(server_members) of server %s: %w", m.ServerId, err)
+			}
+			members[m.ServerId] = server_members
+		}
+
+		for _, u := range members[m.ServerId] {
+			if !models.Mentions(m.Text, u.Username) {
+				continue
+			}
+			_, err := tx.Exec(tx.Rebind(`INSERT INTO message_mentions (message_id, user_id) VALUES (?, ?) ON CONFLICT DO NOTHING;`), m.Id, u.UserId)
+			if err != nil {
+				return fmt.Errorf("on Insert(message_mentions): %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Applies the schema changes in db/migrations that haven't been applied yet.
+//
+// They run after the create_*.sql files, in file name order, each in its own
+// transaction and at most once, as recorded in schema_migrations.
+// Every file has to be valid for both PostgreSQL and sqlite.
+func migrate(db *sqlx.DB) error {
+	_, err := loadSQL(db, "create_schema_migrations.sql")
+	if err != nil {
+		return fmt.Errorf("on loadSQL(create_schema_migrations): %w", err)
+	}
+
+	pending, err := pendingMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	for _, version := range pending {
+		err := applyMigration(db, version)
+		if err != nil {
+			return err
+		}
+		log.Info("applied migration `%s`", version)
+	}
+
+	return nil
+}
+
+// The versions of the migrations not recorded in schema_migrations, in the order they apply
+func pendingMigrations(db *sqlx.DB) ([]string, error) {
+	versions, err := migrationVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	applied := []string{}
+	err = db.Select(&applied, `SELECT version FROM schema_migrations;`)
+	if err != nil {
+		return nil, fmt.Errorf("on Select(schema_migrations): %w", err)
+	}
+
+	return slices.DeleteFunc(versions, func(version string) bool { return slices.Contains(applied, version) }), nil
+}
+
+func applyMigration(db *sqlx.DB, version string) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return fmt.Errorf("on Beginx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if fn, ok := codeMigrations[version]; ok {
+		err = fn(tx)
+	} else {
+		var q []byte
+		q, err = readMigration(version)
+		if err != nil {
+			return fmt.Errorf("on readMigration(%s): %w", version, err)
+		}
+		_, err = tx.Exec(string(q))
+	}
+	if err != nil {
+		return fmt.Errorf("on migration `%s`: %w", version, err)
+	}
+
+	_, err = tx.Exec(tx.Rebind(`INSERT INTO schema_migrations (version, date_applied) VALUES (?, ?);`), version, time.Now())
+	if err != nil {
+		return fmt.Errorf("on recording migration `%s`: %w", version, err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/google/uuid"
+)
+
+func newTestSQLite(t *testing.T) *SQLiteStorage {
+	t.Helper()
+	common.Config.Storage.SQLitePath = filepath.Join(t.TempDir(), "chatter.db")
+	st := NewSQLiteStorage()
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+// Applies the migration of version again, as if the database was made by the chatter before it.
+// The migrations after it are left applied, not all of them can run twice.
+func remigrate(t *testing.T, st *SQLiteStorage, version string) {
+	t.Helper()
+	_, err := st.Exec(`DELETE FROM schema_migrations WHERE version = $1;`, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = migrate(st.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUserDisabledMigration(t *testing.T) {
+	st := newTestSQLite(t)
+
+	// As it was before the column existed
+	_, err := st.Exec(`ALTER TABLE users DROP COLUMN disabled;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := uuid.New()
+	_, err = st.Exec(`INSERT INTO users (id, username, password, date_created) VALUES ($1, 'nikos', '', $2);`, id, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remigrate(t, st, "0008_user_disabled")
+
+	disabled := true
+	err = st.Get(&disabled, `SELECT disabled FROM users WHERE id = $1;`, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if disabled {
+		t.Fatal("expected the existing users to be enabled")
+	}
+	_, err = st.Exec(`UPDATE users SET disabled = TRUE WHERE id = $1;`, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.Get(&disabled, `SELECT disabled FROM users WHERE id = $1;`, id)
+	if err != nil || !disabled {
+		t.Fatalf("expected the user to be disabled, got %t: %v", disabled, err)
+	}
+}
+
+func TestUserSessionVersionMigration(t *testing.T) {
+	st := newTestSQLite(t)
+
+	// As it was before the column existed
+	_, err := st.Exec(`ALTER TABLE users DROP COLUMN session_version;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := uuid.New()
+	_, err = st.Exec(`INSERT INTO users (id, username, password, date_created) VALUES ($1, 'nikos', '', $2);`, id, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remigrate(t, st, "0012_user_session_version")
+
+	version := int64(-1)
+	err = st.Get(&version, `SELECT session_version FROM users WHERE id = $1;`, id)
+	if err != nil || version != 0 {
+		t.Fatalf("expected the existing sessions to keep working at version 0, got %d: %v", version, err)
+	}
+}
+
+func TestHashPasswordsMigration(t *testing.T) {
+	st := newTestSQLite(t)
+
+	plain_id, hashed_id := uuid.New(), uuid.New()
+	hash, err := common.HashPassword("456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.Exec(`INSERT INTO users (id, username, password, date_created) VALUES ($1, 'nikos', '123', $2), ($3, 'maria', $4, $2);`, plain_id, time.Now(), hashed_id, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remigrate(t, st, "0009_hash_passwords")
+
+	stored := ""
+	err = st.Get(&stored, `SELECT password FROM users WHERE id = $1;`, plain_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !common.IsPasswordHash(stored) || !common.CheckPassword(stored, "123") {
+		t.Fatalf("expected the plain password to be replaced by its hash, got `%s`", stored)
+	}
+
+	err = st.Get(&stored, `SELECT password FROM users WHERE id = $1;`, hashed_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored != hash {
+		t.Fatalf("expected the hashed password to be left alone, got `%s`", stored)
+	}
+}
+
+func TestParseMentionsMigration(t *testing.T) {
+	st := newTestSQLite(t)
+
+	maria_id, bob_id, bobby_id := uuid.New(), uuid.New(), uuid.New()
+	server_id, tab_id := uuid.New(), uuid.New()
+	_, err := st.Exec(`INSERT INTO users (id, username, password, date_created) VALUES ($1, 'maria', '', $4), ($2, 'bob', '', $4), ($3, 'bobby', '', $4);`, maria_id, bob_id, bobby_id, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.Exec(`INSERT INTO servers (id, "name", date_created) VALUES ($1, 'Gamiades', $2);`, server_id, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// bobby isn't a member, so @bobby isn't kept
+	_, err = st.Exec(`INSERT INTO server_members (server_id, user_id) VALUES ($1, $2), ($1, $3);`, server_id, maria_id, bob_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.Exec(`INSERT INTO tabs (id, "name", server_id, date_created) VALUES ($1, 'General', $2, $3);`, tab_id, server_id, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.Exec(`INSERT INTO messages (id, "text", sender_id, tab_id, date_sent) VALUES (1, 'hey @Bob', $1, $2, $3), (2, '@bobby', $1, $2, $3), (3, 'hello', $1, $2, $3);`, maria_id, tab_id, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remigrate(t, st, "0011_parse_mentions")
+
+	mentions := []struct {
+		MessageId int64  `db:"message_id"`
+		UserId    string `db:"user_id"`
+	}{}
+	err = st.Select(&mentions, `SELECT message_id, user_id FROM message_mentions;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mentions) != 1 || mentions[0].MessageId != 1 || mentions[0].UserId != bob_id.String() {
+		t.Fatalf("expected only message 1 to mention bob, got %#v", mentions)
+	}
+}
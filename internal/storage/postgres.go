@@ -1,13 +1,18 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/NikosGour/chatter/internal/common"
-	"github.com/NikosGour/chatter/internal/projectpath"
 	"github.com/NikosGour/logging/log"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+)
+
+const (
+	pqUniqueViolation     = "23505"
+	pqForeignKeyViolation = "23503"
 )
 
 type PostgreSQLStorage struct {
@@ -21,19 +26,12 @@ func NewPostgreSQLStorage() *PostgreSQLStorage {
 }
 
 func (st *PostgreSQLStorage) init_database() {
-	var (
-		host   = common.Dotenv[common.EnvPOSTGRES_HOST_ADDRESS]
-		port   = common.Dotenv[common.EnvPOSTGRES_PORT]
-		user   = common.Dotenv[common.EnvPOSTGRES_USER]
-		dbpass = common.Dotenv[common.EnvPOSTGRES_ROOT_PASSWORD]
-		dbname = common.Dotenv[common.EnvPOSTGRES_DB]
-	)
-
-	conn_string := fmt.Sprintf("host=%s port=%s user=%s "+
-		"password=%s dbname=%s sslmode=disable", host, port, user, dbpass, dbname)
+	cfg := common.Config.Storage.Postgres
+	conn_string := fmt.Sprintf("host=%s port=%d user=%s "+
+		"password=%s dbname=%s sslmode=disable", cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Database)
 
 	var err error
-	st.DB, err = sqlx.Connect("postgres", conn_string)
+	st.DB, err = connect("postgres", conn_string)
 	if err != nil {
 		log.Fatal("%s", err)
 	}
@@ -45,36 +43,55 @@ func (st *PostgreSQLStorage) init_database() {
 }
 
 func (st *PostgreSQLStorage) CreateTables() error {
-	_, err := sqlx.LoadFile(st, projectpath.RootFile("db/create_servers.sql"))
+	_, err := loadSQL(st, "create_servers.sql")
 	if err != nil {
-		return fmt.Errorf("on LoadFile(create_servers): %w", err)
+		return fmt.Errorf("on loadSQL(create_servers): %w", err)
 	}
-	_, err = sqlx.LoadFile(st, projectpath.RootFile("db/create_users.sql"))
+	_, err = loadSQL(st, "create_users.sql")
 	if err != nil {
-		return fmt.Errorf("on LoadFile(create_users): %w", err)
+		return fmt.Errorf("on loadSQL(create_users): %w", err)
 	}
-	_, err = sqlx.LoadFile(st, projectpath.RootFile("db/create_server_members.sql"))
+	_, err = loadSQL(st, "create_server_members.sql")
 	if err != nil {
-		return fmt.Errorf("on LoadFile(create_server_members): %w", err)
+		return fmt.Errorf("on loadSQL(create_server_members): %w", err)
 	}
-	_, err = sqlx.LoadFile(st, projectpath.RootFile("db/create_tabs.sql"))
+	_, err = loadSQL(st, "create_tabs.sql")
 	if err != nil {
-		return fmt.Errorf("on LoadFile(create_tabs): %w", err)
+		return fmt.Errorf("on loadSQL(create_tabs): %w", err)
 	}
-	_, err = sqlx.LoadFile(st, projectpath.RootFile("db/create_messages.sql"))
+	_, err = loadSQL(st, "create_messages.sql")
 	if err != nil {
-		return fmt.Errorf("on LoadFile(create_messages): %w", err)
+		return fmt.Errorf("on loadSQL(create_messages): %w", err)
 	}
 
-	return nil
+	return migrate(st.DB)
 }
 
 func (st *PostgreSQLStorage) DropTables() error {
-	_, err := sqlx.LoadFile(st, projectpath.RootFile("db/drop_all.sql"))
+	_, err := loadSQL(st, "drop_all.sql")
 	if err != nil {
-		return fmt.Errorf("on LoadFile(drop_all): %w", err)
+		return fmt.Errorf("on loadSQL(drop_all): %w", err)
 	}
 
 	return nil
 
 }
+
+// Runs fn inside a single transaction.
+//
+// Commits if fn returns nil, otherwise rolls back and returns the error of fn.
+func (st *PostgreSQLStorage) Transact(fn func(tx *SQLTx) error) error {
+	return transact(st, st.DB, fn)
+}
+
+// Reports whether err was caused by a UNIQUE or PRIMARY KEY constraint
+func (st *PostgreSQLStorage) IsUniqueViolation(err error) bool {
+	var pq_err *pq.Error
+	return errors.As(err, &pq_err) && pq_err.Code == pqUniqueViolation
+}
+
+// Reports whether err was caused by a REFERENCES constraint
+func (st *PostgreSQLStorage) IsForeignKeyViolation(err error) bool {
+	var pq_err *pq.Error
+	return errors.As(err, &pq_err) && pq_err.Code == pqForeignKeyViolation
+}
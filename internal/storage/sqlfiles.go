@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/NikosGour/chatter/db"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	migrationsDir = "migrations"
+)
+
+// Runs the statements of an embedded SQL file, named relative to the db directory.
+func loadSQL(e sqlx.Execer, name string) (sql.Result, error) {
+	q, err := fs.ReadFile(db.FS, name)
+	if err != nil {
+		return nil, fmt.Errorf("on ReadFile(%s): %w", name, err)
+	}
+
+	return e.Exec(string(q))
+}
+
+// The embedded migration file of version
+func readMigration(version string) ([]byte, error) {
+	return fs.ReadFile(db.FS, path.Join(migrationsDir, version+".sql"))
+}
+
+// Every migration file name without its extension and every code migration, in the order they apply
+func migrationVersions() ([]string, error) {
+	entries, err := fs.ReadDir(db.FS, migrationsDir)
+	if err != nil {
+		return nil, fmt.Errorf("on ReadDir(%s): %w", migrationsDir, err)
+	}
+
+	versions := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+		versions = append(versions, strings.TrimSuffix(entry.Name(), ".sql"))
+	}
+	for version := range codeMigrations {
+		versions = append(versions, version)
+	}
+	slices.Sort(versions)
+
+	return versions, nil
+}
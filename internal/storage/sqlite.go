@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/logging/log"
+	"github.com/jmoiron/sqlx"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Single file backend, lets chatter run without a database server.
+type SQLiteStorage struct {
+	*sqlx.DB
+}
+
+func NewSQLiteStorage() *SQLiteStorage {
+	st := &SQLiteStorage{}
+	st.init_database()
+	return st
+}
+
+func (st *SQLiteStorage) init_database() {
+	path := common.Config.Storage.SQLitePath
+
+	// Foreign keys are off by default in sqlite and have to be enabled per connection
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_time_format", "sqlite")
+	conn_string := fmt.Sprintf("file:%s?%s", path, params.Encode())
+
+	var err error
+	st.DB, err = connect("sqlite", conn_string)
+	if err != nil {
+		log.Fatal("%s", err)
+	}
+
+	err = st.CreateTables()
+	if err != nil {
+		log.Fatal("%s", err)
+	}
+}
+
+// Runs the same migrations as PostgreSQLStorage.CreateTables,
+// only the messages table needs a sqlite specific autoincrement key.
+func (st *SQLiteStorage) CreateTables() error {
+	_, err := loadSQL(st, "create_servers.sql")
+	if err != nil {
+		return fmt.Errorf("on loadSQL(create_servers): %w", err)
+	}
+	_, err = loadSQL(st, "create_users.sql")
+	if err != nil {
+		return fmt.Errorf("on loadSQL(create_users): %w", err)
+	}
+	_, err = loadSQL(st, "create_server_members.sql")
+	if err != nil {
+		return fmt.Errorf("on loadSQL(create_server_members): %w", err)
+	}
+	_, err = loadSQL(st, "create_tabs.sql")
+	if err != nil {
+		return fmt.Errorf("on loadSQL(create_tabs): %w", err)
+	}
+	_, err = loadSQL(st, "sqlite/create_messages.sql")
+	if err != nil {
+		return fmt.Errorf("on loadSQL(create_messages): %w", err)
+	}
+
+	return migrate(st.DB)
+}
+
+func (st *SQLiteStorage) DropTables() error {
+	_, err := loadSQL(st, "drop_all.sql")
+	if err != nil {
+		return fmt.Errorf("on loadSQL(drop_all): %w", err)
+	}
+
+	return nil
+}
+
+// Runs fn inside a single transaction.
+//
+// Commits if fn returns nil, otherwise rolls back and returns the error of fn.
+func (st *SQLiteStorage) Transact(fn func(tx *SQLTx) error) error {
+	return transact(st, st.DB, fn)
+}
+
+// Reports whether err was caused by a UNIQUE or PRIMARY KEY constraint
+func (st *SQLiteStorage) IsUniqueViolation(err error) bool {
+	var sqlite_err *sqlite.Error
+	if !errors.As(err, &sqlite_err) {
+		return false
+	}
+	code := sqlite_err.Code()
+	return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+
+// Reports whether err was caused by a REFERENCES constraint
+func (st *SQLiteStorage) IsForeignKeyViolation(err error) bool {
+	var sqlite_err *sqlite.Error
+	return errors.As(err, &sqlite_err) && sqlite_err.Code() == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY
+}
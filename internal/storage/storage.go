@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/logging/log"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrUniqueViolation     = common.NewAPIError(http.StatusConflict, "conflict", "unique constraint violation")
+	ErrForeignKeyViolation = common.NewAPIError(http.StatusUnprocessableEntity, "invalid_reference", "foreign key constraint violation")
+)
+
+const (
+	DriverPostgreSQL = "postgres"
+	DriverSQLite     = "sqlite"
+	DriverMemory     = "memory"
+)
+
+const (
+	// Wait after the first failed attempt to connect, doubled after every other one up to connectMaxBackoff
+	connectBackoff    = 500 * time.Millisecond
+	connectMaxBackoff = 15 * time.Second
+)
+
+// Storage is implemented by every backend the repositories can be built on.
+type Storage interface {
+	Ping() error
+	Close() error
+}
+
+// SQLQuerier is what the sql repositories run their queries on,
+// either a SQLStorage or one of its transactions.
+type SQLQuerier interface {
+	Select(dest any, query string, args ...any) error
+	Get(dest any, query string, args ...any) error
+	Exec(query string, args ...any) (sql.Result, error)
+	NamedExec(query string, arg any) (sql.Result, error)
+	PrepareNamed(query string) (*sqlx.NamedStmt, error)
+
+	IsUniqueViolation(err error) bool
+	IsForeignKeyViolation(err error) bool
+}
+
+// SQLStorage is implemented by the database/sql backed storages.
+// The sql repositories run unchanged on any of them.
+type SQLStorage interface {
+	Storage
+	SQLQuerier
+	Transact(fn func(tx *SQLTx) error) error
+}
+
+// Connects to the database, retrying with a growing backoff while it isn't up yet,
+// like when it's started along with chatter.
+//
+// The pool is sized as configured. Gives up after storage.connect_timeout.
+func connect(driver string, conn_string string) (*sqlx.DB, error) {
+	cfg := common.Config.Storage
+	deadline := time.Now().Add(cfg.ConnectTimeout)
+
+	backoff := connectBackoff
+	for attempt := 1; ; attempt++ {
+		db, err := sqlx.Connect(driver, conn_string)
+		if err == nil {
+			db.SetMaxOpenConns(cfg.MaxOpenConns)
+			db.SetMaxIdleConns(cfg.MaxIdleConns)
+			db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+			return db, nil
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, fmt.Errorf("on connecting to %s, gave up after %d attempts: %w", driver, attempt, err)
+		}
+
+		wait := min(backoff, remaining)
+		log.Warn("on connecting to %s, attempt %d failed, retrying in %s: %s", driver, attempt, wait.Round(time.Millisecond), err)
+		time.Sleep(wait)
+		backoff = min(backoff*2, connectMaxBackoff)
+	}
+}
+
+// Opens the backend selected by storage.driver.
+func NewStorage() Storage {
+	driver := common.Config.Storage.Driver
+	switch driver {
+	case DriverPostgreSQL:
+		return NewPostgreSQLStorage()
+	case DriverSQLite:
+		return NewSQLiteStorage()
+	case DriverMemory:
+		return NewMemoryStorage()
+	}
+
+	log.Fatal("unknown storage driver `%s`", driver)
+	return nil
+}
+
+// The connection pool of the database/sql backed storages, nil for the others
+func Pool(st Storage) *sql.DB {
+	db := sqlDB(st)
+	if db == nil {
+		return nil
+	}
+	return db.DB
+}
+
+// The migrations in db/migrations the storage is missing, none for the storages without a schema.
+//
+// Might return any sql error
+func PendingMigrations(st Storage) ([]string, error) {
+	db := sqlDB(st)
+	if db == nil {
+		return nil, nil
+	}
+	return pendingMigrations(db)
+}
+
+func sqlDB(st Storage) *sqlx.DB {
+	switch st := st.(type) {
+	case *PostgreSQLStorage:
+		return st.DB
+	case *SQLiteStorage:
+		return st.DB
+	}
+	return nil
+}
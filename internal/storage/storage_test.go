@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/common"
+)
+
+var errRefused = errors.New("connection refused")
+
+// A database that refuses connections until the attempt numbered up, recording when each was made
+type flakyDriver struct {
+	mu       sync.Mutex
+	up       int
+	attempts []time.Time
+}
+
+func (d *flakyDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.attempts = append(d.attempts, time.Now())
+	if len(d.attempts) < d.up {
+		return nil, errRefused
+	}
+	return flakyConn{}, nil
+}
+
+type flakyConn struct{}
+
+func (flakyConn) Prepare(query string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (flakyConn) Close() error                              { return nil }
+func (flakyConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+func withConnectTimeout(t *testing.T, timeout time.Duration) {
+	t.Helper()
+	previous := common.Config.Storage.ConnectTimeout
+	common.Config.Storage.ConnectTimeout = timeout
+	t.Cleanup(func() { common.Config.Storage.ConnectTimeout = previous })
+}
+
+func TestConnectRetries(t *testing.T) {
+	withConnectTimeout(t, 10*time.Second)
+	d := &flakyDriver{up: 3}
+	sql.Register("flaky_up", d)
+
+	db, err := connect("flaky_up", "")
+	if err != nil {
+		t.Fatalf("expected the third attempt to connect, got %s", err)
+	}
+	db.Close()
+
+	if len(d.attempts) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(d.attempts))
+	}
+	// The backoff doubles after every failed attempt
+	for i, wait := range []time.Duration{connectBackoff, 2 * connectBackoff} {
+		if gap := d.attempts[i+1].Sub(d.attempts[i]); gap < wait || gap >= 2*wait {
+			t.Fatalf("expected attempt %d to wait %s, it waited %s", i+2, wait, gap)
+		}
+	}
+}
+
+func TestConnectGivesUp(t *testing.T) {
+	withConnectTimeout(t, 1200*time.Millisecond)
+	d := &flakyDriver{up: math.MaxInt}
+	sql.Register("flaky_down", d)
+
+	started := time.Now()
+	_, err := connect("flaky_down", "")
+	if !errors.Is(err, errRefused) || !strings.Contains(err.Error(), "gave up after 3 attempts") {
+		t.Fatalf("expected to give up after 3 attempts with the last error, got %v", err)
+	}
+	// The last wait is cut short to the deadline
+	if took := time.Since(started); took < 1200*time.Millisecond || took > 2*time.Second {
+		t.Fatalf("expected to give up at storage.connect_timeout, took %s", took)
+	}
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/NikosGour/logging/log"
+	"github.com/jmoiron/sqlx"
+)
+
+// Transaction of a SQLStorage, queries on it see the same constraint errors as the storage itself.
+type SQLTx struct {
+	*sqlx.Tx
+	st SQLStorage
+}
+
+func (tx *SQLTx) IsUniqueViolation(err error) bool {
+	return tx.st.IsUniqueViolation(err)
+}
+
+func (tx *SQLTx) IsForeignKeyViolation(err error) bool {
+	return tx.st.IsForeignKeyViolation(err)
+}
+
+// Runs fn inside a single transaction on db.
+//
+// Commits if fn returns nil, otherwise rolls back and returns the error of fn.
+func transact(st SQLStorage, db *sqlx.DB, fn func(tx *SQLTx) error) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return fmt.Errorf("on Beginx: %w", err)
+	}
+
+	err = fn(&SQLTx{Tx: tx, st: st})
+	if err != nil {
+		rollback_err := tx.Rollback()
+		if rollback_err != nil {
+			log.Error("on Rollback: %s", rollback_err)
+		}
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("on Commit: %w", err)
+	}
+
+	return nil
+}
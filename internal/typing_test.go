@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/services"
+	"github.com/fasthttp/websocket"
+	"github.com/google/uuid"
+)
+
+// Waits for the ops sent so far to be handled, an unknown op is only answered after them.
+//
+// Fails if a typing event arrives meanwhile.
+func syncOps(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+	sendOp(t, conn, "sync", nil)
+	expectNoTypingUntil(t, conn, models.EventError)
+}
+
+// Reads events until one of the type arrives, failing on any typing event before it
+func expectNoTypingUntil(t *testing.T, conn *websocket.Conn, event_type string) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	defer conn.SetReadDeadline(time.Time{})
+	for {
+		event := models.Event{}
+		err := conn.ReadJSON(&event)
+		if err != nil {
+			t.Fatalf("waiting for a %s event: %s", event_type, err)
+		}
+		if event.Type == models.EventTyping {
+			t.Fatalf("expected no typing event before %s, got %#v", event_type, event.Data)
+		}
+		if event.Type == event_type {
+			return
+		}
+	}
+}
+
+// Reads the next typing event and checks it's the user's in the tab
+func expectTyping(t *testing.T, conn *websocket.Conn, user_id uuid.UUID, tab_id uuid.UUID) models.Typing {
+	t.Helper()
+	typing := models.Typing{}
+	err := json.Unmarshal(readEvent(t, conn, models.EventTyping), &typing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typing.UserId != user_id || typing.TabId != tab_id {
+		t.Fatalf("expected %s to be typing in %s, got %#v", user_id, tab_id, typing)
+	}
+	return typing
+}
+
+func TestTyping(t *testing.T) {
+	s, app := newTestAPI(t)
+	base := listen(t, app)
+
+	nikos := newTestUser(t, s, "nikos")
+	maria := newTestUser(t, s, "maria")
+	kostas := newTestUser(t, s, "kostas")
+	_, tab_id := newTestServer(t, s, "Gamiades", nikos, maria, kostas)
+
+	nikos_conn := dialMessages(t, base, login(t, app, "nikos", "123"))
+	maria_conn := dialMessages(t, base, login(t, app, "maria", "123"))
+	kostas_conn := dialMessages(t, base, login(t, app, "kostas", "123"))
+
+	// Only the tab a client has open can be typed in
+	sendOp(t, nikos_conn, models.OpTypingStart, models.TabOp{TabId: tab_id})
+	res := common.ErrorResponse{}
+	err := json.Unmarshal(readEvent(t, nikos_conn, models.EventError), &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Code != services.ErrNotViewingTab.Code {
+		t.Fatalf("expected %s, got %#v", services.ErrNotViewingTab.Code, res)
+	}
+
+	sendOp(t, maria_conn, models.OpTabView, models.TabOp{TabId: tab_id})
+	syncOps(t, maria_conn)
+
+	sendOp(t, nikos_conn, models.OpTabView, models.TabOp{TabId: tab_id})
+	started := time.Now()
+	sendOp(t, nikos_conn, models.OpTypingStart, models.TabOp{TabId: tab_id})
+	typing := expectTyping(t, maria_conn, nikos, tab_id)
+	expires_in := typing.ExpiresAt.Sub(started)
+	if expires_in < services.TypingExpiry-time.Second || expires_in > services.TypingExpiry+time.Second {
+		t.Fatalf("expected the indicator to expire in %s, got %s", services.TypingExpiry, expires_in)
+	}
+
+	// Starting again within TypingThrottle pushes nothing, sending the message ends the throttle
+	sendOp(t, nikos_conn, models.OpTypingStart, models.TabOp{TabId: tab_id})
+	sendOp(t, nikos_conn, models.OpMessageCreate, models.Message{Text: "kalhspera", Tab: &models.Tab{Id: tab_id}})
+	expectNoTypingUntil(t, maria_conn, models.EventMessageCreate)
+	expectNoTypingUntil(t, nikos_conn, models.EventMessageCreate)
+
+	sendOp(t, nikos_conn, models.OpTypingStart, models.TabOp{TabId: tab_id})
+	expectTyping(t, maria_conn, nikos, tab_id)
+
+	// Neither the typing user nor members without the tab open see it
+	syncOps(t, nikos_conn)
+	syncOps(t, kostas_conn)
+}
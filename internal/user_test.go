@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/encryptcookie"
+)
+
+func TestPasswordsAreHashedAndNeverSent(t *testing.T) {
+	s, app := newTestAPI(t)
+
+	resp, body := request(t, app, fiber.MethodPost, "/user", map[string]string{"username": "nikos", "password": "hunter2"}, "")
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected the user to be created, got %d: %s", resp.StatusCode, body)
+	}
+
+	users, err := s.user_service.GetByUsername("nikos")
+	if err != nil || len(users) != 1 {
+		t.Fatalf("expected the created user, got %v, %s", users, err)
+	}
+	if !common.IsPasswordHash(users[0].Password) {
+		t.Fatalf("expected the password to be stored hashed, got `%s`", users[0].Password)
+	}
+
+	for _, path := range []string{"/user", "/user/" + users[0].Id.String()} {
+		_, body := request(t, app, fiber.MethodGet, path, nil, "")
+		if bytes.Contains(body, []byte("password")) || bytes.Contains(body, []byte(users[0].Password)) {
+			t.Fatalf("expected GET %s to leave the password out, got: %s", path, body)
+		}
+	}
+
+	login(t, app, "nikos", "hunter2")
+	resp, _ = request(t, app, fiber.MethodPost, "/user/login", map[string]string{"username": "nikos", "password": users[0].Password}, "")
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Fatalf("expected logging in with the hash to fail, got %d", resp.StatusCode)
+	}
+
+	session := login(t, app, "nikos", "hunter2")
+	resp, body = request(t, app, fiber.MethodPatch, "/user/"+users[0].Id.String(), map[string]string{"password": "correct horse"}, session)
+	if resp.StatusCode != fiber.StatusOK || bytes.Contains(body, []byte("password")) {
+		t.Fatalf("expected the password to change without being sent back, got %d: %s", resp.StatusCode, body)
+	}
+	login(t, app, "nikos", "correct horse")
+	resp, _ = request(t, app, fiber.MethodPost, "/user/login", map[string]string{"username": "nikos", "password": "hunter2"}, "")
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Fatalf("expected the old password to stop working, got %d", resp.StatusCode)
+	}
+}
+
+// Sessions end with a password change, a logout, a deletion or http.session_max_age, whichever comes first
+func TestSessionsEnd(t *testing.T) {
+	s, app := newTestAPI(t)
+
+	nikos := newTestUser(t, s, "nikos")
+	expectSession := func(session string, status int) {
+		t.Helper()
+		resp, body := request(t, app, fiber.MethodGet, "/user/me/profile", nil, session)
+		if resp.StatusCode != status {
+			t.Fatalf("expected %d, got %d: %s", status, resp.StatusCode, body)
+		}
+	}
+
+	// The session that changed the password goes on with the cookie it gets back, the others end
+	phone := login(t, app, "nikos", "123")
+	laptop := login(t, app, "nikos", "123")
+	resp, body := request(t, app, fiber.MethodPatch, "/user/"+nikos.String(), map[string]string{"password": "456"}, laptop)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected the password to change, got %d: %s", resp.StatusCode, body)
+	}
+	renewed := ""
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == common.CookieMessangerId {
+			renewed = cookie.Value
+		}
+	}
+	expectSession(phone, fiber.StatusUnauthorized)
+	expectSession(laptop, fiber.StatusUnauthorized)
+	expectSession(renewed, fiber.StatusOK)
+
+	// Other changes keep the sessions
+	resp, body = request(t, app, fiber.MethodPatch, "/user/"+nikos.String(), map[string]any{"hide_read_receipts": true}, renewed)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected the user to be updated, got %d: %s", resp.StatusCode, body)
+	}
+	expectSession(renewed, fiber.StatusOK)
+
+	// A copy of the cookie doesn't outlive the logout
+	resp, body = request(t, app, fiber.MethodPost, "/user/logout", nil, renewed)
+	if resp.StatusCode != fiber.StatusNoContent {
+		t.Fatalf("expected to log out, got %d: %s", resp.StatusCode, body)
+	}
+	expectSession(renewed, fiber.StatusUnauthorized)
+
+	// Nor the user, when someone takes the username again
+	session := login(t, app, "nikos", "456")
+	resp, body = request(t, app, fiber.MethodDelete, "/user/"+nikos.String(), nil, session)
+	if resp.StatusCode != fiber.StatusNoContent {
+		t.Fatalf("expected the user to be deleted, got %d: %s", resp.StatusCode, body)
+	}
+	newTestUser(t, s, "nikos")
+	expectSession(session, fiber.StatusUnauthorized)
+	session = login(t, app, "nikos", "123")
+	expectSession(session, fiber.StatusOK)
+
+	// Sessions last http.session_max_age
+	users, err := s.user_service.GetByUsername("nikos")
+	if err != nil || len(users) != 1 {
+		t.Fatalf("expected the new nikos, got %v: %v", users, err)
+	}
+	issued_at := time.Now().Add(-common.Config.HTTP.SessionMaxAge - time.Minute)
+	expired, err := encryptcookie.EncryptCookie(fmt.Sprintf("%s:%d:%d", users[0].Id, users[0].SessionVersion, issued_at.Unix()), common.CookieKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectSession(expired, fiber.StatusUnauthorized)
+
+	resp, _ = request(t, app, fiber.MethodPost, "/user/login", map[string]string{"username": "nikos", "password": "123"}, "")
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == common.CookieMessangerId && time.Until(cookie.Expires) < common.Config.HTTP.SessionMaxAge-time.Minute {
+			t.Fatalf("expected the cookie to last http.session_max_age, it expires at %s", cookie.Expires)
+		}
+	}
+}
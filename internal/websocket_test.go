@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NikosGour/chatter/internal/common"
+	"github.com/NikosGour/chatter/internal/models"
+	"github.com/NikosGour/chatter/internal/services"
+	"github.com/google/uuid"
+)
+
+func TestWebsocketMessageSender(t *testing.T) {
+	s, app := newTestAPI(t)
+	base := listen(t, app)
+
+	nikos := newTestUser(t, s, "nikos")
+	maria := newTestUser(t, s, "maria")
+	eve := newTestUser(t, s, "eve")
+	_, tab_id := newTestServer(t, s, "Gamiades", nikos, maria)
+	_, other_tab_id := newTestServer(t, s, "Other", eve)
+
+	conn := dialMessages(t, base, login(t, app, "nikos", "123"))
+
+	// The sender of the payload is ignored, the message is sent as the connection's user
+	sendOp(t, conn, models.OpMessageCreate, models.Message{Text: "kalhspera", Sender: &models.User{Id: maria}, Tab: &models.Tab{Id: tab_id}})
+	msg := models.Message{}
+	err := json.Unmarshal(readEvent(t, conn, models.EventMessageCreate), &msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Sender == nil || msg.Sender.Id != nikos || msg.Text != "kalhspera" {
+		t.Fatalf("expected the message to be sent by nikos, got %#v", msg)
+	}
+
+	// Only members can send to a tab
+	sendOp(t, conn, models.OpMessageCreate, models.Message{Text: "hello", Tab: &models.Tab{Id: other_tab_id}})
+	res := common.ErrorResponse{}
+	err = json.Unmarshal(readEvent(t, conn, models.EventError), &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Code != models.ErrNotServerMember.Code {
+		t.Fatalf("expected %s, got %#v", models.ErrNotServerMember.Code, res)
+	}
+
+	messages, err := s.message_service.GetByTabID(other_tab_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 0 {
+		t.Fatalf("expected no messages in a tab nikos isn't a member of, got %#v", messages)
+	}
+}
+
+// A client that stops reading is disconnected once its queue fills, without holding up anyone else
+func TestWebsocketSlowClient(t *testing.T) {
+	s, app := newTestAPI(t)
+	base := listen(t, app)
+
+	nikos := newTestUser(t, s, "nikos")
+	maria := newTestUser(t, s, "maria")
+	newTestServer(t, s, "Gamiades", nikos, maria)
+
+	dialMessages(t, base, login(t, app, "maria", "123"))
+
+	event := models.NewEvent(models.EventMessageCreate, strings.Repeat("a", 64<<10))
+	start := time.Now()
+	for range 1000 {
+		s.conn_manager.Publish([]uuid.UUID{maria}, event)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected publishing to a client that doesn't read not to wait on it, took %s", elapsed)
+	}
+
+	// Connecting makes nikos' presence known to maria first, then to nikos
+	conn := dialMessages(t, base, login(t, app, "nikos", "123"))
+	readEvent(t, conn, models.EventPresenceUpdate)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := s.conn_manager.GetClients(maria)
+		if errors.Is(err, services.ErrConnectionNotFound) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the client that doesn't read to be disconnected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}